@@ -0,0 +1,110 @@
+/*
+ * Copyright IBM Corp. All Rights Reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+'use strict';
+
+const { Gateway, Wallets } = require('fabric-network');
+const path = require('path');
+const { buildCCPOrg1, buildCCPOrg2, buildWallet, prettyJSONString } = require('../../test-application/javascript/AppUtil.js');
+
+const myChannel = 'mychannel';
+const myChaincodeName = 'auction';
+
+async function amendBid (ccp, wallet, user, orgMSP, auctionID, bidID, quantity, price) {
+	try {
+		const gateway = new Gateway();
+
+		// connect using Discovery enabled
+		await gateway.connect(ccp,
+			{ wallet: wallet, identity: user, discovery: { enabled: true, asLocalhost: true } });
+
+		const network = await gateway.getNetwork(myChannel);
+		const contract = network.getContract(myChaincodeName);
+
+		console.log('\n--> Evaluate Transaction: get your client ID');
+		const buyer = await contract.evaluateTransaction('GetSubmittingClientIdentity');
+		console.log('*** Result:  Buyer ID is ' + buyer.toString());
+
+		const bidData = { objectType: 'bid', quantity: parseInt(quantity), price: parseInt(price), org: orgMSP, buyer: buyer.toString() };
+
+		const bidTxn = contract.createTransaction('Bid');
+		bidTxn.setEndorsingOrganizations(orgMSP);
+		bidTxn.setTransient({
+			bid: Buffer.from(JSON.stringify(bidData))
+		});
+
+		const newBidID = bidTxn.getTransactionId();
+
+		console.log('\n--> Submit Transaction: Create the new bid that is stored in your organization\'s private data collection');
+		await bidTxn.submit(auctionID);
+		console.log('*** Result: committed');
+		console.log('*** Result ***SAVE THIS VALUE*** BidID: ' + newBidID.toString());
+
+		console.log('\n--> Evaluate Transaction: query the auction you want to amend your bid for');
+		const auctionString = await contract.evaluateTransaction('QueryAuction', auctionID);
+		const auctionJSON = JSON.parse(auctionString);
+
+		const statefulTxn = contract.createTransaction('AmendBid');
+
+		if (auctionJSON.organizations.length === 2) {
+			statefulTxn.setEndorsingOrganizations(auctionJSON.organizations[0], auctionJSON.organizations[1]);
+		} else {
+			statefulTxn.setEndorsingOrganizations(auctionJSON.organizations[0]);
+		}
+
+		console.log('\n--> Submit Transaction: replace your bid in the auction with the new bid');
+		await statefulTxn.submit(auctionID, bidID, newBidID);
+		console.log('*** Result: committed');
+
+		console.log('\n--> Evaluate Transaction: query the auction to see that our bid was replaced');
+		const result = await contract.evaluateTransaction('QueryAuction', auctionID);
+		console.log('*** Result: Auction: ' + prettyJSONString(result.toString()));
+
+		gateway.disconnect();
+	} catch (error) {
+		console.error(`******** FAILED to amend bid: ${error}`);
+		process.exit(1);
+	}
+}
+
+async function main () {
+	try {
+		if (process.argv[2] === undefined || process.argv[3] === undefined ||
+            process.argv[4] === undefined || process.argv[5] === undefined ||
+            process.argv[6] === undefined || process.argv[7] === undefined) {
+			console.log('Usage: node amendBid.js org userID auctionID bidID quantity price');
+			process.exit(1);
+		}
+
+		const org = process.argv[2];
+		const user = process.argv[3];
+		const auctionID = process.argv[4];
+		const bidID = process.argv[5];
+		const quantity = process.argv[6];
+		const price = process.argv[7];
+
+		if (org === 'Org1' || org === 'org1') {
+			const ccp = buildCCPOrg1();
+			const walletPath = path.join(__dirname, 'wallet/org1');
+			const wallet = await buildWallet(Wallets, walletPath);
+			await amendBid(ccp, wallet, user, 'Org1MSP', auctionID, bidID, quantity, price);
+		} else if (org === 'Org2' || org === 'org2') {
+			const ccp = buildCCPOrg2();
+			const walletPath = path.join(__dirname, 'wallet/org2');
+			const wallet = await buildWallet(Wallets, walletPath);
+			await amendBid(ccp, wallet, user, 'Org2MSP', auctionID, bidID, quantity, price);
+		} else {
+			console.log('Usage: node amendBid.js org userID auctionID bidID quantity price');
+			console.log('Org must be Org1 or Org2');
+		}
+	} catch (error) {
+		console.error(`******** FAILED to run the application: ${error}`);
+		process.exit(1);
+	}
+}
+
+
+main();
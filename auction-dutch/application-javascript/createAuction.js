@@ -13,7 +13,7 @@ const { buildCCPOrg1, buildCCPOrg2, buildWallet, prettyJSONString } = require('.
 const myChannel = 'mychannel';
 const myChaincodeName = 'auction';
 
-async function createAuction (ccp, wallet, user, auctionID, item, quantity, auditor) {
+async function createAuction (ccp, wallet, user, auctionID, item, quantity, auditor, biddingDeadline, revealDeadline, tokenChaincode) {
 	try {
 		const gateway = new Gateway();
 		// connect using Discovery enabled
@@ -27,7 +27,7 @@ async function createAuction (ccp, wallet, user, auctionID, item, quantity, audi
 		const statefulTxn = contract.createTransaction('CreateAuction');
 
 		console.log('\n--> Submit Transaction: Propose a new auction');
-		await statefulTxn.submit(auctionID, item, parseInt(quantity), auditor);
+		await statefulTxn.submit(auctionID, item, parseInt(quantity), auditor, biddingDeadline, revealDeadline, tokenChaincode);
 		console.log('*** Result: committed');
 
 		console.log('\n--> Evaluate Transaction: query the auction that was just created');
@@ -45,7 +45,7 @@ async function main () {
 		if (process.argv[2] === undefined || process.argv[3] === undefined ||
             process.argv[4] === undefined || process.argv[5] === undefined ||
             process.argv[6] === undefined) {
-			console.log('Usage: node createAuction.js org userID auctionID item quantity');
+			console.log('Usage: node createAuction.js org userID auctionID item quantity auditor [biddingDeadline revealDeadline] [tokenChaincode]');
 			process.exit(1);
 		}
 
@@ -55,19 +55,22 @@ async function main () {
 		const item = process.argv[5];
 		const quantity = process.argv[6];
 		const auditor = process.argv[7];
+		const biddingDeadline = process.argv[8] || '';
+		const revealDeadline = process.argv[9] || '';
+		const tokenChaincode = process.argv[10] || '';
 
 		if (org === 'Org1' || org === 'org1') {
 			const ccp = buildCCPOrg1();
 			const walletPath = path.join(__dirname, 'wallet/org1');
 			const wallet = await buildWallet(Wallets, walletPath);
-			await createAuction(ccp, wallet, user, auctionID, item, quantity, auditor);
+			await createAuction(ccp, wallet, user, auctionID, item, quantity, auditor, biddingDeadline, revealDeadline, tokenChaincode);
 		} else if (org === 'Org2' || org === 'org2') {
 			const ccp = buildCCPOrg2();
 			const walletPath = path.join(__dirname, 'wallet/org2');
 			const wallet = await buildWallet(Wallets, walletPath);
-			await createAuction(ccp, wallet, user, auctionID, item, quantity, auditor);
+			await createAuction(ccp, wallet, user, auctionID, item, quantity, auditor, biddingDeadline, revealDeadline, tokenChaincode);
 		} else {
-			console.log('Usage: node createAuction.js org userID auctionID item quantity');
+			console.log('Usage: node createAuction.js org userID auctionID item quantity auditor [biddingDeadline revealDeadline] [tokenChaincode]');
 			console.log('Org must be Org1 or Org2');
 		}
 	} catch (error) {
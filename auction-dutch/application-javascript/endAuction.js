@@ -32,7 +32,11 @@ async function endAuction (ccp, wallet, user, auctionID) {
 
 		const statefulTxn = contract.createTransaction('EndAuction');
 
-		if (auctionJSON.organizations.length === 2) {
+		if (auctionJSON.tokenChaincode !== '') {
+			// the transfer of tokens also needs to meet the endorsement policy of the
+			// token chaincode, which requires both organizations
+			statefulTxn.setEndorsingOrganizations('Org1MSP', 'Org2MSP');
+		} else if (auctionJSON.organizations.length === 2) {
 			statefulTxn.setEndorsingOrganizations(auctionJSON.organizations[0], auctionJSON.organizations[1]);
 		} else {
 			statefulTxn.setEndorsingOrganizations(auctionJSON.organizations[0]);
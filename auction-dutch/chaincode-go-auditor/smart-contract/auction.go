@@ -20,17 +20,19 @@ type SmartContract struct {
 
 // Auction data
 type Auction struct {
-	Type         string             `json:"objectType"`
-	ItemSold     string             `json:"item"`
-	Seller       string             `json:"seller"`
-	Quantity     int                `json:"quantity"`
-	Orgs         []string           `json:"organizations"`
-	PrivateBids  map[string]BidHash `json:"privateBids"`
-	RevealedBids map[string]FullBid `json:"revealedBids"`
-	Winners      []Winners          `json:"winners"`
-	Price        int                `json:"price"`
-	Status       string             `json:"status"`
-	Auditor      bool               `json:"auditor"`
+	Type            string             `json:"objectType"`
+	ItemSold        string             `json:"item"`
+	Seller          string             `json:"seller"`
+	Quantity        int                `json:"quantity"`
+	Orgs            []string           `json:"organizations"`
+	BiddingDeadline string             `json:"biddingDeadline"`
+	RevealDeadline  string             `json:"revealDeadline"`
+	PrivateBids     map[string]BidHash `json:"privateBids"`
+	RevealedBids    map[string]FullBid `json:"revealedBids"`
+	Winners         []Winners          `json:"winners"`
+	Price           int                `json:"price"`
+	Status          string             `json:"status"`
+	Auditor         bool               `json:"auditor"`
 }
 
 // FullBid is the structure of a revealed bid
@@ -79,6 +81,16 @@ func (s *SmartContract) SubmitBid(ctx contractapi.TransactionContextInterface, a
 		return fmt.Errorf("cannot join closed or ended auction")
 	}
 
+	// bids cannot be added after the bidding deadline, even if the auction
+	// has not been closed yet
+	passed, err := deadlinePassed(ctx, auction.BiddingDeadline)
+	if err != nil {
+		return err
+	}
+	if passed {
+		return fmt.Errorf("cannot join auction after the bidding deadline %v", auction.BiddingDeadline)
+	}
+
 	// get the inplicit collection name of bidder's org
 	collection, err := getCollectionName(ctx)
 	if err != nil {
@@ -195,6 +207,14 @@ func (s *SmartContract) RevealBid(ctx contractapi.TransactionContextInterface, a
 		return fmt.Errorf("cannot reveal bid for open or ended auction")
 	}
 
+	passed, err := deadlinePassed(ctx, auction.RevealDeadline)
+	if err != nil {
+		return err
+	}
+	if passed {
+		return fmt.Errorf("cannot reveal bid after the reveal deadline %v", auction.RevealDeadline)
+	}
+
 	// check 2: check that hash of revealed bid matches hash of private bid
 	// on the public ledger. This checks that the bidder is telling the truth
 	// about the value of their bid
@@ -280,7 +300,8 @@ func (s *SmartContract) RevealBid(ctx contractapi.TransactionContextInterface, a
 }
 
 // CloseAuction can be used by the seller to close the auction. This prevents
-// bids from being added to the auction, and allows users to reveal their bid
+// bids from being added to the auction, and allows users to reveal their bid.
+// After the bidding deadline, the auction can be closed by anyone
 func (s *SmartContract) CloseAuction(ctx contractapi.TransactionContextInterface, auctionID string) error {
 
 	// get the MSP ID of the bidder's org
@@ -301,7 +322,7 @@ func (s *SmartContract) CloseAuction(ctx contractapi.TransactionContextInterface
 		return fmt.Errorf("Particiant is not a member of the auction", err)
 	}
 
-	// the auction can only be closed by the seller
+	// the auction can only be closed by the seller before the bidding deadline
 
 	// get ID of submitting client
 	clientID, err := s.GetSubmittingClientIdentity(ctx)
@@ -309,9 +330,14 @@ func (s *SmartContract) CloseAuction(ctx contractapi.TransactionContextInterface
 		return fmt.Errorf("failed to get client identity %v", err)
 	}
 
+	passed, err := deadlinePassed(ctx, auction.BiddingDeadline)
+	if err != nil {
+		return err
+	}
+
 	seller := auction.Seller
-	if seller != clientID {
-		return fmt.Errorf("auction can only be closed by seller: %v", err)
+	if seller != clientID && !passed {
+		return fmt.Errorf("auction can only be closed by seller before the bidding deadline")
 	}
 
 	status := auction.Status
@@ -332,7 +358,8 @@ func (s *SmartContract) CloseAuction(ctx contractapi.TransactionContextInterface
 }
 
 // EndAuction both changes the auction status to closed and calculates the winners
-// of the auction
+// of the auction. After the reveal deadline, the auction can be ended by anyone,
+// and bids that have not been revealed are ignored
 func (s *SmartContract) EndAuction(ctx contractapi.TransactionContextInterface, auctionID string) error {
 
 	// get the MSP ID of the bidder's org
@@ -353,7 +380,8 @@ func (s *SmartContract) EndAuction(ctx contractapi.TransactionContextInterface,
 		return fmt.Errorf("Particiant is not a member of the auction", err)
 	}
 
-	// Check that the auction is being ended by the seller
+	// Check that the auction is being ended by the seller, or that the
+	// reveal deadline has passed
 
 	// get ID of submitting client
 	clientID, err := s.GetSubmittingClientIdentity(ctx)
@@ -361,9 +389,14 @@ func (s *SmartContract) EndAuction(ctx contractapi.TransactionContextInterface,
 		return fmt.Errorf("failed to get client identity %v", err)
 	}
 
+	passed, err := deadlinePassed(ctx, auction.RevealDeadline)
+	if err != nil {
+		return err
+	}
+
 	seller := auction.Seller
-	if seller != clientID {
-		return fmt.Errorf("auction can only be ended by seller: %v", err)
+	if seller != clientID && !passed {
+		return fmt.Errorf("auction can only be ended by seller before the reveal deadline")
 	}
 
 	status := auction.Status
@@ -375,7 +408,20 @@ func (s *SmartContract) EndAuction(ctx contractapi.TransactionContextInterface,
 
 	revealedBidMap := auction.RevealedBids
 	if len(auction.RevealedBids) == 0 {
-		return fmt.Errorf("No bids have been revealed, cannot end auction: %v", err)
+		if !passed {
+			return fmt.Errorf("No bids have been revealed, cannot end auction")
+		}
+
+		// nothing is sold if no bids have been revealed by the reveal deadline
+		auction.Status = string("unsold")
+
+		unsoldAuctionJSON, _ := json.Marshal(auction)
+
+		err = ctx.GetStub().PutState(auctionID, unsoldAuctionJSON)
+		if err != nil {
+			return fmt.Errorf("failed to end auction: %v", err)
+		}
+		return nil
 	}
 
 	// sort the map of revealed bids to make it easier to calculate winners
@@ -428,10 +474,13 @@ func (s *SmartContract) EndAuction(ctx contractapi.TransactionContextInterface,
 		}
 	}
 
-	// check if there is a winning bid that has yet to be revealed
-	err = checkForHigherBid(ctx, auction.Price, auction.RevealedBids, auction.PrivateBids)
-	if err != nil {
-		return fmt.Errorf("Cannot end auction: %v", err)
+	// check if there is a winning bid that has yet to be revealed. Bids that
+	// have not been revealed by the reveal deadline are ignored
+	if !passed {
+		err = checkForHigherBid(ctx, auction.Price, auction.RevealedBids, auction.PrivateBids)
+		if err != nil {
+			return fmt.Errorf("Cannot end auction: %v", err)
+		}
 	}
 
 	auction.Status = string("ended")
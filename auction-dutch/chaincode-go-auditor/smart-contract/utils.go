@@ -7,6 +7,7 @@ package auction
 import (
 	"encoding/base64"
 	"fmt"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric-chaincode-go/shim"
@@ -15,6 +16,10 @@ import (
 	"github.com/hyperledger/fabric-protos-go/msp"
 )
 
+// maxClockSkew is the largest difference that a peer accepts between the
+// transaction timestamp and its own clock
+const maxClockSkew = 30 * time.Second
+
 func (s *SmartContract) GetSubmittingClientIdentity(ctx contractapi.TransactionContextInterface) (string, error) {
 
 	b64ID, err := ctx.GetClientIdentity().GetID()
@@ -201,3 +206,45 @@ func setAssetStateBasedEndorsement(ctx contractapi.TransactionContextInterface,
 	}
 	return nil
 }
+
+// deadlinePassed is an internal function that checks if the transaction timestamp
+// is at or after a deadline. An empty deadline never passes
+func deadlinePassed(ctx contractapi.TransactionContextInterface, deadline string) (bool, error) {
+
+	if deadline == "" {
+		return false, nil
+	}
+
+	deadlineTime, err := time.Parse(time.RFC3339, deadline)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse deadline %v: %v", deadline, err)
+	}
+
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return !txTime.Before(deadlineTime), nil
+}
+
+// getTxTime is an internal function that returns the transaction timestamp. The
+// timestamp is set by the client in the transaction proposal and is not checked
+// by Fabric, so each endorsing peer rejects timestamps that are more than
+// maxClockSkew away from its own clock. Within that bound, all endorsing peers
+// use the same time
+func getTxTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	txTime := time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos))
+
+	skew := time.Since(txTime)
+	if skew > maxClockSkew || skew < -maxClockSkew {
+		return time.Time{}, fmt.Errorf("transaction timestamp %v is more than %v away from the time of the peer", txTime.UTC().Format(time.RFC3339Nano), maxClockSkew)
+	}
+
+	return txTime, nil
+}
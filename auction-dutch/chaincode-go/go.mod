@@ -7,4 +7,6 @@ require (
 	github.com/hyperledger/fabric-chaincode-go v0.0.0-20201119163726-f8ef75b17719
 	github.com/hyperledger/fabric-contract-api-go v1.1.1
 	github.com/hyperledger/fabric-protos-go v0.0.0-20210127161553-4f432a78f286
+	github.com/stretchr/testify v1.8.0
+	google.golang.org/protobuf v1.23.0
 )
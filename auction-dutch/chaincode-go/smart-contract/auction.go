@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"sort"
 
+	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
@@ -20,17 +21,22 @@ type SmartContract struct {
 
 // Auction data
 type Auction struct {
-	Type         string             `json:"objectType"`
-	ItemSold     string             `json:"item"`
-	Seller       string             `json:"seller"`
-	Quantity     int                `json:"quantity"`
-	Orgs         []string           `json:"organizations"`
-	PrivateBids  map[string]BidHash `json:"privateBids"`
-	RevealedBids map[string]FullBid `json:"revealedBids"`
-	Winners      []Winners          `json:"winners"`
-	Price        int                `json:"price"`
-	Status       string             `json:"status"`
-	Auditor      bool               `json:"auditor"`
+	Type            string             `json:"objectType"`
+	ItemSold        string             `json:"item"`
+	Seller          string             `json:"seller"`
+	Quantity        int                `json:"quantity"`
+	Orgs            []string           `json:"organizations"`
+	BiddingDeadline string             `json:"biddingDeadline"`
+	RevealDeadline  string             `json:"revealDeadline"`
+	TokenChaincode  string             `json:"tokenChaincode"`
+	PrivateBids     map[string]BidHash `json:"privateBids"`
+	RevealedBids    map[string]FullBid `json:"revealedBids"`
+	Winners         []Winners          `json:"winners"`
+	Price           int                `json:"price"`
+	Status          string             `json:"status"`
+	Auditor         bool               `json:"auditor"`
+	Clock           *Clock             `json:"clock,omitempty" metadata:"clock,optional"`
+	Disqualified    []string           `json:"disqualified,omitempty" metadata:"disqualified,optional"`
 }
 
 // FullBid is the structure of a revealed bid
@@ -52,13 +58,18 @@ type BidHash struct {
 type Winners struct {
 	Buyer    string `json:"buyer"`
 	Quantity int    `json:"quantity"`
+	Price    int    `json:"price,omitempty" metadata:"price,optional"`
 }
 
 const bidKeyType = "bid"
 
 // CreateAuction creates on auction on the public channel. The identity that
-// submits the transacion becomes the seller of the auction
-func (s *SmartContract) CreateAuction(ctx contractapi.TransactionContextInterface, auctionID string, itemsold string, quantity int, withAuditor string) error {
+// submits the transacion becomes the seller of the auction. The bidding and
+// reveal deadlines are RFC 3339 times, after which anyone can close or end the
+// auction. An empty deadline leaves closing or ending the auction to the seller.
+// If a token chaincode is given, the winners pay the seller with tokens of that
+// chaincode when the auction ends
+func (s *SmartContract) CreateAuction(ctx contractapi.TransactionContextInterface, auctionID string, itemsold string, quantity int, withAuditor string, biddingDeadline string, revealDeadline string, tokenChaincode string) error {
 
 	// get ID of submitting client
 	clientID, err := s.GetSubmittingClientIdentity(ctx)
@@ -72,28 +83,50 @@ func (s *SmartContract) CreateAuction(ctx contractapi.TransactionContextInterfac
 		return fmt.Errorf("failed to get client identity %v", err)
 	}
 
+	// check the deadlines against the transaction timestamp
+	biddingDeadline, err = parseDeadline(ctx, biddingDeadline)
+	if err != nil {
+		return fmt.Errorf("invalid bidding deadline: %v", err)
+	}
+	revealDeadline, err = parseDeadline(ctx, revealDeadline)
+	if err != nil {
+		return fmt.Errorf("invalid reveal deadline: %v", err)
+	}
+	if biddingDeadline != "" && revealDeadline != "" && revealDeadline <= biddingDeadline {
+		return fmt.Errorf("reveal deadline must be after the bidding deadline")
+	}
+
 	auditor := false
 
 	if withAuditor == "withAuditor" {
 		auditor = true
 	}
 
+	// the auditor version of the smart contract does not settle auctions, so
+	// an auditor could end the auction without paying the seller
+	if auditor && tokenChaincode != "" {
+		return fmt.Errorf("an auction that is settled with tokens cannot have an auditor")
+	}
+
 	// Create auction
 	bidders := make(map[string]BidHash)
 	revealedBids := make(map[string]FullBid)
 
 	auction := Auction{
-		Type:         "auction",
-		ItemSold:     itemsold,
-		Quantity:     quantity,
-		Price:        0,
-		Seller:       clientID,
-		Orgs:         []string{clientOrgID},
-		PrivateBids:  bidders,
-		RevealedBids: revealedBids,
-		Winners:      []Winners{},
-		Status:       "open",
-		Auditor:      auditor,
+		Type:            "auction",
+		ItemSold:        itemsold,
+		Quantity:        quantity,
+		Price:           0,
+		Seller:          clientID,
+		Orgs:            []string{clientOrgID},
+		BiddingDeadline: biddingDeadline,
+		RevealDeadline:  revealDeadline,
+		TokenChaincode:  tokenChaincode,
+		PrivateBids:     bidders,
+		RevealedBids:    revealedBids,
+		Winners:         []Winners{},
+		Status:          "open",
+		Auditor:         auditor,
 	}
 
 	auctionJSON, err := json.Marshal(auction)
@@ -180,12 +213,27 @@ func (s *SmartContract) SubmitBid(ctx contractapi.TransactionContextInterface, a
 		return fmt.Errorf("failed to get auction from public state %v", err)
 	}
 
+	// buyers in a clock auction accept the current price instead of bidding
+	if auction.Clock != nil {
+		return fmt.Errorf("cannot submit a sealed bid to a clock auction")
+	}
+
 	// the auction needs to be open for users to add their bid
 	status := auction.Status
 	if status != "open" {
 		return fmt.Errorf("cannot join closed or ended auction")
 	}
 
+	// bids cannot be added after the bidding deadline, even if the auction
+	// has not been closed yet
+	passed, err := deadlinePassed(ctx, auction.BiddingDeadline)
+	if err != nil {
+		return err
+	}
+	if passed {
+		return fmt.Errorf("cannot join auction after the bidding deadline %v", auction.BiddingDeadline)
+	}
+
 	// get the inplicit collection name of bidder's org
 	collection, err := getCollectionName(ctx)
 	if err != nil {
@@ -240,6 +288,136 @@ func (s *SmartContract) SubmitBid(ctx contractapi.TransactionContextInterface, a
 	return nil
 }
 
+// WithdrawBid is used by a bidder to remove their bid from an open auction. The
+// hash of the bid is removed from the auction and the bid is deleted from the
+// private data collection of the bidder's organization
+func (s *SmartContract) WithdrawBid(ctx contractapi.TransactionContextInterface, auctionID string, txID string) error {
+
+	// get the auction from public state
+	auction, err := s.QueryAuction(ctx, auctionID)
+	if err != nil {
+		return fmt.Errorf("failed to get auction from public state %v", err)
+	}
+
+	err = checkAuctionOpen(ctx, auction)
+	if err != nil {
+		return fmt.Errorf("cannot withdraw bid: %v", err)
+	}
+
+	bidKey, err := ctx.GetStub().CreateCompositeKey(bidKeyType, []string{auctionID, txID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	// only the bidder can withdraw their bid
+	err = s.verifyBidOwner(ctx, auction, bidKey)
+	if err != nil {
+		return err
+	}
+
+	collection, err := getCollectionName(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get implicit collection name: %v", err)
+	}
+
+	err = ctx.GetStub().DelPrivateData(collection, bidKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete bid from collection: %v", err)
+	}
+
+	// the bidder's organization remains an endorser of the auction
+	delete(auction.PrivateBids, bidKey)
+
+	newAuctionJSON, _ := json.Marshal(auction)
+
+	err = ctx.GetStub().PutState(auctionID, newAuctionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update auction: %v", err)
+	}
+
+	return nil
+}
+
+// AmendBid is used by a bidder to replace their bid in an open auction with a
+// new bid. The new bid needs to be created first using Bid. The hash of the new
+// bid replaces the hash of the old bid in the auction, and the old bid is deleted
+// from the private data collection of the bidder's organization
+func (s *SmartContract) AmendBid(ctx contractapi.TransactionContextInterface, auctionID string, txID string, newTxID string) error {
+
+	// get the auction from public state
+	auction, err := s.QueryAuction(ctx, auctionID)
+	if err != nil {
+		return fmt.Errorf("failed to get auction from public state %v", err)
+	}
+
+	err = checkAuctionOpen(ctx, auction)
+	if err != nil {
+		return fmt.Errorf("cannot amend bid: %v", err)
+	}
+
+	bidKey, err := ctx.GetStub().CreateCompositeKey(bidKeyType, []string{auctionID, txID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	// only the bidder can amend their bid
+	err = s.verifyBidOwner(ctx, auction, bidKey)
+	if err != nil {
+		return err
+	}
+
+	newBidKey, err := ctx.GetStub().CreateCompositeKey(bidKeyType, []string{auctionID, newTxID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	if _, bidInAuction := auction.PrivateBids[newBidKey]; bidInAuction {
+		return fmt.Errorf("bid %v has already been added to the auction", newBidKey)
+	}
+
+	collection, err := getCollectionName(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get implicit collection name: %v", err)
+	}
+
+	// get the hash of the new bid stored in private data collection
+	newBidHash, err := ctx.GetStub().GetPrivateDataHash(collection, newBidKey)
+	if err != nil {
+		return fmt.Errorf("failed to read bid bash from collection: %v", err)
+	}
+	if newBidHash == nil {
+		return fmt.Errorf("bid hash does not exist: %s", newBidKey)
+	}
+
+	// replace the hash of the old bid with the hash of the new bid
+	newHash := BidHash{
+		Org:  auction.PrivateBids[bidKey].Org,
+		Hash: fmt.Sprintf("%x", newBidHash),
+	}
+	delete(auction.PrivateBids, bidKey)
+	auction.PrivateBids[newBidKey] = newHash
+
+	// the new bid also needs to belong to the bidder
+	err = s.verifyBidOwner(ctx, auction, newBidKey)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().DelPrivateData(collection, bidKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete bid from collection: %v", err)
+	}
+
+	newAuctionJSON, _ := json.Marshal(auction)
+
+	err = ctx.GetStub().PutState(auctionID, newAuctionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update auction: %v", err)
+	}
+
+	return nil
+}
+
 // RevealBid is used by a bidder to reveal their bid after the auction is closed
 func (s *SmartContract) RevealBid(ctx contractapi.TransactionContextInterface, auctionID string, txID string) error {
 
@@ -290,6 +468,14 @@ func (s *SmartContract) RevealBid(ctx contractapi.TransactionContextInterface, a
 		return fmt.Errorf("cannot reveal bid for open or ended auction")
 	}
 
+	passed, err := deadlinePassed(ctx, auction.RevealDeadline)
+	if err != nil {
+		return err
+	}
+	if passed {
+		return fmt.Errorf("cannot reveal bid after the reveal deadline %v", auction.RevealDeadline)
+	}
+
 	// check 2: check that hash of revealed bid matches hash of private bid
 	// on the public ledger. This checks that the bidder is telling the truth
 	// about the value of their bid
@@ -375,7 +561,8 @@ func (s *SmartContract) RevealBid(ctx contractapi.TransactionContextInterface, a
 }
 
 // CloseAuction can be used by the seller to close the auction. This prevents
-// bids from being added to the auction, and allows users to reveal their bid
+// bids from being added to the auction, and allows users to reveal their bid.
+// After the bidding deadline, the auction can be closed by anyone
 func (s *SmartContract) CloseAuction(ctx contractapi.TransactionContextInterface, auctionID string) error {
 
 	// get auction from public state
@@ -384,7 +571,12 @@ func (s *SmartContract) CloseAuction(ctx contractapi.TransactionContextInterface
 		return fmt.Errorf("failed to get auction from public state %v", err)
 	}
 
-	// the auction can only be closed by the seller
+	// a clock auction has no bids to reveal, and is ended instead
+	if auction.Clock != nil {
+		return fmt.Errorf("cannot close a clock auction, end the auction instead")
+	}
+
+	// the auction can only be closed by the seller before the bidding deadline
 
 	// get ID of submitting client
 	clientID, err := s.GetSubmittingClientIdentity(ctx)
@@ -392,9 +584,14 @@ func (s *SmartContract) CloseAuction(ctx contractapi.TransactionContextInterface
 		return fmt.Errorf("failed to get client identity %v", err)
 	}
 
+	passed, err := deadlinePassed(ctx, auction.BiddingDeadline)
+	if err != nil {
+		return err
+	}
+
 	seller := auction.Seller
-	if seller != clientID {
-		return fmt.Errorf("auction can only be closed by seller: %v", err)
+	if seller != clientID && !passed {
+		return fmt.Errorf("auction can only be closed by seller before the bidding deadline")
 	}
 
 	status := auction.Status
@@ -415,46 +612,190 @@ func (s *SmartContract) CloseAuction(ctx contractapi.TransactionContextInterface
 }
 
 // EndAuction both changes the auction status to closed and calculates the winners
-// of the auction
+// of the auction. After the reveal deadline, the auction can be ended by anyone,
+// and bids that have not been revealed are ignored. A clock auction can be ended
+// by the seller before the full quantity has been sold, or by anyone after the
+// clock has run out. If the auction was created with a token chaincode, the
+// winners pay the seller in the same transaction, see settleAuction
 func (s *SmartContract) EndAuction(ctx contractapi.TransactionContextInterface, auctionID string) error {
 
+	auction, passed, err := s.calculateAuctionResult(ctx, auctionID)
+	if err != nil {
+		return err
+	}
+
+	if auction.TokenChaincode != "" {
+		err = s.settleAuction(ctx, auction, passed)
+		if err != nil {
+			return err
+		}
+	}
+
+	endedAuctionJSON, _ := json.Marshal(auction)
+
+	err = ctx.GetStub().PutState(auctionID, endedAuctionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to end auction: %v", err)
+	}
+	return nil
+}
+
+// settleAuction is an internal function that pays the seller of an auction that
+// was created with a token chaincode, by invoking a token-erc-20 chaincode on the
+// same channel. Each winner pays the price multiplied by the quantity allocated
+// to them, using the allowance that the winner approved for the seller when they
+// placed their bid. A winner who does not have the allowance or the balance to
+// pay is disqualified, and the quantity allocated to them goes to the next
+// highest bids. The payments are collected with a single BatchTransferFrom, which
+// credits the seller once: the token chaincode does not read the updates of the
+// same transaction, so separate transfers to the seller would overwrite each
+// other. The token chaincode uses the submitting client as the spender of the
+// allowances, so an auction with winners who can pay can only be ended by the
+// seller. Anyone else can only end the auction after the reveal deadline, if no
+// bidder is left who can pay. Any other failure of the token chaincode, for
+// example a paused contract or a frozen account, fails the transaction and the
+// auction does not end
+func (s *SmartContract) settleAuction(ctx contractapi.TransactionContextInterface, auction *Auction, passed bool) error {
+
+	// get ID of submitting client
+	clientID, err := s.GetSubmittingClientIdentity(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	// an unsold auction has nothing to settle
+	for auction.Status == "ended" {
+		buyers, amounts := settlementAmounts(auction)
+
+		disqualified := false
+		for i, buyer := range buyers {
+			paying, err := canPay(ctx, auction.TokenChaincode, buyer, auction.Seller, amounts[i])
+			if err != nil {
+				return fmt.Errorf("failed to settle auction: %v", err)
+			}
+			if !paying {
+				auction.Disqualified = append(auction.Disqualified, buyer)
+				disqualified = true
+			}
+		}
+		if disqualified {
+			err = calculateWinners(ctx, auction, passed)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if clientID != auction.Seller {
+			return fmt.Errorf("auction with winners who can pay can only be ended by seller")
+		}
+
+		err = batchTransferFrom(ctx, auction.TokenChaincode, buyers, auction.Seller, amounts)
+		if err != nil {
+			return fmt.Errorf("failed to settle auction: %v", err)
+		}
+		return nil
+	}
+
+	return nil
+}
+
+// settlementAmounts is an internal function that returns the buyers of the
+// auction, in the order in which they first appear in the winners, and the
+// amount that each buyer pays for all quantities allocated to them
+func settlementAmounts(auction *Auction) ([]string, []int) {
+
+	var buyers []string
+	var amounts []int
+	for _, winner := range auction.Winners {
+		price := auction.Price
+		if winner.Price != 0 {
+			price = winner.Price
+		}
+
+		i := 0
+		for i < len(buyers) && buyers[i] != winner.Buyer {
+			i++
+		}
+		if i == len(buyers) {
+			buyers = append(buyers, winner.Buyer)
+			amounts = append(amounts, 0)
+		}
+		amounts[i] = amounts[i] + price*winner.Quantity
+	}
+
+	return buyers, amounts
+}
+
+// calculateAuctionResult is an internal function that checks that the auction
+// can be ended by the submitting client, and returns the auction updated with
+// the winners and the price, and whether the reveal deadline has passed
+func (s *SmartContract) calculateAuctionResult(ctx contractapi.TransactionContextInterface, auctionID string) (*Auction, bool, error) {
+
 	// get auction from public state
 	auction, err := s.QueryAuction(ctx, auctionID)
 	if err != nil {
-		return fmt.Errorf("failed to get auction from public state %v", err)
+		return nil, false, fmt.Errorf("failed to get auction from public state %v", err)
 	}
 
-	// Check that the auction is being ended by the seller
+	// Check that the auction is being ended by the seller, or that the
+	// reveal deadline has passed
 
 	// get ID of submitting client
 	clientID, err := s.GetSubmittingClientIdentity(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get client identity %v", err)
+		return nil, false, fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	// the winners of a clock auction are added as they accept the price
+	if auction.Clock != nil {
+		err = endClockAuction(ctx, auction, clientID)
+		if err != nil {
+			return nil, false, err
+		}
+		return auction, false, nil
+	}
+
+	passed, err := deadlinePassed(ctx, auction.RevealDeadline)
+	if err != nil {
+		return nil, false, err
 	}
 
 	seller := auction.Seller
-	if seller != clientID {
-		return fmt.Errorf("auction can only be ended by seller: %v", err)
+	if seller != clientID && !passed {
+		return nil, false, fmt.Errorf("auction can only be ended by seller before the reveal deadline")
 	}
 
 	status := auction.Status
 	if status != "closed" {
-		return fmt.Errorf("Can only end a closed auction")
+		return nil, false, fmt.Errorf("Can only end a closed auction")
 	}
 
-	// get the list of revealed bids
+	if len(auction.RevealedBids) == 0 && !passed {
+		return nil, false, fmt.Errorf("No bids have been revealed, cannot end auction")
+	}
 
-	revealedBidMap := auction.RevealedBids
-	if len(auction.RevealedBids) == 0 {
-		return fmt.Errorf("No bids have been revealed, cannot end auction: %v", err)
+	err = calculateWinners(ctx, auction, passed)
+	if err != nil {
+		return nil, false, err
 	}
 
+	return auction, passed, nil
+}
+
+// calculateWinners is an internal function that updates the auction with the
+// winners and the price from the revealed bids. The bids of disqualified buyers
+// are ignored. Nothing is sold if no bids are left
+func calculateWinners(ctx contractapi.TransactionContextInterface, auction *Auction, passed bool) error {
+
 	// sort the map of revealed bids to make it easier to calculate winners
 	// if bids are tied, fill smaller bids first
 	var bidders []FullBid
 
-	for _, bid := range revealedBidMap {
-		bidders = append(bidders, bid)
+	for _, bid := range auction.RevealedBids {
+		if !contains(auction.Disqualified, bid.Buyer) {
+			bidders = append(bidders, bid)
+		}
 	}
 
 	sort.Slice(bidders, func(p, q int) bool {
@@ -467,6 +808,14 @@ func (s *SmartContract) EndAuction(ctx contractapi.TransactionContextInterface,
 		return bidders[p].Quantity < bidders[q].Quantity
 	})
 
+	auction.Winners = []Winners{}
+	auction.Price = 0
+
+	if len(bidders) == 0 {
+		auction.Status = string("unsold")
+		return nil
+	}
+
 	i := 0
 	remainingQuantity := auction.Quantity
 
@@ -499,19 +848,91 @@ func (s *SmartContract) EndAuction(ctx contractapi.TransactionContextInterface,
 		}
 	}
 
-	// check if there is a winning bid that has yet to be revealed
-	err = checkForHigherBid(ctx, auction.Price, auction.RevealedBids, auction.PrivateBids)
-	if err != nil {
-		return fmt.Errorf("Cannot end auction: %v", err)
+	// check if there is a winning bid that has yet to be revealed. Bids that
+	// have not been revealed by the reveal deadline are ignored
+	if !passed {
+		err := checkForHigherBid(ctx, auction.Price, auction.RevealedBids, auction.PrivateBids)
+		if err != nil {
+			return fmt.Errorf("Cannot end auction: %v", err)
+		}
 	}
 
 	auction.Status = string("ended")
 
-	endedAuctionJSON, _ := json.Marshal(auction)
+	return nil
+}
 
-	err = ctx.GetStub().PutState(auctionID, endedAuctionJSON)
+// checkAuctionOpen is an internal function that checks that bids can still be
+// added to or removed from the auction
+func checkAuctionOpen(ctx contractapi.TransactionContextInterface, auction *Auction) error {
+
+	if auction.Status != "open" {
+		return fmt.Errorf("auction is not open")
+	}
+
+	passed, err := deadlinePassed(ctx, auction.BiddingDeadline)
 	if err != nil {
-		return fmt.Errorf("failed to end auction: %v", err)
+		return err
+	}
+	if passed {
+		return fmt.Errorf("the bidding deadline %v has passed", auction.BiddingDeadline)
 	}
+
+	return nil
+}
+
+// verifyBidOwner is an internal function that checks that a bid in the auction
+// belongs to the submitting client. Only the peers of the bidder's organization
+// can read the bid and check the bidder. Because the bidder's organization is
+// an endorser of the auction, the peers of other organizations only check that
+// the client belongs to the organization of the bid
+func (s *SmartContract) verifyBidOwner(ctx contractapi.TransactionContextInterface, auction *Auction, bidKey string) error {
+
+	bidHash, bidInAuction := auction.PrivateBids[bidKey]
+	if !bidInAuction {
+		return fmt.Errorf("bid %v has not been added to the auction", bidKey)
+	}
+
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+
+	if bidHash.Org != clientOrgID {
+		return fmt.Errorf("Permission denied, client from org %v is not the owner of the bid", clientOrgID)
+	}
+
+	peerMSPID, err := shim.GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed getting the peer's MSPID: %v", err)
+	}
+
+	if peerMSPID != clientOrgID {
+		return nil
+	}
+
+	clientID, err := s.GetSubmittingClientIdentity(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	bidJSON, err := ctx.GetStub().GetPrivateData("_implicit_org_"+clientOrgID, bidKey)
+	if err != nil {
+		return fmt.Errorf("failed to get bid %v: %v", bidKey, err)
+	}
+	if bidJSON == nil {
+		return fmt.Errorf("bid %v does not exist", bidKey)
+	}
+
+	var bid *FullBid
+	err = json.Unmarshal(bidJSON, &bid)
+	if err != nil {
+		return err
+	}
+
+	if bid.Buyer != clientID {
+		return fmt.Errorf("Permission denied, client id %v is not the owner of the bid", clientID)
+	}
+
 	return nil
 }
@@ -0,0 +1,272 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auction
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Clock stores the price schedule of a descending price (clock) auction. The
+// price starts at the start price and falls by the decrement after each tick
+// interval, in seconds, that has passed since the start time
+type Clock struct {
+	StartPrice   int    `json:"startPrice"`
+	Decrement    int    `json:"decrement"`
+	TickInterval int    `json:"tickInterval"`
+	StartTime    string `json:"startTime"`
+}
+
+// maxClockPrice is the highest start price of a clock auction, and
+// maxTickInterval is the longest tick interval in seconds (one year)
+const (
+	maxClockPrice   = 1000000000
+	maxTickInterval = 365 * 24 * 60 * 60
+)
+
+// CreateClockAuction creates a descending price auction on the public channel.
+// The identity that submits the transaction becomes the seller of the auction.
+// The clock starts at the transaction timestamp, and buyers use AcceptPrice to
+// buy items at the current price until the quantity has been sold
+func (s *SmartContract) CreateClockAuction(ctx contractapi.TransactionContextInterface, auctionID string, itemsold string, quantity int, startPrice int, decrement int, tickInterval int) error {
+
+	// get ID of submitting client
+	clientID, err := s.GetSubmittingClientIdentity(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	// get org of submitting client
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	if quantity <= 0 {
+		return fmt.Errorf("quantity must be greater than zero")
+	}
+	if startPrice <= 0 || decrement <= 0 || tickInterval <= 0 {
+		return fmt.Errorf("start price, decrement and tick interval must be greater than zero")
+	}
+	if startPrice > maxClockPrice {
+		return fmt.Errorf("start price cannot be greater than %d", maxClockPrice)
+	}
+	if decrement > startPrice {
+		return fmt.Errorf("decrement cannot be greater than the start price")
+	}
+	if tickInterval > maxTickInterval {
+		return fmt.Errorf("tick interval cannot be longer than %d seconds", maxTickInterval)
+	}
+
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Create auction
+	auction := Auction{
+		Type:         "auction",
+		ItemSold:     itemsold,
+		Quantity:     quantity,
+		Price:        0,
+		Seller:       clientID,
+		Orgs:         []string{clientOrgID},
+		PrivateBids:  make(map[string]BidHash),
+		RevealedBids: make(map[string]FullBid),
+		Winners:      []Winners{},
+		Status:       "open",
+		Auditor:      false,
+		Clock: &Clock{
+			StartPrice:   startPrice,
+			Decrement:    decrement,
+			TickInterval: tickInterval,
+			StartTime:    txTime.UTC().Format(time.RFC3339Nano),
+		},
+	}
+
+	auctionJSON, err := json.Marshal(auction)
+	if err != nil {
+		return err
+	}
+
+	// put auction into state
+	err = ctx.GetStub().PutState(auctionID, auctionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put auction in public data: %v", err)
+	}
+
+	// set the seller of the auction as an endorser
+	err = setAssetStateBasedEndorsement(ctx, auctionID, []string{clientOrgID}, false)
+	if err != nil {
+		return fmt.Errorf("failed setting state based endorsement for new organization: %v", err)
+	}
+
+	return nil
+}
+
+// QueryClockPrice returns the price of a clock auction at the transaction timestamp
+func (s *SmartContract) QueryClockPrice(ctx contractapi.TransactionContextInterface, auctionID string) (int, error) {
+
+	auction, err := s.QueryAuction(ctx, auctionID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get auction from public state %v", err)
+	}
+
+	if auction.Clock == nil {
+		return 0, fmt.Errorf("auction %v is not a clock auction", auctionID)
+	}
+
+	return clockPrice(ctx, auction.Clock)
+}
+
+// AcceptPrice is used by a buyer to buy a quantity of the items in a clock
+// auction at the current price. Buyers win in the order that they accept the
+// price, and the auction ends when the full quantity has been sold. The
+// function returns the price that the buyer pays for each item
+func (s *SmartContract) AcceptPrice(ctx contractapi.TransactionContextInterface, auctionID string, quantity int) (int, error) {
+
+	// get the auction from public state
+	auction, err := s.QueryAuction(ctx, auctionID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get auction from public state %v", err)
+	}
+
+	if auction.Clock == nil {
+		return 0, fmt.Errorf("auction %v is not a clock auction", auctionID)
+	}
+
+	if auction.Status != "open" {
+		return 0, fmt.Errorf("cannot buy from an auction that is not open")
+	}
+
+	if quantity <= 0 {
+		return 0, fmt.Errorf("quantity must be greater than zero")
+	}
+
+	remainingQuantity := auction.Quantity
+	for _, winner := range auction.Winners {
+		remainingQuantity = remainingQuantity - winner.Quantity
+	}
+	if quantity > remainingQuantity {
+		return 0, fmt.Errorf("cannot buy %d items, only %d remaining", quantity, remainingQuantity)
+	}
+
+	price, err := clockPrice(ctx, auction.Clock)
+	if err != nil {
+		return 0, err
+	}
+	if price <= 0 {
+		return 0, fmt.Errorf("the clock of auction %v has run out", auctionID)
+	}
+
+	// get ID of submitting client
+	clientID, err := s.GetSubmittingClientIdentity(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	// get the MSP ID of the buyer's org
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+
+	winner := Winners{
+		Buyer:    clientID,
+		Quantity: quantity,
+		Price:    price,
+	}
+
+	auction.Winners = append(auction.Winners, winner)
+	auction.Price = price
+
+	if quantity == remainingQuantity {
+		auction.Status = string("ended")
+	}
+
+	// Add the buyer's organization to the list of participating organization's if it is not already
+	orgs := auction.Orgs
+	if !(contains(orgs, clientOrgID)) {
+		newOrgs := append(orgs, clientOrgID)
+		auction.Orgs = newOrgs
+
+		err = setAssetStateBasedEndorsement(ctx, auctionID, newOrgs, auction.Auditor)
+		if err != nil {
+			return 0, fmt.Errorf("failed setting state based endorsement for new organization: %v", err)
+		}
+	}
+
+	newAuctionJSON, _ := json.Marshal(auction)
+
+	err = ctx.GetStub().PutState(auctionID, newAuctionJSON)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update auction: %v", err)
+	}
+
+	return price, nil
+}
+
+// endClockAuction is an internal function that ends a clock auction before
+// the full quantity has been sold. The auction can be ended by the seller, or by
+// anyone once the clock has run out
+func endClockAuction(ctx contractapi.TransactionContextInterface, auction *Auction, clientID string) error {
+
+	if auction.Status != "open" {
+		return fmt.Errorf("Can only end an open clock auction")
+	}
+
+	price, err := clockPrice(ctx, auction.Clock)
+	if err != nil {
+		return err
+	}
+
+	if auction.Seller != clientID && price > 0 {
+		return fmt.Errorf("clock auction can only be ended by seller before the clock runs out")
+	}
+
+	if len(auction.Winners) == 0 {
+		auction.Status = string("unsold")
+	} else {
+		auction.Status = string("ended")
+	}
+
+	return nil
+}
+
+// clockPrice is an internal function that calculates the price of a clock
+// auction at the transaction timestamp. The timestamp can be up to maxClockSkew
+// ahead of the time of the peer, so the price is calculated at maxClockSkew
+// before the timestamp, and choosing a later timestamp never lowers the price.
+// The price stops falling at zero, after which nothing can be bought
+func clockPrice(ctx contractapi.TransactionContextInterface, clock *Clock) (int, error) {
+
+	startTime, err := time.Parse(time.RFC3339, clock.StartTime)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse start time %v: %v", clock.StartTime, err)
+	}
+
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	priceTime := txTime.Add(-maxClockSkew)
+	if !priceTime.After(startTime) {
+		return clock.StartPrice, nil
+	}
+
+	ticks := int64(priceTime.Sub(startTime) / (time.Duration(clock.TickInterval) * time.Second))
+
+	// compare the ticks before multiplying, so that a clock that has been
+	// running for a long time cannot overflow the price
+	if ticks > int64(clock.StartPrice/clock.Decrement) {
+		return 0, nil
+	}
+
+	return clock.StartPrice - int(ticks)*clock.Decrement, nil
+}
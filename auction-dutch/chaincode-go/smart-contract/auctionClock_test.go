@@ -0,0 +1,352 @@
+package auction
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-samples/auction/dutch-auction/chaincode-go/smart-contract/tests/testsfakes"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// The clock of every test starts at 100 and falls by 5 every 60 seconds
+var _ClockPrice = []struct {
+	name          string
+	started       time.Duration
+	txSkew        time.Duration
+	startTime     string
+	expected      int
+	expectedError string
+}{
+	{
+		name:     "Not started at the price time",
+		started:  10 * time.Second,
+		expected: 100,
+	},
+	{
+		name:     "Less than a tick after the price time",
+		started:  maxClockSkew + 59*time.Second,
+		expected: 100,
+	},
+	{
+		name:     "One tick",
+		started:  maxClockSkew + 61*time.Second,
+		expected: 95,
+	},
+	{
+		name:     "Ten ticks",
+		started:  maxClockSkew + 10*time.Minute + 5*time.Second,
+		expected: 50,
+	},
+	{
+		name:     "Run out",
+		started:  maxClockSkew + 20*time.Minute + 5*time.Second,
+		expected: 0,
+	},
+	{
+		name:     "Past running out",
+		started:  maxClockSkew + 21*time.Minute + 5*time.Second,
+		expected: 0,
+	},
+	{
+		name:     "Long past running out",
+		started:  100 * 365 * 24 * time.Hour,
+		expected: 0,
+	},
+	{
+		name:     "Timestamp ahead of the peer is no cheaper",
+		started:  maxClockSkew + 61*time.Second,
+		txSkew:   maxClockSkew - time.Second,
+		expected: 95,
+	},
+	{
+		name:          "Timestamp too far ahead of the peer",
+		started:       maxClockSkew + 61*time.Second,
+		txSkew:        maxClockSkew + time.Second,
+		expectedError: "is more than 30s away from the time of the peer",
+	},
+	{
+		name:          "Timestamp too far behind the peer",
+		started:       maxClockSkew + 61*time.Second,
+		txSkew:        -maxClockSkew - time.Second,
+		expectedError: "is more than 30s away from the time of the peer",
+	},
+	{
+		name:          "Invalid start time",
+		startTime:     "yesterday",
+		expectedError: "failed to parse start time yesterday",
+	},
+}
+
+// newClockContext returns a transaction context with the transaction timestamp now
+func newClockContext(now time.Time) (*testsfakes.FakeTestChaincodeStubInterface, *testsfakes.FakeTestTransactionContextInterface) {
+	stub := &testsfakes.FakeTestChaincodeStubInterface{}
+	tc := &testsfakes.FakeTestTransactionContextInterface{}
+	tc.GetStubStub = func() shim.ChaincodeStubInterface {
+		return stub
+	}
+	stub.GetTxTimestampReturns(&timestamppb.Timestamp{Seconds: now.Unix(), Nanos: int32(now.Nanosecond())}, nil)
+	return stub, tc
+}
+
+func TestClockPrice(t *testing.T) {
+	for _, tt := range _ClockPrice {
+		t.Run(tt.name, func(t *testing.T) {
+
+			//Prepare dynamic data
+			now := time.Now()
+			_, tc := newClockContext(now.Add(tt.txSkew))
+			clock := &Clock{
+				StartPrice:   100,
+				Decrement:    5,
+				TickInterval: 60,
+				StartTime:    now.Add(-tt.started).UTC().Format(time.RFC3339Nano),
+			}
+			if tt.startTime != "" {
+				clock.StartTime = tt.startTime
+			}
+
+			price, err := clockPrice(tc, clock)
+			if tt.expectedError != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedError)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, price)
+			}
+		})
+	}
+}
+
+var _CreateClockAuction = []struct {
+	name          string
+	startPrice    int
+	decrement     int
+	tickInterval  int
+	expectedError string
+}{
+	{
+		name:         "OK",
+		startPrice:   100,
+		decrement:    5,
+		tickInterval: 60,
+	},
+	{
+		name:         "Highest start price and longest tick interval",
+		startPrice:   maxClockPrice,
+		decrement:    maxClockPrice,
+		tickInterval: maxTickInterval,
+	},
+	{
+		name:          "Zero decrement",
+		startPrice:    100,
+		tickInterval:  60,
+		expectedError: "start price, decrement and tick interval must be greater than zero",
+	},
+	{
+		name:          "Start price too high",
+		startPrice:    maxClockPrice + 1,
+		decrement:     5,
+		tickInterval:  60,
+		expectedError: "start price cannot be greater than 1000000000",
+	},
+	{
+		name:          "Decrement greater than the start price",
+		startPrice:    100,
+		decrement:     101,
+		tickInterval:  60,
+		expectedError: "decrement cannot be greater than the start price",
+	},
+	{
+		name:          "Tick interval too long",
+		startPrice:    100,
+		decrement:     5,
+		tickInterval:  maxTickInterval + 1,
+		expectedError: "tick interval cannot be longer than 31536000 seconds",
+	},
+}
+
+func TestCreateClockAuction(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	identity := &testsfakes.FakeTestClientIdentity{}
+	identity.GetIDReturns(base64.StdEncoding.EncodeToString([]byte("seller")), nil)
+	identity.GetMSPIDReturns("Org1MSP", nil)
+
+	for _, tt := range _CreateClockAuction {
+		t.Run(tt.name, func(t *testing.T) {
+
+			//Prepare dynamic data
+			stub, tc := newClockContext(time.Now())
+			tc.GetClientIdentityReturns(identity)
+
+			err := sc.CreateClockAuction(tc, "auction1", "tickets", 100, tt.startPrice, tt.decrement, tt.tickInterval)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				assert.Equal(t, 0, stub.PutStateCallCount())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, 1, stub.PutStateCallCount())
+				_, value := stub.PutStateArgsForCall(0)
+				var auction Auction
+				assert.NoError(t, json.Unmarshal(value, &auction))
+				assert.Equal(t, tt.startPrice, auction.Clock.StartPrice)
+				assert.Equal(t, tt.decrement, auction.Clock.Decrement)
+				assert.Equal(t, tt.tickInterval, auction.Clock.TickInterval)
+			}
+		})
+	}
+}
+
+// The auction sells 100 items, the clock starts at 100 and falls by 5 every 60 seconds
+var _AcceptPrice = []struct {
+	name           string
+	started        time.Duration
+	status         string
+	sold           int
+	quantity       int
+	buyerOrg       string
+	expected       int
+	expectedError  string
+	expectedStatus string
+	expectedOrgs   []string
+}{
+	{
+		name:           "OK",
+		started:        maxClockSkew + 2*time.Minute + 5*time.Second,
+		status:         "open",
+		quantity:       30,
+		buyerOrg:       "Org1MSP",
+		expected:       90,
+		expectedStatus: "open",
+		expectedOrgs:   []string{"Org1MSP"},
+	},
+	{
+		name:           "Buyer of another organization",
+		started:        maxClockSkew + 2*time.Minute + 5*time.Second,
+		status:         "open",
+		quantity:       30,
+		buyerOrg:       "Org2MSP",
+		expected:       90,
+		expectedStatus: "open",
+		expectedOrgs:   []string{"Org1MSP", "Org2MSP"},
+	},
+	{
+		name:           "Remaining quantity",
+		started:        maxClockSkew + 2*time.Minute + 5*time.Second,
+		status:         "open",
+		sold:           80,
+		quantity:       20,
+		buyerOrg:       "Org1MSP",
+		expected:       90,
+		expectedStatus: "ended",
+		expectedOrgs:   []string{"Org1MSP"},
+	},
+	{
+		name:          "More than the remaining quantity",
+		started:       maxClockSkew + 2*time.Minute + 5*time.Second,
+		status:        "open",
+		sold:          80,
+		quantity:      21,
+		buyerOrg:      "Org1MSP",
+		expectedError: "cannot buy 21 items, only 20 remaining",
+	},
+	{
+		name:          "No quantity",
+		started:       maxClockSkew + 2*time.Minute + 5*time.Second,
+		status:        "open",
+		quantity:      0,
+		buyerOrg:      "Org1MSP",
+		expectedError: "quantity must be greater than zero",
+	},
+	{
+		name:           "Last price before running out",
+		started:        maxClockSkew + 19*time.Minute + 5*time.Second,
+		status:         "open",
+		quantity:       10,
+		buyerOrg:       "Org1MSP",
+		expected:       5,
+		expectedStatus: "open",
+		expectedOrgs:   []string{"Org1MSP"},
+	},
+	{
+		name:          "Clock run out",
+		started:       maxClockSkew + 20*time.Minute + 5*time.Second,
+		status:        "open",
+		quantity:      10,
+		buyerOrg:      "Org1MSP",
+		expectedError: "the clock of auction auction1 has run out",
+	},
+	{
+		name:          "Auction ended",
+		started:       maxClockSkew + 2*time.Minute + 5*time.Second,
+		status:        "ended",
+		quantity:      10,
+		buyerOrg:      "Org1MSP",
+		expectedError: "cannot buy from an auction that is not open",
+	},
+}
+
+func TestAcceptPrice(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	identity := &testsfakes.FakeTestClientIdentity{}
+	identity.GetIDReturns(base64.StdEncoding.EncodeToString([]byte("buyer")), nil)
+
+	for _, tt := range _AcceptPrice {
+		t.Run(tt.name, func(t *testing.T) {
+
+			//Prepare dynamic data
+			now := time.Now()
+			stub, tc := newClockContext(now)
+			tc.GetClientIdentityReturns(identity)
+			identity.GetMSPIDReturns(tt.buyerOrg, nil)
+			auction := Auction{
+				Type:     "auction",
+				ItemSold: "tickets",
+				Quantity: 100,
+				Seller:   "seller",
+				Orgs:     []string{"Org1MSP"},
+				Winners:  []Winners{},
+				Status:   tt.status,
+				Clock: &Clock{
+					StartPrice:   100,
+					Decrement:    5,
+					TickInterval: 60,
+					StartTime:    now.Add(-tt.started).UTC().Format(time.RFC3339Nano),
+				},
+			}
+			if tt.sold > 0 {
+				auction.Winners = append(auction.Winners, Winners{Buyer: "other", Quantity: tt.sold, Price: 95})
+			}
+			auctionJSON, _ := json.Marshal(auction)
+			stub.GetStateReturns(auctionJSON, nil)
+
+			price, err := sc.AcceptPrice(tc, "auction1", tt.quantity)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				assert.Equal(t, 0, stub.PutStateCallCount())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, price)
+				assert.Equal(t, 1, stub.PutStateCallCount())
+				key, value := stub.PutStateArgsForCall(0)
+				assert.Equal(t, "auction1", key)
+				var updated Auction
+				assert.NoError(t, json.Unmarshal(value, &updated))
+				assert.Equal(t, Winners{Buyer: "buyer", Quantity: tt.quantity, Price: tt.expected}, updated.Winners[len(updated.Winners)-1])
+				assert.Equal(t, tt.expected, updated.Price)
+				assert.Equal(t, tt.expectedStatus, updated.Status)
+				assert.Equal(t, tt.expectedOrgs, updated.Orgs)
+				if len(tt.expectedOrgs) > 1 {
+					assert.Equal(t, 1, stub.SetStateValidationParameterCallCount())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,424 @@
+package auction
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-samples/auction/dutch-auction/chaincode-go/smart-contract/tests/testsfakes"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// newTestContext returns a transaction context of a client of Org1 that submits a
+// transaction at the given time. The stub reads and writes the world state in the
+// map. Bid keys are bid<txID>, like the bid keys of newAuction
+func newTestContext(state map[string][]byte, client string, now time.Time) (*testsfakes.FakeTestTransactionContextInterface, *testsfakes.FakeTestChaincodeStubInterface) {
+	stub := &testsfakes.FakeTestChaincodeStubInterface{}
+	stub.GetStateStub = func(key string) ([]byte, error) {
+		return state[key], nil
+	}
+	stub.PutStateStub = func(key string, value []byte) error {
+		state[key] = value
+		return nil
+	}
+	stub.CreateCompositeKeyStub = func(objectType string, attributes []string) (string, error) {
+		return objectType + attributes[len(attributes)-1], nil
+	}
+	stub.GetTxTimestampReturns(&timestamppb.Timestamp{Seconds: now.Unix(), Nanos: int32(now.Nanosecond())}, nil)
+
+	identity := &testsfakes.FakeTestClientIdentity{}
+	identity.GetIDReturns(base64.StdEncoding.EncodeToString([]byte(client)), nil)
+	identity.GetMSPIDReturns("Org1MSP", nil)
+
+	tc := &testsfakes.FakeTestTransactionContextInterface{}
+	tc.GetStubReturns(stub)
+	tc.GetClientIdentityReturns(identity)
+	return tc, stub
+}
+
+// newAuction creates a closed auction of 100 tickets with a revealed bid of buyer<n>
+// for 50 tickets for each bid key bid<n>
+func newAuction(bids map[string]int) *Auction {
+	revealedBids := map[string]FullBid{}
+	for bidKey, price := range bids {
+		revealedBids[bidKey] = FullBid{
+			Type:     "bid",
+			Quantity: 50,
+			Price:    price,
+			Org:      "Org1MSP",
+			Buyer:    strings.Replace(bidKey, "bid", "buyer", 1),
+		}
+	}
+	return &Auction{
+		Type:         "auction",
+		ItemSold:     "tickets",
+		Seller:       "seller",
+		Quantity:     100,
+		Orgs:         []string{"Org1MSP"},
+		PrivateBids:  map[string]BidHash{},
+		RevealedBids: revealedBids,
+		Winners:      []Winners{},
+		Status:       "closed",
+	}
+}
+
+// putAuction stores the auction in the world state under the ID "auction"
+func putAuction(state map[string][]byte, auction *Auction) {
+	state["auction"], _ = json.Marshal(auction)
+}
+
+// getAuction reads the auction with the ID "auction" from the world state
+func getAuction(t *testing.T, state map[string][]byte) *Auction {
+	var auction *Auction
+	err := json.Unmarshal(state["auction"], &auction)
+	assert.NoError(t, err)
+	return auction
+}
+
+// Deadlines are relative to the transaction timestamp, 0 means no deadline
+var _Deadlines = []struct {
+	name            string
+	function        string
+	client          string
+	status          string
+	biddingDeadline time.Duration
+	revealDeadline  time.Duration
+	expectedError   string
+	expectedStatus  string
+}{
+	{
+		name:            "Bid before the bidding deadline",
+		function:        "SubmitBid",
+		client:          "buyer1",
+		status:          "open",
+		biddingDeadline: time.Minute,
+		expectedStatus:  "open",
+	},
+	{
+		name:            "Bid after the bidding deadline",
+		function:        "SubmitBid",
+		client:          "buyer1",
+		status:          "open",
+		biddingDeadline: -time.Minute,
+		expectedError:   "cannot join auction after the bidding deadline",
+	},
+	{
+		name:           "Reveal after the reveal deadline",
+		function:       "RevealBid",
+		client:         "buyer1",
+		status:         "closed",
+		revealDeadline: -time.Minute,
+		expectedError:  "cannot reveal bid after the reveal deadline",
+	},
+	{
+		name:            "Seller closes before the bidding deadline",
+		function:        "CloseAuction",
+		client:          "seller",
+		status:          "open",
+		biddingDeadline: time.Minute,
+		expectedStatus:  "closed",
+	},
+	{
+		name:            "Anyone closes after the bidding deadline",
+		function:        "CloseAuction",
+		client:          "anyone",
+		status:          "open",
+		biddingDeadline: -time.Minute,
+		expectedStatus:  "closed",
+	},
+	{
+		name:            "Anyone closes before the bidding deadline",
+		function:        "CloseAuction",
+		client:          "anyone",
+		status:          "open",
+		biddingDeadline: time.Minute,
+		expectedError:   "auction can only be closed by seller before the bidding deadline",
+	},
+	{
+		name:          "Anyone closes without a deadline",
+		function:      "CloseAuction",
+		client:        "anyone",
+		status:        "open",
+		expectedError: "auction can only be closed by seller before the bidding deadline",
+	},
+	{
+		name:           "Anyone ends after the reveal deadline",
+		function:       "EndAuction",
+		client:         "anyone",
+		status:         "closed",
+		revealDeadline: -time.Minute,
+		expectedStatus: "ended",
+	},
+	{
+		name:           "Anyone ends before the reveal deadline",
+		function:       "EndAuction",
+		client:         "anyone",
+		status:         "closed",
+		revealDeadline: time.Minute,
+		expectedError:  "auction can only be ended by seller before the reveal deadline",
+	},
+	{
+		name:            "Deadline in the past",
+		function:        "CreateAuction",
+		client:          "seller",
+		biddingDeadline: -time.Minute,
+		expectedError:   "invalid bidding deadline: deadline",
+	},
+	{
+		name:            "Reveal deadline before the bidding deadline",
+		function:        "CreateAuction",
+		client:          "seller",
+		biddingDeadline: 2 * time.Minute,
+		revealDeadline:  time.Minute,
+		expectedError:   "reveal deadline must be after the bidding deadline",
+	},
+	{
+		name:            "Auction with deadlines",
+		function:        "CreateAuction",
+		client:          "seller",
+		biddingDeadline: time.Minute,
+		revealDeadline:  2 * time.Minute,
+		expectedStatus:  "open",
+	},
+}
+
+func TestDeadlines(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	now := time.Now()
+	deadline := func(offset time.Duration) string {
+		if offset == 0 {
+			return ""
+		}
+		return now.Add(offset).UTC().Format(time.RFC3339Nano)
+	}
+	bidJSON := []byte(`{"objectType":"bid","quantity":50,"price":120,"org":"Org1MSP","buyer":"buyer1"}`)
+	bidHash := sha256.Sum256(bidJSON)
+	os.Setenv("CORE_PEER_LOCALMSPID", "Org1MSP")
+	defer os.Unsetenv("CORE_PEER_LOCALMSPID")
+
+	for _, tt := range _Deadlines {
+		t.Run(tt.name, func(t *testing.T) {
+
+			//Prepare dynamic data
+			state := map[string][]byte{}
+			tc, stub := newTestContext(state, tt.client, now)
+			stub.GetTransientReturns(map[string][]byte{"bid": bidJSON}, nil)
+			stub.GetPrivateDataHashReturns(bidHash[:], nil)
+			auction := newAuction(map[string]int{"bid2": 100, "bid3": 150})
+			auction.Status = tt.status
+			auction.BiddingDeadline = deadline(tt.biddingDeadline)
+			auction.RevealDeadline = deadline(tt.revealDeadline)
+			auction.PrivateBids = map[string]BidHash{"bid1": {Org: "Org1MSP", Hash: fmt.Sprintf("%x", bidHash)}}
+
+			var err error
+			switch tt.function {
+			case "CreateAuction":
+				err = sc.CreateAuction(tc, "auction", "tickets", 100, "noAuditor", auction.BiddingDeadline, auction.RevealDeadline, "")
+			case "SubmitBid":
+				putAuction(state, auction)
+				err = sc.SubmitBid(tc, "auction", "1")
+			case "RevealBid":
+				putAuction(state, auction)
+				err = sc.RevealBid(tc, "auction", "1")
+			case "CloseAuction":
+				putAuction(state, auction)
+				err = sc.CloseAuction(tc, "auction")
+			case "EndAuction":
+				putAuction(state, auction)
+				err = sc.EndAuction(tc, "auction")
+			}
+
+			if tt.expectedError != "" {
+				assert.Error(t, err)
+				assert.True(t, strings.HasPrefix(err.Error(), tt.expectedError), err.Error())
+				assert.Equal(t, 0, stub.PutStateCallCount())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedStatus, getAuction(t, state).Status)
+			}
+		})
+	}
+}
+
+// Bid bid1 is the bid of the client to withdraw or amend, bid bid2 is the new bid of AmendBid
+var _ChangeBid = []struct {
+	name            string
+	function        string
+	client          string
+	status          string
+	biddingDeadline time.Duration
+	bidOrg          string
+	newBidOwner     string
+	newBidInAuction bool
+	expectedError   string
+}{
+	{
+		name:     "Withdraw",
+		function: "WithdrawBid",
+		client:   "buyer1",
+		status:   "open",
+	},
+	{
+		name:          "Withdraw the bid of another buyer",
+		function:      "WithdrawBid",
+		client:        "buyer2",
+		status:        "open",
+		expectedError: "Permission denied, client id buyer2 is not the owner of the bid",
+	},
+	{
+		name:          "Withdraw the bid of another organization",
+		function:      "WithdrawBid",
+		client:        "buyer1",
+		status:        "open",
+		bidOrg:        "Org2MSP",
+		expectedError: "Permission denied, client from org Org1MSP is not the owner of the bid",
+	},
+	{
+		name:          "Withdraw from a closed auction",
+		function:      "WithdrawBid",
+		client:        "buyer1",
+		status:        "closed",
+		expectedError: "cannot withdraw bid: auction is not open",
+	},
+	{
+		name:            "Withdraw after the bidding deadline",
+		function:        "WithdrawBid",
+		client:          "buyer1",
+		status:          "open",
+		biddingDeadline: -time.Minute,
+		expectedError:   "cannot withdraw bid: the bidding deadline",
+	},
+	{
+		name:        "Amend",
+		function:    "AmendBid",
+		client:      "buyer1",
+		status:      "open",
+		newBidOwner: "buyer1",
+	},
+	{
+		name:          "Amend the bid of another buyer",
+		function:      "AmendBid",
+		client:        "buyer2",
+		status:        "open",
+		newBidOwner:   "buyer2",
+		expectedError: "Permission denied, client id buyer2 is not the owner of the bid",
+	},
+	{
+		name:          "Amend with the bid of another buyer",
+		function:      "AmendBid",
+		client:        "buyer1",
+		status:        "open",
+		newBidOwner:   "buyer2",
+		expectedError: "Permission denied, client id buyer1 is not the owner of the bid",
+	},
+	{
+		name:            "Amend with a bid in the auction",
+		function:        "AmendBid",
+		client:          "buyer1",
+		status:          "open",
+		newBidOwner:     "buyer1",
+		newBidInAuction: true,
+		expectedError:   "bid bid2 has already been added to the auction",
+	},
+	{
+		name:          "Amend with a bid that does not exist",
+		function:      "AmendBid",
+		client:        "buyer1",
+		status:        "open",
+		expectedError: "bid hash does not exist: bid2",
+	},
+	{
+		name:          "Amend in a closed auction",
+		function:      "AmendBid",
+		client:        "buyer1",
+		status:        "closed",
+		newBidOwner:   "buyer1",
+		expectedError: "cannot amend bid: auction is not open",
+	},
+}
+
+func TestChangeBid(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	now := time.Now()
+	os.Setenv("CORE_PEER_LOCALMSPID", "Org1MSP")
+	defer os.Unsetenv("CORE_PEER_LOCALMSPID")
+
+	for _, tt := range _ChangeBid {
+		t.Run(tt.name, func(t *testing.T) {
+
+			//Prepare dynamic data
+			state := map[string][]byte{}
+			tc, stub := newTestContext(state, tt.client, now)
+			privateBids := map[string][]byte{
+				"bid1": []byte(`{"objectType":"bid","quantity":10,"price":100,"org":"Org1MSP","buyer":"buyer1"}`),
+			}
+			if tt.newBidOwner != "" {
+				privateBids["bid2"] = []byte(`{"objectType":"bid","quantity":10,"price":120,"org":"Org1MSP","buyer":"` + tt.newBidOwner + `"}`)
+			}
+			stub.GetPrivateDataStub = func(collection string, key string) ([]byte, error) {
+				return privateBids[key], nil
+			}
+			stub.GetPrivateDataHashStub = func(collection string, key string) ([]byte, error) {
+				if privateBids[key] == nil {
+					return nil, nil
+				}
+				hash := sha256.Sum256(privateBids[key])
+				return hash[:], nil
+			}
+
+			bidOrg := "Org1MSP"
+			if tt.bidOrg != "" {
+				bidOrg = tt.bidOrg
+			}
+			auction := newAuction(map[string]int{})
+			auction.Status = tt.status
+			if tt.biddingDeadline != 0 {
+				auction.BiddingDeadline = now.Add(tt.biddingDeadline).UTC().Format(time.RFC3339Nano)
+			}
+			auction.PrivateBids = map[string]BidHash{"bid1": {Org: bidOrg, Hash: "hash1"}}
+			if tt.newBidInAuction {
+				auction.PrivateBids["bid2"] = BidHash{Org: "Org1MSP", Hash: "hash2"}
+			}
+			putAuction(state, auction)
+
+			var err error
+			if tt.function == "WithdrawBid" {
+				err = sc.WithdrawBid(tc, "auction", "1")
+			} else {
+				err = sc.AmendBid(tc, "auction", "1", "2")
+			}
+
+			if tt.expectedError != "" {
+				assert.Error(t, err)
+				assert.True(t, strings.HasPrefix(err.Error(), tt.expectedError), err.Error())
+				assert.Equal(t, 0, stub.DelPrivateDataCallCount())
+				assert.Equal(t, 0, stub.PutStateCallCount())
+				return
+			}
+
+			// the old bid is removed from the auction and from the collection
+			assert.NoError(t, err)
+			assert.Equal(t, 1, stub.DelPrivateDataCallCount())
+			collection, bidKey := stub.DelPrivateDataArgsForCall(0)
+			assert.Equal(t, "_implicit_org_Org1MSP", collection)
+			assert.Equal(t, "bid1", bidKey)
+			auction = getAuction(t, state)
+			if tt.function == "WithdrawBid" {
+				assert.Empty(t, auction.PrivateBids)
+			} else {
+				newBidHash := sha256.Sum256(privateBids["bid2"])
+				assert.Equal(t, map[string]BidHash{"bid2": {Org: "Org1MSP", Hash: fmt.Sprintf("%x", newBidHash)}}, auction.PrivateBids)
+			}
+		})
+	}
+}
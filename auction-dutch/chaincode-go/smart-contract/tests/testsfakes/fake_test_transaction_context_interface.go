@@ -0,0 +1,169 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package testsfakes
+
+import (
+	"sync"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-samples/auction/dutch-auction/chaincode-go/smart-contract/tests"
+)
+
+type FakeTestTransactionContextInterface struct {
+	GetClientIdentityStub        func() cid.ClientIdentity
+	getClientIdentityMutex       sync.RWMutex
+	getClientIdentityArgsForCall []struct {
+	}
+	getClientIdentityReturns struct {
+		result1 cid.ClientIdentity
+	}
+	getClientIdentityReturnsOnCall map[int]struct {
+		result1 cid.ClientIdentity
+	}
+	GetStubStub        func() shim.ChaincodeStubInterface
+	getStubMutex       sync.RWMutex
+	getStubArgsForCall []struct {
+	}
+	getStubReturns struct {
+		result1 shim.ChaincodeStubInterface
+	}
+	getStubReturnsOnCall map[int]struct {
+		result1 shim.ChaincodeStubInterface
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeTestTransactionContextInterface) GetClientIdentity() cid.ClientIdentity {
+	fake.getClientIdentityMutex.Lock()
+	ret, specificReturn := fake.getClientIdentityReturnsOnCall[len(fake.getClientIdentityArgsForCall)]
+	fake.getClientIdentityArgsForCall = append(fake.getClientIdentityArgsForCall, struct {
+	}{})
+	stub := fake.GetClientIdentityStub
+	fakeReturns := fake.getClientIdentityReturns
+	fake.recordInvocation("GetClientIdentity", []interface{}{})
+	fake.getClientIdentityMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeTestTransactionContextInterface) GetClientIdentityCallCount() int {
+	fake.getClientIdentityMutex.RLock()
+	defer fake.getClientIdentityMutex.RUnlock()
+	return len(fake.getClientIdentityArgsForCall)
+}
+
+func (fake *FakeTestTransactionContextInterface) GetClientIdentityCalls(stub func() cid.ClientIdentity) {
+	fake.getClientIdentityMutex.Lock()
+	defer fake.getClientIdentityMutex.Unlock()
+	fake.GetClientIdentityStub = stub
+}
+
+func (fake *FakeTestTransactionContextInterface) GetClientIdentityReturns(result1 cid.ClientIdentity) {
+	fake.getClientIdentityMutex.Lock()
+	defer fake.getClientIdentityMutex.Unlock()
+	fake.GetClientIdentityStub = nil
+	fake.getClientIdentityReturns = struct {
+		result1 cid.ClientIdentity
+	}{result1}
+}
+
+func (fake *FakeTestTransactionContextInterface) GetClientIdentityReturnsOnCall(i int, result1 cid.ClientIdentity) {
+	fake.getClientIdentityMutex.Lock()
+	defer fake.getClientIdentityMutex.Unlock()
+	fake.GetClientIdentityStub = nil
+	if fake.getClientIdentityReturnsOnCall == nil {
+		fake.getClientIdentityReturnsOnCall = make(map[int]struct {
+			result1 cid.ClientIdentity
+		})
+	}
+	fake.getClientIdentityReturnsOnCall[i] = struct {
+		result1 cid.ClientIdentity
+	}{result1}
+}
+
+func (fake *FakeTestTransactionContextInterface) GetStub() shim.ChaincodeStubInterface {
+	fake.getStubMutex.Lock()
+	ret, specificReturn := fake.getStubReturnsOnCall[len(fake.getStubArgsForCall)]
+	fake.getStubArgsForCall = append(fake.getStubArgsForCall, struct {
+	}{})
+	stub := fake.GetStubStub
+	fakeReturns := fake.getStubReturns
+	fake.recordInvocation("GetStub", []interface{}{})
+	fake.getStubMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeTestTransactionContextInterface) GetStubCallCount() int {
+	fake.getStubMutex.RLock()
+	defer fake.getStubMutex.RUnlock()
+	return len(fake.getStubArgsForCall)
+}
+
+func (fake *FakeTestTransactionContextInterface) GetStubCalls(stub func() shim.ChaincodeStubInterface) {
+	fake.getStubMutex.Lock()
+	defer fake.getStubMutex.Unlock()
+	fake.GetStubStub = stub
+}
+
+func (fake *FakeTestTransactionContextInterface) GetStubReturns(result1 shim.ChaincodeStubInterface) {
+	fake.getStubMutex.Lock()
+	defer fake.getStubMutex.Unlock()
+	fake.GetStubStub = nil
+	fake.getStubReturns = struct {
+		result1 shim.ChaincodeStubInterface
+	}{result1}
+}
+
+func (fake *FakeTestTransactionContextInterface) GetStubReturnsOnCall(i int, result1 shim.ChaincodeStubInterface) {
+	fake.getStubMutex.Lock()
+	defer fake.getStubMutex.Unlock()
+	fake.GetStubStub = nil
+	if fake.getStubReturnsOnCall == nil {
+		fake.getStubReturnsOnCall = make(map[int]struct {
+			result1 shim.ChaincodeStubInterface
+		})
+	}
+	fake.getStubReturnsOnCall[i] = struct {
+		result1 shim.ChaincodeStubInterface
+	}{result1}
+}
+
+func (fake *FakeTestTransactionContextInterface) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.getClientIdentityMutex.RLock()
+	defer fake.getClientIdentityMutex.RUnlock()
+	fake.getStubMutex.RLock()
+	defer fake.getStubMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeTestTransactionContextInterface) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ tests.TestTransactionContextInterface = new(FakeTestTransactionContextInterface)
@@ -6,7 +6,11 @@ package auction
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"math/big"
+	"strconv"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric-chaincode-go/shim"
@@ -15,6 +19,10 @@ import (
 	"github.com/hyperledger/fabric-protos-go/msp"
 )
 
+// maxClockSkew is the largest difference that a peer accepts between the
+// transaction timestamp and its own clock
+const maxClockSkew = 30 * time.Second
+
 func (s *SmartContract) GetSubmittingClientIdentity(ctx contractapi.TransactionContextInterface) (string, error) {
 
 	b64ID, err := ctx.GetClientIdentity().GetID()
@@ -203,3 +211,158 @@ func setAssetStateBasedEndorsement(ctx contractapi.TransactionContextInterface,
 	}
 	return nil
 }
+
+// parseDeadline is an internal function that checks that a deadline is an RFC 3339
+// time after the transaction timestamp, and returns it in UTC. An empty deadline
+// means that the auction has no deadline
+func parseDeadline(ctx contractapi.TransactionContextInterface, deadline string) (string, error) {
+
+	if deadline == "" {
+		return "", nil
+	}
+
+	deadlineTime, err := time.Parse(time.RFC3339, deadline)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse deadline %v: %v", deadline, err)
+	}
+
+	passed, err := deadlinePassed(ctx, deadline)
+	if err != nil {
+		return "", err
+	}
+	if passed {
+		return "", fmt.Errorf("deadline %v has already passed", deadline)
+	}
+
+	return deadlineTime.UTC().Format(time.RFC3339Nano), nil
+}
+
+// deadlinePassed is an internal function that checks if the transaction timestamp
+// is at or after a deadline. An empty deadline never passes
+func deadlinePassed(ctx contractapi.TransactionContextInterface, deadline string) (bool, error) {
+
+	if deadline == "" {
+		return false, nil
+	}
+
+	deadlineTime, err := time.Parse(time.RFC3339, deadline)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse deadline %v: %v", deadline, err)
+	}
+
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return !txTime.Before(deadlineTime), nil
+}
+
+// getTxTime is an internal function that returns the transaction timestamp. The
+// timestamp is set by the client in the transaction proposal and is not checked
+// by Fabric, so each endorsing peer rejects timestamps that are more than
+// maxClockSkew away from its own clock. Within that bound, all endorsing peers
+// use the same time
+func getTxTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	txTime := time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos))
+
+	skew := time.Since(txTime)
+	if skew > maxClockSkew || skew < -maxClockSkew {
+		return time.Time{}, fmt.Errorf("transaction timestamp %v is more than %v away from the time of the peer", txTime.UTC().Format(time.RFC3339Nano), maxClockSkew)
+	}
+
+	return txTime, nil
+}
+
+// batchTransferFrom is an internal function that transfers tokens from a list of
+// clients to one client by invoking BatchTransferFrom of a token-erc-20 chaincode
+// on the same channel, which credits the recipient once. The token chaincode uses
+// the submitting client as the spender of the allowances that the from clients
+// have approved
+func batchTransferFrom(ctx contractapi.TransactionContextInterface, tokenChaincode string, from []string, to string, amounts []int) error {
+
+	// the token chaincode identifies accounts by the base64 encoded client ID
+	var fromAccounts []string
+	var values []string
+	for i := range from {
+		fromAccounts = append(fromAccounts, base64.StdEncoding.EncodeToString([]byte(from[i])))
+		values = append(values, strconv.Itoa(amounts[i]))
+	}
+	toAccount := base64.StdEncoding.EncodeToString([]byte(to))
+
+	// the contract API passes slices as JSON arrays
+	fromJSON, err := json.Marshal(fromAccounts)
+	if err != nil {
+		return err
+	}
+	valuesJSON, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	args := [][]byte{[]byte("BatchTransferFrom"), fromJSON, []byte(toAccount), valuesJSON}
+
+	response := ctx.GetStub().InvokeChaincode(tokenChaincode, args, "")
+	if response.Status != shim.OK {
+		return fmt.Errorf("failed to transfer tokens from %v to %v: %s", from, to, response.Message)
+	}
+
+	return nil
+}
+
+// canPay is an internal function that checks whether a client has approved an
+// allowance of at least the amount for the spender, and has a balance of at
+// least the amount, by querying a token-erc-20 chaincode on the same channel.
+// An error means that the token chaincode could not be queried, not that the
+// client cannot pay
+func canPay(ctx contractapi.TransactionContextInterface, tokenChaincode string, from string, spender string, amount int) (bool, error) {
+
+	// the token chaincode identifies accounts by the base64 encoded client ID
+	fromAccount := base64.StdEncoding.EncodeToString([]byte(from))
+	spenderAccount := base64.StdEncoding.EncodeToString([]byte(spender))
+
+	allowance, err := queryToken(ctx, tokenChaincode, "Allowance", fromAccount, spenderAccount)
+	if err != nil {
+		return false, err
+	}
+	if allowance.Cmp(big.NewRat(int64(amount), 1)) < 0 {
+		return false, nil
+	}
+
+	// the allowance query succeeded, so the token chaincode is initialized and
+	// the balance query only fails if the client has no token account
+	balance, err := queryToken(ctx, tokenChaincode, "BalanceOf", fromAccount)
+	if err != nil {
+		return false, nil
+	}
+
+	return balance.Cmp(big.NewRat(int64(amount), 1)) >= 0, nil
+}
+
+// queryToken is an internal function that invokes a function of a token-erc-20
+// chaincode on the same channel that returns an amount. The token chaincode
+// returns amounts as decimal strings
+func queryToken(ctx contractapi.TransactionContextInterface, tokenChaincode string, function string, params ...string) (*big.Rat, error) {
+
+	args := [][]byte{[]byte(function)}
+	for _, param := range params {
+		args = append(args, []byte(param))
+	}
+
+	response := ctx.GetStub().InvokeChaincode(tokenChaincode, args, "")
+	if response.Status != shim.OK {
+		return nil, fmt.Errorf("failed to query %v of token chaincode %v: %s", function, tokenChaincode, response.Message)
+	}
+
+	amount, ok := new(big.Rat).SetString(string(response.Payload))
+	if !ok {
+		return nil, fmt.Errorf("token chaincode %v returned an invalid amount: %s", tokenChaincode, response.Payload)
+	}
+
+	return amount, nil
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright IBM Corp. All Rights Reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+'use strict';
+
+const { Gateway, Wallets } = require('fabric-network');
+const path = require('path');
+const { buildCCPOrg1, buildCCPOrg2, buildWallet} = require('../../test-application/javascript/AppUtil.js');
+
+const myChannel = 'mychannel';
+const myChaincodeName = 'auction';
+
+async function approveSeller(ccp,wallet,user,auctionID,tokenChaincode,amount) {
+	try {
+
+		const gateway = new Gateway();
+
+		//connect using Discovery enabled
+		await gateway.connect(ccp,
+			{ wallet: wallet, identity: user, discovery: { enabled: true, asLocalhost: true } });
+
+		const network = await gateway.getNetwork(myChannel);
+		const contract = network.getContract(myChaincodeName);
+		const tokenContract = network.getContract(tokenChaincode);
+
+		console.log('\n--> Evaluate Transaction: query the auction to get the seller');
+		let auctionString = await contract.evaluateTransaction('QueryAuction',auctionID);
+		let auctionJSON = JSON.parse(auctionString);
+
+		// the token chaincode identifies accounts by the base64 encoded client ID
+		let spender = Buffer.from(auctionJSON.seller).toString('base64');
+
+		console.log('\n--> Submit Transaction: approve the seller to transfer your tokens');
+		await tokenContract.submitTransaction('Approve',spender,amount);
+		console.log('*** Result: committed');
+
+		console.log('\n--> Evaluate Transaction: query the allowance of the seller');
+		let owner = await tokenContract.evaluateTransaction('ClientAccountID');
+		let result = await tokenContract.evaluateTransaction('Allowance',owner.toString(),spender);
+		console.log('*** Result: Allowance: ' + result.toString());
+
+		gateway.disconnect();
+	} catch (error) {
+		console.error(`******** FAILED to approve seller: ${error}`);
+		process.exit(1);
+	}
+}
+
+async function main() {
+	try {
+
+		if (process.argv[2] === undefined || process.argv[3] === undefined ||
+            process.argv[4] === undefined || process.argv[5] === undefined ||
+            process.argv[6] === undefined) {
+			console.log('Usage: node approveSeller.js org userID auctionID tokenChaincode amount');
+			process.exit(1);
+		}
+
+		const org = process.argv[2];
+		const user = process.argv[3];
+		const auctionID = process.argv[4];
+		const tokenChaincode = process.argv[5];
+		const amount = process.argv[6];
+
+		if (org === 'Org1' || org === 'org1') {
+			const ccp = buildCCPOrg1();
+			const walletPath = path.join(__dirname, 'wallet/org1');
+			const wallet = await buildWallet(Wallets, walletPath);
+			await approveSeller(ccp,wallet,user,auctionID,tokenChaincode,amount);
+		}
+		else if (org === 'Org2' || org === 'org2') {
+			const ccp = buildCCPOrg2();
+			const walletPath = path.join(__dirname, 'wallet/org2');
+			const wallet = await buildWallet(Wallets, walletPath);
+			await approveSeller(ccp,wallet,user,auctionID,tokenChaincode,amount);
+		}  else {
+			console.log('Usage: node approveSeller.js org userID auctionID tokenChaincode amount');
+			console.log('Org must be Org1 or Org2');
+		}
+	} catch (error) {
+		console.error(`******** FAILED to run the application: ${error}`);
+		process.exit(1);
+	}
+}
+
+
+main();
@@ -8,12 +8,13 @@
 
 const { Gateway, Wallets } = require('fabric-network');
 const path = require('path');
+const crypto = require('crypto');
 const { buildCCPOrg1, buildCCPOrg2, buildWallet, prettyJSONString} = require('../../test-application/javascript/AppUtil.js');
 
 const myChannel = 'mychannel';
 const myChaincodeName = 'auction';
 
-async function createAuction(ccp,wallet,user,auctionID,item) {
+async function createAuction(ccp,wallet,user,orgMSP,auctionID,item,priceMode,reserve,biddingDeadline,revealDeadline,tokenChaincode,minIncrement) {
 	try {
 
 		const gateway = new Gateway();
@@ -27,8 +28,18 @@ async function createAuction(ccp,wallet,user,auctionID,item) {
 
 		let statefulTxn = contract.createTransaction('CreateAuction');
 
+		if (reserve !== undefined && reserve !== '') {
+			// the reserve price is stored on the peer of the seller's organization,
+			// the salt keeps other organizations from guessing it from its hash
+			let reserveData = { objectType: 'reserve', price: parseInt(reserve), salt: crypto.randomBytes(16).toString('hex')};
+			statefulTxn.setEndorsingOrganizations(orgMSP);
+			statefulTxn.setTransient({
+				reserve: Buffer.from(JSON.stringify(reserveData))
+			});
+		}
+
 		console.log('\n--> Submit Transaction: Propose a new auction');
-		await statefulTxn.submit(auctionID,item);
+		await statefulTxn.submit(auctionID,item,priceMode,biddingDeadline,revealDeadline,tokenChaincode,minIncrement);
 		console.log('*** Result: committed');
 
 		console.log('\n--> Evaluate Transaction: query the auction that was just created');
@@ -45,8 +56,9 @@ async function main() {
 	try {
 
 		if (process.argv[2] === undefined || process.argv[3] === undefined ||
-            process.argv[4] === undefined || process.argv[5] === undefined) {
-			console.log('Usage: node createAuction.js org userID auctionID item');
+            process.argv[4] === undefined || process.argv[5] === undefined ||
+            process.argv[6] === undefined) {
+			console.log('Usage: node createAuction.js org userID auctionID item priceMode [reserve] [biddingDeadline revealDeadline] [tokenChaincode] [minIncrement]');
 			process.exit(1);
 		}
 
@@ -54,20 +66,26 @@ async function main() {
 		const user = process.argv[3];
 		const auctionID = process.argv[4];
 		const item = process.argv[5];
+		const priceMode = process.argv[6];
+		const reserve = process.argv[7];
+		const biddingDeadline = process.argv[8] || '';
+		const revealDeadline = process.argv[9] || '';
+		const tokenChaincode = process.argv[10] || '';
+		const minIncrement = process.argv[11] || '0';
 
 		if (org === 'Org1' || org === 'org1') {
 			const ccp = buildCCPOrg1();
 			const walletPath = path.join(__dirname, 'wallet/org1');
 			const wallet = await buildWallet(Wallets, walletPath);
-			await createAuction(ccp,wallet,user,auctionID,item);
+			await createAuction(ccp,wallet,user,'Org1MSP',auctionID,item,priceMode,reserve,biddingDeadline,revealDeadline,tokenChaincode,minIncrement);
 		}
 		else if (org === 'Org2' || org === 'org2') {
 			const ccp = buildCCPOrg2();
 			const walletPath = path.join(__dirname, 'wallet/org2');
 			const wallet = await buildWallet(Wallets, walletPath);
-			await createAuction(ccp,wallet,user,auctionID,item);
+			await createAuction(ccp,wallet,user,'Org2MSP',auctionID,item,priceMode,reserve,biddingDeadline,revealDeadline,tokenChaincode,minIncrement);
 		}  else {
-			console.log('Usage: node createAuction.js org userID auctionID item');
+			console.log('Usage: node createAuction.js org userID auctionID item priceMode [reserve] [biddingDeadline revealDeadline] [tokenChaincode] [minIncrement]');
 			console.log('Org must be Org1 or Org2');
 		}
 	} catch (error) {
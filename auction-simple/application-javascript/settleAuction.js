@@ -0,0 +1,86 @@
+/*
+ * Copyright IBM Corp. All Rights Reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+'use strict';
+
+const { Gateway, Wallets } = require('fabric-network');
+const path = require('path');
+const { buildCCPOrg1, buildCCPOrg2, buildWallet, prettyJSONString} = require('../../test-application/javascript/AppUtil.js');
+
+const myChannel = 'mychannel';
+const myChaincodeName = 'auction';
+
+async function settleAuction(ccp,wallet,user,auctionID) {
+	try {
+
+		const gateway = new Gateway();
+
+		//connect using Discovery enabled
+		await gateway.connect(ccp,
+			{ wallet: wallet, identity: user, discovery: { enabled: true, asLocalhost: true } });
+
+		const network = await gateway.getNetwork(myChannel);
+		const contract = network.getContract(myChaincodeName);
+
+		// the transfer of tokens needs to meet the endorsement policy of the token
+		// chaincode, which requires both organizations
+		let statefulTxn = contract.createTransaction('SettleAuction');
+		statefulTxn.setEndorsingOrganizations('Org1MSP','Org2MSP');
+
+		console.log('\n--> Submit the transaction to settle the auction');
+		await statefulTxn.submit(auctionID);
+		console.log('*** Result: committed');
+
+		console.log('\n--> Evaluate Transaction: query the updated auction');
+		let result = await contract.evaluateTransaction('QueryAuction',auctionID);
+		console.log('*** Result: Auction: ' + prettyJSONString(result.toString()));
+
+		gateway.disconnect();
+	} catch (error) {
+		console.error(`******** FAILED to settle auction: ${error}`);
+		process.exit(1);
+	}
+}
+
+async function main() {
+	try {
+
+		if (process.argv[2] === undefined || process.argv[3] === undefined ||
+            process.argv[4] === undefined) {
+			console.log('Usage: node settleAuction.js org userID auctionID');
+			process.exit(1);
+		}
+
+		const org = process.argv[2];
+		const user = process.argv[3];
+		const auctionID = process.argv[4];
+
+		if (org === 'Org1' || org === 'org1') {
+			const ccp = buildCCPOrg1();
+			const walletPath = path.join(__dirname, 'wallet/org1');
+			const wallet = await buildWallet(Wallets, walletPath);
+			await settleAuction(ccp,wallet,user,auctionID);
+		}
+		else if (org === 'Org2' || org === 'org2') {
+			const ccp = buildCCPOrg2();
+			const walletPath = path.join(__dirname, 'wallet/org2');
+			const wallet = await buildWallet(Wallets, walletPath);
+			await settleAuction(ccp,wallet,user,auctionID);
+		}  else {
+			console.log('Usage: node settleAuction.js org userID auctionID');
+			console.log('Org must be Org1 or Org2');
+		}
+	} catch (error) {
+		console.error(`******** FAILED to run the application: ${error}`);
+		if (error.stack) {
+			console.error(error.stack);
+		}
+		process.exit(1);
+	}
+}
+
+
+main();
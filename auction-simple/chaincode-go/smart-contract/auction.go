@@ -9,7 +9,9 @@ import (
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"sort"
 
+	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
@@ -19,15 +21,25 @@ type SmartContract struct {
 
 // Auction data
 type Auction struct {
-	Type         string             `json:"objectType"`
-	ItemSold     string             `json:"item"`
-	Seller       string             `json:"seller"`
-	Orgs         []string           `json:"organizations"`
-	PrivateBids  map[string]BidHash `json:"privateBids"`
-	RevealedBids map[string]FullBid `json:"revealedBids"`
-	Winner       string             `json:"winner"`
-	Price        int                `json:"price"`
-	Status       string             `json:"status"`
+	Type            string             `json:"objectType"`
+	ItemSold        string             `json:"item"`
+	Seller          string             `json:"seller"`
+	Orgs            []string           `json:"organizations"`
+	SecondPrice     bool               `json:"secondPrice"`
+	MinIncrement    int                `json:"minIncrement"`
+	BiddingDeadline string             `json:"biddingDeadline"`
+	RevealDeadline  string             `json:"revealDeadline"`
+	TokenChaincode  string             `json:"tokenChaincode"`
+	PrivateBids     map[string]BidHash `json:"privateBids"`
+	RevealedBids    map[string]FullBid `json:"revealedBids"`
+	ReserveHash     string             `json:"reserveHash"`
+	Reserve         int                `json:"reserve"`
+	ReserveRevealed bool               `json:"reserveRevealed"`
+	Winner          string             `json:"winner"`
+	Price           int                `json:"price"`
+	Status          string             `json:"status"`
+	Disqualified    []string           `json:"disqualified,omitempty" metadata:"disqualified,optional"`
+	Paid            bool               `json:"paid,omitempty" metadata:"paid,optional"`
 }
 
 // FullBid is the structure of a revealed bid
@@ -44,11 +56,31 @@ type BidHash struct {
 	Hash string `json:"hash"`
 }
 
+// Reserve is the structure of the reserve price. The salt prevents other
+// organizations from guessing the price from the hash on the public ledger
+type Reserve struct {
+	Type  string `json:"objectType"`
+	Price int    `json:"price"`
+	Salt  string `json:"salt"`
+}
+
 const bidKeyType = "bid"
+const reserveKeyType = "reserve"
 
 // CreateAuction creates on auction on the public channel. The identity that
-// submits the transacion becomes the seller of the auction
-func (s *SmartContract) CreateAuction(ctx contractapi.TransactionContextInterface, auctionID string, itemsold string) error {
+// submits the transacion becomes the seller of the auction. The seller can
+// pass a reserve price in the transient map, the reserve is stored in the
+// implicit collection of the seller's organization and only its hash is
+// added to the auction. The price mode is either firstPrice, in which the
+// winner pays their bid, or secondPrice, in which the winner pays the second
+// highest bid. The bidding and reveal deadlines are RFC 3339 times, after which
+// anyone can close or end the auction. An empty deadline leaves closing or
+// ending the auction to the seller. If a token chaincode is given, the winner
+// pays the seller with tokens of that chaincode when the auction ends. Bids
+// are placed in steps of the minimum bid increment, and the winner of a
+// second-price auction pays one increment above the second highest bid. A
+// minimum increment of 0 accepts any price
+func (s *SmartContract) CreateAuction(ctx contractapi.TransactionContextInterface, auctionID string, itemsold string, priceMode string, biddingDeadline string, revealDeadline string, tokenChaincode string, minIncrement int) error {
 
 	// get ID of submitting client
 	clientID, err := s.GetSubmittingClientIdentity(ctx)
@@ -62,20 +94,66 @@ func (s *SmartContract) CreateAuction(ctx contractapi.TransactionContextInterfac
 		return fmt.Errorf("failed to get client identity %v", err)
 	}
 
+	secondPrice := false
+
+	switch priceMode {
+	case "firstPrice":
+	case "secondPrice":
+		secondPrice = true
+	default:
+		return fmt.Errorf("price mode must be firstPrice or secondPrice: %v", priceMode)
+	}
+
+	if minIncrement < 0 {
+		return fmt.Errorf("minimum bid increment cannot be negative")
+	}
+
+	// check the deadlines against the transaction timestamp
+	biddingDeadline, err = parseDeadline(ctx, biddingDeadline)
+	if err != nil {
+		return fmt.Errorf("invalid bidding deadline: %v", err)
+	}
+	revealDeadline, err = parseDeadline(ctx, revealDeadline)
+	if err != nil {
+		return fmt.Errorf("invalid reveal deadline: %v", err)
+	}
+	if biddingDeadline != "" && revealDeadline != "" && revealDeadline <= biddingDeadline {
+		return fmt.Errorf("reveal deadline must be after the bidding deadline")
+	}
+
 	// Create auction
 	bidders := make(map[string]BidHash)
 	revealedBids := make(map[string]FullBid)
 
 	auction := Auction{
-		Type:         "auction",
-		ItemSold:     itemsold,
-		Price:        0,
-		Seller:       clientID,
-		Orgs:         []string{clientOrgID},
-		PrivateBids:  bidders,
-		RevealedBids: revealedBids,
-		Winner:       "",
-		Status:       "open",
+		Type:            "auction",
+		ItemSold:        itemsold,
+		Price:           0,
+		Seller:          clientID,
+		Orgs:            []string{clientOrgID},
+		SecondPrice:     secondPrice,
+		MinIncrement:    minIncrement,
+		BiddingDeadline: biddingDeadline,
+		RevealDeadline:  revealDeadline,
+		TokenChaincode:  tokenChaincode,
+		PrivateBids:     bidders,
+		RevealedBids:    revealedBids,
+		Winner:          "",
+		Status:          "open",
+	}
+
+	// get the reserve price from the transient map
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("error getting transient: %v", err)
+	}
+
+	if reserveJSON, ok := transientMap["reserve"]; ok {
+		reserveHash, err := putReserve(ctx, auctionID, reserveJSON)
+		if err != nil {
+			return err
+		}
+		auction.ReserveHash = reserveHash
 	}
 
 	auctionJSON, err := json.Marshal(auction)
@@ -168,6 +246,16 @@ func (s *SmartContract) SubmitBid(ctx contractapi.TransactionContextInterface, a
 		return fmt.Errorf("cannot join closed or ended auction")
 	}
 
+	// bids cannot be added after the bidding deadline, even if the auction
+	// has not been closed yet
+	passed, err := deadlinePassed(ctx, auction.BiddingDeadline)
+	if err != nil {
+		return err
+	}
+	if passed {
+		return fmt.Errorf("cannot join auction after the bidding deadline %v", auction.BiddingDeadline)
+	}
+
 	// get the inplicit collection name of bidder's org
 	collection, err := getCollectionName(ctx)
 	if err != nil {
@@ -222,6 +310,136 @@ func (s *SmartContract) SubmitBid(ctx contractapi.TransactionContextInterface, a
 	return nil
 }
 
+// WithdrawBid is used by a bidder to remove their bid from an open auction. The
+// hash of the bid is removed from the auction and the bid is deleted from the
+// private data collection of the bidder's organization
+func (s *SmartContract) WithdrawBid(ctx contractapi.TransactionContextInterface, auctionID string, txID string) error {
+
+	// get the auction from public state
+	auction, err := s.QueryAuction(ctx, auctionID)
+	if err != nil {
+		return fmt.Errorf("failed to get auction from public state %v", err)
+	}
+
+	err = checkAuctionOpen(ctx, auction)
+	if err != nil {
+		return fmt.Errorf("cannot withdraw bid: %v", err)
+	}
+
+	bidKey, err := ctx.GetStub().CreateCompositeKey(bidKeyType, []string{auctionID, txID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	// only the bidder can withdraw their bid
+	err = s.verifyBidOwner(ctx, auction, bidKey)
+	if err != nil {
+		return err
+	}
+
+	collection, err := getCollectionName(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get implicit collection name: %v", err)
+	}
+
+	err = ctx.GetStub().DelPrivateData(collection, bidKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete bid from collection: %v", err)
+	}
+
+	// the bidder's organization remains an endorser of the auction
+	delete(auction.PrivateBids, bidKey)
+
+	newAuctionJSON, _ := json.Marshal(auction)
+
+	err = ctx.GetStub().PutState(auctionID, newAuctionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update auction: %v", err)
+	}
+
+	return nil
+}
+
+// AmendBid is used by a bidder to replace their bid in an open auction with a
+// new bid. The new bid needs to be created first using Bid. The hash of the new
+// bid replaces the hash of the old bid in the auction, and the old bid is deleted
+// from the private data collection of the bidder's organization
+func (s *SmartContract) AmendBid(ctx contractapi.TransactionContextInterface, auctionID string, txID string, newTxID string) error {
+
+	// get the auction from public state
+	auction, err := s.QueryAuction(ctx, auctionID)
+	if err != nil {
+		return fmt.Errorf("failed to get auction from public state %v", err)
+	}
+
+	err = checkAuctionOpen(ctx, auction)
+	if err != nil {
+		return fmt.Errorf("cannot amend bid: %v", err)
+	}
+
+	bidKey, err := ctx.GetStub().CreateCompositeKey(bidKeyType, []string{auctionID, txID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	// only the bidder can amend their bid
+	err = s.verifyBidOwner(ctx, auction, bidKey)
+	if err != nil {
+		return err
+	}
+
+	newBidKey, err := ctx.GetStub().CreateCompositeKey(bidKeyType, []string{auctionID, newTxID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	if _, bidInAuction := auction.PrivateBids[newBidKey]; bidInAuction {
+		return fmt.Errorf("bid %v has already been added to the auction", newBidKey)
+	}
+
+	collection, err := getCollectionName(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get implicit collection name: %v", err)
+	}
+
+	// get the hash of the new bid stored in private data collection
+	newBidHash, err := ctx.GetStub().GetPrivateDataHash(collection, newBidKey)
+	if err != nil {
+		return fmt.Errorf("failed to read bid bash from collection: %v", err)
+	}
+	if newBidHash == nil {
+		return fmt.Errorf("bid hash does not exist: %s", newBidKey)
+	}
+
+	// replace the hash of the old bid with the hash of the new bid
+	newHash := BidHash{
+		Org:  auction.PrivateBids[bidKey].Org,
+		Hash: fmt.Sprintf("%x", newBidHash),
+	}
+	delete(auction.PrivateBids, bidKey)
+	auction.PrivateBids[newBidKey] = newHash
+
+	// the new bid also needs to belong to the bidder
+	err = s.verifyBidOwner(ctx, auction, newBidKey)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().DelPrivateData(collection, bidKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete bid from collection: %v", err)
+	}
+
+	newAuctionJSON, _ := json.Marshal(auction)
+
+	err = ctx.GetStub().PutState(auctionID, newAuctionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update auction: %v", err)
+	}
+
+	return nil
+}
+
 // RevealBid is used by a bidder to reveal their bid after the auction is closed
 func (s *SmartContract) RevealBid(ctx contractapi.TransactionContextInterface, auctionID string, txID string) error {
 
@@ -272,6 +490,21 @@ func (s *SmartContract) RevealBid(ctx contractapi.TransactionContextInterface, a
 		return fmt.Errorf("cannot reveal bid for open or ended auction")
 	}
 
+	// the seller commits to the reserve price before any bid is revealed, so
+	// that the seller cannot cancel the sale after seeing the bids by keeping
+	// the reserve price hidden
+	if auction.ReserveHash != "" && !auction.ReserveRevealed {
+		return fmt.Errorf("cannot reveal bid before the seller has revealed the reserve price")
+	}
+
+	passed, err := deadlinePassed(ctx, auction.RevealDeadline)
+	if err != nil {
+		return err
+	}
+	if passed {
+		return fmt.Errorf("cannot reveal bid after the reveal deadline %v", auction.RevealDeadline)
+	}
+
 	// check 2: check that hash of revealed bid matches hash of private bid
 	// on the public ledger. This checks that the bidder is telling the truth
 	// about the value of their bid
@@ -338,6 +571,12 @@ func (s *SmartContract) RevealBid(ctx contractapi.TransactionContextInterface, a
 		return fmt.Errorf("Permission denied, client id %v is not the owner of the bid", clientID)
 	}
 
+	// check 5: make sure that the price is a multiple of the minimum bid
+	// increment, so that different bids differ by at least the increment
+	if auction.MinIncrement > 0 && bidInput.Price%auction.MinIncrement != 0 {
+		return fmt.Errorf("bid price %d is not a multiple of the minimum bid increment %d", bidInput.Price, auction.MinIncrement)
+	}
+
 	revealedBids := make(map[string]FullBid)
 	revealedBids = auction.RevealedBids
 	revealedBids[bidKey] = NewBid
@@ -355,7 +594,8 @@ func (s *SmartContract) RevealBid(ctx contractapi.TransactionContextInterface, a
 }
 
 // CloseAuction can be used by the seller to close the auction. This prevents
-// bids from being added to the auction, and allows users to reveal their bid
+// bids from being added to the auction, and allows users to reveal their bid.
+// After the bidding deadline, the auction can be closed by anyone
 func (s *SmartContract) CloseAuction(ctx contractapi.TransactionContextInterface, auctionID string) error {
 
 	// get auction from public state
@@ -364,7 +604,7 @@ func (s *SmartContract) CloseAuction(ctx contractapi.TransactionContextInterface
 		return fmt.Errorf("failed to get auction from public state %v", err)
 	}
 
-	// the auction can only be closed by the seller
+	// the auction can only be closed by the seller before the bidding deadline
 
 	// get ID of submitting client
 	clientID, err := s.GetSubmittingClientIdentity(ctx)
@@ -372,9 +612,14 @@ func (s *SmartContract) CloseAuction(ctx contractapi.TransactionContextInterface
 		return fmt.Errorf("failed to get client identity %v", err)
 	}
 
+	passed, err := deadlinePassed(ctx, auction.BiddingDeadline)
+	if err != nil {
+		return err
+	}
+
 	Seller := auction.Seller
-	if Seller != clientID {
-		return fmt.Errorf("auction can only be closed by seller: %v", err)
+	if Seller != clientID && !passed {
+		return fmt.Errorf("auction can only be closed by seller before the bidding deadline")
 	}
 
 	Status := auction.Status
@@ -394,17 +639,157 @@ func (s *SmartContract) CloseAuction(ctx contractapi.TransactionContextInterface
 	return nil
 }
 
+// RevealReserve is used by the seller to add the reserve price to a closed
+// auction. The reserve price is passed in the transient map and needs to match
+// the hash stored in the auction. Bids can only be revealed after the reserve
+// price, and the reserve price can only be revealed before the reveal deadline
+func (s *SmartContract) RevealReserve(ctx contractapi.TransactionContextInterface, auctionID string) error {
+
+	// get auction from public state
+	auction, err := s.QueryAuction(ctx, auctionID)
+	if err != nil {
+		return fmt.Errorf("failed to get auction from public state %v", err)
+	}
+
+	// get ID of submitting client
+	clientID, err := s.GetSubmittingClientIdentity(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	if auction.Seller != clientID {
+		return fmt.Errorf("reserve price can only be revealed by seller")
+	}
+
+	if auction.ReserveHash == "" {
+		return fmt.Errorf("auction does not have a reserve price")
+	}
+	if auction.ReserveRevealed {
+		return fmt.Errorf("reserve price has already been revealed")
+	}
+
+	// the reserve price is revealed after bidding has finished, and before the
+	// bids are revealed
+	if auction.Status != "closed" {
+		return fmt.Errorf("cannot reveal reserve price of an auction that is not closed")
+	}
+
+	passed, err := deadlinePassed(ctx, auction.RevealDeadline)
+	if err != nil {
+		return err
+	}
+	if passed {
+		return fmt.Errorf("cannot reveal reserve price after the reveal deadline %v", auction.RevealDeadline)
+	}
+
+	reserve, err := revealReserve(ctx, auction.ReserveHash)
+	if err != nil {
+		return fmt.Errorf("failed to reveal reserve price: %v", err)
+	}
+
+	auction.Reserve = reserve
+	auction.ReserveRevealed = true
+
+	newAuctionJSON, _ := json.Marshal(auction)
+
+	err = ctx.GetStub().PutState(auctionID, newAuctionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update auction: %v", err)
+	}
+
+	return nil
+}
+
 // EndAuction both changes the auction status to closed and calculates the winners
-// of the auction
+// of the auction. If the auction has a reserve price, the seller needs to reveal
+// it with RevealReserve before the bids can be revealed. An auction that ends
+// below the reserve price ends as unsold, without a winner. After the reveal
+// deadline, the auction can be ended by anyone, and bids that have not been
+// revealed are ignored. The highest bid wins the auction. If several bids have
+// the highest price, the bid with the lowest bid key wins. The bid key contains
+// the transaction ID of the bid, so the winner among tied bids is arbitrary, but
+// the same on every peer. If the auction was created with a token chaincode and is
+// ended by the seller or the winner, the seller is paid in the same transaction,
+// see settleAuction
 func (s *SmartContract) EndAuction(ctx contractapi.TransactionContextInterface, auctionID string) error {
 
+	auction, passed, err := s.calculateAuctionResult(ctx, auctionID)
+	if err != nil {
+		return err
+	}
+
+	if auction.TokenChaincode != "" {
+		err = s.settleAuction(ctx, auction, passed)
+		if err != nil {
+			return err
+		}
+	}
+
+	endedAuctionJSON, _ := json.Marshal(auction)
+
+	err = ctx.GetStub().PutState(auctionID, endedAuctionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to end auction: %v", err)
+	}
+	return nil
+}
+
+// SettleAuction is used by the seller or the winner to pay the seller of an
+// auction that was ended by someone else after the reveal deadline. The payment
+// is made in the same way as by EndAuction, so a winner who can no longer pay
+// is disqualified, and the auction goes to the next highest bid
+func (s *SmartContract) SettleAuction(ctx contractapi.TransactionContextInterface, auctionID string) error {
+
 	// get auction from public state
 	auction, err := s.QueryAuction(ctx, auctionID)
 	if err != nil {
 		return fmt.Errorf("failed to get auction from public state %v", err)
 	}
 
-	// Check that the auction is being ended by the seller
+	if auction.TokenChaincode == "" || auction.Status != "ended" || auction.Paid {
+		return fmt.Errorf("auction does not have a payment to settle")
+	}
+
+	// get ID of submitting client
+	clientID, err := s.GetSubmittingClientIdentity(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	if clientID != auction.Seller && clientID != auction.Winner {
+		return fmt.Errorf("auction can only be settled by seller or winner")
+	}
+
+	// the auction was ended after the reveal deadline
+	err = s.settleAuction(ctx, auction, true)
+	if err != nil {
+		return err
+	}
+
+	settledAuctionJSON, _ := json.Marshal(auction)
+
+	err = ctx.GetStub().PutState(auctionID, settledAuctionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to settle auction: %v", err)
+	}
+	return nil
+}
+
+// settleAuction is an internal function that pays the seller of an auction that
+// was created with a token chaincode, by invoking a token-erc-20 chaincode on the
+// same channel. The token chaincode uses the submitting client as the sender of
+// the tokens, so the payment depends on who ends the auction:
+// The winner pays the price from their own account with Transfer.
+// The seller transfers the price from the account of the winner with TransferFrom,
+// using the allowance that the winner approved for the seller when they placed
+// their bid. A winner who does not have the allowance or the balance to pay is
+// disqualified, and the auction goes to the next highest bid.
+// Anyone else can only end the auction after the reveal deadline. Because they
+// cannot use the allowance of the winner, the auction ends with the winner who
+// can pay, and the payment is left to the seller or the winner, see SettleAuction.
+// Any other failure of the token chaincode, for example a paused contract or a
+// frozen account, fails the transaction and the auction does not end
+func (s *SmartContract) settleAuction(ctx contractapi.TransactionContextInterface, auction *Auction, passed bool) error {
 
 	// get ID of submitting client
 	clientID, err := s.GetSubmittingClientIdentity(ctx)
@@ -412,43 +797,327 @@ func (s *SmartContract) EndAuction(ctx contractapi.TransactionContextInterface,
 		return fmt.Errorf("failed to get client identity %v", err)
 	}
 
+	// an unsold auction has nothing to settle
+	for auction.Status == "ended" {
+		if clientID == auction.Winner {
+			err = transfer(ctx, auction.TokenChaincode, auction.Seller, auction.Price)
+			if err != nil {
+				return fmt.Errorf("failed to settle auction: %v", err)
+			}
+			auction.Paid = true
+			return nil
+		}
+
+		paying, err := canPay(ctx, auction.TokenChaincode, auction.Winner, auction.Seller, auction.Price)
+		if err != nil {
+			return fmt.Errorf("failed to settle auction: %v", err)
+		}
+		if !paying {
+			auction.Disqualified = append(auction.Disqualified, auction.Winner)
+			err = calculateWinner(ctx, auction, passed)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		// only the seller can use the allowance of the winner
+		if clientID != auction.Seller {
+			return nil
+		}
+
+		err = transferFrom(ctx, auction.TokenChaincode, auction.Winner, auction.Seller, auction.Price)
+		if err != nil {
+			return fmt.Errorf("failed to settle auction: %v", err)
+		}
+		auction.Paid = true
+		return nil
+	}
+
+	return nil
+}
+
+// calculateAuctionResult is an internal function that checks that the auction
+// can be ended by the submitting client, and returns the auction updated with
+// the winner and the price, and whether the reveal deadline has passed
+func (s *SmartContract) calculateAuctionResult(ctx contractapi.TransactionContextInterface, auctionID string) (*Auction, bool, error) {
+
+	// get auction from public state
+	auction, err := s.QueryAuction(ctx, auctionID)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get auction from public state %v", err)
+	}
+
+	// Check that the auction is being ended by the seller, or that the
+	// reveal deadline has passed. The winner of an auction that is settled
+	// with tokens can also end the auction by paying the seller
+
+	// get ID of submitting client
+	clientID, err := s.GetSubmittingClientIdentity(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	passed, err := deadlinePassed(ctx, auction.RevealDeadline)
+	if err != nil {
+		return nil, false, err
+	}
+
 	Seller := auction.Seller
-	if Seller != clientID {
-		return fmt.Errorf("auction can only be ended by seller: %v", err)
+	if Seller != clientID && !passed && auction.TokenChaincode == "" {
+		return nil, false, fmt.Errorf("auction can only be ended by seller before the reveal deadline")
 	}
 
 	Status := auction.Status
 	if Status != "closed" {
-		return fmt.Errorf("Can only end a closed auction")
+		return nil, false, fmt.Errorf("Can only end a closed auction")
 	}
 
+	// a reserve price that the seller has not revealed by the reveal deadline
+	// is never met
+	reserveRevealed := auction.ReserveHash == "" || auction.ReserveRevealed
+	if !reserveRevealed && !passed {
+		return nil, false, fmt.Errorf("The reserve price has not been revealed, cannot end auction")
+	}
+
+	if len(auction.RevealedBids) == 0 && !passed {
+		return nil, false, fmt.Errorf("No bids have been revealed, cannot end auction")
+	}
+
+	err = calculateWinner(ctx, auction, passed)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if Seller != clientID && !passed && auction.Winner != clientID {
+		return nil, false, fmt.Errorf("auction can only be ended by seller or winner before the reveal deadline")
+	}
+
+	return auction, passed, nil
+}
+
+// calculateWinner is an internal function that updates the auction with the
+// winner and the price from the revealed bids. The bids of disqualified
+// bidders are ignored
+func calculateWinner(ctx contractapi.TransactionContextInterface, auction *Auction, passed bool) error {
+
+	reserve := auction.Reserve
+	reserveRevealed := auction.ReserveHash == "" || auction.ReserveRevealed
+
 	// get the list of revealed bids
 	revealedBidMap := auction.RevealedBids
-	if len(auction.RevealedBids) == 0 {
-		return fmt.Errorf("No bids have been revealed, cannot end auction: %v", err)
+
+	// sort the revealed bids by price. Bids with the same price are sorted by
+	// their bid key, so that every endorsing peer picks the same winner
+	bidKeys := make([]string, 0, len(revealedBidMap))
+	for bidKey, bid := range revealedBidMap {
+		if !contains(auction.Disqualified, bid.Bidder) {
+			bidKeys = append(bidKeys, bidKey)
+		}
+	}
+
+	sort.Slice(bidKeys, func(p, q int) bool {
+		if revealedBidMap[bidKeys[p]].Price != revealedBidMap[bidKeys[q]].Price {
+			return revealedBidMap[bidKeys[p]].Price > revealedBidMap[bidKeys[q]].Price
+		}
+		return bidKeys[p] < bidKeys[q]
+	})
+
+	highestPrice := 0
+	if len(bidKeys) > 0 {
+		highestPrice = revealedBidMap[bidKeys[0]].Price
 	}
 
-	// determine the highest bid
-	for _, bid := range revealedBidMap {
-		if bid.Price > auction.Price {
-			auction.Winner = bid.Bidder
-			auction.Price = bid.Price
+	// the winner pays the price of their bid. In a second-price auction, the
+	// winner pays the second highest price plus the minimum bid increment, but
+	// not more than their bid and not less than the reserve price. If there is
+	// neither a second bid nor a reserve price, the winner pays the price of
+	// their bid
+	price := highestPrice
+	minPrice := highestPrice
+	if auction.SecondPrice {
+		minPrice = reserve
+		secondPrice := reserve
+		if len(bidKeys) > 1 && revealedBidMap[bidKeys[1]].Price > minPrice {
+			minPrice = revealedBidMap[bidKeys[1]].Price
+			secondPrice = highestPrice
+			if auction.MinIncrement < highestPrice-minPrice {
+				secondPrice = minPrice + auction.MinIncrement
+			}
+		}
+		if len(bidKeys) > 1 || auction.ReserveHash != "" {
+			price = secondPrice
 		}
 	}
 
-	// check if there is a winning bid that has yet to be revealed
-	err = checkForHigherBid(ctx, auction.Price, auction.RevealedBids, auction.PrivateBids)
+	// check if there is a bid that has yet to be revealed that would change
+	// the winner or the price. Bids that have not been revealed by the reveal
+	// deadline are ignored
+	if !passed {
+		err := checkForHigherBid(ctx, minPrice, auction.RevealedBids, auction.PrivateBids)
+		if err != nil {
+			return fmt.Errorf("Cannot end auction: %v", err)
+		}
+	}
+
+	// the item is not sold if there is no winning bid, or if the highest bid
+	// is below the reserve price
+	if len(bidKeys) == 0 || !reserveRevealed || highestPrice < reserve {
+		auction.Winner = ""
+		auction.Price = 0
+		auction.Status = string("unsold")
+	} else {
+		auction.Winner = revealedBidMap[bidKeys[0]].Bidder
+		auction.Price = price
+		auction.Status = string("ended")
+	}
+
+	return nil
+}
+
+// putReserve is an internal function that stores the reserve price in the
+// implicit collection of the seller's organization and returns its hash
+func putReserve(ctx contractapi.TransactionContextInterface, auctionID string, reserveJSON []byte) (string, error) {
+
+	var reserve Reserve
+	err := json.Unmarshal(reserveJSON, &reserve)
 	if err != nil {
-		return fmt.Errorf("Cannot end auction: %v", err)
+		return "", fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+	if reserve.Price < 0 {
+		return "", fmt.Errorf("reserve price cannot be negative")
 	}
 
-	auction.Status = string("ended")
+	// the seller has to target their peer to store the reserve price
+	err = verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return "", fmt.Errorf("Cannot store reserve price on this peer, not a member of this org: Error %v", err)
+	}
 
-	endedAuctionJSON, _ := json.Marshal(auction)
+	collection, err := getCollectionName(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get implicit collection name: %v", err)
+	}
 
-	err = ctx.GetStub().PutState(auctionID, endedAuctionJSON)
+	reserveKey, err := ctx.GetStub().CreateCompositeKey(reserveKeyType, []string{auctionID})
 	if err != nil {
-		return fmt.Errorf("failed to end auction: %v", err)
+		return "", fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	err = ctx.GetStub().PutPrivateData(collection, reserveKey, reserveJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to input reserve price into collection: %v", err)
+	}
+
+	// the hash is the same as the private data hash of the collection
+	hash := sha256.Sum256(reserveJSON)
+
+	return fmt.Sprintf("%x", hash), nil
+}
+
+// revealReserve is an internal function that reads the reserve price from the
+// transient map and checks that it matches the hash stored in the auction
+func revealReserve(ctx contractapi.TransactionContextInterface, reserveHash string) (int, error) {
+
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return 0, fmt.Errorf("error getting transient: %v", err)
+	}
+
+	transientReserveJSON, ok := transientMap["reserve"]
+	if !ok {
+		return 0, fmt.Errorf("reserve key not found in the transient map")
+	}
+
+	calculatedReserveHash := fmt.Sprintf("%x", sha256.Sum256(transientReserveJSON))
+	if calculatedReserveHash != reserveHash {
+		return 0, fmt.Errorf("hash %s for reserve JSON %s does not match hash in auction: %s",
+			calculatedReserveHash,
+			transientReserveJSON,
+			reserveHash,
+		)
+	}
+
+	var reserve Reserve
+	err = json.Unmarshal(transientReserveJSON, &reserve)
+	if err != nil {
+		return 0, fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+
+	return reserve.Price, nil
+}
+
+// checkAuctionOpen is an internal function that checks that bids can still be
+// added to or removed from the auction
+func checkAuctionOpen(ctx contractapi.TransactionContextInterface, auction *Auction) error {
+
+	if auction.Status != "open" {
+		return fmt.Errorf("auction is not open")
+	}
+
+	passed, err := deadlinePassed(ctx, auction.BiddingDeadline)
+	if err != nil {
+		return err
+	}
+	if passed {
+		return fmt.Errorf("the bidding deadline %v has passed", auction.BiddingDeadline)
+	}
+
+	return nil
+}
+
+// verifyBidOwner is an internal function that checks that a bid in the auction
+// belongs to the submitting client. Only the peers of the bidder's organization
+// can read the bid and check the bidder. Because the bidder's organization is
+// an endorser of the auction, the peers of other organizations only check that
+// the client belongs to the organization of the bid
+func (s *SmartContract) verifyBidOwner(ctx contractapi.TransactionContextInterface, auction *Auction, bidKey string) error {
+
+	bidHash, bidInAuction := auction.PrivateBids[bidKey]
+	if !bidInAuction {
+		return fmt.Errorf("bid %v has not been added to the auction", bidKey)
 	}
+
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+
+	if bidHash.Org != clientOrgID {
+		return fmt.Errorf("Permission denied, client from org %v is not the owner of the bid", clientOrgID)
+	}
+
+	peerMSPID, err := shim.GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed getting the peer's MSPID: %v", err)
+	}
+
+	if peerMSPID != clientOrgID {
+		return nil
+	}
+
+	clientID, err := s.GetSubmittingClientIdentity(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	bidJSON, err := ctx.GetStub().GetPrivateData("_implicit_org_"+clientOrgID, bidKey)
+	if err != nil {
+		return fmt.Errorf("failed to get bid %v: %v", bidKey, err)
+	}
+	if bidJSON == nil {
+		return fmt.Errorf("bid %v does not exist", bidKey)
+	}
+
+	var bid *FullBid
+	err = json.Unmarshal(bidJSON, &bid)
+	if err != nil {
+		return err
+	}
+
+	if bid.Bidder != clientID {
+		return fmt.Errorf("Permission denied, client id %v is not the owner of the bid", clientID)
+	}
+
 	return nil
 }
@@ -77,6 +77,57 @@ func (s *SmartContract) QueryBid(ctx contractapi.TransactionContextInterface, au
 	return bid, nil
 }
 
+// QueryReserve allows the seller to read the reserve price of their auction from
+// the implicit collection of their organization
+func (s *SmartContract) QueryReserve(ctx contractapi.TransactionContextInterface, auctionID string) (*Reserve, error) {
+
+	err := verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get implicit collection name: %v", err)
+	}
+
+	clientID, err := s.GetSubmittingClientIdentity(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	auction, err := s.QueryAuction(ctx, auctionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get auction from public state %v", err)
+	}
+
+	// check that the client querying the reserve price is the seller
+	if auction.Seller != clientID {
+		return nil, fmt.Errorf("Permission denied, client id %v is not the seller of the auction", clientID)
+	}
+
+	collection, err := getCollectionName(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get implicit collection name: %v", err)
+	}
+
+	reserveKey, err := ctx.GetStub().CreateCompositeKey(reserveKeyType, []string{auctionID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	reserveJSON, err := ctx.GetStub().GetPrivateData(collection, reserveKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reserve price %v: %v", reserveKey, err)
+	}
+	if reserveJSON == nil {
+		return nil, fmt.Errorf("reserve price %v does not exist", reserveKey)
+	}
+
+	var reserve *Reserve
+	err = json.Unmarshal(reserveJSON, &reserve)
+	if err != nil {
+		return nil, err
+	}
+
+	return reserve, nil
+}
+
 // checkForHigherBid is an internal function that is used to determine if a winning bid has yet to be revealed
 func checkForHigherBid(ctx contractapi.TransactionContextInterface, auctionPrice int, revealedBidders map[string]FullBid, bidders map[string]BidHash) error {
 
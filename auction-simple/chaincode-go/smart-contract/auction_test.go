@@ -0,0 +1,1085 @@
+package auction
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-samples/auction/chaincode-go/smart-contract/tests/testsfakes"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var _CalculateWinner = []struct {
+	name            string
+	secondPrice     bool
+	minIncrement    int
+	bids            map[string]int
+	reserveHash     string
+	reserve         int
+	reserveRevealed bool
+	disqualified    []string
+	expectedWinner  string
+	expectedPrice   int
+	expectedStatus  string
+}{
+	{
+		name:           "First price",
+		bids:           map[string]int{"bid1": 100, "bid2": 150, "bid3": 120},
+		expectedWinner: "bidder2",
+		expectedPrice:  150,
+		expectedStatus: "ended",
+	},
+	{
+		name:           "Second price",
+		secondPrice:    true,
+		bids:           map[string]int{"bid1": 100, "bid2": 150, "bid3": 120},
+		expectedWinner: "bidder2",
+		expectedPrice:  120,
+		expectedStatus: "ended",
+	},
+	{
+		name:           "Second price with a single bid",
+		secondPrice:    true,
+		bids:           map[string]int{"bid1": 100},
+		expectedWinner: "bidder1",
+		expectedPrice:  100,
+		expectedStatus: "ended",
+	},
+	{
+		name:            "Second price with a single bid and a reserve",
+		secondPrice:     true,
+		bids:            map[string]int{"bid1": 100},
+		reserveHash:     "hash",
+		reserve:         60,
+		reserveRevealed: true,
+		expectedWinner:  "bidder1",
+		expectedPrice:   60,
+		expectedStatus:  "ended",
+	},
+	{
+		name:            "Second price below the reserve",
+		secondPrice:     true,
+		bids:            map[string]int{"bid1": 100, "bid2": 50},
+		reserveHash:     "hash",
+		reserve:         60,
+		reserveRevealed: true,
+		expectedWinner:  "bidder1",
+		expectedPrice:   60,
+		expectedStatus:  "ended",
+	},
+	{
+		name:            "First price with a reserve",
+		bids:            map[string]int{"bid1": 100, "bid2": 50},
+		reserveHash:     "hash",
+		reserve:         60,
+		reserveRevealed: true,
+		expectedWinner:  "bidder1",
+		expectedPrice:   100,
+		expectedStatus:  "ended",
+	},
+	{
+		name:            "Highest bid below the reserve",
+		secondPrice:     true,
+		bids:            map[string]int{"bid1": 100, "bid2": 50},
+		reserveHash:     "hash",
+		reserve:         101,
+		reserveRevealed: true,
+		expectedStatus:  "unsold",
+	},
+	{
+		name:           "Reserve not revealed",
+		bids:           map[string]int{"bid1": 100},
+		reserveHash:    "hash",
+		expectedStatus: "unsold",
+	},
+	{
+		name:           "Second price with an increment",
+		secondPrice:    true,
+		minIncrement:   10,
+		bids:           map[string]int{"bid1": 100, "bid2": 150, "bid3": 120},
+		expectedWinner: "bidder2",
+		expectedPrice:  130,
+		expectedStatus: "ended",
+	},
+	{
+		name:           "Increment capped at the winning bid",
+		secondPrice:    true,
+		minIncrement:   10,
+		bids:           map[string]int{"bid1": 145, "bid2": 150},
+		expectedWinner: "bidder2",
+		expectedPrice:  150,
+		expectedStatus: "ended",
+	},
+	{
+		name:            "Increment with a reserve above the second bid",
+		secondPrice:     true,
+		minIncrement:    10,
+		bids:            map[string]int{"bid1": 100, "bid2": 50},
+		reserveHash:     "hash",
+		reserve:         60,
+		reserveRevealed: true,
+		expectedWinner:  "bidder1",
+		expectedPrice:   60,
+		expectedStatus:  "ended",
+	},
+	{
+		name:           "First price with an increment",
+		minIncrement:   10,
+		bids:           map[string]int{"bid1": 100, "bid2": 150, "bid3": 120},
+		expectedWinner: "bidder2",
+		expectedPrice:  150,
+		expectedStatus: "ended",
+	},
+	{
+		name:           "Tie goes to the lowest bid key",
+		bids:           map[string]int{"bid3": 150, "bid1": 100, "bid2": 150},
+		expectedWinner: "bidder2",
+		expectedPrice:  150,
+		expectedStatus: "ended",
+	},
+	{
+		name:           "Second price tie",
+		secondPrice:    true,
+		bids:           map[string]int{"bid3": 150, "bid1": 100, "bid2": 150},
+		expectedWinner: "bidder2",
+		expectedPrice:  150,
+		expectedStatus: "ended",
+	},
+	{
+		name:           "Highest bidder disqualified",
+		secondPrice:    true,
+		bids:           map[string]int{"bid1": 100, "bid2": 150, "bid3": 120},
+		disqualified:   []string{"bidder2"},
+		expectedWinner: "bidder3",
+		expectedPrice:  100,
+		expectedStatus: "ended",
+	},
+	{
+		name:            "Disqualified down to the reserve",
+		secondPrice:     true,
+		bids:            map[string]int{"bid1": 50, "bid2": 150, "bid3": 120},
+		reserveHash:     "hash",
+		reserve:         60,
+		reserveRevealed: true,
+		disqualified:    []string{"bidder2", "bidder3"},
+		expectedStatus:  "unsold",
+	},
+	{
+		name:           "All bidders disqualified",
+		bids:           map[string]int{"bid1": 100, "bid2": 150},
+		disqualified:   []string{"bidder1", "bidder2"},
+		expectedStatus: "unsold",
+	},
+	{
+		name:           "No bids",
+		bids:           map[string]int{},
+		expectedStatus: "unsold",
+	},
+}
+
+// newAuction creates an ended auction with a revealed bid of bidder<n> for each bid key bid<n>
+func newAuction(secondPrice bool, bids map[string]int) *Auction {
+	revealedBids := map[string]FullBid{}
+	for bidKey, price := range bids {
+		revealedBids[bidKey] = FullBid{
+			Type:   "bid",
+			Price:  price,
+			Org:    "Org1MSP",
+			Bidder: strings.Replace(bidKey, "bid", "bidder", 1),
+		}
+	}
+	return &Auction{
+		Seller:       "seller",
+		SecondPrice:  secondPrice,
+		RevealedBids: revealedBids,
+		Status:       "closed",
+	}
+}
+
+func TestCalculateWinner(t *testing.T) {
+
+	//Prepare fixed data
+	tc := &testsfakes.FakeTestTransactionContextInterface{}
+
+	for _, tt := range _CalculateWinner {
+		t.Run(tt.name, func(t *testing.T) {
+
+			//Prepare dynamic data
+			auction := newAuction(tt.secondPrice, tt.bids)
+			auction.MinIncrement = tt.minIncrement
+			auction.ReserveHash = tt.reserveHash
+			auction.Reserve = tt.reserve
+			auction.ReserveRevealed = tt.reserveRevealed
+			auction.Disqualified = tt.disqualified
+
+			err := calculateWinner(tc, auction, true)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedWinner, auction.Winner)
+			assert.Equal(t, tt.expectedPrice, auction.Price)
+			assert.Equal(t, tt.expectedStatus, auction.Status)
+		})
+	}
+}
+
+func TestCalculateWinnerHigherBid(t *testing.T) {
+
+	//Prepare fixed data
+	stub := &testsfakes.FakeTestChaincodeStubInterface{}
+	tc := &testsfakes.FakeTestTransactionContextInterface{}
+	tc.GetStubStub = func() shim.ChaincodeStubInterface {
+		return stub
+	}
+	os.Setenv("CORE_PEER_LOCALMSPID", "Org1MSP")
+	defer os.Unsetenv("CORE_PEER_LOCALMSPID")
+
+	//Prepare dynamic data
+	auction := newAuction(true, map[string]int{"bid1": 100, "bid2": 150})
+	auction.PrivateBids = map[string]BidHash{
+		"bid1": {Org: "Org1MSP"},
+		"bid2": {Org: "Org1MSP"},
+		"bid3": {Org: "Org1MSP"},
+	}
+	unrevealedBid, _ := json.Marshal(FullBid{Type: "bid", Price: 120, Org: "Org1MSP", Bidder: "bidder3"})
+	stub.GetPrivateDataReturns(unrevealedBid, nil)
+
+	// a bid that would raise the second price has to be revealed before the reveal deadline
+	err := calculateWinner(tc, auction, false)
+	assert.EqualError(t, err, "Cannot end auction: Cannot close auction, bidder has a higher price: <nil>")
+	collection, bidKey := stub.GetPrivateDataArgsForCall(0)
+	assert.Equal(t, "_implicit_org_Org1MSP", collection)
+	assert.Equal(t, "bid3", bidKey)
+
+	// after the reveal deadline the bid is ignored
+	err = calculateWinner(tc, auction, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "bidder2", auction.Winner)
+	assert.Equal(t, 100, auction.Price)
+}
+
+// Allowances (approved for the seller) and balances of the bidders in the token chaincode
+var _SettleAuction = []struct {
+	name                 string
+	client               string
+	allowances           map[string]string
+	balances             map[string]string
+	paused               bool
+	expectedError        string
+	expectedWinner       string
+	expectedPrice        int
+	expectedStatus       string
+	expectedDisqualified []string
+	expectedTransfer     string
+	expectedPaid         bool
+}{
+	{
+		name:             "Seller collects from the winner",
+		client:           "seller",
+		allowances:       map[string]string{"bidder1": "200", "bidder2": "200", "bidder3": "200"},
+		balances:         map[string]string{"bidder1": "200", "bidder2": "200", "bidder3": "200"},
+		expectedWinner:   "bidder2",
+		expectedPrice:    120,
+		expectedStatus:   "ended",
+		expectedTransfer: "TransferFrom bidder2 seller 120",
+		expectedPaid:     true,
+	},
+	{
+		name:             "Winner pays",
+		client:           "bidder2",
+		expectedWinner:   "bidder2",
+		expectedPrice:    120,
+		expectedStatus:   "ended",
+		expectedTransfer: "Transfer seller 120",
+		expectedPaid:     true,
+	},
+	{
+		name:                 "Winner without allowance",
+		client:               "seller",
+		allowances:           map[string]string{"bidder1": "200", "bidder2": "119.99", "bidder3": "200"},
+		balances:             map[string]string{"bidder1": "200", "bidder2": "200", "bidder3": "200"},
+		expectedWinner:       "bidder3",
+		expectedPrice:        100,
+		expectedStatus:       "ended",
+		expectedDisqualified: []string{"bidder2"},
+		expectedTransfer:     "TransferFrom bidder3 seller 100",
+		expectedPaid:         true,
+	},
+	{
+		name:                 "Winners without balance or account",
+		client:               "seller",
+		allowances:           map[string]string{"bidder1": "200", "bidder2": "200", "bidder3": "200"},
+		balances:             map[string]string{"bidder1": "100", "bidder2": "50"},
+		expectedWinner:       "bidder1",
+		expectedPrice:        100,
+		expectedStatus:       "ended",
+		expectedDisqualified: []string{"bidder2", "bidder3"},
+		expectedTransfer:     "TransferFrom bidder1 seller 100",
+		expectedPaid:         true,
+	},
+	{
+		name:                 "Nobody can pay",
+		client:               "anyone",
+		allowances:           map[string]string{"bidder1": "200"},
+		balances:             map[string]string{"bidder2": "200", "bidder3": "200"},
+		expectedStatus:       "unsold",
+		expectedDisqualified: []string{"bidder2", "bidder3", "bidder1"},
+	},
+	{
+		name:           "Third party leaves the payment to the seller",
+		client:         "anyone",
+		allowances:     map[string]string{"bidder1": "200", "bidder2": "200", "bidder3": "200"},
+		balances:       map[string]string{"bidder1": "200", "bidder2": "200", "bidder3": "200"},
+		expectedWinner: "bidder2",
+		expectedPrice:  120,
+		expectedStatus: "ended",
+	},
+	{
+		name:          "Token chaincode paused",
+		client:        "seller",
+		paused:        true,
+		expectedError: "failed to settle auction: failed to query Allowance of token chaincode token_erc20: contract is paused",
+	},
+}
+
+// tokenChaincode returns a token chaincode that answers with the allowances and balances, and records
+// the transfers
+func tokenChaincode(allowances map[string]string, balances map[string]string, paused bool, transfers *[]string) func(string, [][]byte, string) peer.Response {
+	account := func(arg []byte) string {
+		id, _ := base64.StdEncoding.DecodeString(string(arg))
+		return string(id)
+	}
+	return func(name string, args [][]byte, channel string) peer.Response {
+		if name != "token_erc20" || paused {
+			return shim.Error("contract is paused")
+		}
+		switch string(args[0]) {
+		case "Allowance":
+			if account(args[2]) != "seller" {
+				return shim.Success([]byte("0"))
+			}
+			if allowance, ok := allowances[account(args[1])]; ok {
+				return shim.Success([]byte(allowance))
+			}
+			return shim.Success([]byte("0"))
+		case "BalanceOf":
+			if balance, ok := balances[account(args[1])]; ok {
+				return shim.Success([]byte(balance))
+			}
+			return shim.Error("the account does not exist")
+		case "TransferFrom":
+			*transfers = append(*transfers, "TransferFrom "+account(args[1])+" "+account(args[2])+" "+string(args[3]))
+		case "Transfer":
+			*transfers = append(*transfers, "Transfer "+account(args[1])+" "+string(args[2]))
+		}
+		return shim.Success(nil)
+	}
+}
+
+func TestSettleAuction(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	stub := &testsfakes.FakeTestChaincodeStubInterface{}
+	tc := &testsfakes.FakeTestTransactionContextInterface{}
+	tc.GetStubStub = func() shim.ChaincodeStubInterface {
+		return stub
+	}
+	identity := &testsfakes.FakeTestClientIdentity{}
+	tc.GetClientIdentityReturns(identity)
+
+	for _, tt := range _SettleAuction {
+		t.Run(tt.name, func(t *testing.T) {
+
+			//Prepare dynamic data
+			identity.GetIDReturns(base64.StdEncoding.EncodeToString([]byte(tt.client)), nil)
+			var transfers []string
+			stub.InvokeChaincodeStub = tokenChaincode(tt.allowances, tt.balances, tt.paused, &transfers)
+			auction := newAuction(true, map[string]int{"bid1": 100, "bid2": 150, "bid3": 120})
+			auction.TokenChaincode = "token_erc20"
+			err := calculateWinner(tc, auction, true)
+			assert.NoError(t, err)
+
+			err = sc.settleAuction(tc, auction, true)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				assert.Empty(t, transfers)
+				assert.Empty(t, auction.Disqualified)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedWinner, auction.Winner)
+				assert.Equal(t, tt.expectedPrice, auction.Price)
+				assert.Equal(t, tt.expectedStatus, auction.Status)
+				assert.Equal(t, tt.expectedDisqualified, auction.Disqualified)
+				assert.Equal(t, tt.expectedPaid, auction.Paid)
+				if tt.expectedTransfer != "" {
+					assert.Equal(t, []string{tt.expectedTransfer}, transfers)
+				} else {
+					assert.Empty(t, transfers)
+				}
+			}
+		})
+	}
+}
+
+var _SettlePendingAuction = []struct {
+	name                 string
+	client               string
+	paid                 bool
+	allowances           map[string]string
+	expectedError        string
+	expectedWinner       string
+	expectedPrice        int
+	expectedDisqualified []string
+	expectedTransfer     string
+}{
+	{
+		name:             "Seller collects from the winner",
+		client:           "seller",
+		allowances:       map[string]string{"bidder1": "200", "bidder2": "200", "bidder3": "200"},
+		expectedWinner:   "bidder2",
+		expectedPrice:    120,
+		expectedTransfer: "TransferFrom bidder2 seller 120",
+	},
+	{
+		name:             "Winner pays",
+		client:           "bidder2",
+		expectedWinner:   "bidder2",
+		expectedPrice:    120,
+		expectedTransfer: "Transfer seller 120",
+	},
+	{
+		name:                 "Winner revoked the allowance",
+		client:               "seller",
+		allowances:           map[string]string{"bidder1": "200", "bidder3": "200"},
+		expectedWinner:       "bidder3",
+		expectedPrice:        100,
+		expectedDisqualified: []string{"bidder2"},
+		expectedTransfer:     "TransferFrom bidder3 seller 100",
+	},
+	{
+		name:          "Third party",
+		client:        "anyone",
+		expectedError: "auction can only be settled by seller or winner",
+	},
+	{
+		name:          "Already paid",
+		client:        "seller",
+		paid:          true,
+		expectedError: "auction does not have a payment to settle",
+	},
+}
+
+func TestSettlePendingAuction(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	balances := map[string]string{"bidder1": "200", "bidder2": "200", "bidder3": "200"}
+
+	for _, tt := range _SettlePendingAuction {
+		t.Run(tt.name, func(t *testing.T) {
+
+			//Prepare dynamic data
+			state := map[string][]byte{}
+			tc, stub := newTestContext(state, tt.client, time.Now())
+			var transfers []string
+			stub.InvokeChaincodeStub = tokenChaincode(tt.allowances, balances, false, &transfers)
+
+			// the auction was ended by a third party after the reveal deadline
+			auction := newAuction(true, map[string]int{"bid1": 100, "bid2": 150, "bid3": 120})
+			auction.TokenChaincode = "token_erc20"
+			auction.Winner = "bidder2"
+			auction.Price = 120
+			auction.Status = "ended"
+			auction.Paid = tt.paid
+			putAuction(state, auction)
+
+			err := sc.SettleAuction(tc, "auction")
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				assert.Empty(t, transfers)
+				assert.Equal(t, 0, stub.PutStateCallCount())
+			} else {
+				assert.NoError(t, err)
+				auction = getAuction(t, state)
+				assert.Equal(t, tt.expectedWinner, auction.Winner)
+				assert.Equal(t, tt.expectedPrice, auction.Price)
+				assert.Equal(t, "ended", auction.Status)
+				assert.Equal(t, tt.expectedDisqualified, auction.Disqualified)
+				assert.True(t, auction.Paid)
+				assert.Equal(t, []string{tt.expectedTransfer}, transfers)
+			}
+		})
+	}
+}
+
+// newTestContext returns a transaction context of a client of Org1 that submits a
+// transaction at the given time. The stub reads and writes the world state in the
+// map. Bid keys are bid<txID>, like the bid keys of newAuction
+func newTestContext(state map[string][]byte, client string, now time.Time) (*testsfakes.FakeTestTransactionContextInterface, *testsfakes.FakeTestChaincodeStubInterface) {
+	stub := &testsfakes.FakeTestChaincodeStubInterface{}
+	stub.GetStateStub = func(key string) ([]byte, error) {
+		return state[key], nil
+	}
+	stub.PutStateStub = func(key string, value []byte) error {
+		state[key] = value
+		return nil
+	}
+	stub.CreateCompositeKeyStub = func(objectType string, attributes []string) (string, error) {
+		return objectType + attributes[len(attributes)-1], nil
+	}
+	stub.GetTxTimestampReturns(&timestamppb.Timestamp{Seconds: now.Unix(), Nanos: int32(now.Nanosecond())}, nil)
+
+	identity := &testsfakes.FakeTestClientIdentity{}
+	identity.GetIDReturns(base64.StdEncoding.EncodeToString([]byte(client)), nil)
+	identity.GetMSPIDReturns("Org1MSP", nil)
+
+	tc := &testsfakes.FakeTestTransactionContextInterface{}
+	tc.GetStubReturns(stub)
+	tc.GetClientIdentityReturns(identity)
+	return tc, stub
+}
+
+// putAuction stores the auction in the world state under the ID "auction"
+func putAuction(state map[string][]byte, auction *Auction) {
+	state["auction"], _ = json.Marshal(auction)
+}
+
+// getAuction reads the auction with the ID "auction" from the world state
+func getAuction(t *testing.T, state map[string][]byte) *Auction {
+	var auction *Auction
+	err := json.Unmarshal(state["auction"], &auction)
+	assert.NoError(t, err)
+	return auction
+}
+
+func TestCreateAuction(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	state := map[string][]byte{}
+	tc, _ := newTestContext(state, "seller", time.Now())
+
+	err := sc.CreateAuction(tc, "auction", "painting", "secondPrice", "", "", "", -1)
+	assert.EqualError(t, err, "minimum bid increment cannot be negative")
+	assert.Empty(t, state)
+
+	err = sc.CreateAuction(tc, "auction", "painting", "secondPrice", "", "", "", 10)
+	assert.NoError(t, err)
+	auction := getAuction(t, state)
+	assert.Equal(t, "seller", auction.Seller)
+	assert.True(t, auction.SecondPrice)
+	assert.Equal(t, 10, auction.MinIncrement)
+	assert.Equal(t, "open", auction.Status)
+}
+
+var _RevealReserve = []struct {
+	name            string
+	client          string
+	status          string
+	reserveHash     string
+	reserveRevealed bool
+	revealDeadline  time.Duration
+	transient       string
+	expectedError   string
+}{
+	{
+		name:          "Reserve revealed",
+		client:        "seller",
+		status:        "closed",
+		transient:     `{"objectType":"reserve","price":60,"salt":"salt"}`,
+		expectedError: "",
+	},
+	{
+		name:          "Not the seller",
+		client:        "bidder1",
+		status:        "closed",
+		transient:     `{"objectType":"reserve","price":60,"salt":"salt"}`,
+		expectedError: "reserve price can only be revealed by seller",
+	},
+	{
+		name:          "No reserve price",
+		client:        "seller",
+		status:        "closed",
+		reserveHash:   "none",
+		transient:     `{"objectType":"reserve","price":60,"salt":"salt"}`,
+		expectedError: "auction does not have a reserve price",
+	},
+	{
+		name:            "Already revealed",
+		client:          "seller",
+		status:          "closed",
+		reserveRevealed: true,
+		transient:       `{"objectType":"reserve","price":60,"salt":"salt"}`,
+		expectedError:   "reserve price has already been revealed",
+	},
+	{
+		name:          "Auction still open",
+		client:        "seller",
+		status:        "open",
+		transient:     `{"objectType":"reserve","price":60,"salt":"salt"}`,
+		expectedError: "cannot reveal reserve price of an auction that is not closed",
+	},
+	{
+		name:           "After the reveal deadline",
+		client:         "seller",
+		status:         "closed",
+		revealDeadline: -time.Minute,
+		transient:      `{"objectType":"reserve","price":60,"salt":"salt"}`,
+		expectedError:  "cannot reveal reserve price after the reveal deadline",
+	},
+	{
+		name:          "Different reserve price",
+		client:        "seller",
+		status:        "closed",
+		transient:     `{"objectType":"reserve","price":50,"salt":"salt"}`,
+		expectedError: "failed to reveal reserve price: hash",
+	},
+}
+
+func TestRevealReserve(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	now := time.Now()
+	reserveHash := fmt.Sprintf("%x", sha256.Sum256([]byte(`{"objectType":"reserve","price":60,"salt":"salt"}`)))
+
+	for _, tt := range _RevealReserve {
+		t.Run(tt.name, func(t *testing.T) {
+
+			//Prepare dynamic data
+			state := map[string][]byte{}
+			tc, stub := newTestContext(state, tt.client, now)
+			stub.GetTransientReturns(map[string][]byte{"reserve": []byte(tt.transient)}, nil)
+			auction := newAuction(false, map[string]int{})
+			auction.Status = tt.status
+			auction.ReserveHash = reserveHash
+			if tt.reserveHash == "none" {
+				auction.ReserveHash = ""
+			}
+			auction.ReserveRevealed = tt.reserveRevealed
+			if tt.revealDeadline != 0 {
+				auction.RevealDeadline = now.Add(tt.revealDeadline).UTC().Format(time.RFC3339Nano)
+			}
+			putAuction(state, auction)
+
+			err := sc.RevealReserve(tc, "auction")
+			if tt.expectedError != "" {
+				assert.Error(t, err)
+				assert.True(t, strings.HasPrefix(err.Error(), tt.expectedError), err.Error())
+				assert.Equal(t, 0, stub.PutStateCallCount())
+			} else {
+				assert.NoError(t, err)
+				auction = getAuction(t, state)
+				assert.True(t, auction.ReserveRevealed)
+				assert.Equal(t, 60, auction.Reserve)
+			}
+		})
+	}
+}
+
+func TestRevealBidIncrement(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	os.Setenv("CORE_PEER_LOCALMSPID", "Org1MSP")
+	defer os.Unsetenv("CORE_PEER_LOCALMSPID")
+
+	for _, price := range []int{125, 120} {
+
+		//Prepare dynamic data
+		state := map[string][]byte{}
+		tc, stub := newTestContext(state, "bidder1", time.Now())
+		bidJSON := []byte(fmt.Sprintf(`{"objectType":"bid","price":%d,"org":"Org1MSP","bidder":"bidder1"}`, price))
+		bidHash := sha256.Sum256(bidJSON)
+		stub.GetTransientReturns(map[string][]byte{"bid": bidJSON}, nil)
+		stub.GetPrivateDataHashReturns(bidHash[:], nil)
+		auction := newAuction(false, map[string]int{})
+		auction.MinIncrement = 10
+		auction.PrivateBids = map[string]BidHash{"bid1": {Org: "Org1MSP", Hash: fmt.Sprintf("%x", bidHash)}}
+		putAuction(state, auction)
+
+		err := sc.RevealBid(tc, "auction", "1")
+		if price == 125 {
+			assert.EqualError(t, err, "bid price 125 is not a multiple of the minimum bid increment 10")
+			assert.Equal(t, 0, stub.PutStateCallCount())
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, FullBid{Type: "bid", Price: 120, Org: "Org1MSP", Bidder: "bidder1"}, getAuction(t, state).RevealedBids["bid1"])
+		}
+	}
+}
+
+func TestEndAuctionUnsold(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	os.Setenv("CORE_PEER_LOCALMSPID", "Org1MSP")
+	defer os.Unsetenv("CORE_PEER_LOCALMSPID")
+	state := map[string][]byte{}
+	tc, _ := newTestContext(state, "seller", time.Now())
+
+	//Prepare dynamic data
+	auction := newAuction(false, map[string]int{"bid1": 100, "bid2": 150})
+	auction.ReserveHash = "hash"
+	auction.Reserve = 200
+	auction.ReserveRevealed = true
+	putAuction(state, auction)
+
+	// the highest bid is below the reserve price
+	err := sc.EndAuction(tc, "auction")
+	assert.NoError(t, err)
+	auction = getAuction(t, state)
+	assert.Equal(t, "unsold", auction.Status)
+	assert.Equal(t, "", auction.Winner)
+	assert.Equal(t, 0, auction.Price)
+}
+
+// Deadlines are relative to the transaction timestamp, 0 means no deadline
+var _Deadlines = []struct {
+	name            string
+	function        string
+	client          string
+	status          string
+	biddingDeadline time.Duration
+	revealDeadline  time.Duration
+	expectedError   string
+	expectedStatus  string
+}{
+	{
+		name:            "Bid before the bidding deadline",
+		function:        "SubmitBid",
+		client:          "bidder1",
+		status:          "open",
+		biddingDeadline: time.Minute,
+		expectedStatus:  "open",
+	},
+	{
+		name:            "Bid after the bidding deadline",
+		function:        "SubmitBid",
+		client:          "bidder1",
+		status:          "open",
+		biddingDeadline: -time.Minute,
+		expectedError:   "cannot join auction after the bidding deadline",
+	},
+	{
+		name:           "Reveal after the reveal deadline",
+		function:       "RevealBid",
+		client:         "bidder1",
+		status:         "closed",
+		revealDeadline: -time.Minute,
+		expectedError:  "cannot reveal bid after the reveal deadline",
+	},
+	{
+		name:            "Seller closes before the bidding deadline",
+		function:        "CloseAuction",
+		client:          "seller",
+		status:          "open",
+		biddingDeadline: time.Minute,
+		expectedStatus:  "closed",
+	},
+	{
+		name:            "Anyone closes after the bidding deadline",
+		function:        "CloseAuction",
+		client:          "anyone",
+		status:          "open",
+		biddingDeadline: -time.Minute,
+		expectedStatus:  "closed",
+	},
+	{
+		name:            "Anyone closes before the bidding deadline",
+		function:        "CloseAuction",
+		client:          "anyone",
+		status:          "open",
+		biddingDeadline: time.Minute,
+		expectedError:   "auction can only be closed by seller before the bidding deadline",
+	},
+	{
+		name:          "Anyone closes without a deadline",
+		function:      "CloseAuction",
+		client:        "anyone",
+		status:        "open",
+		expectedError: "auction can only be closed by seller before the bidding deadline",
+	},
+	{
+		name:           "Anyone ends after the reveal deadline",
+		function:       "EndAuction",
+		client:         "anyone",
+		status:         "closed",
+		revealDeadline: -time.Minute,
+		expectedStatus: "ended",
+	},
+	{
+		name:           "Anyone ends before the reveal deadline",
+		function:       "EndAuction",
+		client:         "anyone",
+		status:         "closed",
+		revealDeadline: time.Minute,
+		expectedError:  "auction can only be ended by seller before the reveal deadline",
+	},
+	{
+		name:            "Deadline in the past",
+		function:        "CreateAuction",
+		client:          "seller",
+		biddingDeadline: -time.Minute,
+		expectedError:   "invalid bidding deadline: deadline",
+	},
+	{
+		name:            "Reveal deadline before the bidding deadline",
+		function:        "CreateAuction",
+		client:          "seller",
+		biddingDeadline: 2 * time.Minute,
+		revealDeadline:  time.Minute,
+		expectedError:   "reveal deadline must be after the bidding deadline",
+	},
+	{
+		name:            "Auction with deadlines",
+		function:        "CreateAuction",
+		client:          "seller",
+		biddingDeadline: time.Minute,
+		revealDeadline:  2 * time.Minute,
+		expectedStatus:  "open",
+	},
+}
+
+func TestDeadlines(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	now := time.Now()
+	deadline := func(offset time.Duration) string {
+		if offset == 0 {
+			return ""
+		}
+		return now.Add(offset).UTC().Format(time.RFC3339Nano)
+	}
+	bidJSON := []byte(`{"objectType":"bid","price":120,"org":"Org1MSP","bidder":"bidder1"}`)
+	bidHash := sha256.Sum256(bidJSON)
+	os.Setenv("CORE_PEER_LOCALMSPID", "Org1MSP")
+	defer os.Unsetenv("CORE_PEER_LOCALMSPID")
+
+	for _, tt := range _Deadlines {
+		t.Run(tt.name, func(t *testing.T) {
+
+			//Prepare dynamic data
+			state := map[string][]byte{}
+			tc, stub := newTestContext(state, tt.client, now)
+			stub.GetTransientReturns(map[string][]byte{"bid": bidJSON}, nil)
+			stub.GetPrivateDataHashReturns(bidHash[:], nil)
+			auction := newAuction(false, map[string]int{"bid2": 100, "bid3": 150})
+			auction.Orgs = []string{"Org1MSP"}
+			auction.Status = tt.status
+			auction.BiddingDeadline = deadline(tt.biddingDeadline)
+			auction.RevealDeadline = deadline(tt.revealDeadline)
+			auction.PrivateBids = map[string]BidHash{"bid1": {Org: "Org1MSP", Hash: fmt.Sprintf("%x", bidHash)}}
+
+			var err error
+			switch tt.function {
+			case "CreateAuction":
+				err = sc.CreateAuction(tc, "auction", "painting", "firstPrice", auction.BiddingDeadline, auction.RevealDeadline, "", 0)
+			case "SubmitBid":
+				putAuction(state, auction)
+				err = sc.SubmitBid(tc, "auction", "1")
+			case "RevealBid":
+				putAuction(state, auction)
+				err = sc.RevealBid(tc, "auction", "1")
+			case "CloseAuction":
+				putAuction(state, auction)
+				err = sc.CloseAuction(tc, "auction")
+			case "EndAuction":
+				putAuction(state, auction)
+				err = sc.EndAuction(tc, "auction")
+			}
+
+			if tt.expectedError != "" {
+				assert.Error(t, err)
+				assert.True(t, strings.HasPrefix(err.Error(), tt.expectedError), err.Error())
+				assert.Equal(t, 0, stub.PutStateCallCount())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedStatus, getAuction(t, state).Status)
+			}
+		})
+	}
+}
+
+// Bid bid1 is the bid of the client to withdraw or amend, bid bid2 is the new bid of AmendBid
+var _ChangeBid = []struct {
+	name            string
+	function        string
+	client          string
+	status          string
+	biddingDeadline time.Duration
+	bidOrg          string
+	newBidOwner     string
+	newBidInAuction bool
+	expectedError   string
+}{
+	{
+		name:     "Withdraw",
+		function: "WithdrawBid",
+		client:   "bidder1",
+		status:   "open",
+	},
+	{
+		name:          "Withdraw the bid of another bidder",
+		function:      "WithdrawBid",
+		client:        "bidder2",
+		status:        "open",
+		expectedError: "Permission denied, client id bidder2 is not the owner of the bid",
+	},
+	{
+		name:          "Withdraw the bid of another organization",
+		function:      "WithdrawBid",
+		client:        "bidder1",
+		status:        "open",
+		bidOrg:        "Org2MSP",
+		expectedError: "Permission denied, client from org Org1MSP is not the owner of the bid",
+	},
+	{
+		name:          "Withdraw from a closed auction",
+		function:      "WithdrawBid",
+		client:        "bidder1",
+		status:        "closed",
+		expectedError: "cannot withdraw bid: auction is not open",
+	},
+	{
+		name:            "Withdraw after the bidding deadline",
+		function:        "WithdrawBid",
+		client:          "bidder1",
+		status:          "open",
+		biddingDeadline: -time.Minute,
+		expectedError:   "cannot withdraw bid: the bidding deadline",
+	},
+	{
+		name:        "Amend",
+		function:    "AmendBid",
+		client:      "bidder1",
+		status:      "open",
+		newBidOwner: "bidder1",
+	},
+	{
+		name:          "Amend the bid of another bidder",
+		function:      "AmendBid",
+		client:        "bidder2",
+		status:        "open",
+		newBidOwner:   "bidder2",
+		expectedError: "Permission denied, client id bidder2 is not the owner of the bid",
+	},
+	{
+		name:          "Amend with the bid of another bidder",
+		function:      "AmendBid",
+		client:        "bidder1",
+		status:        "open",
+		newBidOwner:   "bidder2",
+		expectedError: "Permission denied, client id bidder1 is not the owner of the bid",
+	},
+	{
+		name:            "Amend with a bid in the auction",
+		function:        "AmendBid",
+		client:          "bidder1",
+		status:          "open",
+		newBidOwner:     "bidder1",
+		newBidInAuction: true,
+		expectedError:   "bid bid2 has already been added to the auction",
+	},
+	{
+		name:          "Amend with a bid that does not exist",
+		function:      "AmendBid",
+		client:        "bidder1",
+		status:        "open",
+		expectedError: "bid hash does not exist: bid2",
+	},
+	{
+		name:          "Amend in a closed auction",
+		function:      "AmendBid",
+		client:        "bidder1",
+		status:        "closed",
+		newBidOwner:   "bidder1",
+		expectedError: "cannot amend bid: auction is not open",
+	},
+}
+
+func TestChangeBid(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	now := time.Now()
+	os.Setenv("CORE_PEER_LOCALMSPID", "Org1MSP")
+	defer os.Unsetenv("CORE_PEER_LOCALMSPID")
+
+	for _, tt := range _ChangeBid {
+		t.Run(tt.name, func(t *testing.T) {
+
+			//Prepare dynamic data
+			state := map[string][]byte{}
+			tc, stub := newTestContext(state, tt.client, now)
+			privateBids := map[string][]byte{
+				"bid1": []byte(`{"objectType":"bid","price":100,"org":"Org1MSP","bidder":"bidder1"}`),
+			}
+			if tt.newBidOwner != "" {
+				privateBids["bid2"] = []byte(`{"objectType":"bid","price":120,"org":"Org1MSP","bidder":"` + tt.newBidOwner + `"}`)
+			}
+			stub.GetPrivateDataStub = func(collection string, key string) ([]byte, error) {
+				return privateBids[key], nil
+			}
+			stub.GetPrivateDataHashStub = func(collection string, key string) ([]byte, error) {
+				if privateBids[key] == nil {
+					return nil, nil
+				}
+				hash := sha256.Sum256(privateBids[key])
+				return hash[:], nil
+			}
+
+			bidOrg := "Org1MSP"
+			if tt.bidOrg != "" {
+				bidOrg = tt.bidOrg
+			}
+			auction := newAuction(false, map[string]int{})
+			auction.Status = tt.status
+			if tt.biddingDeadline != 0 {
+				auction.BiddingDeadline = now.Add(tt.biddingDeadline).UTC().Format(time.RFC3339Nano)
+			}
+			auction.PrivateBids = map[string]BidHash{"bid1": {Org: bidOrg, Hash: "hash1"}}
+			if tt.newBidInAuction {
+				auction.PrivateBids["bid2"] = BidHash{Org: "Org1MSP", Hash: "hash2"}
+			}
+			putAuction(state, auction)
+
+			var err error
+			if tt.function == "WithdrawBid" {
+				err = sc.WithdrawBid(tc, "auction", "1")
+			} else {
+				err = sc.AmendBid(tc, "auction", "1", "2")
+			}
+
+			if tt.expectedError != "" {
+				assert.Error(t, err)
+				assert.True(t, strings.HasPrefix(err.Error(), tt.expectedError), err.Error())
+				assert.Equal(t, 0, stub.DelPrivateDataCallCount())
+				assert.Equal(t, 0, stub.PutStateCallCount())
+				return
+			}
+
+			// the old bid is removed from the auction and from the collection
+			assert.NoError(t, err)
+			assert.Equal(t, 1, stub.DelPrivateDataCallCount())
+			collection, bidKey := stub.DelPrivateDataArgsForCall(0)
+			assert.Equal(t, "_implicit_org_Org1MSP", collection)
+			assert.Equal(t, "bid1", bidKey)
+			auction = getAuction(t, state)
+			if tt.function == "WithdrawBid" {
+				assert.Empty(t, auction.PrivateBids)
+			} else {
+				newBidHash := sha256.Sum256(privateBids["bid2"])
+				assert.Equal(t, map[string]BidHash{"bid2": {Org: "Org1MSP", Hash: fmt.Sprintf("%x", newBidHash)}}, auction.PrivateBids)
+			}
+		})
+	}
+}
@@ -9,6 +9,8 @@ package main
 import (
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	f "github.com/hyperledger/fabric-samples/high-throughput/application-go/functions"
 )
@@ -19,7 +21,60 @@ func main() {
 
 	if len(os.Args) <= 2 {
 		log.Println("Usage: function variableName")
-		log.Fatalf("functions: update manyUpdates manyUpdatesTraditional get prune delete")
+		log.Fatalf("functions: update batchUpdate transfer manyUpdates manyUpdatesTraditional benchmark get prune checkpointPrune delete")
+	} else if os.Args[1] == "batchUpdate" || os.Args[1] == "transfer" {
+		// batchUpdate name value operation [name value operation ...]
+		// transfer source destination amount
+		result, err := f.Submit(os.Args[1], os.Args[2:]...)
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+		log.Println(string(result))
+		return
+	} else if os.Args[1] == "benchmark" {
+		// benchmark name value operation concurrency rate duration
+		if len(os.Args) != 8 {
+			log.Fatalf("error: provide value, operation, concurrency, rate (transactions per second, 0 for no limit) and duration (e.g. 30s)")
+		}
+		concurrency, err := strconv.Atoi(os.Args[5])
+		if err != nil {
+			log.Fatalf("error: invalid concurrency %s: %v", os.Args[5], err)
+		}
+		rate, err := strconv.ParseFloat(os.Args[6], 64)
+		if err != nil {
+			log.Fatalf("error: invalid rate %s: %v", os.Args[6], err)
+		}
+		duration, err := time.ParseDuration(os.Args[7])
+		if err != nil {
+			log.Fatalf("error: invalid duration %s: %v", os.Args[7], err)
+		}
+		log.Printf("benchmarking update and putstandard with %d clients for %v...", concurrency, duration)
+		results, err := f.Benchmark(os.Args[2], os.Args[3], os.Args[4], f.BenchmarkOptions{Concurrency: concurrency, Rate: rate, Duration: duration})
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+		for _, result := range results {
+			log.Println(result)
+			if result.FirstError != nil {
+				log.Println("first error:", result.FirstError)
+			}
+		}
+		return
+	} else if os.Args[1] == "checkpointPrune" {
+		// checkpointPrune name maxRows
+		if len(os.Args) != 4 {
+			log.Fatalf("error: provide variable name and maximum number of rows per transaction")
+		}
+		_, err := f.CheckpointPrune(os.Args[2], os.Args[3])
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+		result, err := f.Query("get", os.Args[2])
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+		log.Println("Value of variable", os.Args[2], ": ", string(result))
+		return
 	} else if (os.Args[1] == "update" || os.Args[1] == "manyUpdates" || os.Args[1] == "manyUpdatesTraditional") && len(os.Args) < 5 {
 		log.Fatalf("error: provide value and operation")
 	} else if len(os.Args) == 3 {
@@ -0,0 +1,195 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package functions
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+)
+
+// Contract is the part of a gateway contract used by the benchmark, it is implemented by *client.Contract
+type Contract interface {
+	SubmitTransaction(name string, args ...string) ([]byte, error)
+}
+
+// BenchmarkOptions configures how transactions are submitted during a benchmark
+type BenchmarkOptions struct {
+	// Concurrency is the number of clients submitting transactions at the same time
+	Concurrency int
+	// Rate is the maximum number of transactions per second submitted by all clients together, 0 for no limit
+	Rate float64
+	// Duration is how long transactions are submitted
+	Duration time.Duration
+}
+
+// BenchmarkResult is the outcome of submitting transactions of one function during a benchmark.
+// Conflicts counts the transactions that were invalidated because another transaction changed the
+// keys they read (MVCC_READ_CONFLICT or PHANTOM_READ_CONFLICT), Failed counts all other errors.
+// The latencies are measured from submitting a transaction until it has been committed or rejected.
+type BenchmarkResult struct {
+	Function   string
+	Submitted  int
+	Succeeded  int
+	Conflicts  int
+	Failed     int
+	FirstError error
+	Elapsed    time.Duration
+	TPS        float64
+	P50        time.Duration
+	P90        time.Duration
+	P99        time.Duration
+	Max        time.Duration
+}
+
+// String formats the result as a single line of a report
+func (r *BenchmarkResult) String() string {
+	return fmt.Sprintf("%-12s submitted %6d  succeeded %6d  conflicts %6d  failed %6d  TPS %8.1f  latency p50 %v p90 %v p99 %v max %v",
+		r.Function, r.Submitted, r.Succeeded, r.Conflicts, r.Failed, r.TPS,
+		r.P50.Round(time.Millisecond), r.P90.Round(time.Millisecond), r.P99.Round(time.Millisecond), r.Max.Round(time.Millisecond))
+}
+
+// Benchmark submits update transactions and then putstandard transactions for the same variable,
+// each with the given options, and returns the results of both runs
+func Benchmark(variableName, change, sign string, options BenchmarkOptions) ([]*BenchmarkResult, error) {
+
+	contract, closeConnection, err := connect()
+	if err != nil {
+		return nil, err
+	}
+	defer closeConnection()
+
+	return CompareUpdates(contract, variableName, change, sign, options)
+}
+
+// CompareUpdates runs the benchmark for update, which adds a delta row per transaction, and for
+// putstandard, which overwrites a single key, so their throughput and conflicts can be compared
+func CompareUpdates(contract Contract, variableName, change, sign string, options BenchmarkOptions) ([]*BenchmarkResult, error) {
+	var results []*BenchmarkResult
+	for _, function := range []string{"update", "putstandard"} {
+		result, err := RunBenchmark(contract, function, []string{variableName, change, sign}, options)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// RunBenchmark submits transactions of a function with the given arguments from several concurrent
+// clients, at most at the given rate, until the duration has passed. It waits for the transactions
+// in flight and reports how many transactions succeeded, conflicted or failed, the throughput of
+// successful transactions and the latency percentiles of all transactions.
+func RunBenchmark(contract Contract, function string, args []string, options BenchmarkOptions) (*BenchmarkResult, error) {
+	if options.Concurrency < 1 {
+		return nil, fmt.Errorf("concurrency must be at least 1")
+	}
+	if options.Rate < 0 {
+		return nil, fmt.Errorf("rate must not be negative")
+	}
+	if options.Duration <= 0 {
+		return nil, fmt.Errorf("duration must be positive")
+	}
+
+	result := &BenchmarkResult{Function: function}
+	var latencies []time.Duration
+	var mutex sync.Mutex
+
+	// the clients stop submitting once done is closed
+	done := make(chan struct{})
+	timer := time.AfterFunc(options.Duration, func() { close(done) })
+	defer timer.Stop()
+
+	// every tick allows one client to submit a transaction
+	var ticks <-chan time.Time
+	if options.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / options.Rate))
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < options.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if ticks != nil {
+					select {
+					case <-done:
+						return
+					case <-ticks:
+					}
+				}
+
+				submitted := time.Now()
+				_, err := contract.SubmitTransaction(function, args...)
+				latency := time.Since(submitted)
+
+				mutex.Lock()
+				latencies = append(latencies, latency)
+				result.Submitted++
+				switch {
+				case err == nil:
+					result.Succeeded++
+				case isConflict(err):
+					result.Conflicts++
+				default:
+					result.Failed++
+					if result.FirstError == nil {
+						result.FirstError = err
+					}
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	result.Elapsed = time.Since(start)
+
+	result.TPS = float64(result.Succeeded) / result.Elapsed.Seconds()
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	result.P50 = percentile(latencies, 50)
+	result.P90 = percentile(latencies, 90)
+	result.P99 = percentile(latencies, 99)
+	result.Max = percentile(latencies, 100)
+
+	return result, nil
+}
+
+// isConflict returns whether a transaction was invalidated because the keys it read have been changed
+func isConflict(err error) bool {
+	var commitErr *client.CommitError
+	if !errors.As(err, &commitErr) {
+		return false
+	}
+	return commitErr.Code == peer.TxValidationCode_MVCC_READ_CONFLICT || commitErr.Code == peer.TxValidationCode_PHANTOM_READ_CONFLICT
+}
+
+// percentile returns the nearest-rank percentile of sorted latencies, 0 if there are none
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
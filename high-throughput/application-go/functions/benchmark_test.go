@@ -0,0 +1,141 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package functions_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	f "github.com/hyperledger/fabric-samples/high-throughput/application-go/functions"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGateway is an in-memory contract that simulates how the peers validate transactions. update adds a
+// new row, so it never conflicts. putstandard reads and writes a single key, it is rejected with an
+// MVCC_READ_CONFLICT if another transaction committed the key between its simulation and its commit.
+type fakeGateway struct {
+	mutex     sync.Mutex
+	latency   time.Duration
+	rows      int
+	versions  map[string]int
+	err       error
+	submitted int
+}
+
+func newFakeGateway(latency time.Duration) *fakeGateway {
+	return &fakeGateway{latency: latency, versions: make(map[string]int)}
+}
+
+func (g *fakeGateway) SubmitTransaction(name string, args ...string) ([]byte, error) {
+	g.mutex.Lock()
+	g.submitted++
+	version := g.versions[args[0]]
+	g.mutex.Unlock()
+
+	// endorsement, ordering and validation
+	time.Sleep(g.latency)
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.err != nil {
+		return nil, g.err
+	}
+	switch name {
+	case "update":
+		g.rows++
+	case "putstandard":
+		if g.versions[args[0]] != version {
+			return nil, &client.CommitError{TransactionID: fmt.Sprintf("tx%d", g.submitted), Code: peer.TxValidationCode_MVCC_READ_CONFLICT}
+		}
+		g.versions[args[0]]++
+	default:
+		return nil, fmt.Errorf("Invalid Smart Contract function name.")
+	}
+	return nil, nil
+}
+
+func TestRunBenchmarkUpdate(t *testing.T) {
+	gateway := newFakeGateway(5 * time.Millisecond)
+
+	result, err := f.RunBenchmark(gateway, "update", []string{"myvar", "1", "+"}, f.BenchmarkOptions{Concurrency: 10, Duration: 100 * time.Millisecond})
+	require.NoError(t, err)
+	require.Equal(t, "update", result.Function)
+	require.Greater(t, result.Submitted, 10)
+	require.Equal(t, result.Submitted, result.Succeeded)
+	require.Equal(t, gateway.rows, result.Succeeded)
+	require.Zero(t, result.Conflicts)
+	require.Zero(t, result.Failed)
+	require.Greater(t, result.TPS, 0.0)
+	require.True(t, result.P50 >= 5*time.Millisecond)
+	require.True(t, result.P50 <= result.P90 && result.P90 <= result.P99 && result.P99 <= result.Max)
+}
+
+func TestRunBenchmarkPutStandard(t *testing.T) {
+	gateway := newFakeGateway(5 * time.Millisecond)
+
+	result, err := f.RunBenchmark(gateway, "putstandard", []string{"myvar", "1", "+"}, f.BenchmarkOptions{Concurrency: 10, Duration: 100 * time.Millisecond})
+	require.NoError(t, err)
+	require.Equal(t, result.Submitted, result.Succeeded+result.Conflicts)
+	require.Equal(t, gateway.versions["myvar"], result.Succeeded)
+	require.Greater(t, result.Conflicts, 0)
+	require.Zero(t, result.Failed)
+	require.Nil(t, result.FirstError)
+}
+
+func TestRunBenchmarkRate(t *testing.T) {
+	gateway := newFakeGateway(time.Millisecond)
+
+	result, err := f.RunBenchmark(gateway, "update", []string{"myvar", "1", "+"}, f.BenchmarkOptions{Concurrency: 10, Rate: 50, Duration: 200 * time.Millisecond})
+	require.NoError(t, err)
+	require.Greater(t, result.Submitted, 0)
+	require.LessOrEqual(t, result.Submitted, 11)
+}
+
+func TestRunBenchmarkErrors(t *testing.T) {
+	gateway := newFakeGateway(time.Millisecond)
+	gateway.err = fmt.Errorf("failed to endorse transaction")
+
+	result, err := f.RunBenchmark(gateway, "update", []string{"myvar", "1", "+"}, f.BenchmarkOptions{Concurrency: 2, Duration: 20 * time.Millisecond})
+	require.NoError(t, err)
+	require.Greater(t, result.Failed, 0)
+	require.Equal(t, result.Submitted, result.Failed)
+	require.Zero(t, result.Succeeded)
+	require.Zero(t, result.TPS)
+	require.EqualError(t, result.FirstError, "failed to endorse transaction")
+}
+
+func TestRunBenchmarkOptions(t *testing.T) {
+	gateway := newFakeGateway(0)
+
+	_, err := f.RunBenchmark(gateway, "update", nil, f.BenchmarkOptions{Duration: time.Second})
+	require.EqualError(t, err, "concurrency must be at least 1")
+
+	_, err = f.RunBenchmark(gateway, "update", nil, f.BenchmarkOptions{Concurrency: 1, Rate: -1, Duration: time.Second})
+	require.EqualError(t, err, "rate must not be negative")
+
+	_, err = f.RunBenchmark(gateway, "update", nil, f.BenchmarkOptions{Concurrency: 1})
+	require.EqualError(t, err, "duration must be positive")
+	require.Zero(t, gateway.submitted)
+}
+
+func TestCompareUpdates(t *testing.T) {
+	gateway := newFakeGateway(2 * time.Millisecond)
+
+	results, err := f.CompareUpdates(gateway, "myvar", "1", "+", f.BenchmarkOptions{Concurrency: 8, Duration: 50 * time.Millisecond})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, "update", results[0].Function)
+	require.Zero(t, results[0].Conflicts)
+	require.Equal(t, "putstandard", results[1].Function)
+	require.Greater(t, results[1].Conflicts, 0)
+	require.Greater(t, results[0].TPS, results[1].TPS)
+	require.Contains(t, results[1].String(), "putstandard")
+}
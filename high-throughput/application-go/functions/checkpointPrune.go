@@ -0,0 +1,47 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package functions
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// checkpoint is the progress of a checkpointed prune, as returned by checkpointPrune
+type checkpoint struct {
+	Value json.Number
+	Rows  int
+	Done  bool
+}
+
+// CheckpointPrune prunes a variable incrementally, folding up to maxRows rows per transaction into the
+// checkpoint of the variable until all rows have been folded
+func CheckpointPrune(variableName, maxRows string) ([]byte, error) {
+	contract, closeConnection, err := connect()
+	if err != nil {
+		return nil, err
+	}
+	defer closeConnection()
+
+	for {
+		result, err := submitAsync(contract, "checkpointPrune", variableName, maxRows)
+		if err != nil {
+			return nil, err
+		}
+
+		var progress checkpoint
+		err = json.Unmarshal(result, &progress)
+		if err != nil {
+			return result, fmt.Errorf("failed to parse checkpoint: %w", err)
+		}
+		log.Println("Rows folded into checkpoint:", progress.Rows, "checkpoint value:", progress.Value)
+		if progress.Done {
+			return result, nil
+		}
+	}
+}
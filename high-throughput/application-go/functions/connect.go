@@ -0,0 +1,162 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package functions
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	mspID         = "Org1MSP"
+	cryptoPath    = "../../test-network/organizations/peerOrganizations/org1.example.com"
+	certPath      = cryptoPath + "/users/User1@org1.example.com/msp/signcerts/cert.pem"
+	keyPath       = cryptoPath + "/users/User1@org1.example.com/msp/keystore/"
+	tlsCertPath   = cryptoPath + "/peers/peer0.org1.example.com/tls/ca.crt"
+	hsmCertPath   = "../../hardware-security-module/crypto-material/hsm/HSMUser/signcerts/cert.pem"
+	peerEndpoint  = "localhost:7051"
+	gatewayPeer   = "peer0.org1.example.com"
+	channelName   = "mychannel"
+	chaincodeName = "bigdatacc"
+)
+
+// connect creates a Gateway connection and returns the contract of the high-throughput chaincode, together
+// with a function that closes the connection. The client identity is User1 of Org1, unless the HSM environment
+// variable is set to "true", in which case the HSM managed identity of the hardware-security-module sample is used.
+func connect() (*client.Contract, func(), error) {
+	// The gRPC client connection should be shared by all Gateway connections to this endpoint
+	clientConnection, err := newGrpcConnection()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var id *identity.X509Identity
+	var sign identity.Sign
+	closeSign := func() {}
+	if os.Getenv("HSM") == "true" {
+		certificatePEM, err := ioutil.ReadFile(hsmCertPath)
+		if err != nil {
+			clientConnection.Close()
+			return nil, nil, fmt.Errorf("failed to read certificate file: %w", err)
+		}
+		id, err = newIdentity(certificatePEM)
+		if err != nil {
+			clientConnection.Close()
+			return nil, nil, err
+		}
+		sign, closeSign, err = newHSMSign(certificatePEM)
+		if err != nil {
+			clientConnection.Close()
+			return nil, nil, err
+		}
+	} else {
+		certificatePEM, err := ioutil.ReadFile(certPath)
+		if err != nil {
+			clientConnection.Close()
+			return nil, nil, fmt.Errorf("failed to read certificate file: %w", err)
+		}
+		id, err = newIdentity(certificatePEM)
+		if err != nil {
+			clientConnection.Close()
+			return nil, nil, err
+		}
+		sign, err = newSign()
+		if err != nil {
+			clientConnection.Close()
+			return nil, nil, err
+		}
+	}
+
+	// Create a Gateway connection for a specific client identity
+	gateway, err := client.Connect(
+		id,
+		client.WithSign(sign),
+		client.WithClientConnection(clientConnection),
+		// Default timeouts for different gRPC calls
+		client.WithEvaluateTimeout(5*time.Second),
+		client.WithEndorseTimeout(15*time.Second),
+		client.WithSubmitTimeout(5*time.Second),
+		client.WithCommitStatusTimeout(1*time.Minute),
+	)
+	if err != nil {
+		closeSign()
+		clientConnection.Close()
+		return nil, nil, fmt.Errorf("failed to connect to gateway: %w", err)
+	}
+
+	closeAll := func() {
+		gateway.Close()
+		closeSign()
+		clientConnection.Close()
+	}
+
+	return gateway.GetNetwork(channelName).GetContract(chaincodeName), closeAll, nil
+}
+
+// newGrpcConnection creates a gRPC connection to the Gateway server.
+func newGrpcConnection() (*grpc.ClientConn, error) {
+	certificatePEM, err := ioutil.ReadFile(tlsCertPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TLS certificate file: %w", err)
+	}
+	certificate, err := identity.CertificateFromPEM(certificatePEM)
+	if err != nil {
+		return nil, err
+	}
+
+	certPool := x509.NewCertPool()
+	certPool.AddCert(certificate)
+	transportCredentials := credentials.NewClientTLSFromCert(certPool, gatewayPeer)
+
+	connection, err := grpc.Dial(peerEndpoint, grpc.WithTransportCredentials(transportCredentials))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC connection: %w", err)
+	}
+
+	return connection, nil
+}
+
+// newIdentity creates a client identity for this Gateway connection using an X.509 certificate.
+func newIdentity(certificatePEM []byte) (*identity.X509Identity, error) {
+	certificate, err := identity.CertificateFromPEM(certificatePEM)
+	if err != nil {
+		return nil, err
+	}
+
+	return identity.NewX509Identity(mspID, certificate)
+}
+
+// newSign creates a function that generates a digital signature from a message digest using a private key.
+func newSign() (identity.Sign, error) {
+	files, err := ioutil.ReadDir(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key directory: %w", err)
+	}
+	if len(files) != 1 {
+		return nil, fmt.Errorf("keystore folder should have contain one file")
+	}
+	privateKeyPEM, err := ioutil.ReadFile(path.Join(keyPath, files[0].Name()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key file: %w", err)
+	}
+
+	privateKey, err := identity.PrivateKeyFromPEM(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	return identity.NewPrivateKeySign(privateKey)
+}
@@ -0,0 +1,105 @@
+//go:build pkcs11
+// +build pkcs11
+
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package functions
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+)
+
+// newHSMSign creates a function that generates a digital signature using the private key stored in the HSM for
+// the given certificate. The token label and user PIN can be set with the HSM_LABEL and HSM_PIN environment
+// variables, they default to the token initialized in the hardware-security-module sample.
+func newHSMSign(certificatePEM []byte) (identity.Sign, func(), error) {
+	library, err := findSoftHSMLibrary()
+	if err != nil {
+		return nil, nil, err
+	}
+	ski, err := getSKI(certificatePEM)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hsmSignerFactory, err := identity.NewHSMSignerFactory(library)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opt := identity.HSMSignerOptions{
+		Label:      getenv("HSM_LABEL", "ForFabric"),
+		Pin:        getenv("HSM_PIN", "98765432"),
+		Identifier: string(ski),
+	}
+	sign, hsmSignClose, err := hsmSignerFactory.NewHSMSigner(opt)
+	if err != nil {
+		hsmSignerFactory.Dispose()
+		return nil, nil, err
+	}
+
+	closeSign := func() {
+		hsmSignClose()
+		hsmSignerFactory.Dispose()
+	}
+	return sign, closeSign, nil
+}
+
+func getSKI(certPEM []byte) ([]byte, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode certificate")
+	}
+
+	x509Cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	pk, ok := x509Cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("certificate does not contain an ECDSA public key")
+	}
+
+	ski := sha256.Sum256(elliptic.Marshal(pk.Curve, pk.X, pk.Y))
+	return ski[:], nil
+}
+
+func findSoftHSMLibrary() (string, error) {
+	libraryLocations := []string{
+		"/usr/lib/softhsm/libsofthsm2.so",
+		"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+		"/usr/local/lib/softhsm/libsofthsm2.so",
+		"/usr/lib/libacsp-pkcs11.so",
+	}
+	pkcs11lib := os.Getenv("PKCS11_LIB")
+	if pkcs11lib != "" {
+		libraryLocations = append(libraryLocations, pkcs11lib)
+	}
+	for _, libraryLocation := range libraryLocations {
+		if _, err := os.Stat(libraryLocation); !errors.Is(err, os.ErrNotExist) {
+			return libraryLocation, nil
+		}
+	}
+
+	return "", fmt.Errorf("no SoftHSM library can be found, set PKCS11_LIB to the location of the PKCS11 library")
+}
+
+func getenv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -8,79 +8,72 @@ package functions
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
+	"log"
 	"sync"
 
-	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
-	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
 )
 
-// ManyUpdates allows you to push many cuncurrent updates to a variable
+// ManyUpdates allows you to push many cuncurrent updates to a variable. The transactions are submitted
+// asynchronously and the commit status of every transaction is collected, the number of transactions
+// per status (e.g. VALID or MVCC_READ_CONFLICT) is logged.
 func ManyUpdates(function, variableName, change, sign string) ([]byte, error) {
-
-	err := os.Setenv("DISCOVERY_AS_LOCALHOST", "true")
-	if err != nil {
-		return nil, fmt.Errorf("error setting DISCOVERY_AS_LOCALHOST environemnt variable: %v", err)
-	}
-
-	wallet, err := gateway.NewFileSystemWallet("wallet")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create wallet: %v", err)
-	}
-
-	if !wallet.Exists("appUser") {
-		err := populateWallet(wallet)
-		if err != nil {
-			return nil, fmt.Errorf("failed to populate wallet contents: %v", err)
-		}
-	}
-
-	ccpPath := filepath.Join(
-		"..",
-		"..",
-		"test-network",
-		"organizations",
-		"peerOrganizations",
-		"org1.example.com",
-		"connection-org1.yaml",
-	)
-
-	gw, err := gateway.Connect(
-		gateway.WithConfig(config.FromFile(filepath.Clean(ccpPath))),
-		gateway.WithIdentity(wallet, "appUser"),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to gateway: %v", err)
-	}
-	defer gw.Close()
-
-	network, err := gw.GetNetwork("mychannel")
+	contract, closeConnection, err := connect()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get network: %v", err)
+		return nil, err
 	}
-
-	contract := network.GetContract("bigdatacc")
+	defer closeConnection()
 
 	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	statuses := make(map[string]int)
+	var failed int
+	var firstErr error
 
 	for i := 0; i < 1000; i++ {
 		wg.Add(1)
-		go func() ([]byte, error) {
+		go func() {
 			defer wg.Done()
-			result, err := contract.SubmitTransaction(function, variableName, change, sign)
+			status, err := submitAndWait(contract, function, variableName, change, sign)
+
+			mutex.Lock()
+			defer mutex.Unlock()
 			if err != nil {
-				return result, fmt.Errorf("failed to evaluate transaction: %v", err)
+				failed++
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
 			}
-			return result, nil
+			statuses[status.Code.String()]++
 		}()
 	}
 
 	wg.Wait()
+	for code, count := range statuses {
+		log.Printf("%d transactions committed with status %s", count, code)
+	}
+	if failed > 0 {
+		log.Printf("%d of 1000 transactions failed, first error: %v", failed, firstErr)
+	}
 
 	result, err := contract.EvaluateTransaction("get", variableName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to evaluate transaction: %v", err)
+		return nil, fmt.Errorf("failed to evaluate transaction: %w", err)
+	}
+	return result, nil
+}
+
+// submitAndWait submits a transaction asynchronously and waits for its commit status
+func submitAndWait(contract *client.Contract, function string, args ...string) (*client.Status, error) {
+	_, commit, err := contract.SubmitAsync(function, client.WithArguments(args...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to submit transaction: %w", err)
+	}
+
+	status, err := commit.Status()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit status: %w", err)
 	}
-	return result, err
+	return status, nil
 }
@@ -0,0 +1,21 @@
+//go:build !pkcs11
+// +build !pkcs11
+
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package functions
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+)
+
+// newHSMSign is only available when the application is built with the pkcs11 build tag
+func newHSMSign(certificatePEM []byte) (identity.Sign, func(), error) {
+	return nil, nil, fmt.Errorf("HSM support requires the pkcs11 build tag, e.g. go run -tags pkcs11 app.go")
+}
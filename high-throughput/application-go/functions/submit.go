@@ -0,0 +1,45 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package functions
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// Submit submits a transaction with any number of arguments, e.g. batchUpdate or transfer
+func Submit(function string, args ...string) ([]byte, error) {
+	contract, closeConnection, err := connect()
+	if err != nil {
+		return nil, err
+	}
+	defer closeConnection()
+
+	return submitAsync(contract, function, args...)
+}
+
+// submitAsync submits a transaction asynchronously, blocking until it has been sent to the orderer, and then
+// waits for its commit status. It returns the chaincode response if the transaction committed successfully.
+func submitAsync(contract *client.Contract, function string, args ...string) ([]byte, error) {
+	result, commit, err := contract.SubmitAsync(function, client.WithArguments(args...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to submit transaction: %w", err)
+	}
+
+	status, err := commit.Status()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit status: %w", err)
+	}
+	if !status.Successful {
+		return nil, fmt.Errorf("transaction %s failed to commit with status: %s", status.TransactionID, status.Code)
+	}
+	log.Printf("Transaction %s committed in block %d", status.TransactionID, status.BlockNumber)
+
+	return result, nil
+}
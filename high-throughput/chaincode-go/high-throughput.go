@@ -26,8 +26,12 @@ package main
  * 2 specific Hyperledger Fabric specific libraries for Smart Contracts
  */
 import (
+	"encoding/json"
 	"fmt"
+	"math/big"
+	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/hyperledger/fabric-chaincode-go/shim"
 	pb "github.com/hyperledger/fabric-protos-go/peer"
@@ -37,22 +41,56 @@ import (
 type SmartContract struct {
 }
 
+// Checkpoint is the running aggregate of the delta rows of a variable that have been folded by checkpointPrune
+type Checkpoint struct {
+	Value json.Number
+	Rows  int
+	Done  bool
+}
+
 // Define Status codes for the response
 const (
 	OK    = 200
 	ERROR = 500
 )
 
-// Init is called when the smart contract is instantiated
+// Values are exact decimals with at most scale digits after the decimal point
+const (
+	defaultScale = 6
+	maxScale     = 30
+)
+
+// The maximum number of rows checkpointPrune folds in one transaction, the default totalQueryLimit of the
+// peer. A range query returns at most totalQueryLimit rows, so a short transaction only means all rows
+// have been folded as long as it asked for no more rows than the query returns.
+const maxPruneRows = 100000
+
+// decimalPattern matches the values accepted for deltas, e.g. 100, -2.5 or 0.125
+var decimalPattern = regexp.MustCompile(`^[+-]?[0-9]+(\.[0-9]+)?$`)
+
+// Init is called when the smart contract is instantiated. The scale of the values can be given as the
+// optional first argument, otherwise the default scale of 6 digits after the decimal point is used.
+// The chaincode is deployed with --init-required, so Init runs once for each chaincode definition that
+// the channel members approve, and raising the scale needs a new definition rather than a client call.
 func (s *SmartContract) Init(APIstub shim.ChaincodeStubInterface) pb.Response {
+	_, args := APIstub.GetFunctionAndParameters()
+	if len(args) > 1 {
+		return shim.Error("Incorrect number of arguments, expecting at most 1")
+	}
+	if len(args) == 1 {
+		return s.setScale(APIstub, args)
+	}
 	return shim.Success(nil)
 }
 
 // Invoke routes invocations to the appropriate function in chaincode
 // Current supported invocations are:
 //	- update, adds a delta to an aggregate variable in the ledger, all variables are assumed to start at 0
+//	- batchUpdate, adds deltas to several aggregate variables in a single transaction
+//	- transfer, moves an amount from one aggregate variable to another, the source can't go negative
 //	- get, retrieves the aggregate value of a variable in the ledger
 //	- prune, deletes all rows associated with the variable and replaces them with a single row containing the aggregate value
+//	- checkpointPrune, folds a limited number of rows associated with the variable into a checkpoint and deletes them
 //	- delete, removes all rows associated with the variable
 func (s *SmartContract) Invoke(APIstub shim.ChaincodeStubInterface) pb.Response {
 	// Retrieve the requested Smart Contract function and arguments
@@ -61,10 +99,16 @@ func (s *SmartContract) Invoke(APIstub shim.ChaincodeStubInterface) pb.Response
 	// Route to the appropriate handler function to interact with the ledger appropriately
 	if function == "update" {
 		return s.update(APIstub, args)
+	} else if function == "batchUpdate" {
+		return s.batchUpdate(APIstub, args)
+	} else if function == "transfer" {
+		return s.transfer(APIstub, args)
 	} else if function == "get" {
 		return s.get(APIstub, args)
 	} else if function == "prune" {
 		return s.prune(APIstub, args)
+	} else if function == "checkpointPrune" {
+		return s.checkpointPrune(APIstub, args)
 	} else if function == "delete" {
 		return s.delete(APIstub, args)
 	} else if function == "putstandard" {
@@ -83,7 +127,7 @@ func (s *SmartContract) Invoke(APIstub shim.ChaincodeStubInterface) pb.Response
  * this variable is being added to the ledger, then its initial value is assumed to be 0. The arguments
  * to give in the args array are as follows:
  *	- args[0] -> name of the variable
- *	- args[1] -> new delta (float)
+ *	- args[1] -> new delta (decimal with at most scale digits after the decimal point)
  *	- args[2] -> operation (currently supported are addition "+" and subtraction "-")
  *
  * @param APIstub The chaincode shim
@@ -100,33 +144,139 @@ func (s *SmartContract) update(APIstub shim.ChaincodeStubInterface, args []strin
 	// Extract the args
 	name := args[0]
 	op := args[2]
-	_, err := strconv.ParseFloat(args[1], 64)
-	if err != nil {
-		return shim.Error("Provided value was not a number")
+
+	// Validate the delta and add it to the ledger
+	scale, scaleErr := getScale(APIstub)
+	if scaleErr != nil {
+		return shim.Error(scaleErr.Error())
+	}
+	value, validateErr := validateDelta(args[1], op, scale)
+	if validateErr != nil {
+		return shim.Error(validateErr.Error())
+	}
+	putErr := putDelta(APIstub, name, value, op)
+	if putErr != nil {
+		return shim.Error(putErr.Error())
 	}
 
-	// Make sure a valid operator is provided
-	if op != "+" && op != "-" {
-		return shim.Error(fmt.Sprintf("Operator %s is unrecognized", op))
+	return shim.Success([]byte(fmt.Sprintf("Successfully added %s%s to %s", op, value, name)))
+}
+
+/**
+ * Updates the ledger to include a new delta for each of several variables in a single transaction.
+ * Every delta is added as its own row, so the batch doesn't conflict with concurrent updates of the
+ * same variables. Either all deltas are added or none. The args array contains one triple of arguments
+ * per variable, in the same order as for update:
+ *	- args[3*i] -> name of the variable
+ *	- args[3*i+1] -> new delta (decimal with at most scale digits after the decimal point)
+ *	- args[3*i+2] -> operation (currently supported are addition "+" and subtraction "-")
+ * A variable can appear only once in a batch.
+ *
+ * @param APIstub The chaincode shim
+ * @param args The arguments array for the batchUpdate invocation
+ *
+ * @return A response structure indicating success or failure with a message
+ */
+func (s *SmartContract) batchUpdate(APIstub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// Check we have a valid number of args
+	if len(args) == 0 || len(args)%3 != 0 {
+		return shim.Error("Incorrect number of arguments, expecting a multiple of 3")
 	}
 
-	// Retrieve info needed for the update procedure
-	txid := APIstub.GetTxID()
-	compositeIndexName := "varName~op~value~txID"
+	scale, scaleErr := getScale(APIstub)
+	if scaleErr != nil {
+		return shim.Error(scaleErr.Error())
+	}
 
-	// Create the composite key that will allow us to query for all deltas on a particular variable
-	compositeKey, compositeErr := APIstub.CreateCompositeKey(compositeIndexName, []string{name, op, args[1], txid})
-	if compositeErr != nil {
-		return shim.Error(fmt.Sprintf("Could not create a composite key for %s: %s", name, compositeErr.Error()))
+	// Validate all deltas before adding any of them
+	names := make(map[string]bool)
+	values := make([]string, 0, len(args)/3)
+	for i := 0; i < len(args); i += 3 {
+		if names[args[i]] {
+			return shim.Error(fmt.Sprintf("Variable %s appears more than once in the batch", args[i]))
+		}
+		names[args[i]] = true
+
+		value, validateErr := validateDelta(args[i+1], args[i+2], scale)
+		if validateErr != nil {
+			return shim.Error(fmt.Sprintf("Invalid delta for %s: %s", args[i], validateErr.Error()))
+		}
+		values = append(values, value)
 	}
 
-	// Save the composite key index
-	compositePutErr := APIstub.PutState(compositeKey, []byte{0x00})
-	if compositePutErr != nil {
-		return shim.Error(fmt.Sprintf("Could not put operation for %s in the ledger: %s", name, compositePutErr.Error()))
+	// Add a delta row for each variable
+	for i := 0; i < len(args); i += 3 {
+		putErr := putDelta(APIstub, args[i], values[i/3], args[i+2])
+		if putErr != nil {
+			return shim.Error(putErr.Error())
+		}
 	}
 
-	return shim.Success([]byte(fmt.Sprintf("Successfully added %s%s to %s", op, args[1], name)))
+	return shim.Success([]byte(fmt.Sprintf("Successfully added deltas to %d variables", len(names))))
+}
+
+/**
+ * Transfers an amount from one aggregate variable to another. The aggregate value of the source is
+ * computed from all of its delta rows and the transfer is rejected if the source would go negative.
+ * The transfer then adds a "-" delta row to the source and a "+" delta row to the destination, so it
+ * doesn't conflict with concurrent updates of the destination. Since the delta rows of the source are
+ * read through a range query, the transfer is invalidated at commit time (phantom read conflict) if
+ * the rows of the source changed in the meantime, so concurrent withdrawals can't overdraw the source.
+ * The args array contains the following arguments:
+ *	- args[0] -> name of the source variable
+ *	- args[1] -> name of the destination variable
+ *	- args[2] -> amount to transfer (positive decimal with at most scale digits after the decimal point)
+ *
+ * @param APIstub The chaincode shim
+ * @param args The arguments array for the transfer invocation
+ *
+ * @return A response structure indicating success or failure with a message
+ */
+func (s *SmartContract) transfer(APIstub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// Check we have a valid number of args
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments, expecting 3")
+	}
+
+	// Extract the args
+	source := args[0]
+	destination := args[1]
+	scale, scaleErr := getScale(APIstub)
+	if scaleErr != nil {
+		return shim.Error(scaleErr.Error())
+	}
+	amount, err := parseDecimal(args[2], scale)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("Provided amount %s", err.Error()))
+	}
+	if amount.Sign() <= 0 {
+		return shim.Error("Provided amount must be positive")
+	}
+	if source == destination {
+		return shim.Error("Source and destination must be different variables")
+	}
+	amountStr := formatDecimal(amount, scale)
+
+	// Make sure the source doesn't go negative
+	sourceVal, aggregateErr := aggregate(APIstub, source)
+	if aggregateErr != nil {
+		return shim.Error(aggregateErr.Error())
+	}
+	if sourceVal.Cmp(amount) < 0 {
+		return shim.Error(fmt.Sprintf("Insufficient value in %s: %s, cannot transfer %s", source, formatDecimal(sourceVal, scale), amountStr))
+	}
+
+	// Subtract the amount from the source and add it to the destination
+	putErr := putDelta(APIstub, source, amountStr, "-")
+	if putErr != nil {
+		return shim.Error(putErr.Error())
+	}
+	putErr = putDelta(APIstub, destination, amountStr, "+")
+	if putErr != nil {
+		return shim.Error(putErr.Error())
+	}
+
+	return shim.Success([]byte(fmt.Sprintf("Successfully transferred %s from %s to %s", amountStr, source, destination)))
 }
 
 /**
@@ -147,32 +297,66 @@ func (s *SmartContract) get(APIstub shim.ChaincodeStubInterface, args []string)
 	}
 
 	name := args[0]
+	// Compute the final value from all deltas for the variable
+	finalVal, aggregateErr := aggregate(APIstub, name)
+	if aggregateErr != nil {
+		return shim.Error(aggregateErr.Error())
+	}
+	scale, scaleErr := getScale(APIstub)
+	if scaleErr != nil {
+		return shim.Error(scaleErr.Error())
+	}
+
+	return shim.Success([]byte(formatDecimal(finalVal, scale)))
+}
+
+/**
+ * Computes the aggregate value of a variable from all of its delta rows. The values are added as exact
+ * rational numbers, so the result doesn't depend on the order in which the rows are returned.
+ *
+ * @param APIstub The chaincode shim
+ * @param name The name of the variable
+ *
+ * @return The aggregate value, or an error if the variable doesn't exist
+ */
+func aggregate(APIstub shim.ChaincodeStubInterface, name string) (*big.Rat, error) {
 	// Get all deltas for the variable
 	deltaResultsIterator, deltaErr := APIstub.GetStateByPartialCompositeKey("varName~op~value~txID", []string{name})
 	if deltaErr != nil {
-		return shim.Error(fmt.Sprintf("Could not retrieve value for %s: %s", name, deltaErr.Error()))
+		return nil, fmt.Errorf("Could not retrieve value for %s: %s", name, deltaErr.Error())
 	}
 	defer deltaResultsIterator.Close()
 
+	// Rows that have been folded into the checkpoint of an incremental prune are part of the value
+	checkpoint, _, checkpointErr := getCheckpoint(APIstub, name)
+	if checkpointErr != nil {
+		return nil, checkpointErr
+	}
+
 	// Check the variable existed
-	if !deltaResultsIterator.HasNext() {
-		return shim.Error(fmt.Sprintf("No variable by the name %s exists", name))
+	if !deltaResultsIterator.HasNext() && checkpoint == nil {
+		return nil, fmt.Errorf("No variable by the name %s exists", name)
 	}
 
 	// Iterate through result set and compute final value
-	var finalVal float64
-	var i int
-	for i = 0; deltaResultsIterator.HasNext(); i++ {
+	finalVal := new(big.Rat)
+	if checkpoint != nil {
+		_, ok := finalVal.SetString(checkpoint.Value.String())
+		if !ok {
+			return nil, fmt.Errorf("Invalid checkpoint value %s", checkpoint.Value)
+		}
+	}
+	for deltaResultsIterator.HasNext() {
 		// Get the next row
 		responseRange, nextErr := deltaResultsIterator.Next()
 		if nextErr != nil {
-			return shim.Error(nextErr.Error())
+			return nil, nextErr
 		}
 
 		// Split the composite key into its component parts
 		_, keyParts, splitKeyErr := APIstub.SplitCompositeKey(responseRange.Key)
 		if splitKeyErr != nil {
-			return shim.Error(splitKeyErr.Error())
+			return nil, splitKeyErr
 		}
 
 		// Retrieve the delta value and operation
@@ -180,22 +364,22 @@ func (s *SmartContract) get(APIstub shim.ChaincodeStubInterface, args []string)
 		valueStr := keyParts[2]
 
 		// Convert the value string and perform the operation
-		value, convErr := strconv.ParseFloat(valueStr, 64)
-		if convErr != nil {
-			return shim.Error(convErr.Error())
+		value, ok := new(big.Rat).SetString(valueStr)
+		if !ok {
+			return nil, fmt.Errorf("Invalid delta value %s", valueStr)
 		}
 
 		switch operation {
 		case "+":
-			finalVal += value
+			finalVal.Add(finalVal, value)
 		case "-":
-			finalVal -= value
+			finalVal.Sub(finalVal, value)
 		default:
-			return shim.Error(fmt.Sprintf("Unrecognized operation %s", operation))
+			return nil, fmt.Errorf("Unrecognized operation %s", operation)
 		}
 	}
 
-	return shim.Success([]byte(strconv.FormatFloat(finalVal, 'f', -1, 64)))
+	return finalVal, nil
 }
 
 /**
@@ -218,68 +402,224 @@ func (s *SmartContract) prune(APIstub shim.ChaincodeStubInterface, args []string
 	// Retrieve the name of the variable to prune
 	name := args[0]
 
-	// Get all delta rows for the variable
-	deltaResultsIterator, deltaErr := APIstub.GetStateByPartialCompositeKey("varName~op~value~txID", []string{name})
-	if deltaErr != nil {
-		return shim.Error(fmt.Sprintf("Could not retrieve value for %s: %s", name, deltaErr.Error()))
+	// Retrieve the checkpoint of a checkpointed prune that may be in progress
+	checkpoint, checkpointKey, checkpointErr := getCheckpoint(APIstub, name)
+	if checkpointErr != nil {
+		return shim.Error(checkpointErr.Error())
+	}
+
+	// Delete all delta rows while computing their aggregate
+	rowsVal, i, foldErr := foldRows(APIstub, name, 0)
+	if foldErr != nil {
+		return shim.Error(foldErr.Error())
 	}
-	defer deltaResultsIterator.Close()
 
 	// Check the variable existed
-	if !deltaResultsIterator.HasNext() {
+	if i == 0 && checkpoint == nil {
 		return shim.Error(fmt.Sprintf("No variable by the name %s exists", name))
 	}
 
-	// Iterate through result set computing final value while iterating and deleting each key
-	var finalVal float64
+	// The checkpoint is folded into the final value as well
+	finalVal := rowsVal
+	if checkpoint != nil {
+		checkpointVal, ok := new(big.Rat).SetString(checkpoint.Value.String())
+		if !ok {
+			return shim.Error(fmt.Sprintf("Invalid checkpoint value %s", checkpoint.Value))
+		}
+		finalVal.Add(finalVal, checkpointVal)
+		checkpointDelErr := APIstub.DelState(checkpointKey)
+		if checkpointDelErr != nil {
+			return shim.Error(fmt.Sprintf("Could not delete checkpoint: %s", checkpointDelErr.Error()))
+		}
+	}
+
+	// Update the ledger with the final value, a negative value is added as a subtraction
+	scale, scaleErr := getScale(APIstub)
+	if scaleErr != nil {
+		return shim.Error(scaleErr.Error())
+	}
+	op := "+"
+	if finalVal.Sign() < 0 {
+		op = "-"
+	}
+	putErr := putDelta(APIstub, name, formatDecimal(new(big.Rat).Abs(finalVal), scale), op)
+	if putErr != nil {
+		return shim.Error(fmt.Sprintf("Could not update the final value of the variable after pruning: %s", putErr.Error()))
+	}
+
+	return shim.Success([]byte(fmt.Sprintf("Successfully pruned variable %s, final value is %s, %d rows pruned", args[0], formatDecimal(finalVal, scale), i)))
+}
+
+/**
+ * Prunes a variable incrementally. Each invocation folds up to a maximum number of delta rows into a
+ * running checkpoint of the variable and deletes them, so pruning millions of rows is spread over many
+ * small transactions rather than one that exceeds the transaction size or the query limits of the peer.
+ * The checkpoint records the aggregate value of all rows folded so far and the number of rows folded.
+ * Every invocation starts at the first remaining row of the variable: the rows folded before have been
+ * deleted, so restarting never folds a row twice. Rows added by concurrent updates are folded by later
+ * invocations. Done is set in the checkpoint once an invocation folded fewer rows than the maximum, i.e.
+ * no rows were left. The maximum is capped at maxPruneRows, as the peer truncates larger range queries.
+ * get adds the checkpoint to the remaining rows, so the value of the variable stays correct while the
+ * prune is only partly done. The args array contains the following arguments:
+ *	- args[0] -> The name of the variable to prune
+ *	- args[1] -> The maximum number of rows to fold in this transaction
+ *
+ * @param APIstub The chaincode shim
+ * @param args The args array for the checkpointPrune invocation
+ *
+ * @return A response structure containing the checkpoint as JSON, or an error message
+ */
+func (s *SmartContract) checkpointPrune(APIstub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// Check we have a valid number of args
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments, expecting 2")
+	}
+
+	// Extract the args
+	name := args[0]
+	maxRows, err := strconv.Atoi(args[1])
+	if err != nil || maxRows <= 0 {
+		return shim.Error("Provided maximum number of rows was not a positive number")
+	}
+	if maxRows > maxPruneRows {
+		return shim.Error(fmt.Sprintf("Provided maximum number of rows exceeds the limit of %d", maxPruneRows))
+	}
+
+	// Retrieve the checkpoint, or start a new one
+	checkpoint, checkpointKey, checkpointErr := getCheckpoint(APIstub, name)
+	if checkpointErr != nil {
+		return shim.Error(checkpointErr.Error())
+	}
+
+	// Fold the next rows into the checkpoint
+	rowsVal, rows, foldErr := foldRows(APIstub, name, maxRows)
+	if foldErr != nil {
+		return shim.Error(foldErr.Error())
+	}
+	if checkpoint == nil {
+		if rows == 0 {
+			return shim.Error(fmt.Sprintf("No variable by the name %s exists", name))
+		}
+		checkpoint = &Checkpoint{Value: "0"}
+	}
+	checkpointVal, ok := new(big.Rat).SetString(checkpoint.Value.String())
+	if !ok {
+		return shim.Error(fmt.Sprintf("Invalid checkpoint value %s", checkpoint.Value))
+	}
+	scale, scaleErr := getScale(APIstub)
+	if scaleErr != nil {
+		return shim.Error(scaleErr.Error())
+	}
+	checkpoint.Value = json.Number(formatDecimal(checkpointVal.Add(checkpointVal, rowsVal), scale))
+	checkpoint.Rows += rows
+	checkpoint.Done = rows < maxRows
+
+	// Save the checkpoint
+	checkpointJSON, marshalErr := json.Marshal(checkpoint)
+	if marshalErr != nil {
+		return shim.Error(marshalErr.Error())
+	}
+	putErr := APIstub.PutState(checkpointKey, checkpointJSON)
+	if putErr != nil {
+		return shim.Error(fmt.Sprintf("Could not put checkpoint for %s in the ledger: %s", name, putErr.Error()))
+	}
+
+	return shim.Success(checkpointJSON)
+}
+
+/**
+ * Deletes up to a maximum number of delta rows of a variable while computing their aggregate.
+ *
+ * @param APIstub The chaincode shim
+ * @param name The name of the variable
+ * @param maxRows The maximum number of rows to delete, 0 deletes all rows
+ *
+ * @return The aggregate of the deleted rows and the number of rows deleted
+ */
+func foldRows(APIstub shim.ChaincodeStubInterface, name string, maxRows int) (*big.Rat, int, error) {
+	// Get all delta rows for the variable
+	deltaResultsIterator, deltaErr := APIstub.GetStateByPartialCompositeKey("varName~op~value~txID", []string{name})
+	if deltaErr != nil {
+		return nil, 0, fmt.Errorf("Could not retrieve value for %s: %s", name, deltaErr.Error())
+	}
+	defer deltaResultsIterator.Close()
+
+	// Iterate through result set computing final value while iterating and deleting each key,
+	// stop once the maximum number of rows has been reached
+	finalVal := new(big.Rat)
 	var i int
-	for i = 0; deltaResultsIterator.HasNext(); i++ {
+	for i = 0; deltaResultsIterator.HasNext() && (maxRows == 0 || i < maxRows); i++ {
 		// Get the next row
 		responseRange, nextErr := deltaResultsIterator.Next()
 		if nextErr != nil {
-			return shim.Error(nextErr.Error())
+			return nil, 0, nextErr
 		}
 
 		// Split the key into its composite parts
 		_, keyParts, splitKeyErr := APIstub.SplitCompositeKey(responseRange.Key)
 		if splitKeyErr != nil {
-			return shim.Error(splitKeyErr.Error())
+			return nil, 0, splitKeyErr
 		}
 
 		// Retrieve the operation and value
 		operation := keyParts[1]
 		valueStr := keyParts[2]
 
-		// Convert the value to a float
-		value, convErr := strconv.ParseFloat(valueStr, 64)
-		if convErr != nil {
-			return shim.Error(convErr.Error())
+		// Convert the value to an exact rational number
+		value, ok := new(big.Rat).SetString(valueStr)
+		if !ok {
+			return nil, 0, fmt.Errorf("Invalid delta value %s", valueStr)
 		}
 
 		// Delete the row from the ledger
 		deltaRowDelErr := APIstub.DelState(responseRange.Key)
 		if deltaRowDelErr != nil {
-			return shim.Error(fmt.Sprintf("Could not delete delta row: %s", deltaRowDelErr.Error()))
+			return nil, 0, fmt.Errorf("Could not delete delta row: %s", deltaRowDelErr.Error())
 		}
 
 		// Add the value of the deleted row to the final aggregate
 		switch operation {
 		case "+":
-			finalVal += value
+			finalVal.Add(finalVal, value)
 		case "-":
-			finalVal -= value
+			finalVal.Sub(finalVal, value)
 		default:
-			return shim.Error(fmt.Sprintf("Unrecognized operation %s", operation))
+			return nil, 0, fmt.Errorf("Unrecognized operation %s", operation)
 		}
 	}
 
-	// Update the ledger with the final value
-	updateResp := s.update(APIstub, []string{name, strconv.FormatFloat(finalVal, 'f', -1, 64), "+"})
-	if updateResp.Status == ERROR {
-		return shim.Error(fmt.Sprintf("Could not update the final value of the variable after pruning: %s", updateResp.Message))
+	return finalVal, i, nil
+}
+
+/**
+ * Retrieves the checkpoint of a variable that is pruned incrementally.
+ *
+ * @param APIstub The chaincode shim
+ * @param name The name of the variable
+ *
+ * @return The checkpoint, nil if the variable has no checkpoint, and the key of the checkpoint
+ */
+func getCheckpoint(APIstub shim.ChaincodeStubInterface, name string) (*Checkpoint, string, error) {
+	checkpointKey, compositeErr := APIstub.CreateCompositeKey("checkpoint~varName", []string{name})
+	if compositeErr != nil {
+		return nil, "", fmt.Errorf("Could not create a composite key for %s: %s", name, compositeErr.Error())
+	}
+
+	checkpointJSON, getErr := APIstub.GetState(checkpointKey)
+	if getErr != nil {
+		return nil, "", fmt.Errorf("Could not retrieve checkpoint for %s: %s", name, getErr.Error())
+	}
+	if checkpointJSON == nil {
+		return nil, checkpointKey, nil
 	}
 
-	return shim.Success([]byte(fmt.Sprintf("Successfully pruned variable %s, final value is %f, %d rows pruned", args[0], finalVal, i)))
+	var checkpoint Checkpoint
+	unmarshalErr := json.Unmarshal(checkpointJSON, &checkpoint)
+	if unmarshalErr != nil {
+		return nil, "", unmarshalErr
+	}
+
+	return &checkpoint, checkpointKey, nil
 }
 
 /**
@@ -308,11 +648,25 @@ func (s *SmartContract) delete(APIstub shim.ChaincodeStubInterface, args []strin
 	}
 	defer deltaResultsIterator.Close()
 
+	// Retrieve the checkpoint of a checkpointed prune that may be in progress
+	checkpoint, checkpointKey, checkpointErr := getCheckpoint(APIstub, name)
+	if checkpointErr != nil {
+		return shim.Error(checkpointErr.Error())
+	}
+
 	// Ensure the variable exists
-	if !deltaResultsIterator.HasNext() {
+	if !deltaResultsIterator.HasNext() && checkpoint == nil {
 		return shim.Error(fmt.Sprintf("No variable by the name %s exists", name))
 	}
 
+	// Delete the checkpoint
+	if checkpoint != nil {
+		checkpointDelErr := APIstub.DelState(checkpointKey)
+		if checkpointDelErr != nil {
+			return shim.Error(fmt.Sprintf("Could not delete checkpoint: %s", checkpointDelErr.Error()))
+		}
+	}
+
 	// Iterate through result set and delete all indices
 	var i int
 	for i = 0; deltaResultsIterator.HasNext(); i++ {
@@ -331,16 +685,171 @@ func (s *SmartContract) delete(APIstub shim.ChaincodeStubInterface, args []strin
 }
 
 /**
- * Converts a float64 to a byte array
+ * Sets the number of digits after the decimal point accepted for values. The scale can only be increased,
+ * so the values already in the ledger can still be represented exactly. It is only called from Init:
+ * every update, batchUpdate, transfer, get and prune reads the scale, so writing it fails all of those
+ * transactions that are endorsed concurrently with an MVCC_READ_CONFLICT. The args array contains the
+ * following argument:
+ *	- args[0] -> The new scale
+ *
+ * @param APIstub The chaincode shim
+ * @param args The arguments array for the setScale invocation
+ *
+ * @return A response structure indicating success or failure with a message
+ */
+func (s *SmartContract) setScale(APIstub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// Check there are a correct number of arguments
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments, expecting 1")
+	}
+
+	// Make sure the scale is valid and not decreased
+	scale, err := strconv.Atoi(args[0])
+	if err != nil || scale < 0 || scale > maxScale {
+		return shim.Error(fmt.Sprintf("Provided scale must be a number between 0 and %d", maxScale))
+	}
+	current, scaleErr := getScale(APIstub)
+	if scaleErr != nil {
+		return shim.Error(scaleErr.Error())
+	}
+	if scale < current {
+		return shim.Error(fmt.Sprintf("Scale cannot be decreased from %d to %d", current, scale))
+	}
+
+	scaleKey, compositeErr := APIstub.CreateCompositeKey("config~name", []string{"scale"})
+	if compositeErr != nil {
+		return shim.Error(fmt.Sprintf("Could not create a composite key for the scale: %s", compositeErr.Error()))
+	}
+	putErr := APIstub.PutState(scaleKey, []byte(strconv.Itoa(scale)))
+	if putErr != nil {
+		return shim.Error(fmt.Sprintf("Could not put the scale in the ledger: %s", putErr.Error()))
+	}
+
+	return shim.Success([]byte(fmt.Sprintf("Scale set to %d", scale)))
+}
+
+/**
+ * Checks that a delta is a decimal with at most scale digits after the decimal point and its
+ * operation is supported.
  *
- * @param f The float64 to convert
+ * @param value The delta value
+ * @param op The operation, addition "+" or subtraction "-"
+ * @param scale The maximum number of digits after the decimal point
  *
- * @return The byte array representation
+ * @return The canonical representation of the delta value, or an error if the delta is invalid
  */
-func f2barr(f float64) []byte {
-	str := strconv.FormatFloat(f, 'f', -1, 64)
+func validateDelta(value, op string, scale int) (string, error) {
+	rat, err := parseDecimal(value, scale)
+	if err != nil {
+		return "", fmt.Errorf("Provided value %s", err.Error())
+	}
+
+	// Make sure a valid operator is provided
+	if op != "+" && op != "-" {
+		return "", fmt.Errorf("Operator %s is unrecognized", op)
+	}
+
+	return formatDecimal(rat, scale), nil
+}
+
+/**
+ * Adds a delta row for a variable to the ledger. The row is keyed by the variable name, the operation,
+ * the value and the transaction ID, so concurrent transactions never write the same key.
+ *
+ * @param APIstub The chaincode shim
+ * @param name The name of the variable
+ * @param value The delta value
+ * @param op The operation, addition "+" or subtraction "-"
+ *
+ * @return An error if the row could not be added
+ */
+func putDelta(APIstub shim.ChaincodeStubInterface, name, value, op string) error {
+	// Retrieve info needed for the update procedure
+	txid := APIstub.GetTxID()
+	compositeIndexName := "varName~op~value~txID"
+
+	// Create the composite key that will allow us to query for all deltas on a particular variable
+	compositeKey, compositeErr := APIstub.CreateCompositeKey(compositeIndexName, []string{name, op, value, txid})
+	if compositeErr != nil {
+		return fmt.Errorf("Could not create a composite key for %s: %s", name, compositeErr.Error())
+	}
+
+	// Save the composite key index
+	compositePutErr := APIstub.PutState(compositeKey, []byte{0x00})
+	if compositePutErr != nil {
+		return fmt.Errorf("Could not put operation for %s in the ledger: %s", name, compositePutErr.Error())
+	}
+
+	return nil
+}
+
+/**
+ * Parses a decimal with at most scale digits after the decimal point into an exact rational number.
+ *
+ * @param value The decimal, e.g. 100, -2.5 or 0.125
+ * @param scale The maximum number of digits after the decimal point
+ *
+ * @return The rational number, or an error if the value is not such a decimal
+ */
+func parseDecimal(value string, scale int) (*big.Rat, error) {
+	if !decimalPattern.MatchString(value) {
+		return nil, fmt.Errorf("%s was not a decimal number", value)
+	}
+	if dot := strings.IndexByte(value, '.'); dot >= 0 && len(value)-dot-1 > scale {
+		return nil, fmt.Errorf("%s has more than %d digits after the decimal point", value, scale)
+	}
+
+	rat, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return nil, fmt.Errorf("%s was not a decimal number", value)
+	}
+
+	return rat, nil
+}
+
+/**
+ * Formats an exact rational number as a decimal without trailing zeros. Since all deltas have at most
+ * scale digits after the decimal point, so have their aggregates and the result is exact.
+ *
+ * @param r The rational number
+ * @param scale The number of digits after the decimal point
+ *
+ * @return The decimal representation
+ */
+func formatDecimal(r *big.Rat, scale int) string {
+	str := r.FloatString(scale)
+	if strings.IndexByte(str, '.') >= 0 {
+		str = strings.TrimRight(strings.TrimRight(str, "0"), ".")
+	}
+	if str == "-0" {
+		str = "0"
+	}
+
+	return str
+}
+
+/**
+ * Retrieves the number of digits after the decimal point accepted for values.
+ *
+ * @param APIstub The chaincode shim
+ *
+ * @return The scale, the default scale if none has been set
+ */
+func getScale(APIstub shim.ChaincodeStubInterface) (int, error) {
+	scaleKey, compositeErr := APIstub.CreateCompositeKey("config~name", []string{"scale"})
+	if compositeErr != nil {
+		return 0, fmt.Errorf("Could not create a composite key for the scale: %s", compositeErr.Error())
+	}
+
+	scaleBytes, getErr := APIstub.GetState(scaleKey)
+	if getErr != nil {
+		return 0, fmt.Errorf("Could not retrieve the scale: %s", getErr.Error())
+	}
+	if scaleBytes == nil {
+		return defaultScale, nil
+	}
 
-	return []byte(str)
+	return strconv.Atoi(string(scaleBytes))
 }
 
 // The main function is only relevant in unit test mode. Only included here for completeness.
@@ -0,0 +1,709 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// The number of shuffled orders in which every test reads the delta rows
+const shuffles = 20
+
+// mapStub is a world state held in a map. Range queries return the matching rows in sorted order, or
+// shuffled if shuffle is set, so the tests can check that the results don't depend on the row order.
+type mapStub struct {
+	shim.ChaincodeStubInterface
+	state   map[string][]byte
+	txID    string
+	args    []string
+	shuffle *rand.Rand
+}
+
+// newMapStub creates a world state with a delta row for each of the deltas, e.g. "+1.5", of a variable.
+// Each row gets its own transaction ID, seed 0 returns the rows of range queries in sorted order.
+func newMapStub(t *testing.T, seed int64, deltas map[string][]string) *mapStub {
+	stub := &mapStub{state: map[string][]byte{}, txID: "tx"}
+	if seed != 0 {
+		stub.shuffle = rand.New(rand.NewSource(seed))
+	}
+	for name, values := range deltas {
+		for i, delta := range values {
+			key, err := shim.CreateCompositeKey("varName~op~value~txID", []string{name, delta[:1], delta[1:], fmt.Sprintf("tx%d", i)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			stub.state[key] = []byte{0x00}
+		}
+	}
+	return stub
+}
+
+func (s *mapStub) GetFunctionAndParameters() (string, []string) {
+	if len(s.args) == 0 {
+		return "", nil
+	}
+	return s.args[0], s.args[1:]
+}
+
+func (s *mapStub) GetTxID() string {
+	return s.txID
+}
+
+func (s *mapStub) GetState(key string) ([]byte, error) {
+	return s.state[key], nil
+}
+
+func (s *mapStub) PutState(key string, value []byte) error {
+	s.state[key] = value
+	return nil
+}
+
+func (s *mapStub) DelState(key string) error {
+	delete(s.state, key)
+	return nil
+}
+
+func (s *mapStub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return shim.CreateCompositeKey(objectType, attributes)
+}
+
+func (s *mapStub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(compositeKey, "\x00"), "\x00"), "\x00")
+	return parts[0], parts[1:], nil
+}
+
+func (s *mapStub) GetStateByPartialCompositeKey(objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	prefix, err := shim.CreateCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []*queryresult.KV
+	for key, value := range s.state {
+		if strings.HasPrefix(key, prefix) {
+			rows = append(rows, &queryresult.KV{Key: key, Value: value})
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Key < rows[j].Key
+	})
+	if s.shuffle != nil {
+		s.shuffle.Shuffle(len(rows), func(i, j int) {
+			rows[i], rows[j] = rows[j], rows[i]
+		})
+	}
+
+	return &mapIterator{rows: rows}, nil
+}
+
+// mapIterator iterates over the rows of a range query of mapStub
+type mapIterator struct {
+	rows []*queryresult.KV
+}
+
+func (it *mapIterator) HasNext() bool {
+	return len(it.rows) > 0
+}
+
+func (it *mapIterator) Next() (*queryresult.KV, error) {
+	row := it.rows[0]
+	it.rows = it.rows[1:]
+	return row, nil
+}
+
+func (it *mapIterator) Close() error {
+	return nil
+}
+
+// result returns the payload of a response, or its error message
+func result(response pb.Response) string {
+	if response.Status != shim.OK {
+		return "error: " + response.Message
+	}
+	return string(response.Payload)
+}
+
+// rows returns the delta rows of a variable in the world state, sorted
+func rows(stub *mapStub, name string) []string {
+	var deltas []string
+	for key := range stub.state {
+		objectType, parts, _ := stub.SplitCompositeKey(key)
+		if objectType == "varName~op~value~txID" && parts[0] == name {
+			deltas = append(deltas, parts[1]+parts[2])
+		}
+	}
+	sort.Strings(deltas)
+	return deltas
+}
+
+// inAnyOrder runs a test once with the rows in sorted order and once for each shuffled order, and
+// checks that every run returns exactly the same output as the first
+func inAnyOrder(t *testing.T, run func(seed int64) string) string {
+	expected := run(0)
+	for seed := int64(1); seed <= shuffles; seed++ {
+		if actual := run(seed); actual != expected {
+			t.Fatalf("rows in order %d returned %q, sorted rows returned %q", seed, actual, expected)
+		}
+	}
+	return expected
+}
+
+var _Get = []struct {
+	name     string
+	deltas   []string
+	expected string
+}{
+	{
+		name:     "Fractions",
+		deltas:   []string{"+0.1", "+0.2", "-0.3", "+0.125"},
+		expected: "0.125",
+	},
+	{
+		name:     "Negative",
+		deltas:   []string{"+1", "-2.5", "+0.000001"},
+		expected: "-1.499999",
+	},
+	{
+		name:     "Large values",
+		deltas:   []string{"+123456789012345678901234567890.5", "+0.5", "-1"},
+		expected: "123456789012345678901234567890",
+	},
+	{
+		name:     "Cancel out",
+		deltas:   []string{"+0.3", "-0.1", "-0.1", "-0.1"},
+		expected: "0",
+	},
+	{
+		name:     "Variable doesn't exist",
+		expected: "error: No variable by the name myvar exists",
+	},
+}
+
+func TestGet(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+
+	for _, tt := range _Get {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := inAnyOrder(t, func(seed int64) string {
+
+				//Prepare dynamic data
+				stub := newMapStub(t, seed, map[string][]string{"myvar": tt.deltas, "other": {"+7"}})
+
+				return result(sc.get(stub, []string{"myvar"}))
+			})
+			if actual != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+var _Prune = []struct {
+	name         string
+	deltas       []string
+	expected     string
+	expectedRows []string
+}{
+	{
+		name:         "Positive",
+		deltas:       []string{"+0.1", "+0.2", "-0.05"},
+		expected:     "Successfully pruned variable myvar, final value is 0.25, 3 rows pruned",
+		expectedRows: []string{"+0.25"},
+	},
+	{
+		name:         "Negative",
+		deltas:       []string{"+1", "-3.5"},
+		expected:     "Successfully pruned variable myvar, final value is -2.5, 2 rows pruned",
+		expectedRows: []string{"-2.5"},
+	},
+	{
+		name:         "Variable doesn't exist",
+		expected:     "error: No variable by the name myvar exists",
+		expectedRows: nil,
+	},
+}
+
+func TestPrune(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+
+	for _, tt := range _Prune {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := inAnyOrder(t, func(seed int64) string {
+
+				//Prepare dynamic data
+				stub := newMapStub(t, seed, map[string][]string{"myvar": tt.deltas, "other": {"+7"}})
+
+				response := result(sc.prune(stub, []string{"myvar"}))
+				if fmt.Sprint(rows(stub, "myvar")) != fmt.Sprint(tt.expectedRows) {
+					t.Errorf("expected rows %v, got %v", tt.expectedRows, rows(stub, "myvar"))
+				}
+				if fmt.Sprint(rows(stub, "other")) != "[+7]" {
+					t.Errorf("rows of another variable were pruned: %v", rows(stub, "other"))
+				}
+				return response
+			})
+			if actual != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+var _FoldRows = []struct {
+	name          string
+	deltas        []string
+	maxRows       int
+	expectedValue string
+	expectedRows  int
+}{
+	{
+		name:          "All rows",
+		deltas:        []string{"+0.1", "+0.2", "-0.3", "+5"},
+		maxRows:       0,
+		expectedValue: "5",
+		expectedRows:  4,
+	},
+	{
+		name:          "Fewer rows than the maximum",
+		deltas:        []string{"+0.1", "+0.2"},
+		maxRows:       3,
+		expectedValue: "0.3",
+		expectedRows:  2,
+	},
+	{
+		name:          "No rows",
+		maxRows:       0,
+		expectedValue: "0",
+		expectedRows:  0,
+	},
+}
+
+func TestFoldRows(t *testing.T) {
+	for _, tt := range _FoldRows {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := inAnyOrder(t, func(seed int64) string {
+
+				//Prepare dynamic data
+				stub := newMapStub(t, seed, map[string][]string{"myvar": tt.deltas})
+
+				value, i, err := foldRows(stub, "myvar", tt.maxRows)
+				if err != nil {
+					return "error: " + err.Error()
+				}
+				if len(rows(stub, "myvar")) != 0 {
+					t.Errorf("rows left after folding: %v", rows(stub, "myvar"))
+				}
+				return fmt.Sprintf("%s %d", formatDecimal(value, defaultScale), i)
+			})
+			expected := fmt.Sprintf("%s %d", tt.expectedValue, tt.expectedRows)
+			if actual != expected {
+				t.Errorf("expected %q, got %q", expected, actual)
+			}
+		})
+	}
+}
+
+func TestFoldRowsMaximum(t *testing.T) {
+	deltas := []string{"+1", "+2", "+4", "+8", "+16"}
+
+	// The folded rows depend on the order, but the folded and remaining rows always add up to the same
+	actual := inAnyOrder(t, func(seed int64) string {
+
+		//Prepare dynamic data
+		stub := newMapStub(t, seed, map[string][]string{"myvar": deltas})
+
+		value, i, err := foldRows(stub, "myvar", 3)
+		if err != nil {
+			return "error: " + err.Error()
+		}
+		remaining, _, err := foldRows(stub, "myvar", 0)
+		if err != nil {
+			return "error: " + err.Error()
+		}
+		return fmt.Sprintf("%d %s", i, formatDecimal(value.Add(value, remaining), defaultScale))
+	})
+	if actual != "3 31" {
+		t.Errorf("expected %q, got %q", "3 31", actual)
+	}
+}
+
+var _ParseDecimal = []struct {
+	value         string
+	scale         int
+	expected      string
+	expectedError string
+}{
+	{value: "100", scale: 6, expected: "100"},
+	{value: "+2.50", scale: 6, expected: "2.5"},
+	{value: "-0.125", scale: 3, expected: "-0.125"},
+	{value: "0.000", scale: 3, expected: "0"},
+	{value: "-0.0", scale: 6, expected: "0"},
+	{value: "123456789012345678901234567890.000001", scale: 6, expected: "123456789012345678901234567890.000001"},
+	{value: "0.1234567", scale: 6, expectedError: "0.1234567 has more than 6 digits after the decimal point"},
+	{value: "1.5", scale: 0, expectedError: "1.5 has more than 0 digits after the decimal point"},
+	{value: "1e5", scale: 6, expectedError: "1e5 was not a decimal number"},
+	{value: ".5", scale: 6, expectedError: ".5 was not a decimal number"},
+	{value: "1/3", scale: 6, expectedError: "1/3 was not a decimal number"},
+	{value: "", scale: 6, expectedError: " was not a decimal number"},
+}
+
+func TestParseDecimal(t *testing.T) {
+	for _, tt := range _ParseDecimal {
+		t.Run(tt.value, func(t *testing.T) {
+			value, err := parseDecimal(tt.value, tt.scale)
+			if tt.expectedError != "" {
+				if err == nil || err.Error() != tt.expectedError {
+					t.Errorf("expected error %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual := formatDecimal(value, tt.scale); actual != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+var _Scale = []struct {
+	name     string
+	init     []string
+	invoke   []string
+	expected string
+}{
+	{
+		name:     "Default scale",
+		invoke:   []string{"update", "myvar", "0.1234567", "+"},
+		expected: "error: Provided value 0.1234567 has more than 6 digits after the decimal point",
+	},
+	{
+		name:     "Scale set by Init",
+		init:     []string{"", "8"},
+		invoke:   []string{"update", "myvar", "0.1234567", "+"},
+		expected: "Successfully added +0.1234567 to myvar",
+	},
+	{
+		name:     "Scale can't be set by a client",
+		invoke:   []string{"setScale", "8"},
+		expected: "error: Invalid Smart Contract function name.",
+	},
+}
+
+func TestScale(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+
+	for _, tt := range _Scale {
+		t.Run(tt.name, func(t *testing.T) {
+
+			//Prepare dynamic data
+			stub := newMapStub(t, 0, nil)
+
+			if tt.init != nil {
+				stub.args = tt.init
+				if actual := result(sc.Init(stub)); actual != "Scale set to 8" {
+					t.Fatalf("Init returned %q", actual)
+				}
+			}
+			stub.args = tt.invoke
+			if actual := result(sc.Invoke(stub)); actual != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+var _BatchUpdate = []struct {
+	name          string
+	args          []string
+	expected      string
+	expectedMyvar string
+	expectedOther string
+}{
+	{
+		name:          "OK",
+		args:          []string{"myvar", "0.5", "+", "other", "2", "-"},
+		expected:      "Successfully added deltas to 2 variables",
+		expectedMyvar: "1.5",
+		expectedOther: "5",
+	},
+	{
+		name:          "Variable appears twice",
+		args:          []string{"myvar", "0.5", "+", "myvar", "2", "-"},
+		expected:      "error: Variable myvar appears more than once in the batch",
+		expectedMyvar: "1",
+		expectedOther: "7",
+	},
+	{
+		name:          "Invalid delta",
+		args:          []string{"myvar", "0.5", "+", "other", "0.1234567", "-"},
+		expected:      "error: Invalid delta for other: Provided value 0.1234567 has more than 6 digits after the decimal point",
+		expectedMyvar: "1",
+		expectedOther: "7",
+	},
+	{
+		name:          "Invalid operation",
+		args:          []string{"myvar", "0.5", "*"},
+		expected:      "error: Invalid delta for myvar: Operator * is unrecognized",
+		expectedMyvar: "1",
+		expectedOther: "7",
+	},
+	{
+		name:          "Incomplete triple",
+		args:          []string{"myvar", "0.5"},
+		expected:      "error: Incorrect number of arguments, expecting a multiple of 3",
+		expectedMyvar: "1",
+		expectedOther: "7",
+	},
+}
+
+func TestBatchUpdate(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+
+	for _, tt := range _BatchUpdate {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := inAnyOrder(t, func(seed int64) string {
+
+				//Prepare dynamic data
+				stub := newMapStub(t, seed, map[string][]string{"myvar": {"+0.25", "+0.75"}, "other": {"+7"}})
+
+				response := result(sc.batchUpdate(stub, tt.args))
+				return fmt.Sprintf("%s|%s|%s", response, result(sc.get(stub, []string{"myvar"})), result(sc.get(stub, []string{"other"})))
+			})
+			expected := fmt.Sprintf("%s|%s|%s", tt.expected, tt.expectedMyvar, tt.expectedOther)
+			if actual != expected {
+				t.Errorf("expected %q, got %q", expected, actual)
+			}
+		})
+	}
+}
+
+var _Transfer = []struct {
+	name                string
+	args                []string
+	expected            string
+	expectedSource      string
+	expectedDestination string
+}{
+	{
+		name:                "OK",
+		args:                []string{"source", "destination", "0.5"},
+		expected:            "Successfully transferred 0.5 from source to destination",
+		expectedSource:      "0.5",
+		expectedDestination: "2.5",
+	},
+	{
+		name:                "Whole value",
+		args:                []string{"source", "destination", "1.000"},
+		expected:            "Successfully transferred 1 from source to destination",
+		expectedSource:      "0",
+		expectedDestination: "3",
+	},
+	{
+		name:                "To a new variable",
+		args:                []string{"source", "new", "0.1"},
+		expected:            "Successfully transferred 0.1 from source to new",
+		expectedSource:      "0.9",
+		expectedDestination: "0.1",
+	},
+	{
+		name:                "Source would go negative",
+		args:                []string{"source", "destination", "1.000001"},
+		expected:            "error: Insufficient value in source: 1, cannot transfer 1.000001",
+		expectedSource:      "1",
+		expectedDestination: "2",
+	},
+	{
+		name:                "Source doesn't exist",
+		args:                []string{"missing", "destination", "1"},
+		expected:            "error: No variable by the name missing exists",
+		expectedSource:      "1",
+		expectedDestination: "2",
+	},
+	{
+		name:                "Negative amount",
+		args:                []string{"destination", "source", "-1"},
+		expected:            "error: Provided amount must be positive",
+		expectedSource:      "1",
+		expectedDestination: "2",
+	},
+	{
+		name:                "Zero amount",
+		args:                []string{"source", "destination", "0"},
+		expected:            "error: Provided amount must be positive",
+		expectedSource:      "1",
+		expectedDestination: "2",
+	},
+	{
+		name:                "Same variable",
+		args:                []string{"source", "source", "0.5"},
+		expected:            "error: Source and destination must be different variables",
+		expectedSource:      "1",
+		expectedDestination: "2",
+	},
+}
+
+func TestTransfer(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+
+	for _, tt := range _Transfer {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := inAnyOrder(t, func(seed int64) string {
+
+				//Prepare dynamic data
+				stub := newMapStub(t, seed, map[string][]string{"source": {"+0.3", "+0.7", "-0.5", "+0.5"}, "destination": {"+2"}})
+				stub.txID = "transfer"
+
+				response := result(sc.transfer(stub, tt.args))
+				destination := tt.args[1]
+				if destination == "source" {
+					destination = "destination"
+				}
+				return fmt.Sprintf("%s|%s|%s", response, result(sc.get(stub, []string{"source"})), result(sc.get(stub, []string{destination})))
+			})
+			expected := fmt.Sprintf("%s|%s|%s", tt.expected, tt.expectedSource, tt.expectedDestination)
+			if actual != expected {
+				t.Errorf("expected %q, got %q", expected, actual)
+			}
+		})
+	}
+}
+
+var _CheckpointPrune = []struct {
+	name          string
+	deltas        []string
+	maxRows       string
+	steps         []string
+	expectedFinal string
+}{
+	{
+		name:    "Rows left over",
+		deltas:  []string{"+1", "+2", "+4", "-8", "+16.5"},
+		maxRows: "2",
+		steps: []string{
+			"rows 2, done false, value 15.5",
+			"rows 4, done false, value 15.5",
+			"rows 5, done true, value 15.5",
+			"rows 5, done true, value 15.5",
+		},
+		expectedFinal: `{"Value":15.5,"Rows":5,"Done":true}`,
+	},
+	{
+		name:    "No rows left over",
+		deltas:  []string{"+0.1", "+0.2", "+0.3", "-0.6"},
+		maxRows: "2",
+		steps: []string{
+			"rows 2, done false, value 0",
+			"rows 4, done false, value 0",
+			"rows 4, done true, value 0",
+		},
+		expectedFinal: `{"Value":0,"Rows":4,"Done":true}`,
+	},
+	{
+		name:          "All rows at once",
+		deltas:        []string{"+1", "+2"},
+		maxRows:       "100000",
+		steps:         []string{"rows 2, done true, value 3"},
+		expectedFinal: `{"Value":3,"Rows":2,"Done":true}`,
+	},
+	{
+		name:          "Variable doesn't exist",
+		maxRows:       "2",
+		expectedFinal: "error: No variable by the name myvar exists",
+	},
+	{
+		name:          "No rows",
+		deltas:        []string{"+1"},
+		maxRows:       "0",
+		expectedFinal: "error: Provided maximum number of rows was not a positive number",
+	},
+	{
+		name:          "Too many rows",
+		deltas:        []string{"+1"},
+		maxRows:       "100001",
+		expectedFinal: "error: Provided maximum number of rows exceeds the limit of 100000",
+	},
+}
+
+func TestCheckpointPrune(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+
+	for _, tt := range _CheckpointPrune {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := inAnyOrder(t, func(seed int64) string {
+
+				//Prepare dynamic data
+				stub := newMapStub(t, seed, map[string][]string{"myvar": tt.deltas, "other": {"+7"}})
+
+				// The value of a partial checkpoint depends on the order of the rows, the progress doesn't,
+				// and neither does the value of the variable
+				for i, expected := range tt.steps {
+					response := sc.checkpointPrune(stub, []string{"myvar", tt.maxRows})
+					if response.Status != shim.OK {
+						t.Fatalf("step %d failed: %s", i, response.Message)
+					}
+					var checkpoint Checkpoint
+					if err := json.Unmarshal(response.Payload, &checkpoint); err != nil {
+						t.Fatal(err)
+					}
+					actual := fmt.Sprintf("rows %d, done %t, value %s", checkpoint.Rows, checkpoint.Done, result(sc.get(stub, []string{"myvar"})))
+					if actual != expected {
+						t.Errorf("step %d: expected %q, got %q", i, expected, actual)
+					}
+				}
+				if fmt.Sprint(rows(stub, "other")) != "[+7]" {
+					t.Errorf("rows of another variable were pruned: %v", rows(stub, "other"))
+				}
+				return result(sc.checkpointPrune(stub, []string{"myvar", tt.maxRows}))
+			})
+			if actual != tt.expectedFinal {
+				t.Errorf("expected %q, got %q", tt.expectedFinal, actual)
+			}
+		})
+	}
+}
+
+func TestPruneCheckpoint(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+
+	// A prune folds the checkpoint of a checkpointed prune that is in progress and deletes it
+	actual := inAnyOrder(t, func(seed int64) string {
+
+		//Prepare dynamic data
+		stub := newMapStub(t, seed, map[string][]string{"myvar": {"+1", "+2", "+4", "-8", "+16.5"}})
+
+		result(sc.checkpointPrune(stub, []string{"myvar", "3"}))
+		response := result(sc.prune(stub, []string{"myvar"}))
+		checkpoint, _, err := getCheckpoint(stub, "myvar")
+		if err != nil || checkpoint != nil {
+			t.Errorf("checkpoint left after pruning: %v %v", checkpoint, err)
+		}
+		return fmt.Sprintf("%s|%v", response, rows(stub, "myvar"))
+	})
+	expected := "Successfully pruned variable myvar, final value is 15.5, 2 rows pruned|[+15.5]"
+	if actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// OutstandingPayment is a payment of a swap that has been calculated but not settled yet.
+// NettingID is set if the payment is part of a netting that has not been settled yet.
+type OutstandingPayment struct {
+	SwapID    string
+	Payer     string
+	Payee     string
+	Amount    uint64
+	NettingID string `json:"NettingID,omitempty" metadata:"NettingID,optional"`
+}
+
+// GetSwapsByParticipant returns all swaps the organization participates in
+func (s *SwapManager) GetSwapsByParticipant(ctx contractapi.TransactionContextInterface, participant string) ([]*InterestRateSwap, error) {
+	swaps, err := getSwaps(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*InterestRateSwap{}
+	for _, irs := range swaps {
+		if irs.PartyA == participant || irs.PartyB == participant {
+			result = append(result, irs)
+		}
+	}
+	return result, nil
+}
+
+// GetSwapsAboveAuditThreshold returns all swaps whose principal amount exceeds the
+// audit threshold set in Init, i.e. the swaps the auditor needs to endorse
+func (s *SwapManager) GetSwapsAboveAuditThreshold(ctx contractapi.TransactionContextInterface) ([]*InterestRateSwap, error) {
+	threshold, err := getAuditLimit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	swaps, err := getSwaps(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*InterestRateSwap{}
+	for _, irs := range swaps {
+		if irs.PrincipalAmount > threshold {
+			result = append(result, irs)
+		}
+	}
+	return result, nil
+}
+
+// GetOutstandingPayments returns all payments that have been calculated but not settled yet
+func (s *SwapManager) GetOutstandingPayments(ctx contractapi.TransactionContextInterface) ([]*OutstandingPayment, error) {
+	swaps, err := getSwaps(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*OutstandingPayment{}
+	for _, irs := range swaps {
+		paid, err := ctx.GetStub().GetState("payment" + irs.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read from world state: %v", err)
+		}
+		if paid == nil || string(paid) == "none" {
+			continue
+		}
+
+		outstanding := &OutstandingPayment{SwapID: irs.ID}
+		payment, err := strconv.ParseInt(string(paid), 10, 64)
+		if err != nil {
+			// the payment is part of a netting, which holds the amount
+			outstanding.NettingID = strings.TrimPrefix(string(paid), "netting")
+			netting, err := getNetting(ctx, outstanding.NettingID)
+			if err != nil {
+				return nil, err
+			}
+			payment = netting.Payments[irs.ID]
+		}
+		outstanding.Payer, outstanding.Payee, outstanding.Amount = obligation(irs, payment)
+		result = append(result, outstanding)
+	}
+	return result, nil
+}
+
+// getSwaps returns all swaps in the world state
+func getSwaps(ctx contractapi.TransactionContextInterface) ([]*InterestRateSwap, error) {
+	// all swap keys start with "swap", the range ends before "swaq"
+	swapIterator, err := ctx.GetStub().GetStateByRange("swap", "swaq")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get swaps: %v", err)
+	}
+	defer swapIterator.Close()
+
+	swaps := []*InterestRateSwap{}
+	for swapIterator.HasNext() {
+		swapKV, err := swapIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var irs InterestRateSwap
+		err = json.Unmarshal(swapKV.Value, &irs)
+		if err != nil {
+			return nil, err
+		}
+		irs.ID = strings.TrimPrefix(swapKV.Key, "swap")
+		swaps = append(swaps, &irs)
+	}
+	return swaps, nil
+}
@@ -0,0 +1,396 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/interest_rate_swaps/chaincode/swapmath"
+)
+
+// ReferenceRate defines how the submissions of the providers of a reference
+// rate are aggregated into fixings. A rate is fixed for a date once Quorum
+// providers have submitted a value for that date. The fixing is the median or
+// the trimmed mean (dropping TrimPercent of the submissions at either end) of
+// the submissions. Submissions deviating from the fixing by more than
+// OutlierBPS are flagged in a ReferenceRateOutliers event.
+type ReferenceRate struct {
+	Providers   []string
+	Quorum      int
+	Method      string
+	TrimPercent int
+	OutlierBPS  int64
+}
+
+// Submission is the value of a reference rate for a fixing date, as submitted
+// by a rate provider, together with the provider's signature of the
+// transaction proposal with ID TxID.
+type Submission struct {
+	Provider  string
+	RateBPS   int64
+	Date      string
+	Timestamp string
+	TxID      string
+	ProposalSignature
+}
+
+// Fixing is the value of a reference rate for a fixing date, aggregated from
+// the submissions of its providers. Only finalized fixings are stored, i.e.
+// fixings that reached the quorum of their reference rate. Timestamp is the
+// time of the transaction that reached the quorum.
+type Fixing struct {
+	RateBPS     int64
+	Date        string
+	Timestamp   string
+	Method      string
+	Submissions []*Submission
+	Outliers    []string `json:"Outliers,omitempty" metadata:"Outliers,optional"`
+}
+
+// outlierEvent provides an organized struct for emitting ReferenceRateOutliers events
+type outlierEvent struct {
+	ReferenceRate string
+	Date          string
+	RateBPS       int64
+	Outliers      []*Submission
+}
+
+// Aggregation methods
+const (
+	median      = swapmath.Median
+	trimmedMean = swapmath.TrimmedMean
+)
+
+const (
+	// layout of fixing dates
+	fixingDateLayout = "2006-01-02"
+	// how far the fixing date of a submission may be from the date of the transaction
+	maxFixingDistance = 24 * time.Hour
+	// default deviation from the fixing above which a submission is an outlier
+	defaultOutlierBPS = 50
+)
+
+// SetReferenceRate submits the value of a reference rate for a fixing date (YYYY-MM-DD)
+// as a provider of the rate. If fixingDate is empty, the date of the transaction is used,
+// otherwise it may be at most one day before or after the date of the transaction.
+// Every provider can submit one value per date, the submission records the transaction
+// timestamp and the provider's signature of the proposal. The submission that reaches
+// the quorum of the rate finalizes the fixing, later submissions for the date are rejected.
+func (s *SwapManager) SetReferenceRate(ctx contractapi.TransactionContextInterface, rateID string, rateBPS int64, fixingDate string) error {
+	rr, err := getReferenceRate(ctx, rateID)
+	if err != nil {
+		return err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	submission := &Submission{
+		RateBPS:   rateBPS,
+		Date:      now.Format(fixingDateLayout),
+		Timestamp: now.Format(time.RFC3339Nano),
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+	if fixingDate != "" {
+		date, err := time.Parse(fixingDateLayout, fixingDate)
+		if err != nil {
+			return fmt.Errorf("invalid fixing date %s: %v", fixingDate, err)
+		}
+		today, _ := time.Parse(fixingDateLayout, submission.Date)
+		distance := today.Sub(date)
+		if distance > maxFixingDistance || distance < -maxFixingDistance {
+			return fmt.Errorf("the fixing date %s is more than one day away from the transaction date %s", fixingDate, submission.Date)
+		}
+		submission.Date = date.Format(fixingDateLayout)
+	}
+	fixing, err := readFixing(ctx, rateID, submission.Date)
+	if err != nil {
+		return err
+	}
+	if fixing != nil {
+		return fmt.Errorf("the reference rate %s has already been fixed for %s", rateID, submission.Date)
+	}
+
+	// record who submitted the rate
+	submission.Provider, submission.ProposalSignature, err = signer(ctx)
+	if err != nil {
+		return err
+	}
+	if !contains(rr.Providers, submission.Provider) {
+		return fmt.Errorf("%s is not a provider of reference rate %s", submission.Provider, rateID)
+	}
+	submissionID := "submission" + rateID + "@" + submission.Date + "#" + submission.Provider
+	existing, err := ctx.GetStub().GetState(submissionID)
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if existing != nil {
+		return fmt.Errorf("%s has already submitted reference rate %s for %s", submission.Provider, rateID, submission.Date)
+	}
+
+	// writing the provider key requires the endorsement of the provider,
+	// the submission key gets the same endorsement policy
+	providerID := "rr" + rateID + "#" + submission.Provider
+	submissionJSON, err := json.Marshal(submission)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().PutState(providerID, submissionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put to world state: %v", err)
+	}
+	err = ctx.GetStub().PutState(submissionID, submissionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put to world state: %v", err)
+	}
+	err = setEndorsers(ctx, submissionID, submission.Provider)
+	if err != nil {
+		return err
+	}
+
+	// collect the submissions for the date, in the order of the providers
+	submissions := []*Submission{}
+	for _, provider := range rr.Providers {
+		if provider == submission.Provider {
+			submissions = append(submissions, submission)
+			continue
+		}
+		submissionJSON, err := ctx.GetStub().GetState("submission" + rateID + "@" + submission.Date + "#" + provider)
+		if err != nil {
+			return fmt.Errorf("failed to read from world state: %v", err)
+		}
+		if submissionJSON == nil {
+			continue
+		}
+		var s Submission
+		err = json.Unmarshal(submissionJSON, &s)
+		if err != nil {
+			return err
+		}
+		submissions = append(submissions, &s)
+	}
+	if len(submissions) < rr.Quorum {
+		log.Printf("Reference rate %s for %s has %d of %d submissions", rateID, submission.Date, len(submissions), rr.Quorum)
+		return nil
+	}
+
+	return finalizeFixing(ctx, rateID, rr, submission.Date, submissions)
+}
+
+// ConfigureReferenceRate changes how the submissions of a reference rate are aggregated.
+// method is "median" or "trimmedMean", trimPercent the percentage of submissions dropped
+// at either end by "trimmedMean". Since the reference rate definition is endorsed by all
+// its providers, they all have to agree on the change.
+func (s *SwapManager) ConfigureReferenceRate(ctx contractapi.TransactionContextInterface, rateID string, quorum int, method string, trimPercent int, outlierBPS int64) error {
+	rr, err := getReferenceRate(ctx, rateID)
+	if err != nil {
+		return err
+	}
+	rr.Quorum = quorum
+	rr.Method = method
+	rr.TrimPercent = trimPercent
+	rr.OutlierBPS = outlierBPS
+	err = validateReferenceRate(rr)
+	if err != nil {
+		return err
+	}
+
+	rrJSON, err := json.Marshal(rr)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().PutState("rr"+rateID, rrJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put to world state: %v", err)
+	}
+	return nil
+}
+
+// GetReferenceRate returns the definition of a reference rate
+func (s *SwapManager) GetReferenceRate(ctx contractapi.TransactionContextInterface, rateID string) (*ReferenceRate, error) {
+	return getReferenceRate(ctx, rateID)
+}
+
+// GetFixing returns the fixing of a reference rate for a date (YYYY-MM-DD)
+func (s *SwapManager) GetFixing(ctx contractapi.TransactionContextInterface, rateID string, fixingDate string) (*Fixing, error) {
+	fixing, err := readFixing(ctx, rateID, fixingDate)
+	if err != nil {
+		return nil, err
+	}
+	if fixing == nil {
+		return nil, fmt.Errorf("the reference rate %s has not been fixed for %s", rateID, fixingDate)
+	}
+	return fixing, nil
+}
+
+// defineReferenceRates creates the reference rates of the given providers. A rate may
+// have several providers. The definition of a rate is endorsed by all its providers,
+// every provider gets a key of its own that is endorsed by the provider alone.
+// By default, a rate is fixed at the median once a majority of its providers submitted.
+func defineReferenceRates(ctx contractapi.TransactionContextInterface, providers []RateProvider) error {
+	rateIDs := []string{}
+	rates := map[string]*ReferenceRate{}
+	for _, provider := range providers {
+		rr, ok := rates[provider.ReferenceRate]
+		if !ok {
+			rr = &ReferenceRate{Providers: []string{}, Method: median, OutlierBPS: defaultOutlierBPS}
+			rates[provider.ReferenceRate] = rr
+			rateIDs = append(rateIDs, provider.ReferenceRate)
+		}
+		if !contains(rr.Providers, provider.Provider) {
+			rr.Providers = append(rr.Providers, provider.Provider)
+		}
+	}
+
+	for _, rateID := range rateIDs {
+		rr := rates[rateID]
+		rr.Quorum = len(rr.Providers)/2 + 1
+		for _, org := range rr.Providers {
+			providerID := "rr" + rateID + "#" + org
+			err := ctx.GetStub().PutState(providerID, []byte("none"))
+			if err != nil {
+				return fmt.Errorf("failed to put to world state: %v", err)
+			}
+			err = setEndorsers(ctx, providerID, org)
+			if err != nil {
+				return err
+			}
+		}
+
+		rrID := "rr" + rateID
+		rrJSON, err := json.Marshal(rr)
+		if err != nil {
+			return err
+		}
+		err = ctx.GetStub().PutState(rrID, rrJSON)
+		if err != nil {
+			return fmt.Errorf("failed to put to world state: %v", err)
+		}
+		err = setEndorsers(ctx, rrID, rr.Providers...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finalizeFixing aggregates the submissions for a date into the fixing of the reference rate.
+// The fixing is endorsed by all providers of the rate, so it cannot be changed afterwards.
+func finalizeFixing(ctx contractapi.TransactionContextInterface, rateID string, rr *ReferenceRate, date string, submissions []*Submission) error {
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	fixing := &Fixing{
+		RateBPS:     aggregate(rr, submissions),
+		Date:        date,
+		Timestamp:   now.Format(time.RFC3339Nano),
+		Method:      rr.Method,
+		Submissions: submissions,
+	}
+	outliers := []*Submission{}
+	for _, s := range submissions {
+		if swapmath.IsOutlier(s.RateBPS, fixing.RateBPS, rr.OutlierBPS) {
+			outliers = append(outliers, s)
+			fixing.Outliers = append(fixing.Outliers, s.Provider)
+		}
+	}
+
+	fixingID := "fixing" + rateID + "@" + date
+	fixingJSON, err := json.Marshal(fixing)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().PutState(fixingID, fixingJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put to world state: %v", err)
+	}
+	err = setEndorsers(ctx, fixingID, rr.Providers...)
+	if err != nil {
+		return err
+	}
+	log.Printf("Reference rate %s fixed at %d for %s", rateID, fixing.RateBPS, date)
+
+	if len(outliers) > 0 {
+		eventJSON, err := json.Marshal(outlierEvent{rateID, date, fixing.RateBPS, outliers})
+		if err != nil {
+			return err
+		}
+		err = ctx.GetStub().SetEvent("ReferenceRateOutliers", eventJSON)
+		if err != nil {
+			return fmt.Errorf("failed to set event: %v", err)
+		}
+	}
+	return nil
+}
+
+// aggregate returns the median or trimmed mean of the submitted rates, rounded towards zero
+func aggregate(rr *ReferenceRate, submissions []*Submission) int64 {
+	rates := make([]int64, len(submissions))
+	for i, s := range submissions {
+		rates[i] = s.RateBPS
+	}
+	return swapmath.Aggregate(rr.Method, rr.TrimPercent, rates)
+}
+
+// getReferenceRate reads the definition of a reference rate
+func getReferenceRate(ctx contractapi.TransactionContextInterface, rateID string) (*ReferenceRate, error) {
+	rrJSON, err := ctx.GetStub().GetState("rr" + rateID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if rrJSON == nil {
+		return nil, fmt.Errorf("the reference rate %s does not exist", rateID)
+	}
+	var rr ReferenceRate
+	err = json.Unmarshal(rrJSON, &rr)
+	if err != nil {
+		return nil, err
+	}
+	return &rr, nil
+}
+
+// validateReferenceRate checks that the quorum and aggregation method of a reference rate are usable
+func validateReferenceRate(rr *ReferenceRate) error {
+	if rr.Quorum < 1 || rr.Quorum > len(rr.Providers) {
+		return fmt.Errorf("the quorum must be between 1 and the number of providers (%d)", len(rr.Providers))
+	}
+	switch rr.Method {
+	case median:
+	case trimmedMean:
+		// less than half is trimmed at either end, so at least one submission remains
+		if rr.TrimPercent < 0 || rr.TrimPercent >= 50 {
+			return fmt.Errorf("the trim percentage must be between 0 and 49")
+		}
+	default:
+		return fmt.Errorf("unsupported aggregation method %s", rr.Method)
+	}
+	if rr.OutlierBPS < 0 {
+		return fmt.Errorf("the outlier threshold must not be negative")
+	}
+	return nil
+}
+
+// readFixing returns the finalized fixing of a reference rate for a date, nil if the rate has not been fixed
+func readFixing(ctx contractapi.TransactionContextInterface, rateID string, date string) (*Fixing, error) {
+	fixingJSON, err := ctx.GetStub().GetState("fixing" + rateID + "@" + date)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if fixingJSON == nil {
+		return nil, nil
+	}
+	var fixing Fixing
+	err = json.Unmarshal(fixingJSON, &fixing)
+	if err != nil {
+		return nil, err
+	}
+	return &fixing, nil
+}
@@ -0,0 +1,362 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/interest_rate_swaps/chaincode/swapmath"
+)
+
+// Settlement records that a payment of a swap has been made off-chain.
+// Payer, Payee and Amount are given by the settlement instruction, Reference
+// identifies the transfer in the external payment system. NettingID is set
+// if the payment was settled as part of a netting. Submitter is the MSP ID of
+// the client that submitted the instruction, ProposalSignature its signature
+// of the transaction proposal with ID TxID.
+type Settlement struct {
+	SwapID    string
+	Payer     string
+	Payee     string
+	Amount    uint64
+	Reference string
+	NettingID string `json:"NettingID,omitempty" metadata:"NettingID,optional"`
+	Timestamp string
+	Submitter string
+	TxID      string
+	ProposalSignature
+}
+
+// Netting combines the outstanding payments of all swaps between two
+// participants into a single net obligation of Payer to pay Amount to Payee.
+// Payments holds the netted payment of every swap, from party A to party B
+// of the swap.
+type Netting struct {
+	ID        string
+	Payer     string
+	Payee     string
+	Amount    uint64
+	Payments  map[string]int64
+	Settled   bool
+	Reference string `json:"Reference,omitempty" metadata:"Reference,optional"`
+}
+
+// Define objectType names for prefix
+const settlementPrefix = "settlement"
+
+// SettlePayment settles the payment for a given swap.
+// The settlement instruction states who paid whom, it has to match the payment
+// due. It is recorded in the settlement history of the swap together with the
+// external reference of the transfer (e.g. a SWIFT message ID) and the
+// submitter's signature.
+func (s *SwapManager) SettlePayment(ctx contractapi.TransactionContextInterface, swapID string, payer string, payee string, amount uint64, reference string) error {
+	if reference == "" {
+		return fmt.Errorf("the settlement reference must not be empty")
+	}
+	paid, err := ctx.GetStub().GetState("payment" + swapID)
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if paid == nil {
+		return fmt.Errorf("unexpected error: payment entry is nil. This should not happen")
+	}
+	if string(paid) == "none" {
+		return fmt.Errorf("the payment has already been settled")
+	}
+	payment, err := strconv.ParseInt(string(paid), 10, 64)
+	if err != nil {
+		return fmt.Errorf("the payment of swap %s is part of a netting: %s", swapID, paid)
+	}
+
+	irs, err := getSwap(ctx, swapID)
+	if err != nil {
+		return err
+	}
+	instruction := &Settlement{
+		SwapID:    swapID,
+		Payer:     payer,
+		Payee:     payee,
+		Amount:    amount,
+		Reference: reference,
+	}
+	err = checkInstruction(irs, payment, instruction)
+	if err != nil {
+		return err
+	}
+	err = putSettlement(ctx, instruction)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState("payment"+swapID, []byte("none"))
+	if err != nil {
+		return fmt.Errorf("failed to put to world state: %v", err)
+	}
+	return nil
+}
+
+// NetPayments nets the outstanding payments of all swaps between two participants.
+// The payments are marked as part of the netting (the payment entries hold the
+// netting key instead of the amount), so they can only be settled together by
+// SettleNetting. Since the payment entries are updated, the transaction needs
+// to be endorsed according to the policies of all swaps involved.
+// The ID of the netting is the transaction ID.
+func (s *SwapManager) NetPayments(ctx contractapi.TransactionContextInterface, party1 string, party2 string) (*Netting, error) {
+	if party1 == party2 {
+		return nil, fmt.Errorf("payments can only be netted between two different participants")
+	}
+
+	netting := &Netting{
+		ID:       ctx.GetStub().GetTxID(),
+		Payments: map[string]int64{},
+	}
+	nettingID := "netting" + netting.ID
+
+	swaps, err := getSwaps(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	net := swapmath.NewNet(party1, party2)
+	ep, err := statebased.NewStateEP(nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, irs := range swaps {
+		if !(irs.PartyA == party1 && irs.PartyB == party2) && !(irs.PartyA == party2 && irs.PartyB == party1) {
+			continue
+		}
+
+		paymentID := "payment" + irs.ID
+		paid, err := ctx.GetStub().GetState(paymentID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read from world state: %v", err)
+		}
+		payment, err := strconv.ParseInt(string(paid), 10, 64)
+		if err != nil {
+			// settled or already netted
+			continue
+		}
+		netting.Payments[irs.ID] = payment
+		net.Add(irs.PartyA, payment)
+		err = ctx.GetStub().PutState(paymentID, []byte(nettingID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to put to world state: %v", err)
+		}
+
+		// the netting is endorsed by everyone endorsing the swaps
+		swapEP, err := ctx.GetStub().GetStateValidationParameter("swap" + irs.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get endorsement policy of swap %s: %v", irs.ID, err)
+		}
+		orgs, err := statebased.NewStateEP(swapEP)
+		if err != nil {
+			return nil, err
+		}
+		err = ep.AddOrgs(statebased.RoleTypePeer, orgs.ListOrgs()...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(netting.Payments) == 0 {
+		return nil, fmt.Errorf("no outstanding payments between %s and %s", party1, party2)
+	}
+
+	var ok bool
+	netting.Payer, netting.Payee, netting.Amount, ok = net.Obligation()
+	if !ok {
+		return nil, fmt.Errorf("the net amount is out of range")
+	}
+
+	err = putNetting(ctx, netting)
+	if err != nil {
+		return nil, err
+	}
+	epBytes, err := ep.Policy()
+	if err != nil {
+		return nil, err
+	}
+	err = ctx.GetStub().SetStateValidationParameter(nettingID, epBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set endorsement policy of %s: %v", nettingID, err)
+	}
+	return netting, nil
+}
+
+// SettleNetting settles the net obligation of a netting.
+// The settlement instruction has to match the net obligation. Every payment of
+// the netting is marked done and recorded in the settlement history of its swap
+// with the reference of the net transfer.
+func (s *SwapManager) SettleNetting(ctx contractapi.TransactionContextInterface, nettingID string, payer string, payee string, amount uint64, reference string) error {
+	if reference == "" {
+		return fmt.Errorf("the settlement reference must not be empty")
+	}
+	netting, err := getNetting(ctx, nettingID)
+	if err != nil {
+		return err
+	}
+	if netting.Settled {
+		return fmt.Errorf("the netting %s has already been settled", nettingID)
+	}
+	if !swapmath.MatchesObligation(netting.Payer, netting.Payee, netting.Amount, payer, payee, amount) {
+		return fmt.Errorf("the settlement instruction does not match the net obligation: %s pays %d to %s", netting.Payer, netting.Amount, netting.Payee)
+	}
+
+	swapIDs := make([]string, 0, len(netting.Payments))
+	for swapID := range netting.Payments {
+		swapIDs = append(swapIDs, swapID)
+	}
+	sort.Strings(swapIDs)
+	for _, swapID := range swapIDs {
+		irs, err := getSwap(ctx, swapID)
+		if err != nil {
+			return err
+		}
+		payer, payee, amount := obligation(irs, netting.Payments[swapID])
+		err = putSettlement(ctx, &Settlement{
+			SwapID:    swapID,
+			Payer:     payer,
+			Payee:     payee,
+			Amount:    amount,
+			Reference: reference,
+			NettingID: netting.ID,
+		})
+		if err != nil {
+			return err
+		}
+		err = ctx.GetStub().PutState("payment"+swapID, []byte("none"))
+		if err != nil {
+			return fmt.Errorf("failed to put to world state: %v", err)
+		}
+	}
+
+	netting.Settled = true
+	netting.Reference = reference
+	return putNetting(ctx, netting)
+}
+
+// GetNetting returns the netting stored in the world state with given id
+func (s *SwapManager) GetNetting(ctx contractapi.TransactionContextInterface, nettingID string) (*Netting, error) {
+	return getNetting(ctx, nettingID)
+}
+
+// GetSettlements returns the settlement history of a swap, ordered by time
+func (s *SwapManager) GetSettlements(ctx contractapi.TransactionContextInterface, swapID string) ([]*Settlement, error) {
+	settlementIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(settlementPrefix, []string{swapID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get settlements of swap %s: %v", swapID, err)
+	}
+	defer settlementIterator.Close()
+
+	settlements := []*Settlement{}
+	for settlementIterator.HasNext() {
+		settlementKV, err := settlementIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var settlement Settlement
+		err = json.Unmarshal(settlementKV.Value, &settlement)
+		if err != nil {
+			return nil, err
+		}
+		settlements = append(settlements, &settlement)
+	}
+	sort.SliceStable(settlements, func(i, j int) bool {
+		ti, _ := time.Parse(time.RFC3339Nano, settlements[i].Timestamp)
+		tj, _ := time.Parse(time.RFC3339Nano, settlements[j].Timestamp)
+		return ti.Before(tj)
+	})
+	return settlements, nil
+}
+
+// checkInstruction checks that a settlement instruction matches the payment due for a swap
+func checkInstruction(irs *InterestRateSwap, payment int64, instruction *Settlement) error {
+	if irs.PartyA == "" || irs.PartyB == "" {
+		return fmt.Errorf("the swap %s does not record its participants", instruction.SwapID)
+	}
+	payer, payee, amount := obligation(irs, payment)
+	if !swapmath.MatchesObligation(payer, payee, amount, instruction.Payer, instruction.Payee, instruction.Amount) {
+		return fmt.Errorf("the settlement instruction does not match the payment due: %s pays %d to %s", payer, amount, payee)
+	}
+	return nil
+}
+
+// obligation returns who pays whom for a payment from party A to party B of a swap
+func obligation(irs *InterestRateSwap, payment int64) (string, string, uint64) {
+	return swapmath.Obligation(irs.PartyA, irs.PartyB, payment)
+}
+
+// putSettlement records a settlement, signed by the submitter, in the settlement history of the swap.
+// The settlement entry gets the endorsement policy of the swap.
+func putSettlement(ctx contractapi.TransactionContextInterface, settlement *Settlement) error {
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	settlement.Timestamp = now.Format(time.RFC3339Nano)
+	settlement.TxID = ctx.GetStub().GetTxID()
+	settlement.Submitter, settlement.ProposalSignature, err = signer(ctx)
+	if err != nil {
+		return err
+	}
+
+	settlementID, err := ctx.GetStub().CreateCompositeKey(settlementPrefix, []string{settlement.SwapID, settlement.TxID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", settlementPrefix, err)
+	}
+	settlementJSON, err := json.Marshal(settlement)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().PutState(settlementID, settlementJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put to world state: %v", err)
+	}
+	epBytes, err := ctx.GetStub().GetStateValidationParameter("swap" + settlement.SwapID)
+	if err != nil {
+		return fmt.Errorf("failed to get endorsement policy of swap %s: %v", settlement.SwapID, err)
+	}
+	err = ctx.GetStub().SetStateValidationParameter(settlementID, epBytes)
+	if err != nil {
+		return fmt.Errorf("failed to set endorsement policy of %s: %v", settlementID, err)
+	}
+	return nil
+}
+
+// getNetting reads a netting from the world state
+func getNetting(ctx contractapi.TransactionContextInterface, nettingID string) (*Netting, error) {
+	nettingJSON, err := ctx.GetStub().GetState("netting" + nettingID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if nettingJSON == nil {
+		return nil, fmt.Errorf("the netting %s does not exist", nettingID)
+	}
+	var netting Netting
+	err = json.Unmarshal(nettingJSON, &netting)
+	if err != nil {
+		return nil, err
+	}
+	return &netting, nil
+}
+
+// putNetting writes a netting to the world state
+func putNetting(ctx contractapi.TransactionContextInterface, netting *Netting) error {
+	nettingJSON, err := json.Marshal(netting)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().PutState("netting"+netting.ID, nettingJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put to world state: %v", err)
+	}
+	return nil
+}
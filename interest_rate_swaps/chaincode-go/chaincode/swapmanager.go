@@ -0,0 +1,649 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package chaincode
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/interest_rate_swaps/chaincode/swapmath"
+)
+
+// SwapManager is the contract API version of the interest rate swap chaincode in
+// interest_rate_swaps/chaincode. It keeps the same ledger layout and the same
+// state-based endorsement policies:
+// -) the actual swap data ("swap" + ID)
+// -) the payment information ("payment" + ID), if "none", the payment has been settled
+// -) the last payment period calculated ("period" + ID)
+// -) the reference rate definition ("rr" + ID) and its providers ("rr" + ID + "#" + provider)
+// -) the reference rate submissions ("submission" + ID + "@" + date + "#" + provider)
+// -) the reference rate fixings ("fixing" + ID + "@" + date)
+// -) the settlements of a swap (composite key "settlement" + swap ID + transaction ID)
+// -) the nettings ("netting" + ID)
+type SwapManager struct {
+	contractapi.Contract
+}
+
+// InterestRateSwap represents an interest rate swap on the ledger
+// The swap is active between its start- and end-date (RFC3339).
+// The time between start- and end-date is divided into payment periods of
+// PaymentInterval nanoseconds, the last period ends at the end-date. At the end
+// of each period, two parties A and B exchange the following payments:
+// A->B PrincipalAmount * FixedRateBPS / 10000 * DayCountFraction
+// B->A PrincipalAmount * (ReferenceRateBPS + FloatingRateBPS) / 10000 * DayCountFraction
+// The reference rate of a period is the one fixed for the start date of the period.
+// The day count fraction of a period depends on the DayCountConvention of the swap,
+// "ACT/360" (the default) or "30/360".
+// ID, Status, TerminationDate, TerminationPayment, PartyA and PartyB are set by the contract.
+type InterestRateSwap struct {
+	ID                 string `json:"ID,omitempty" metadata:"ID,optional"`
+	StartDate          string
+	EndDate            string
+	PaymentInterval    int64
+	PrincipalAmount    uint64
+	FixedRateBPS       uint64
+	FloatingRateBPS    uint64
+	ReferenceRate      string
+	DayCountConvention string `json:"DayCountConvention,omitempty" metadata:"DayCountConvention,optional"`
+	Status             string `json:"Status,omitempty" metadata:"Status,optional"`
+	TerminationDate    string `json:"TerminationDate,omitempty" metadata:"TerminationDate,optional"`
+	TerminationPayment int64  `json:"TerminationPayment,omitempty" metadata:"TerminationPayment,optional"`
+	PartyA             string `json:"PartyA,omitempty" metadata:"PartyA,optional"`
+	PartyB             string `json:"PartyB,omitempty" metadata:"PartyB,optional"`
+}
+
+// PaymentPeriod is a period of a swap, at the end of which a payment is due.
+// ReferenceRateBPS and Payment are set once the payment has been calculated.
+type PaymentPeriod struct {
+	Period           int
+	StartDate        string
+	EndDate          string
+	FixingDate       string
+	ReferenceRateBPS int64 `json:"ReferenceRateBPS,omitempty" metadata:"ReferenceRateBPS,optional"`
+	Payment          int64 `json:"Payment,omitempty" metadata:"Payment,optional"`
+}
+
+// RateProvider is an organization providing a reference rate
+type RateProvider struct {
+	Provider      string
+	ReferenceRate string
+}
+
+// Status of swaps that are no longer active
+const (
+	statusMatured    = "matured"
+	statusTerminated = "terminated"
+)
+
+// Supported day count conventions
+const (
+	actual360 = swapmath.Actual360
+	thirty360 = swapmath.Thirty360
+)
+
+const (
+	// upper bound for the number of payment periods of a swap
+	maxPeriods = 1000
+	// key of the principal amount above which the auditor needs to be involved
+	auditLimitKey = "audit_limit"
+	// tolerated difference between the transaction timestamp and the time of the peer
+	maxClockSkew = 30 * time.Second
+)
+
+// ProposalSignature is the signature of a client of the transaction proposal it
+// submitted. Signature signs ProposalBytes, the serialized proposal with the
+// transaction ID and arguments, and can be verified with Certificate, the
+// certificate of the client. The fields are base64 encoded like the []byte
+// fields in the JSON of the shim chaincode.
+type ProposalSignature struct {
+	Certificate   string `json:"Certificate,omitempty" metadata:"Certificate,optional"`
+	ProposalBytes string `json:"ProposalBytes,omitempty" metadata:"ProposalBytes,optional"`
+	Signature     string `json:"Signature,omitempty" metadata:"Signature,optional"`
+}
+
+// Init sets the principal amount above which the auditor needs to be involved
+// and creates the reference rates, a rate may be provided by several organizations.
+// The audit limit is endorsed by the auditor, the reference rates by their providers.
+// Init can only be called once.
+func (s *SwapManager) Init(ctx contractapi.TransactionContextInterface, auditor string, auditLimit uint64, providers []RateProvider) error {
+	existing, err := ctx.GetStub().GetState(auditLimitKey)
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if existing != nil {
+		return fmt.Errorf("the chaincode has already been initialized")
+	}
+	if len(providers) == 0 {
+		return fmt.Errorf("at least one reference rate provider is required")
+	}
+
+	// set the limit above which the auditor needs to be involved, require it
+	// to be endorsed by the auditor
+	err = ctx.GetStub().PutState(auditLimitKey, []byte(strconv.FormatUint(auditLimit, 10)))
+	if err != nil {
+		return fmt.Errorf("failed to put to world state: %v", err)
+	}
+	err = setEndorsers(ctx, auditLimitKey, auditor)
+	if err != nil {
+		return err
+	}
+
+	// create the reference rates, require them to be endorsed by their providers
+	return defineReferenceRates(ctx, providers)
+}
+
+// CreateSwap creates a new swap among participants.
+// The creation of the swap needs to be endorsed by the chaincode endorsement policy.
+// Once created, the swap needs to be endorsed by its participants as well as the
+// auditor in case the principal amount of the swap exceeds the audit threshold.
+func (s *SwapManager) CreateSwap(ctx contractapi.TransactionContextInterface, swapID string, swap InterestRateSwap, partyA string, partyB string) error {
+	irs := &swap
+	err := validateSwap(irs)
+	if err != nil {
+		return err
+	}
+	existing, err := ctx.GetStub().GetState("swap" + swapID)
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if existing != nil {
+		return fmt.Errorf("the swap %s already exists", swapID)
+	}
+	irs.ID, irs.PartyA, irs.PartyB = swapID, partyA, partyB
+	err = putSwap(ctx, irs)
+	if err != nil {
+		return err
+	}
+
+	// get the auditing threshold
+	threshold, err := getAuditLimit(ctx)
+	if err != nil {
+		return err
+	}
+
+	// set endorsers
+	ep, err := statebased.NewStateEP(nil)
+	if err != nil {
+		return err
+	}
+	err = ep.AddOrgs(statebased.RoleTypePeer, partyA, partyB)
+	if err != nil {
+		return err
+	}
+	// if the swap principal amount exceeds the audit threshold set in init, the auditor needs to endorse as well
+	if irs.PrincipalAmount > threshold {
+		log.Printf("Adding auditor for swap %s with principal amount %v above threshold %v", swapID, irs.PrincipalAmount, threshold)
+		err = ep.AddOrgs(statebased.RoleTypePeer, "auditor")
+		if err != nil {
+			return err
+		}
+	}
+	epBytes, err := ep.Policy()
+	if err != nil {
+		return err
+	}
+
+	// create the keys for the payment and the last payment period calculated,
+	// with the same endorsement policy as the swap
+	err = ctx.GetStub().PutState("payment"+swapID, []byte("none"))
+	if err != nil {
+		return fmt.Errorf("failed to put to world state: %v", err)
+	}
+	err = ctx.GetStub().PutState("period"+swapID, []byte("-1"))
+	if err != nil {
+		return fmt.Errorf("failed to put to world state: %v", err)
+	}
+	for _, key := range []string{"swap" + swapID, "payment" + swapID, "period" + swapID} {
+		err = ctx.GetStub().SetStateValidationParameter(key, epBytes)
+		if err != nil {
+			return fmt.Errorf("failed to set endorsement policy of %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// GetSwap returns the swap stored in the world state with given id
+func (s *SwapManager) GetSwap(ctx contractapi.TransactionContextInterface, swapID string) (*InterestRateSwap, error) {
+	return getSwap(ctx, swapID)
+}
+
+// CalculatePayment calculates the payment due for a given payment period of a swap.
+// Periods have to be calculated in order, once they have ended. The reference rate
+// fixed for the start date of the period has to be finalized. The swap matures with
+// the payment of its last period.
+// Returns the net payment from party A to party B.
+func (s *SwapManager) CalculatePayment(ctx contractapi.TransactionContextInterface, swapID string, period int) (int64, error) {
+	irs, err := getSwap(ctx, swapID)
+	if err != nil {
+		return 0, err
+	}
+	if irs.Status != "" {
+		return 0, fmt.Errorf("the swap %s has %s", swapID, irs.Status)
+	}
+
+	// check if the previous payment has been settled
+	err = checkSettled(ctx, swapID)
+	if err != nil {
+		return 0, err
+	}
+
+	// check that the period is the next one to be calculated and that it has ended
+	lastPeriod, err := getLastPeriod(ctx, swapID)
+	if err != nil {
+		return 0, err
+	}
+	if period <= lastPeriod {
+		return 0, fmt.Errorf("the payment for period %d has already been calculated", period)
+	}
+	if period > lastPeriod+1 {
+		return 0, fmt.Errorf("the payment for period %d has to be calculated first", lastPeriod+1)
+	}
+	p, err := paymentPeriod(irs, period)
+	if err != nil {
+		return 0, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return 0, err
+	}
+	end, _ := time.Parse(time.RFC3339, p.EndDate) // Error handling not needed since paymentPeriod() formatted the date
+	// the timestamp may be ahead of the actual time by up to maxClockSkew
+	if now.Add(-maxClockSkew).Before(end) {
+		return 0, fmt.Errorf("period %d ends at %s, the payment cannot be calculated before", period, p.EndDate)
+	}
+
+	// get the reference rate fixed for the period
+	fixing, err := readFixing(ctx, irs.ReferenceRate, p.FixingDate)
+	if err != nil {
+		return 0, err
+	}
+	if fixing == nil {
+		return 0, fmt.Errorf("the reference rate %s has not been fixed for %s", irs.ReferenceRate, p.FixingDate)
+	}
+
+	// calculate payment
+	p.ReferenceRateBPS = fixing.RateBPS
+	p.Payment, err = accrue(irs, p)
+	if err != nil {
+		return 0, err
+	}
+	err = ctx.GetStub().PutState("payment"+swapID, []byte(strconv.FormatInt(p.Payment, 10)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to put to world state: %v", err)
+	}
+	periodJSON, err := json.Marshal(p)
+	if err != nil {
+		return 0, err
+	}
+	err = ctx.GetStub().PutState("period"+swapID, periodJSON)
+	if err != nil {
+		return 0, fmt.Errorf("failed to put to world state: %v", err)
+	}
+
+	// the swap matures with the payment of its last period
+	if period == periodCount(irs)-1 {
+		irs.Status = statusMatured
+		err = putSwap(ctx, irs)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return p.Payment, nil
+}
+
+// GetPaymentSchedule returns the payment periods of a swap
+func (s *SwapManager) GetPaymentSchedule(ctx contractapi.TransactionContextInterface, swapID string) ([]*PaymentPeriod, error) {
+	irs, err := getSwap(ctx, swapID)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule := []*PaymentPeriod{}
+	for period := 0; period < periodCount(irs); period++ {
+		p, err := paymentPeriod(irs, period)
+		if err != nil {
+			return nil, err
+		}
+		schedule = append(schedule, p)
+	}
+	return schedule, nil
+}
+
+// TerminateSwap terminates a swap before its end date.
+// The termination payment is the net payment from party A to party B the two
+// parties agreed on, it replaces all remaining payments of the swap. Since the
+// payment entry is updated, the transaction needs to be endorsed by both
+// parties (and the auditor, if required).
+func (s *SwapManager) TerminateSwap(ctx contractapi.TransactionContextInterface, swapID string, terminationPayment int64) error {
+	irs, err := getSwap(ctx, swapID)
+	if err != nil {
+		return err
+	}
+	if irs.Status != "" {
+		return fmt.Errorf("the swap %s has %s", swapID, irs.Status)
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	end, _ := time.Parse(time.RFC3339, irs.EndDate) // Error handling not needed since validateSwap() checked the date
+	if !now.Before(end) {
+		return fmt.Errorf("the swap %s has ended, it can only mature", swapID)
+	}
+
+	// check if the previous payment has been settled
+	err = checkSettled(ctx, swapID)
+	if err != nil {
+		return err
+	}
+
+	irs.Status = statusTerminated
+	irs.TerminationDate = now.Format(time.RFC3339Nano)
+	irs.TerminationPayment = terminationPayment
+	err = putSwap(ctx, irs)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().PutState("payment"+swapID, []byte(strconv.FormatInt(terminationPayment, 10)))
+	if err != nil {
+		return fmt.Errorf("failed to put to world state: %v", err)
+	}
+	return nil
+}
+
+// NovateSwap replaces a participant of a swap by another organization.
+// The endorsement policies of the swap, payment and period entries are changed
+// to the new participant. The change is endorsed according to the current
+// policies, i.e. by the participant stepping out and the remaining participant
+// (and the auditor, if required).
+func (s *SwapManager) NovateSwap(ctx contractapi.TransactionContextInterface, swapID string, oldParticipant string, newParticipant string) error {
+	if oldParticipant == "auditor" || newParticipant == "auditor" {
+		return fmt.Errorf("the auditor cannot be a participant of a swap")
+	}
+
+	irs, err := getSwap(ctx, swapID)
+	if err != nil {
+		return err
+	}
+	if irs.Status != "" {
+		return fmt.Errorf("the swap %s has %s", swapID, irs.Status)
+	}
+
+	epBytes, err := ctx.GetStub().GetStateValidationParameter("swap" + swapID)
+	if err != nil {
+		return fmt.Errorf("failed to get endorsement policy of swap %s: %v", swapID, err)
+	}
+	ep, err := statebased.NewStateEP(epBytes)
+	if err != nil {
+		return err
+	}
+	orgs := ep.ListOrgs()
+	if !contains(orgs, oldParticipant) {
+		return fmt.Errorf("%s is not a participant of swap %s", oldParticipant, swapID)
+	}
+	if contains(orgs, newParticipant) {
+		return fmt.Errorf("%s is already a participant of swap %s", newParticipant, swapID)
+	}
+	err = checkSettled(ctx, swapID)
+	if err != nil {
+		return err
+	}
+	switch oldParticipant {
+	case irs.PartyA:
+		irs.PartyA = newParticipant
+	case irs.PartyB:
+		irs.PartyB = newParticipant
+	}
+	err = putSwap(ctx, irs)
+	if err != nil {
+		return err
+	}
+
+	ep.DelOrgs(oldParticipant)
+	err = ep.AddOrgs(statebased.RoleTypePeer, newParticipant)
+	if err != nil {
+		return err
+	}
+	epBytes, err = ep.Policy()
+	if err != nil {
+		return err
+	}
+	for _, key := range []string{"swap" + swapID, "payment" + swapID, "period" + swapID} {
+		value, err := ctx.GetStub().GetState(key)
+		if err != nil {
+			return fmt.Errorf("failed to read from world state: %v", err)
+		}
+		if value == nil {
+			// swaps created before payment periods were introduced have no period entry
+			continue
+		}
+		err = ctx.GetStub().SetStateValidationParameter(key, epBytes)
+		if err != nil {
+			return fmt.Errorf("failed to set endorsement policy of %s: %v", key, err)
+		}
+	}
+	log.Printf("Swap %s novated from %s to %s", swapID, oldParticipant, newParticipant)
+	return nil
+}
+
+// getSwap reads a swap from the world state
+func getSwap(ctx contractapi.TransactionContextInterface, swapID string) (*InterestRateSwap, error) {
+	irsJSON, err := ctx.GetStub().GetState("swap" + swapID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if irsJSON == nil {
+		return nil, fmt.Errorf("the swap %s does not exist", swapID)
+	}
+	var irs InterestRateSwap
+	err = json.Unmarshal(irsJSON, &irs)
+	if err != nil {
+		return nil, err
+	}
+	// swaps created by the shim chaincode don't store their ID
+	irs.ID = swapID
+	return &irs, nil
+}
+
+// putSwap writes a swap to the world state, keeping its endorsement policy
+func putSwap(ctx contractapi.TransactionContextInterface, irs *InterestRateSwap) error {
+	irsJSON, err := json.Marshal(irs)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().PutState("swap"+irs.ID, irsJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put to world state: %v", err)
+	}
+	return nil
+}
+
+// getAuditLimit reads the principal amount above which the auditor needs to be involved
+func getAuditLimit(ctx contractapi.TransactionContextInterface) (uint64, error) {
+	auditLimit, err := ctx.GetStub().GetState(auditLimitKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if auditLimit == nil {
+		return 0, fmt.Errorf("the chaincode has not been initialized, call Init() first")
+	}
+	return strconv.ParseUint(string(auditLimit), 10, 64)
+}
+
+// checkSettled checks that the payment of a swap has been settled
+func checkSettled(ctx contractapi.TransactionContextInterface, swapID string) error {
+	paid, err := ctx.GetStub().GetState("payment" + swapID)
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if paid == nil {
+		return fmt.Errorf("unexpected error: payment entry is nil. This should not happen")
+	}
+	if string(paid) != "none" {
+		return fmt.Errorf("the previous payment has not been settled yet")
+	}
+	return nil
+}
+
+// validateSwap checks that the dates and day count convention of a swap are usable
+func validateSwap(irs *InterestRateSwap) error {
+	start, err := time.Parse(time.RFC3339, irs.StartDate)
+	if err != nil {
+		return fmt.Errorf("invalid StartDate: %v", err)
+	}
+	end, err := time.Parse(time.RFC3339, irs.EndDate)
+	if err != nil {
+		return fmt.Errorf("invalid EndDate: %v", err)
+	}
+	if !end.After(start) {
+		return fmt.Errorf("EndDate must be after StartDate")
+	}
+	if irs.PaymentInterval <= 0 {
+		return fmt.Errorf("PaymentInterval must be positive")
+	}
+	if periodCount(irs) > maxPeriods {
+		return fmt.Errorf("a swap must not have more than %d payment periods", maxPeriods)
+	}
+	switch irs.DayCountConvention {
+	case "", actual360, thirty360:
+	default:
+		return fmt.Errorf("unsupported day count convention %s", irs.DayCountConvention)
+	}
+	if irs.Status != "" || irs.TerminationDate != "" || irs.TerminationPayment != 0 {
+		return fmt.Errorf("a new swap must not be terminated or matured")
+	}
+	return nil
+}
+
+// periodCount returns the number of payment periods of a swap
+func periodCount(irs *InterestRateSwap) int {
+	start, _ := time.Parse(time.RFC3339, irs.StartDate)
+	end, _ := time.Parse(time.RFC3339, irs.EndDate)
+	return swapmath.PeriodCount(start, end, time.Duration(irs.PaymentInterval))
+}
+
+// paymentPeriod returns a payment period of a swap, the last period ends at the end date of the swap
+func paymentPeriod(irs *InterestRateSwap, period int) (*PaymentPeriod, error) {
+	if period < 0 || period >= periodCount(irs) {
+		return nil, fmt.Errorf("the swap has no payment period %d", period)
+	}
+	swapStart, _ := time.Parse(time.RFC3339, irs.StartDate)
+	swapEnd, _ := time.Parse(time.RFC3339, irs.EndDate)
+	start, end := swapmath.PeriodDates(swapStart, swapEnd, time.Duration(irs.PaymentInterval), period)
+	return &PaymentPeriod{
+		Period:     period,
+		StartDate:  start.Format(time.RFC3339Nano),
+		EndDate:    end.Format(time.RFC3339Nano),
+		FixingDate: start.UTC().Format(fixingDateLayout),
+	}, nil
+}
+
+// getLastPeriod returns the last payment period calculated, -1 if there is none
+func getLastPeriod(ctx contractapi.TransactionContextInterface, swapID string) (int, error) {
+	periodJSON, err := ctx.GetStub().GetState("period" + swapID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if periodJSON == nil || string(periodJSON) == "-1" {
+		return -1, nil
+	}
+	var p PaymentPeriod
+	err = json.Unmarshal(periodJSON, &p)
+	if err != nil {
+		return 0, err
+	}
+	return p.Period, nil
+}
+
+// accrue calculates the net payment from A to B for a payment period, rounded towards zero:
+// PrincipalAmount * (FixedRateBPS - ReferenceRateBPS - FloatingRateBPS) / 10000 * days / 360
+func accrue(irs *InterestRateSwap, p *PaymentPeriod) (int64, error) {
+	start, _ := time.Parse(time.RFC3339, p.StartDate)
+	end, _ := time.Parse(time.RFC3339, p.EndDate)
+	payment, ok := swapmath.Accrue(irs.PrincipalAmount, irs.FixedRateBPS, irs.FloatingRateBPS, p.ReferenceRateBPS, irs.DayCountConvention, start, end)
+	if !ok {
+		return 0, fmt.Errorf("the payment for period %d is out of range", p.Period)
+	}
+	return payment, nil
+}
+
+// signer returns the MSP ID of the client submitting the transaction and its signature of the proposal
+func signer(ctx contractapi.TransactionContextInterface) (string, ProposalSignature, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", ProposalSignature{}, fmt.Errorf("failed to get MSP ID: %v", err)
+	}
+	signedProposal, err := ctx.GetStub().GetSignedProposal()
+	if err != nil {
+		return "", ProposalSignature{}, fmt.Errorf("failed to get signed proposal: %v", err)
+	}
+	if signedProposal == nil {
+		return mspID, ProposalSignature{}, nil
+	}
+	cert, err := ctx.GetClientIdentity().GetX509Certificate()
+	if err != nil {
+		return "", ProposalSignature{}, fmt.Errorf("failed to get client certificate: %v", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	return mspID, ProposalSignature{
+		Certificate:   base64.StdEncoding.EncodeToString(certPEM),
+		ProposalBytes: base64.StdEncoding.EncodeToString(signedProposal.ProposalBytes),
+		Signature:     base64.StdEncoding.EncodeToString(signedProposal.Signature),
+	}, nil
+}
+
+// txTime returns the timestamp of the transaction. The timestamp is set by the
+// client, it is rejected if it is more than maxClockSkew away from the time of the peer.
+func txTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	ts, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	t := time.Unix(ts.Seconds, int64(ts.Nanos)).UTC()
+	skew := time.Since(t)
+	if skew > maxClockSkew || skew < -maxClockSkew {
+		return time.Time{}, fmt.Errorf("the transaction timestamp %s is more than %s away from the time of the peer", t.Format(time.RFC3339), maxClockSkew)
+	}
+	return t, nil
+}
+
+// setEndorsers sets the endorsement policy of a key to require all given organizations
+func setEndorsers(ctx contractapi.TransactionContextInterface, key string, orgs ...string) error {
+	ep, err := statebased.NewStateEP(nil)
+	if err != nil {
+		return err
+	}
+	err = ep.AddOrgs(statebased.RoleTypePeer, orgs...)
+	if err != nil {
+		return err
+	}
+	epBytes, err := ep.Policy()
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().SetStateValidationParameter(key, epBytes)
+	if err != nil {
+		return fmt.Errorf("failed to set endorsement policy of %s: %v", key, err)
+	}
+	return nil
+}
+
+// contains checks if an organization is in a list
+func contains(orgs []string, org string) bool {
+	for _, o := range orgs {
+		if o == org {
+			return true
+		}
+	}
+	return false
+}
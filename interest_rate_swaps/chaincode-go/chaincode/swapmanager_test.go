@@ -0,0 +1,314 @@
+package chaincode_test
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-samples/interest_rate_swaps/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/interest_rate_swaps/chaincode-go/chaincode/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+//go:generate counterfeiter -o mocks/transaction.go -fake-name TransactionContext . transactionContext
+type transactionContext interface {
+	contractapi.TransactionContextInterface
+}
+
+//go:generate counterfeiter -o mocks/chaincodestub.go -fake-name ChaincodeStub . chaincodeStub
+type chaincodeStub interface {
+	shim.ChaincodeStubInterface
+}
+
+//go:generate counterfeiter -o mocks/statequeryiterator.go -fake-name StateQueryIterator . stateQueryIterator
+type stateQueryIterator interface {
+	shim.StateQueryIteratorInterface
+}
+
+//go:generate counterfeiter -o mocks/clientIdentity.go -fake-name ClientIdentity . clientIdentity
+type clientIdentity interface {
+	cid.ClientIdentity
+}
+
+// newTransactionContext returns a transaction context of a client of the given
+// organization, whose stub reads and writes the given world state
+func newTransactionContext(mspID string, state map[string][]byte, now time.Time) (*mocks.TransactionContext, *mocks.ChaincodeStub) {
+	chaincodeStub := &mocks.ChaincodeStub{}
+	chaincodeStub.GetStateStub = func(key string) ([]byte, error) {
+		return state[key], nil
+	}
+	chaincodeStub.PutStateStub = func(key string, value []byte) error {
+		state[key] = value
+		return nil
+	}
+	chaincodeStub.GetStateByRangeStub = func(startKey string, endKey string) (shim.StateQueryIteratorInterface, error) {
+		keys := []string{}
+		for key := range state {
+			if key >= startKey && key < endKey {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		iterator := &mocks.StateQueryIterator{}
+		iterator.HasNextStub = func() bool {
+			return iterator.NextCallCount() < len(keys)
+		}
+		iterator.NextStub = func() (*queryresult.KV, error) {
+			key := keys[iterator.NextCallCount()-1]
+			return &queryresult.KV{Key: key, Value: state[key]}, nil
+		}
+		return iterator, nil
+	}
+	chaincodeStub.GetTxIDReturns("tx1")
+	chaincodeStub.GetTxTimestampReturns(&timestamp.Timestamp{Seconds: now.Unix(), Nanos: int32(now.Nanosecond())}, nil)
+
+	clientIdentity := &mocks.ClientIdentity{}
+	clientIdentity.GetMSPIDReturns(mspID, nil)
+	clientIdentity.GetX509CertificateReturns(&x509.Certificate{Raw: []byte(mspID)}, nil)
+
+	transactionContext := &mocks.TransactionContext{}
+	transactionContext.GetStubReturns(chaincodeStub)
+	transactionContext.GetClientIdentityReturns(clientIdentity)
+	return transactionContext, chaincodeStub
+}
+
+// endorsementPolicies returns the key-level endorsement policies set in a transaction
+func endorsementPolicies(chaincodeStub *mocks.ChaincodeStub) map[string][]byte {
+	policies := map[string][]byte{}
+	for i := 0; i < chaincodeStub.SetStateValidationParameterCallCount(); i++ {
+		key, policy := chaincodeStub.SetStateValidationParameterArgsForCall(i)
+		policies[key] = policy
+	}
+	return policies
+}
+
+// policy returns the endorsement policy the shim chaincode in interest_rate_swaps/chaincode
+// sets for a key endorsed by the given organizations
+func policy(t *testing.T, orgs ...string) []byte {
+	ep, err := statebased.NewStateEP(nil)
+	require.NoError(t, err)
+	err = ep.AddOrgs(statebased.RoleTypePeer, orgs...)
+	require.NoError(t, err)
+	policy, err := ep.Policy()
+	require.NoError(t, err)
+	return policy
+}
+
+func newSwap(startDate string, endDate string, principalAmount uint64) chaincode.InterestRateSwap {
+	return chaincode.InterestRateSwap{
+		StartDate:       startDate,
+		EndDate:         endDate,
+		PaymentInterval: int64(24 * time.Hour),
+		PrincipalAmount: principalAmount,
+		FixedRateBPS:    400,
+		FloatingRateBPS: 500,
+		ReferenceRate:   "libor",
+	}
+}
+
+func TestInit(t *testing.T) {
+	state := map[string][]byte{}
+	transactionContext, chaincodeStub := newTransactionContext("Org1MSP", state, time.Now())
+	providers := []chaincode.RateProvider{
+		{Provider: "lse", ReferenceRate: "libor"},
+		{Provider: "ice", ReferenceRate: "libor"},
+		{Provider: "ecb", ReferenceRate: "euribor"},
+	}
+
+	swapManager := chaincode.SwapManager{}
+	err := swapManager.Init(transactionContext, "auditor", 1000, providers)
+	require.NoError(t, err)
+	require.Equal(t, []byte("1000"), state["audit_limit"])
+	require.Equal(t, map[string][]byte{
+		"audit_limit":   policy(t, "auditor"),
+		"rrlibor#lse":   policy(t, "lse"),
+		"rrlibor#ice":   policy(t, "ice"),
+		"rrlibor":       policy(t, "lse", "ice"),
+		"rreuribor#ecb": policy(t, "ecb"),
+		"rreuribor":     policy(t, "ecb"),
+	}, endorsementPolicies(chaincodeStub))
+
+	rr, err := swapManager.GetReferenceRate(transactionContext, "libor")
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.ReferenceRate{Providers: []string{"lse", "ice"}, Quorum: 2, Method: "median", OutlierBPS: 50}, rr)
+
+	err = swapManager.Init(transactionContext, "auditor", 1000, providers)
+	require.EqualError(t, err, "the chaincode has already been initialized")
+
+	transactionContext, _ = newTransactionContext("Org1MSP", map[string][]byte{}, time.Now())
+	err = swapManager.Init(transactionContext, "auditor", 1000, nil)
+	require.EqualError(t, err, "at least one reference rate provider is required")
+}
+
+func TestCreateSwap(t *testing.T) {
+	state := map[string][]byte{"audit_limit": []byte("1000")}
+	transactionContext, chaincodeStub := newTransactionContext("Org1MSP", state, time.Now())
+
+	swapManager := chaincode.SwapManager{}
+	err := swapManager.CreateSwap(transactionContext, "1", newSwap("2018-09-27T15:04:05Z", "2018-09-30T15:04:05Z", 1000), "partya", "partyb")
+	require.NoError(t, err)
+	require.Equal(t, []byte("none"), state["payment1"])
+	require.Equal(t, []byte("-1"), state["period1"])
+	require.Equal(t, map[string][]byte{
+		"swap1":    policy(t, "partya", "partyb"),
+		"payment1": policy(t, "partya", "partyb"),
+		"period1":  policy(t, "partya", "partyb"),
+	}, endorsementPolicies(chaincodeStub))
+
+	swap, err := swapManager.GetSwap(transactionContext, "1")
+	require.NoError(t, err)
+	require.Equal(t, "partya", swap.PartyA)
+	require.Equal(t, "partyb", swap.PartyB)
+
+	// the auditor endorses swaps above the audit threshold
+	transactionContext, chaincodeStub = newTransactionContext("Org1MSP", state, time.Now())
+	err = swapManager.CreateSwap(transactionContext, "2", newSwap("2018-09-27T15:04:05Z", "2018-09-30T15:04:05Z", 1001), "partya", "partyb")
+	require.NoError(t, err)
+	require.Equal(t, map[string][]byte{
+		"swap2":    policy(t, "partya", "partyb", "auditor"),
+		"payment2": policy(t, "partya", "partyb", "auditor"),
+		"period2":  policy(t, "partya", "partyb", "auditor"),
+	}, endorsementPolicies(chaincodeStub))
+
+	err = swapManager.CreateSwap(transactionContext, "1", newSwap("2018-09-27T15:04:05Z", "2018-09-30T15:04:05Z", 1000), "partya", "partyb")
+	require.EqualError(t, err, "the swap 1 already exists")
+
+	err = swapManager.CreateSwap(transactionContext, "3", newSwap("2018-09-30T15:04:05Z", "2018-09-27T15:04:05Z", 1000), "partya", "partyb")
+	require.EqualError(t, err, "EndDate must be after StartDate")
+}
+
+func TestSetReferenceRate(t *testing.T) {
+	rr, err := json.Marshal(&chaincode.ReferenceRate{Providers: []string{"lse", "ice", "ecb"}, Quorum: 3, Method: "median", OutlierBPS: 50})
+	require.NoError(t, err)
+	state := map[string][]byte{"rrlibor": rr}
+	swapManager := chaincode.SwapManager{}
+	// providers submit the rate for the previous day
+	fixingDate := time.Now().UTC().AddDate(0, 0, -1).Format("2006-01-02")
+
+	for _, submission := range []struct {
+		provider string
+		rateBPS  int64
+	}{{"lse", 27}, {"ice", 25}, {"ecb", 100}} {
+		transactionContext, chaincodeStub := newTransactionContext(submission.provider, state, time.Now())
+		chaincodeStub.GetSignedProposalReturns(&peer.SignedProposal{ProposalBytes: []byte("proposal"), Signature: []byte("signature")}, nil)
+		err = swapManager.SetReferenceRate(transactionContext, "libor", submission.rateBPS, fixingDate)
+		require.NoError(t, err)
+	}
+
+	transactionContext, _ := newTransactionContext("lse", state, time.Now())
+	fixing, err := swapManager.GetFixing(transactionContext, "libor", fixingDate)
+	require.NoError(t, err)
+	require.Equal(t, int64(27), fixing.RateBPS)
+	require.Equal(t, []string{"ecb"}, fixing.Outliers)
+	require.Len(t, fixing.Submissions, 3)
+	require.Equal(t, chaincode.ProposalSignature{
+		Certificate:   "LS0tLS1CRUdJTiBDRVJUSUZJQ0FURS0tLS0tCmJITmwKLS0tLS1FTkQgQ0VSVElGSUNBVEUtLS0tLQo=",
+		ProposalBytes: "cHJvcG9zYWw=",
+		Signature:     "c2lnbmF0dXJl",
+	}, fixing.Submissions[0].ProposalSignature)
+
+	err = swapManager.SetReferenceRate(transactionContext, "libor", 27, fixingDate)
+	require.EqualError(t, err, "the reference rate libor has already been fixed for "+fixingDate)
+
+	// the fixing date has to be close to the date of the transaction
+	err = swapManager.SetReferenceRate(transactionContext, "libor", 27, "2018-09-28")
+	require.Error(t, err)
+	require.True(t, strings.HasPrefix(err.Error(), "the fixing date 2018-09-28 is more than one day away from the transaction date"))
+
+	transactionContext, _ = newTransactionContext("lse", state, time.Now().Add(time.Minute))
+	err = swapManager.SetReferenceRate(transactionContext, "libor", 27, "")
+	require.Error(t, err)
+	require.True(t, strings.HasSuffix(err.Error(), "is more than 30s away from the time of the peer"))
+}
+
+func TestCalculatePayment(t *testing.T) {
+	fixing, err := json.Marshal(&chaincode.Fixing{RateBPS: 27, Date: "2018-09-27"})
+	require.NoError(t, err)
+	state := map[string][]byte{
+		"audit_limit":            []byte("1000000000"),
+		"fixinglibor@2018-09-27": fixing,
+		"fixinglibor@2018-09-28": fixing,
+		"fixinglibor@2018-09-29": fixing,
+	}
+	transactionContext, _ := newTransactionContext("partya", state, time.Now())
+
+	swapManager := chaincode.SwapManager{}
+	err = swapManager.CreateSwap(transactionContext, "1", newSwap("2018-09-27T15:04:05Z", "2018-09-30T15:04:05Z", 10000000), "partya", "partyb")
+	require.NoError(t, err)
+
+	// 10000000 * (400 - 27 - 500) / 10000 * 1 / 360
+	payment, err := swapManager.CalculatePayment(transactionContext, "1", 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(-352), payment)
+	require.Equal(t, []byte("-352"), state["payment1"])
+
+	_, err = swapManager.CalculatePayment(transactionContext, "1", 1)
+	require.EqualError(t, err, "the previous payment has not been settled yet")
+
+	// the end of the period has to be more than the tolerated clock skew before the transaction
+	now := time.Now()
+	start := now.Add(-24*time.Hour - 10*time.Second).UTC().Truncate(time.Second)
+	err = swapManager.CreateSwap(transactionContext, "2", newSwap(start.Format(time.RFC3339), start.Add(48*time.Hour).Format(time.RFC3339), 10000000), "partya", "partyb")
+	require.NoError(t, err)
+	_, err = swapManager.CalculatePayment(transactionContext, "2", 0)
+	require.EqualError(t, err, fmt.Sprintf("period 0 ends at %s, the payment cannot be calculated before", start.Add(24*time.Hour).Format(time.RFC3339)))
+}
+
+func TestQueries(t *testing.T) {
+	state := map[string][]byte{"audit_limit": []byte("1000")}
+	transactionContext, _ := newTransactionContext("partya", state, time.Now())
+
+	swapManager := chaincode.SwapManager{}
+	for _, swap := range []struct {
+		id              string
+		principalAmount uint64
+		partyA          string
+		partyB          string
+	}{{"1", 100, "partya", "partyb"}, {"2", 5000, "partya", "partyc"}, {"3", 20, "partyb", "partyc"}} {
+		err := swapManager.CreateSwap(transactionContext, swap.id, newSwap("2018-09-27T15:04:05Z", "2018-09-30T15:04:05Z", swap.principalAmount), swap.partyA, swap.partyB)
+		require.NoError(t, err)
+	}
+	netting, err := json.Marshal(&chaincode.Netting{ID: "tx0", Payer: "partyc", Payee: "partyb", Amount: 40, Payments: map[string]int64{"3": -40}})
+	require.NoError(t, err)
+	state["nettingtx0"] = netting
+	state["payment1"] = []byte("-352")
+	state["payment3"] = []byte("nettingtx0")
+
+	swaps, err := swapManager.GetSwapsByParticipant(transactionContext, "partyb")
+	require.NoError(t, err)
+	require.Len(t, swaps, 2)
+	require.Equal(t, "1", swaps[0].ID)
+	require.Equal(t, "3", swaps[1].ID)
+
+	swaps, err = swapManager.GetSwapsByParticipant(transactionContext, "partyd")
+	require.NoError(t, err)
+	require.Empty(t, swaps)
+
+	swaps, err = swapManager.GetSwapsAboveAuditThreshold(transactionContext)
+	require.NoError(t, err)
+	require.Len(t, swaps, 1)
+	require.Equal(t, "2", swaps[0].ID)
+
+	payments, err := swapManager.GetOutstandingPayments(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, []*chaincode.OutstandingPayment{
+		{SwapID: "1", Payer: "partyb", Payee: "partya", Amount: 352},
+		{SwapID: "3", Payer: "partyc", Payee: "partyb", Amount: 40, NettingID: "tx0"},
+	}, payments)
+
+	transactionContext, _ = newTransactionContext("partya", map[string][]byte{}, time.Now())
+	_, err = swapManager.GetSwapsAboveAuditThreshold(transactionContext)
+	require.EqualError(t, err, "the chaincode has not been initialized, call Init() first")
+}
@@ -0,0 +1,23 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"log"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/interest_rate_swaps/chaincode-go/chaincode"
+)
+
+func main() {
+	swapChaincode, err := contractapi.NewChaincode(&chaincode.SwapManager{})
+	if err != nil {
+		log.Panicf("Error creating interest rate swaps chaincode: %v", err)
+	}
+
+	if err := swapChaincode.Start(); err != nil {
+		log.Panicf("Error starting interest rate swaps chaincode: %v", err)
+	}
+}
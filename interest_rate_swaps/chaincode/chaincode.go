@@ -12,27 +12,84 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
 	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/msp"
 	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-samples/interest_rate_swaps/chaincode/swapmath"
 )
 
 /* InterestRateSwap represents an interest rate swap on the ledger
  * The swap is active between its start- and end-date.
- * At the specified interval, two parties A and B exchange the following payments:
- * A->B (PrincipalAmount * FixedRateBPS) / 100
- * B->A (PrincipalAmount * (ReferenceRateBPS + FloatingRateBPS)) / 100
+ * The time between start- and end-date is divided into payment periods of
+ * PaymentInterval, the last period ends at the end-date. At the end of each
+ * period, two parties A and B exchange the following payments:
+ * A->B PrincipalAmount * FixedRateBPS / 10000 * DayCountFraction
+ * B->A PrincipalAmount * (ReferenceRateBPS + FloatingRateBPS) / 10000 * DayCountFraction
  * We represent rates as basis points, with one basis point being equal to 1/100th
  * of 1% (see https://www.investopedia.com/terms/b/basispoint.asp)
+ * The reference rate of a period is the one fixed for the start date of the period.
+ * The day count fraction of a period depends on the DayCountConvention of the swap,
+ * "ACT/360" (the default) or "30/360".
+ * A swap is active until it matures with the payment of its last period, or until
+ * its counterparties terminate it early, agreeing on a TerminationPayment.
+ * PartyA and PartyB are the MSP IDs of the participants, they are set by createSwap.
  */
 type InterestRateSwap struct {
-	StartDate       time.Time
-	EndDate         time.Time
-	PaymentInterval time.Duration
-	PrincipalAmount uint64
-	FixedRateBPS    uint64
-	FloatingRateBPS uint64
-	ReferenceRate   string
+	StartDate          time.Time
+	EndDate            time.Time
+	PaymentInterval    time.Duration
+	PrincipalAmount    uint64
+	FixedRateBPS       uint64
+	FloatingRateBPS    uint64
+	ReferenceRate      string
+	DayCountConvention string
+	Status             string     `json:",omitempty"`
+	TerminationDate    *time.Time `json:",omitempty"`
+	TerminationPayment int64      `json:",omitempty"`
+	PartyA             string     `json:",omitempty"`
+	PartyB             string     `json:",omitempty"`
+}
+
+// PaymentPeriod is a period of a swap, at the end of which a payment is due.
+// ReferenceRateBPS and Payment are set once the payment has been calculated.
+type PaymentPeriod struct {
+	Period           int
+	StartDate        time.Time
+	EndDate          time.Time
+	FixingDate       string
+	ReferenceRateBPS int64 `json:",omitempty"`
+	Payment          int64 `json:",omitempty"`
+}
+
+// Status of swaps that are no longer active
+const (
+	statusMatured    = "matured"
+	statusTerminated = "terminated"
+)
+
+// Supported day count conventions
+const (
+	actual360 = swapmath.Actual360
+	thirty360 = swapmath.Thirty360
+)
+
+const (
+	// upper bound for the number of payment periods of a swap
+	maxPeriods = 1000
+	// tolerated difference between the transaction timestamp and the time of the peer
+	maxClockSkew = 30 * time.Second
+)
+
+// ProposalSignature is the signature of a client of the transaction proposal it
+// submitted. Signature signs ProposalBytes, the serialized proposal with the
+// transaction ID and arguments, and can be verified with Certificate, the
+// certificate of the client.
+type ProposalSignature struct {
+	Certificate   []byte
+	ProposalBytes []byte
+	Signature     []byte
 }
 
 /*
@@ -40,14 +97,27 @@ SwapManager is the chaincode that handles interest rate swaps.
 The chaincode endorsement policy includes an auditing organization.
 It provides the following functions:
 -) createSwap: create swap with participants
--) calculatePayment: calculate what needs to be paid
+-) calculatePayment: calculate what needs to be paid for a payment period
 -) settlePayment: mark payment done
--) setReferenceRate: for providers to set the reference rate
+-) setReferenceRate: for providers to submit the reference rate
+-) configureReferenceRate: for providers to change how the reference rate is aggregated
+-) getPaymentSchedule: list the payment periods of a swap
+-) getFixing: get the reference rate fixed for a date
+-) terminateSwap: terminate a swap early, with a termination payment
+-) novateSwap: replace a participant of a swap
+-) netPayments: net the outstanding payments between two participants
+-) settleNetting: mark the payments of a netting done
+-) getSettlements: list the settlements of a swap
 
-The SwapManager stores three different kinds of information on the ledger:
+The SwapManager stores the following kinds of information on the ledger:
 -) the actual swap data ("swap" + ID)
 -) the payment information ("payment" + ID), if "none", the payment has been settled
--) the reference rate ("rr" + ID)
+-) the last payment period calculated ("period" + ID)
+-) the reference rate definition ("rr" + ID) and its providers ("rr" + ID + "#" + provider)
+-) the reference rate submissions ("submission" + ID + "@" + date + "#" + provider)
+-) the reference rate fixings ("fixing" + ID + "@" + date)
+-) the settlements of a swap (composite key "settlement" + swap ID + transaction ID)
+-) the nettings ("netting" + ID)
 */
 type SwapManager struct {
 }
@@ -81,30 +151,10 @@ func (cc *SwapManager) Init(stub shim.ChaincodeStubInterface) pb.Response {
 		return shim.Error(err.Error())
 	}
 
-	// create the reference rates, require them to be endorsed by the provider
-	for i := 3; i+1 < len(args); i += 2 {
-		org := string(args[i])
-		rrID := "rr" + string(args[i+1])
-		err = stub.PutState(rrID, []byte("0"))
-		if err != nil {
-			return shim.Error(err.Error())
-		}
-		ep, err := statebased.NewStateEP(nil)
-		if err != nil {
-			return shim.Error(err.Error())
-		}
-		err = ep.AddOrgs(statebased.RoleTypePeer, org)
-		if err != nil {
-			return shim.Error(err.Error())
-		}
-		epBytes, err = ep.Policy()
-		if err != nil {
-			return shim.Error(err.Error())
-		}
-		err = stub.SetStateValidationParameter(rrID, epBytes)
-		if err != nil {
-			return shim.Error(err.Error())
-		}
+	// create the reference rates, require them to be endorsed by their providers
+	err = defineReferenceRates(stub, args[3:])
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
 	return shim.Success([]byte{})
@@ -121,10 +171,18 @@ func (cc *SwapManager) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 }
 
 var functions = map[string]func(stub shim.ChaincodeStubInterface) pb.Response{
-	"createSwap":       createSwap,
-	"calculatePayment": calculatePayment,
-	"settlePayment":    settlePayment,
-	"setReferenceRate": setReferenceRate,
+	"createSwap":             createSwap,
+	"calculatePayment":       calculatePayment,
+	"settlePayment":          settlePayment,
+	"setReferenceRate":       setReferenceRate,
+	"configureReferenceRate": configureReferenceRate,
+	"getPaymentSchedule":     getPaymentSchedule,
+	"getFixing":              getFixing,
+	"terminateSwap":          terminateSwap,
+	"novateSwap":             novateSwap,
+	"netPayments":            netPayments,
+	"settleNetting":          settleNetting,
+	"getSettlements":         getSettlements,
 }
 
 // Create a new swap among participants.
@@ -149,6 +207,15 @@ func createSwap(stub shim.ChaincodeStubInterface) pb.Response {
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	err = validateSwap(&irs)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	irs.PartyA, irs.PartyB = parameters[2], parameters[3]
+	irsJSON, err = json.Marshal(irs)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	err = stub.PutState(swapID, irsJSON)
 	if err != nil {
 		return shim.Error(err.Error())
@@ -203,14 +270,31 @@ func createSwap(stub shim.ChaincodeStubInterface) pb.Response {
 		return shim.Error(err.Error())
 	}
 
+	// create the key for the last payment period calculated, no period has been calculated yet
+	periodID := "period" + string(parameters[0])
+	err = stub.PutState(periodID, []byte("-1"))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.SetStateValidationParameter(periodID, epBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	return shim.Success([]byte{})
 }
 
-// Calculate the payment due for a given swap
+// Calculate the payment due for a given payment period of a swap.
+// Periods have to be calculated in order, once they have ended.
+// Parameters: swap ID, number of the payment period (starting at 0)
 func calculatePayment(stub shim.ChaincodeStubInterface) pb.Response {
 	_, parameters := stub.GetFunctionAndParameters()
-	if len(parameters) != 1 {
-		return shim.Error("Wrong number of arguments supplied. Expected: <swap_ID>")
+	if len(parameters) != 2 {
+		return shim.Error("Wrong number of arguments supplied. Expected: <swap_ID> <period>")
+	}
+	period, err := strconv.Atoi(parameters[1])
+	if err != nil {
+		return shim.Error(fmt.Sprintf("Invalid period %s: %s", parameters[1], err))
 	}
 
 	// retrieve swap
@@ -227,6 +311,9 @@ func calculatePayment(stub shim.ChaincodeStubInterface) pb.Response {
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	if irs.Status != "" {
+		return shim.Error(fmt.Sprintf("Swap %s has %s", parameters[0], irs.Status))
+	}
 
 	// check if the previous payment has been settled
 	paymentID := "payment" + parameters[0]
@@ -241,36 +328,89 @@ func calculatePayment(stub shim.ChaincodeStubInterface) pb.Response {
 		return shim.Error("Previous payment has not been settled yet")
 	}
 
-	// get reference rate
-	referenceRateBytes, err := stub.GetState("rr" + irs.ReferenceRate)
+	// check that the period is the next one to be calculated and that it has ended
+	periodID := "period" + parameters[0]
+	lastPeriod, err := getLastPeriod(stub, periodID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if period <= lastPeriod {
+		return shim.Error(fmt.Sprintf("Payment for period %d has already been calculated", period))
+	}
+	if period > lastPeriod+1 {
+		return shim.Error(fmt.Sprintf("Payment for period %d has to be calculated first", lastPeriod+1))
+	}
+	p, err := paymentPeriod(&irs, period)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := txTime(stub)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	if referenceRateBytes == nil {
-		return shim.Error(fmt.Sprintf("Reference rate %s not found", irs.ReferenceRate))
+	// the timestamp may be ahead of the actual time by up to maxClockSkew
+	if now.Add(-maxClockSkew).Before(p.EndDate) {
+		return shim.Error(fmt.Sprintf("Period %d ends at %s, payment cannot be calculated before", period, p.EndDate.Format(time.RFC3339)))
 	}
-	referenceRate, err := strconv.Atoi(string(referenceRateBytes))
+
+	// get the reference rate fixed for the period
+	fixing, err := readFixing(stub, irs.ReferenceRate, p.FixingDate)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	if fixing == nil {
+		return shim.Error(fmt.Sprintf("Reference rate %s has not been fixed for %s", irs.ReferenceRate, p.FixingDate))
+	}
 
 	// calculate payment
-	p1 := int((irs.PrincipalAmount * irs.FixedRateBPS) / 100)
-	p2 := int((irs.PrincipalAmount * (irs.FloatingRateBPS + uint64(referenceRate))) / 100)
-	payment := strconv.Itoa(p1 - p2)
+	p.ReferenceRateBPS = fixing.RateBPS
+	p.Payment, err = accrue(&irs, p)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	payment := strconv.FormatInt(p.Payment, 10)
 	err = stub.PutState(paymentID, []byte(payment))
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	periodJSON, err := json.Marshal(p)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(periodID, periodJSON)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// the swap matures with the payment of its last period
+	if period == periodCount(&irs)-1 {
+		irs.Status = statusMatured
+		err = putSwap(stub, parameters[0], &irs)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
 
 	return shim.Success([]byte(payment))
 }
 
-// Settle the payment for a given swap
+// Settle the payment for a given swap.
+// The settlement instruction states who paid whom, it has to match the payment
+// due. It is recorded in the settlement history of the swap together with the
+// external reference of the transfer (e.g. a SWIFT message ID) and the
+// submitter's signature.
+// Parameters: swap ID, MSP ID of the payer, MSP ID of the payee, amount, settlement reference
 func settlePayment(stub shim.ChaincodeStubInterface) pb.Response {
 	_, parameters := stub.GetFunctionAndParameters()
-	if len(parameters) != 1 {
-		return shim.Error("Wrong number of arguments supplied. Expected: <swap_ID>")
+	if len(parameters) != 5 {
+		return shim.Error("Wrong number of arguments supplied. Expected: <swap_ID> <payer_MSPID> <payee_MSPID> <amount> <settlement_reference>")
+	}
+	amount, err := strconv.ParseUint(parameters[3], 10, 64)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("Invalid amount %s: %s", parameters[3], err))
+	}
+	if parameters[4] == "" {
+		return shim.Error("Settlement reference must not be empty")
 	}
 	paymentID := "payment" + parameters[0]
 	paid, err := stub.GetState(paymentID)
@@ -283,6 +423,31 @@ func settlePayment(stub shim.ChaincodeStubInterface) pb.Response {
 	if string(paid) == "none" {
 		return shim.Error("Payment has already been settled.")
 	}
+	payment, err := strconv.ParseInt(string(paid), 10, 64)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("Payment of swap %s is part of a netting: %s", parameters[0], paid))
+	}
+
+	irs, err := getSwap(stub, parameters[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	instruction := &Settlement{
+		SwapID:    parameters[0],
+		Payer:     parameters[1],
+		Payee:     parameters[2],
+		Amount:    amount,
+		Reference: parameters[4],
+	}
+	err = checkInstruction(irs, payment, instruction)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putSettlement(stub, instruction)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	err = stub.PutState(paymentID, []byte("none"))
 	if err != nil {
 		return shim.Error(err.Error())
@@ -290,21 +455,312 @@ func settlePayment(stub shim.ChaincodeStubInterface) pb.Response {
 	return shim.Success([]byte{})
 }
 
-// Set the reference rate for a given rate provider
-func setReferenceRate(stub shim.ChaincodeStubInterface) pb.Response {
+// Get the payment periods of a swap
+// Parameters: swap ID
+func getPaymentSchedule(stub shim.ChaincodeStubInterface) pb.Response {
+	_, parameters := stub.GetFunctionAndParameters()
+	if len(parameters) != 1 {
+		return shim.Error("Wrong number of arguments supplied. Expected: <swap_ID>")
+	}
+	irs, err := getSwap(stub, parameters[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	schedule := []*PaymentPeriod{}
+	for period := 0; period < periodCount(irs); period++ {
+		p, err := paymentPeriod(irs, period)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		schedule = append(schedule, p)
+	}
+	scheduleJSON, err := json.Marshal(schedule)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(scheduleJSON)
+}
+
+// Terminate a swap before its end date.
+// The termination payment is the net payment from party A to party B the two
+// parties agreed on, it replaces all remaining payments of the swap. Since the
+// payment entry is updated, the transaction needs to be endorsed by both
+// parties (and the auditor, if required).
+// Parameters: swap ID, termination payment
+func terminateSwap(stub shim.ChaincodeStubInterface) pb.Response {
 	_, parameters := stub.GetFunctionAndParameters()
 	if len(parameters) != 2 {
-		return shim.Error("Wrong number of arguments supplied. Expected: <reference_rate_ID> <reference_rate_BPS>")
+		return shim.Error("Wrong number of arguments supplied. Expected: <swap_ID> <termination_payment>")
+	}
+	terminationPayment, err := strconv.ParseInt(parameters[1], 10, 64)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("Invalid termination payment %s: %s", parameters[1], err))
 	}
 
-	rrID := "rr" + parameters[0]
-	err := stub.PutState(rrID, []byte(parameters[1]))
+	irs, err := getSwap(stub, parameters[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if irs.Status != "" {
+		return shim.Error(fmt.Sprintf("Swap %s has %s", parameters[0], irs.Status))
+	}
+	now, err := txTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !now.Before(irs.EndDate) {
+		return shim.Error(fmt.Sprintf("Swap %s has ended, it can only mature", parameters[0]))
+	}
+
+	// check if the previous payment has been settled
+	paymentID := "payment" + parameters[0]
+	paid, err := stub.GetState(paymentID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if paid == nil {
+		return shim.Error("Unexpected error: payment entry is nil. This should not happen.")
+	}
+	if string(paid) != "none" {
+		return shim.Error("Previous payment has not been settled yet")
+	}
+
+	irs.Status = statusTerminated
+	irs.TerminationDate = &now
+	irs.TerminationPayment = terminationPayment
+	err = putSwap(stub, parameters[0], irs)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(paymentID, []byte(parameters[1]))
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 	return shim.Success([]byte{})
 }
 
+// Replace a participant of a swap by another organization.
+// The endorsement policies of the swap, payment and period entries are changed
+// to the new participant. The change is endorsed according to the current
+// policies, i.e. by the participant stepping out and the remaining participant
+// (and the auditor, if required).
+// Parameters: swap ID, MSP ID of the participant stepping out, MSP ID of the new participant
+func novateSwap(stub shim.ChaincodeStubInterface) pb.Response {
+	_, parameters := stub.GetFunctionAndParameters()
+	if len(parameters) != 3 {
+		return shim.Error("Wrong number of arguments supplied. Expected: <swap_ID> <old_participant_MSPID> <new_participant_MSPID>")
+	}
+	oldParticipant, newParticipant := parameters[1], parameters[2]
+	if oldParticipant == "auditor" || newParticipant == "auditor" {
+		return shim.Error("The auditor cannot be a participant of a swap")
+	}
+
+	irs, err := getSwap(stub, parameters[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if irs.Status != "" {
+		return shim.Error(fmt.Sprintf("Swap %s has %s", parameters[0], irs.Status))
+	}
+
+	swapID := "swap" + parameters[0]
+	epBytes, err := stub.GetStateValidationParameter(swapID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ep, err := statebased.NewStateEP(epBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	participant := map[string]bool{}
+	for _, org := range ep.ListOrgs() {
+		participant[org] = true
+	}
+	if !participant[oldParticipant] {
+		return shim.Error(fmt.Sprintf("%s is not a participant of swap %s", oldParticipant, parameters[0]))
+	}
+	if participant[newParticipant] {
+		return shim.Error(fmt.Sprintf("%s is already a participant of swap %s", newParticipant, parameters[0]))
+	}
+	paid, err := stub.GetState("payment" + parameters[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if string(paid) != "none" {
+		return shim.Error("Previous payment has not been settled yet")
+	}
+	switch oldParticipant {
+	case irs.PartyA:
+		irs.PartyA = newParticipant
+	case irs.PartyB:
+		irs.PartyB = newParticipant
+	}
+	err = putSwap(stub, parameters[0], irs)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ep.DelOrgs(oldParticipant)
+	err = ep.AddOrgs(statebased.RoleTypePeer, newParticipant)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	epBytes, err = ep.Policy()
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, key := range []string{swapID, "payment" + parameters[0], "period" + parameters[0]} {
+		value, err := stub.GetState(key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if value == nil {
+			// swaps created before payment periods were introduced have no period entry
+			continue
+		}
+		err = stub.SetStateValidationParameter(key, epBytes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	fmt.Printf("Swap %s novated from %s to %s\n", parameters[0], oldParticipant, newParticipant)
+	return shim.Success([]byte{})
+}
+
+// getSwap reads a swap from the ledger
+func getSwap(stub shim.ChaincodeStubInterface, id string) (*InterestRateSwap, error) {
+	irsJSON, err := stub.GetState("swap" + id)
+	if err != nil {
+		return nil, err
+	}
+	if irsJSON == nil {
+		return nil, fmt.Errorf("Swap %s does not exist", id)
+	}
+	var irs InterestRateSwap
+	err = json.Unmarshal(irsJSON, &irs)
+	if err != nil {
+		return nil, err
+	}
+	return &irs, nil
+}
+
+// putSwap writes a swap to the ledger, keeping its endorsement policy
+func putSwap(stub shim.ChaincodeStubInterface, id string, irs *InterestRateSwap) error {
+	irsJSON, err := json.Marshal(irs)
+	if err != nil {
+		return err
+	}
+	return stub.PutState("swap"+id, irsJSON)
+}
+
+// validateSwap checks that the dates and day count convention of a swap are usable
+func validateSwap(irs *InterestRateSwap) error {
+	if !irs.EndDate.After(irs.StartDate) {
+		return fmt.Errorf("EndDate must be after StartDate")
+	}
+	if irs.PaymentInterval <= 0 {
+		return fmt.Errorf("PaymentInterval must be positive")
+	}
+	if periodCount(irs) > maxPeriods {
+		return fmt.Errorf("Swap must not have more than %d payment periods", maxPeriods)
+	}
+	switch irs.DayCountConvention {
+	case "", actual360, thirty360:
+	default:
+		return fmt.Errorf("Unsupported day count convention %s", irs.DayCountConvention)
+	}
+	if irs.Status != "" || irs.TerminationDate != nil || irs.TerminationPayment != 0 {
+		return fmt.Errorf("A new swap must not be terminated or matured")
+	}
+	return nil
+}
+
+// periodCount returns the number of payment periods of a swap
+func periodCount(irs *InterestRateSwap) int {
+	return swapmath.PeriodCount(irs.StartDate, irs.EndDate, irs.PaymentInterval)
+}
+
+// paymentPeriod returns a payment period of a swap, the last period ends at the end date of the swap
+func paymentPeriod(irs *InterestRateSwap, period int) (*PaymentPeriod, error) {
+	if period < 0 || period >= periodCount(irs) {
+		return nil, fmt.Errorf("Swap has no payment period %d", period)
+	}
+	start, end := swapmath.PeriodDates(irs.StartDate, irs.EndDate, irs.PaymentInterval, period)
+	return &PaymentPeriod{
+		Period:     period,
+		StartDate:  start,
+		EndDate:    end,
+		FixingDate: start.UTC().Format(fixingDate),
+	}, nil
+}
+
+// getLastPeriod returns the last payment period calculated, -1 if there is none
+func getLastPeriod(stub shim.ChaincodeStubInterface, periodID string) (int, error) {
+	periodJSON, err := stub.GetState(periodID)
+	if err != nil {
+		return 0, err
+	}
+	if periodJSON == nil || string(periodJSON) == "-1" {
+		return -1, nil
+	}
+	var p PaymentPeriod
+	err = json.Unmarshal(periodJSON, &p)
+	if err != nil {
+		return 0, err
+	}
+	return p.Period, nil
+}
+
+// accrue calculates the net payment from A to B for a payment period, rounded towards zero:
+// PrincipalAmount * (FixedRateBPS - ReferenceRateBPS - FloatingRateBPS) / 10000 * days / 360
+func accrue(irs *InterestRateSwap, p *PaymentPeriod) (int64, error) {
+	payment, ok := swapmath.Accrue(irs.PrincipalAmount, irs.FixedRateBPS, irs.FloatingRateBPS, p.ReferenceRateBPS, irs.DayCountConvention, p.StartDate, p.EndDate)
+	if !ok {
+		return 0, fmt.Errorf("Payment for period %d is out of range", p.Period)
+	}
+	return payment, nil
+}
+
+// signer returns the MSP ID of the client submitting the transaction and its signature of the proposal
+func signer(stub shim.ChaincodeStubInterface) (string, ProposalSignature, error) {
+	creator, err := stub.GetCreator()
+	if err != nil {
+		return "", ProposalSignature{}, err
+	}
+	identity := &msp.SerializedIdentity{}
+	err = proto.Unmarshal(creator, identity)
+	if err != nil {
+		return "", ProposalSignature{}, err
+	}
+	signedProposal, err := stub.GetSignedProposal()
+	if err != nil {
+		return "", ProposalSignature{}, err
+	}
+	if signedProposal == nil {
+		return identity.Mspid, ProposalSignature{}, nil
+	}
+	return identity.Mspid, ProposalSignature{
+		Certificate:   identity.IdBytes,
+		ProposalBytes: signedProposal.ProposalBytes,
+		Signature:     signedProposal.Signature,
+	}, nil
+}
+
+// txTime returns the timestamp of the transaction. The timestamp is set by the
+// client, it is rejected if it is more than maxClockSkew away from the time of the peer.
+func txTime(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	ts, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+	t := time.Unix(ts.Seconds, int64(ts.Nanos)).UTC()
+	skew := time.Since(t)
+	if skew > maxClockSkew || skew < -maxClockSkew {
+		return time.Time{}, fmt.Errorf("Transaction timestamp %s is more than %s away from the time of the peer", t.Format(time.RFC3339), maxClockSkew)
+	}
+	return t, nil
+}
+
 func main() {
 	err := shim.Start(new(SwapManager))
 	if err != nil {
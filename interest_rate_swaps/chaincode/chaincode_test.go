@@ -0,0 +1,465 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/msp"
+)
+
+const day = 24 * time.Hour
+
+// newSwapManager returns a stub of the chaincode, initialized with the
+// auditor, an audit limit of 1000000 and the reference rate myrr of rrprovider
+func newSwapManager(t *testing.T) *shimtest.MockStub {
+	stub := shimtest.NewMockStub("irs", new(SwapManager))
+	res := stub.MockInit("init", [][]byte{[]byte("Init"), []byte("auditor"), []byte("1000000"), []byte("rrprovider"), []byte("myrr")})
+	if res.Status != 200 {
+		t.Fatalf("Init failed: %s", res.Message)
+	}
+	return stub
+}
+
+var txCount int
+
+// invoke calls a function of the chaincode as a client of the given organization,
+// it returns the payload of the response or the error message
+func invoke(t *testing.T, stub *shimtest.MockStub, mspID string, function string, parameters ...string) (string, string) {
+	creator, err := proto.Marshal(&msp.SerializedIdentity{Mspid: mspID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.Creator = creator
+	args := [][]byte{[]byte(function)}
+	for _, parameter := range parameters {
+		args = append(args, []byte(parameter))
+	}
+	txCount++
+	res := stub.MockInvoke("tx"+strconv.Itoa(txCount), args)
+	if res.Status != 200 {
+		return "", res.Message
+	}
+	return string(res.Payload), ""
+}
+
+// newSwap creates a swap between org1 and org2 starting at start, with
+// payment periods of 30 days, fixed rate 300 and floating rate 50 basis points
+func newSwap(t *testing.T, stub *shimtest.MockStub, id string, start time.Time, periods int) {
+	newSwapBetween(t, stub, id, start, periods, "org1", "org2")
+}
+
+// newSwapBetween creates a swap like newSwap, between party A and party B
+func newSwapBetween(t *testing.T, stub *shimtest.MockStub, id string, start time.Time, periods int, partyA string, partyB string) {
+	irs := InterestRateSwap{
+		StartDate:       start,
+		EndDate:         start.Add(time.Duration(periods) * 30 * day),
+		PaymentInterval: 30 * day,
+		PrincipalAmount: 100000,
+		FixedRateBPS:    300,
+		FloatingRateBPS: 50,
+		ReferenceRate:   "myrr",
+	}
+	irsJSON, err := json.Marshal(irs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errMsg := invoke(t, stub, partyA, "createSwap", id, string(irsJSON), partyA, partyB)
+	if errMsg != "" {
+		t.Fatalf("createSwap failed: %s", errMsg)
+	}
+}
+
+// fixRate stores a finalized fixing of myrr for a date, as the providers would have
+func fixRate(t *testing.T, stub *shimtest.MockStub, date time.Time, rateBPS int64) {
+	fixing := Fixing{RateBPS: rateBPS, Date: date.Format(fixingDate), Method: median}
+	fixingJSON, err := json.Marshal(fixing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.State["fixingmyrr@"+fixing.Date] = fixingJSON
+}
+
+// pastStart returns the start date of a swap whose first periods have ended
+func pastStart(periods int) time.Time {
+	return time.Now().UTC().Truncate(day).Add(-time.Duration(periods) * 30 * day).Add(-day)
+}
+
+func checkError(t *testing.T, errMsg string, expected string) {
+	t.Helper()
+	if expected == "" && errMsg != "" {
+		t.Fatalf("unexpected error: %s", errMsg)
+	}
+	if !strings.Contains(errMsg, expected) {
+		t.Fatalf("expected error %q, got %q", expected, errMsg)
+	}
+}
+
+func TestCalculatePayment(t *testing.T) {
+	stub := newSwapManager(t)
+	start := pastStart(2)
+	newSwap(t, stub, "1", start, 3)
+
+	_, errMsg := invoke(t, stub, "org1", "calculatePayment", "1", "1")
+	checkError(t, errMsg, "Payment for period 0 has to be calculated first")
+
+	_, errMsg = invoke(t, stub, "org1", "calculatePayment", "1", "0")
+	checkError(t, errMsg, "Reference rate myrr has not been fixed for "+start.Format(fixingDate))
+
+	// 100000 * (300 - 100 - 50) / 10000 * 30 / 360
+	fixRate(t, stub, start, 100)
+	payment, errMsg := invoke(t, stub, "org1", "calculatePayment", "1", "0")
+	checkError(t, errMsg, "")
+	if payment != "125" {
+		t.Fatalf("expected payment 125, got %s", payment)
+	}
+
+	_, errMsg = invoke(t, stub, "org1", "calculatePayment", "1", "1")
+	checkError(t, errMsg, "Previous payment has not been settled yet")
+
+	// the payment has been settled
+	stub.State["payment1"] = []byte("none")
+	_, errMsg = invoke(t, stub, "org1", "calculatePayment", "1", "0")
+	checkError(t, errMsg, "Payment for period 0 has already been calculated")
+
+	// the reference rate rose above the fixed rate, B pays A
+	fixRate(t, stub, start.Add(30*day), 400)
+	payment, errMsg = invoke(t, stub, "org1", "calculatePayment", "1", "1")
+	checkError(t, errMsg, "")
+	if payment != "-125" {
+		t.Fatalf("expected payment -125, got %s", payment)
+	}
+
+	// the last period has not ended yet
+	stub.State["payment1"] = []byte("none")
+	fixRate(t, stub, start.Add(60*day), 100)
+	_, errMsg = invoke(t, stub, "org1", "calculatePayment", "1", "2")
+	checkError(t, errMsg, "Period 2 ends at "+start.Add(90*day).Format(time.RFC3339)+", payment cannot be calculated before")
+}
+
+// getTestSwap reads a swap from the state of the stub
+func getTestSwap(t *testing.T, stub *shimtest.MockStub, id string) *InterestRateSwap {
+	var irs InterestRateSwap
+	err := json.Unmarshal(stub.State["swap"+id], &irs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &irs
+}
+
+func TestMaturity(t *testing.T) {
+	stub := newSwapManager(t)
+	start := pastStart(1)
+	newSwap(t, stub, "1", start, 1)
+	fixRate(t, stub, start, 100)
+
+	_, errMsg := invoke(t, stub, "org1", "calculatePayment", "1", "0")
+	checkError(t, errMsg, "")
+	if status := getTestSwap(t, stub, "1").Status; status != statusMatured {
+		t.Fatalf("expected status %s, got %s", statusMatured, status)
+	}
+
+	stub.State["payment1"] = []byte("none")
+	_, errMsg = invoke(t, stub, "org1", "calculatePayment", "1", "1")
+	checkError(t, errMsg, "Swap 1 has matured")
+	_, errMsg = invoke(t, stub, "org1", "terminateSwap", "1", "100")
+	checkError(t, errMsg, "Swap 1 has matured")
+	_, errMsg = invoke(t, stub, "org1", "novateSwap", "1", "org2", "org3")
+	checkError(t, errMsg, "Swap 1 has matured")
+}
+
+func TestTerminateSwap(t *testing.T) {
+	stub := newSwapManager(t)
+	start := pastStart(1)
+	newSwap(t, stub, "1", start, 3)
+	newSwap(t, stub, "2", pastStart(3), 2)
+
+	_, errMsg := invoke(t, stub, "org1", "terminateSwap", "1", "a lot")
+	checkError(t, errMsg, "Invalid termination payment a lot")
+
+	_, errMsg = invoke(t, stub, "org1", "terminateSwap", "2", "100")
+	checkError(t, errMsg, "Swap 2 has ended, it can only mature")
+
+	fixRate(t, stub, start, 100)
+	_, errMsg = invoke(t, stub, "org1", "calculatePayment", "1", "0")
+	checkError(t, errMsg, "")
+	_, errMsg = invoke(t, stub, "org1", "terminateSwap", "1", "-500")
+	checkError(t, errMsg, "Previous payment has not been settled yet")
+
+	stub.State["payment1"] = []byte("none")
+	_, errMsg = invoke(t, stub, "org1", "terminateSwap", "1", "-500")
+	checkError(t, errMsg, "")
+	irs := getTestSwap(t, stub, "1")
+	if irs.Status != statusTerminated || irs.TerminationPayment != -500 || irs.TerminationDate == nil {
+		t.Fatalf("expected the swap to be terminated with payment -500, got %+v", irs)
+	}
+	if payment := string(stub.State["payment1"]); payment != "-500" {
+		t.Fatalf("expected the termination payment to be due, got %s", payment)
+	}
+
+	// no further payments
+	_, errMsg = invoke(t, stub, "org1", "terminateSwap", "1", "-500")
+	checkError(t, errMsg, "Swap 1 has terminated")
+	stub.State["payment1"] = []byte("none")
+	_, errMsg = invoke(t, stub, "org1", "calculatePayment", "1", "1")
+	checkError(t, errMsg, "Swap 1 has terminated")
+}
+
+var novateSwapTests = []struct {
+	name          string
+	oldOrg        string
+	newOrg        string
+	unsettled     bool
+	expectedError string
+}{
+	{"Auditor steps out", "auditor", "org3", false, "The auditor cannot be a participant of a swap"},
+	{"Auditor steps in", "org2", "auditor", false, "The auditor cannot be a participant of a swap"},
+	{"Not a participant", "org3", "org4", false, "org3 is not a participant of swap 1"},
+	{"Already a participant", "org2", "org1", false, "org1 is already a participant of swap 1"},
+	{"Payment not settled", "org2", "org3", true, "Previous payment has not been settled yet"},
+	{"Party B replaced", "org2", "org3", false, ""},
+	{"Party A replaced", "org1", "org3", false, ""},
+}
+
+func TestNovateSwap(t *testing.T) {
+	for _, tt := range novateSwapTests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newSwapManager(t)
+			newSwap(t, stub, "1", pastStart(1), 3)
+			if tt.unsettled {
+				stub.State["payment1"] = []byte("125")
+			}
+
+			_, errMsg := invoke(t, stub, tt.oldOrg, "novateSwap", "1", tt.oldOrg, tt.newOrg)
+			checkError(t, errMsg, tt.expectedError)
+			if tt.expectedError != "" {
+				return
+			}
+
+			irs := getTestSwap(t, stub, "1")
+			parties := map[string]bool{irs.PartyA: true, irs.PartyB: true}
+			if parties[tt.oldOrg] || !parties[tt.newOrg] {
+				t.Fatalf("expected %s to replace %s, got parties %s and %s", tt.newOrg, tt.oldOrg, irs.PartyA, irs.PartyB)
+			}
+
+			// the new participant has to endorse all changes of the swap
+			for _, key := range []string{"swap1", "payment1", "period1"} {
+				ep, err := statebased.NewStateEP(stub.EndorsementPolicies[""][key])
+				if err != nil {
+					t.Fatal(err)
+				}
+				orgs := map[string]bool{}
+				for _, org := range ep.ListOrgs() {
+					orgs[org] = true
+				}
+				if len(orgs) != 2 || !orgs[irs.PartyA] || !orgs[irs.PartyB] {
+					t.Errorf("expected %s to be endorsed by %s and %s, got %v", key, irs.PartyA, irs.PartyB, ep.ListOrgs())
+				}
+			}
+		})
+	}
+}
+
+var settlePaymentTests = []struct {
+	name          string
+	payment       string
+	instruction   []string
+	expectedError string
+}{
+	{"Wrong payer", "125", []string{"org2", "org1", "125", "REF"}, "Settlement instruction does not match the payment due: org1 pays 125 to org2"},
+	{"Wrong amount", "125", []string{"org1", "org2", "120", "REF"}, "Settlement instruction does not match the payment due: org1 pays 125 to org2"},
+	{"Wrong payee", "125", []string{"org1", "org3", "125", "REF"}, "Settlement instruction does not match the payment due: org1 pays 125 to org2"},
+	{"B pays A", "-125", []string{"org1", "org2", "125", "REF"}, "Settlement instruction does not match the payment due: org2 pays 125 to org1"},
+	{"Invalid amount", "125", []string{"org1", "org2", "-125", "REF"}, "Invalid amount -125"},
+	{"No reference", "125", []string{"org1", "org2", "125", ""}, "Settlement reference must not be empty"},
+	{"Already settled", "none", []string{"org1", "org2", "125", "REF"}, "Payment has already been settled."},
+	{"Part of a netting", "nettingtx1", []string{"org1", "org2", "125", "REF"}, "Payment of swap 1 is part of a netting: nettingtx1"},
+	{"A pays B", "125", []string{"org1", "org2", "125", "REF"}, ""},
+	{"B pays A", "-125", []string{"org2", "org1", "125", "REF"}, ""},
+	{"Nothing to pay", "0", []string{"org2", "org1", "0", "REF"}, ""},
+}
+
+func TestSettlePayment(t *testing.T) {
+	for _, tt := range settlePaymentTests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newSwapManager(t)
+			newSwap(t, stub, "1", pastStart(1), 3)
+			stub.State["payment1"] = []byte(tt.payment)
+
+			_, errMsg := invoke(t, stub, "org1", "settlePayment", append([]string{"1"}, tt.instruction...)...)
+			checkError(t, errMsg, tt.expectedError)
+			if tt.expectedError != "" {
+				if payment := string(stub.State["payment1"]); payment != tt.payment {
+					t.Fatalf("expected the payment %s to stay due, got %s", tt.payment, payment)
+				}
+				return
+			}
+			if payment := string(stub.State["payment1"]); payment != "none" {
+				t.Fatalf("expected the payment to be settled, got %s", payment)
+			}
+
+			settlements := getTestSettlements(t, stub, "1")
+			if len(settlements) != 1 {
+				t.Fatalf("expected one settlement, got %d", len(settlements))
+			}
+			s := settlements[0]
+			if s.Payer != tt.instruction[0] || s.Payee != tt.instruction[1] || strconv.FormatUint(s.Amount, 10) != tt.instruction[2] || s.Reference != "REF" || s.Submitter != "org1" {
+				t.Errorf("unexpected settlement %+v", s)
+			}
+		})
+	}
+}
+
+// getTestSettlements returns the settlement history of a swap
+func getTestSettlements(t *testing.T, stub *shimtest.MockStub, id string) []*Settlement {
+	settlementsJSON, errMsg := invoke(t, stub, "org1", "getSettlements", id)
+	checkError(t, errMsg, "")
+	settlements := []*Settlement{}
+	err := json.Unmarshal([]byte(settlementsJSON), &settlements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return settlements
+}
+
+func TestNetPayments(t *testing.T) {
+	stub := newSwapManager(t)
+	start := pastStart(1)
+	newSwapBetween(t, stub, "1", start, 3, "org1", "org2")
+	newSwapBetween(t, stub, "2", start, 3, "org2", "org1")
+	newSwapBetween(t, stub, "3", start, 3, "org1", "org3")
+	newSwapBetween(t, stub, "4", start, 3, "org1", "org2")
+	newSwapBetween(t, stub, "5", start, 3, "org2", "org1")
+	// org1 pays 125 to org2, org2 pays 50 to org1 and org1 pays another 20 to org2
+	stub.State["payment1"] = []byte("125")
+	stub.State["payment2"] = []byte("50")
+	stub.State["payment3"] = []byte("1000")
+	stub.State["payment5"] = []byte("-20")
+
+	_, errMsg := invoke(t, stub, "org1", "netPayments", "org1", "org1")
+	checkError(t, errMsg, "Payments can only be netted between two different participants")
+
+	nettingJSON, errMsg := invoke(t, stub, "org1", "netPayments", "org2", "org1")
+	checkError(t, errMsg, "")
+	var netting Netting
+	err := json.Unmarshal([]byte(nettingJSON), &netting)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if netting.Payer != "org1" || netting.Payee != "org2" || netting.Amount != 95 {
+		t.Fatalf("expected org1 to pay 95 to org2, got %+v", netting)
+	}
+	if len(netting.Payments) != 3 || netting.Payments["1"] != 125 || netting.Payments["2"] != 50 || netting.Payments["5"] != -20 {
+		t.Fatalf("expected the payments of swaps 1, 2 and 5, got %v", netting.Payments)
+	}
+	for _, id := range []string{"1", "2", "5"} {
+		if payment := string(stub.State["payment"+id]); payment != "netting"+netting.ID {
+			t.Errorf("expected the payment of swap %s to be part of the netting, got %s", id, payment)
+		}
+	}
+	if payment := string(stub.State["payment3"]); payment != "1000" {
+		t.Errorf("expected the payment of swap 3 to stay due, got %s", payment)
+	}
+
+	// the netted payments can't be netted or settled again on their own
+	_, errMsg = invoke(t, stub, "org1", "netPayments", "org1", "org2")
+	checkError(t, errMsg, "No outstanding payments between org1 and org2")
+	_, errMsg = invoke(t, stub, "org1", "settlePayment", "1", "org1", "org2", "125", "REF")
+	checkError(t, errMsg, "Payment of swap 1 is part of a netting")
+
+	// the instruction must match the net obligation
+	_, errMsg = invoke(t, stub, "org1", "settleNetting", netting.ID, "org2", "org1", "95", "NETREF")
+	checkError(t, errMsg, "Settlement instruction does not match the net obligation: org1 pays 95 to org2")
+	_, errMsg = invoke(t, stub, "org1", "settleNetting", netting.ID, "org1", "org2", "125", "NETREF")
+	checkError(t, errMsg, "Settlement instruction does not match the net obligation: org1 pays 95 to org2")
+	_, errMsg = invoke(t, stub, "org1", "settleNetting", "unknown", "org1", "org2", "95", "NETREF")
+	checkError(t, errMsg, "Netting unknown does not exist")
+
+	_, errMsg = invoke(t, stub, "org1", "settleNetting", netting.ID, "org1", "org2", "95", "NETREF")
+	checkError(t, errMsg, "")
+	_, errMsg = invoke(t, stub, "org1", "settleNetting", netting.ID, "org1", "org2", "95", "NETREF")
+	checkError(t, errMsg, "Netting "+netting.ID+" has already been settled")
+
+	// every payment of the netting is settled and recorded in the history of its swap
+	expected := map[string]Settlement{
+		"1": {Payer: "org1", Payee: "org2", Amount: 125},
+		"2": {Payer: "org2", Payee: "org1", Amount: 50},
+		"5": {Payer: "org1", Payee: "org2", Amount: 20},
+	}
+	for id, e := range expected {
+		if payment := string(stub.State["payment"+id]); payment != "none" {
+			t.Errorf("expected the payment of swap %s to be settled, got %s", id, payment)
+		}
+		settlements := getTestSettlements(t, stub, id)
+		if len(settlements) != 1 {
+			t.Fatalf("expected one settlement of swap %s, got %d", id, len(settlements))
+		}
+		s := settlements[0]
+		if s.Payer != e.Payer || s.Payee != e.Payee || s.Amount != e.Amount || s.Reference != "NETREF" || s.NettingID != netting.ID {
+			t.Errorf("unexpected settlement of swap %s: %+v", id, s)
+		}
+	}
+	if settlements := getTestSettlements(t, stub, "3"); len(settlements) != 0 {
+		t.Errorf("expected no settlement of swap 3, got %d", len(settlements))
+	}
+}
+
+func TestSetReferenceRate(t *testing.T) {
+	// myrr has three providers, it is fixed at the median of two submissions
+	stub := shimtest.NewMockStub("irs", new(SwapManager))
+	res := stub.MockInit("init", [][]byte{[]byte("Init"), []byte("auditor"), []byte("1000000"), []byte("p1"), []byte("myrr"), []byte("p2"), []byte("myrr"), []byte("p3"), []byte("myrr")})
+	if res.Status != 200 {
+		t.Fatalf("Init failed: %s", res.Message)
+	}
+	yesterday := time.Now().UTC().AddDate(0, 0, -1).Format(fixingDate)
+
+	_, errMsg := invoke(t, stub, "org1", "setReferenceRate", "myrr", "100", yesterday)
+	checkError(t, errMsg, "org1 is not a provider of reference rate myrr")
+
+	_, errMsg = invoke(t, stub, "p1", "setReferenceRate", "myrr", "100", time.Now().UTC().AddDate(0, 0, -3).Format(fixingDate))
+	checkError(t, errMsg, "is more than one day away from the transaction date")
+
+	_, errMsg = invoke(t, stub, "p1", "setReferenceRate", "myrr", "100", yesterday)
+	checkError(t, errMsg, "")
+	_, errMsg = invoke(t, stub, "p1", "getFixing", "myrr", yesterday)
+	checkError(t, errMsg, "Reference rate myrr has not been fixed for "+yesterday)
+
+	_, errMsg = invoke(t, stub, "p1", "setReferenceRate", "myrr", "110", yesterday)
+	checkError(t, errMsg, "p1 has already submitted reference rate myrr for "+yesterday)
+
+	// the second submission reaches the quorum, both deviate from the median by more than 50
+	_, errMsg = invoke(t, stub, "p2", "setReferenceRate", "myrr", "300", yesterday)
+	checkError(t, errMsg, "")
+	fixingJSON, errMsg := invoke(t, stub, "p1", "getFixing", "myrr", yesterday)
+	checkError(t, errMsg, "")
+	var fixing Fixing
+	err := json.Unmarshal([]byte(fixingJSON), &fixing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fixing.RateBPS != 200 || len(fixing.Submissions) != 2 || strings.Join(fixing.Outliers, ",") != "p1,p2" {
+		t.Fatalf("unexpected fixing %s", fixingJSON)
+	}
+	select {
+	case event := <-stub.ChaincodeEventsChannel:
+		if event.EventName != "ReferenceRateOutliers" {
+			t.Fatalf("unexpected event %s", event.EventName)
+		}
+	default:
+		t.Fatal("expected a ReferenceRateOutliers event")
+	}
+
+	_, errMsg = invoke(t, stub, "p3", "setReferenceRate", "myrr", "200", yesterday)
+	checkError(t, errMsg, "Reference rate myrr has already been fixed for "+yesterday)
+}
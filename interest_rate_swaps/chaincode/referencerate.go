@@ -0,0 +1,462 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-samples/interest_rate_swaps/chaincode/swapmath"
+)
+
+// ReferenceRate defines how the submissions of the providers of a reference
+// rate are aggregated into fixings. A rate is fixed for a date once Quorum
+// providers have submitted a value for that date. The fixing is the median or
+// the trimmed mean (dropping TrimPercent of the submissions at either end) of
+// the submissions. Submissions deviating from the fixing by more than
+// OutlierBPS are flagged in a ReferenceRateOutliers event.
+type ReferenceRate struct {
+	Providers   []string
+	Quorum      int
+	Method      string
+	TrimPercent int
+	OutlierBPS  int64
+}
+
+// Submission is the value of a reference rate for a fixing date, as submitted
+// by a rate provider, together with the provider's signature of the
+// transaction proposal with ID TxID.
+type Submission struct {
+	Provider  string
+	RateBPS   int64
+	Date      string
+	Timestamp time.Time
+	TxID      string
+	ProposalSignature
+}
+
+// Fixing is the value of a reference rate for a fixing date, aggregated from
+// the submissions of its providers. Only finalized fixings are stored, i.e.
+// fixings that reached the quorum of their reference rate. Timestamp is the
+// time of the transaction that reached the quorum.
+type Fixing struct {
+	RateBPS     int64
+	Date        string
+	Timestamp   time.Time
+	Method      string
+	Submissions []*Submission
+	Outliers    []string `json:",omitempty"`
+}
+
+// outlierEvent provides an organized struct for emitting ReferenceRateOutliers events
+type outlierEvent struct {
+	ReferenceRate string
+	Date          string
+	RateBPS       int64
+	Outliers      []*Submission
+}
+
+// Aggregation methods
+const (
+	median      = swapmath.Median
+	trimmedMean = swapmath.TrimmedMean
+)
+
+const (
+	// layout of fixing dates
+	fixingDate = "2006-01-02"
+	// how far the fixing date of a submission may be from the date of the transaction
+	maxFixingDistance = 24 * time.Hour
+	// default deviation from the fixing above which a submission is an outlier
+	defaultOutlierBPS = 50
+)
+
+// Submit the value of a reference rate for a fixing date as a provider of the rate.
+// The rate is submitted for the given date, or for the date of the transaction if
+// no date is given. The given date may be at most one day before or after the
+// date of the transaction, whose timestamp is bounded by maxClockSkew. Every provider can submit one value per date, the submission
+// records the transaction timestamp and the provider's signature of the proposal.
+// The submission that reaches the quorum of the rate finalizes the fixing, later
+// submissions for the date are rejected.
+// Parameters: reference rate ID, rate in basis points, optional fixing date (YYYY-MM-DD)
+func setReferenceRate(stub shim.ChaincodeStubInterface) pb.Response {
+	_, parameters := stub.GetFunctionAndParameters()
+	if len(parameters) != 2 && len(parameters) != 3 {
+		return shim.Error("Wrong number of arguments supplied. Expected: <reference_rate_ID> <reference_rate_BPS> [<fixing_date>]")
+	}
+	rate, err := strconv.ParseInt(parameters[1], 10, 64)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("Invalid reference rate %s: %s", parameters[1], err))
+	}
+	rr, err := getReferenceRate(stub, parameters[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	submission := &Submission{
+		RateBPS:   rate,
+		Date:      now.Format(fixingDate),
+		Timestamp: now,
+		TxID:      stub.GetTxID(),
+	}
+	if len(parameters) == 3 {
+		date, err := time.Parse(fixingDate, parameters[2])
+		if err != nil {
+			return shim.Error(fmt.Sprintf("Invalid fixing date %s: %s", parameters[2], err))
+		}
+		today, _ := time.Parse(fixingDate, submission.Date)
+		distance := today.Sub(date)
+		if distance > maxFixingDistance || distance < -maxFixingDistance {
+			return shim.Error(fmt.Sprintf("Fixing date %s is more than one day away from the transaction date %s", parameters[2], submission.Date))
+		}
+		submission.Date = date.Format(fixingDate)
+	}
+	fixing, err := readFixing(stub, parameters[0], submission.Date)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if fixing != nil {
+		return shim.Error(fmt.Sprintf("Reference rate %s has already been fixed for %s", parameters[0], submission.Date))
+	}
+
+	// record who submitted the rate
+	submission.Provider, submission.ProposalSignature, err = signer(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !contains(rr.Providers, submission.Provider) {
+		return shim.Error(fmt.Sprintf("%s is not a provider of reference rate %s", submission.Provider, parameters[0]))
+	}
+	submissionID := "submission" + parameters[0] + "@" + submission.Date + "#" + submission.Provider
+	existing, err := stub.GetState(submissionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if existing != nil {
+		return shim.Error(fmt.Sprintf("%s has already submitted reference rate %s for %s", submission.Provider, parameters[0], submission.Date))
+	}
+
+	// writing the provider key requires the endorsement of the provider,
+	// the submission key gets the same endorsement policy
+	providerID := "rr" + parameters[0] + "#" + submission.Provider
+	epBytes, err := stub.GetStateValidationParameter(providerID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	submissionJSON, err := json.Marshal(submission)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(providerID, submissionJSON)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(submissionID, submissionJSON)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.SetStateValidationParameter(submissionID, epBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// collect the submissions for the date, in the order of the providers
+	submissions := []*Submission{}
+	for _, provider := range rr.Providers {
+		if provider == submission.Provider {
+			submissions = append(submissions, submission)
+			continue
+		}
+		submissionJSON, err := stub.GetState("submission" + parameters[0] + "@" + submission.Date + "#" + provider)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if submissionJSON == nil {
+			continue
+		}
+		var s Submission
+		err = json.Unmarshal(submissionJSON, &s)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		submissions = append(submissions, &s)
+	}
+	if len(submissions) < rr.Quorum {
+		fmt.Printf("Reference rate %s for %s has %d of %d submissions\n", parameters[0], submission.Date, len(submissions), rr.Quorum)
+		return shim.Success([]byte{})
+	}
+
+	err = finalizeFixing(stub, parameters[0], rr, submission.Date, submissions)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success([]byte{})
+}
+
+// Change how the submissions of a reference rate are aggregated.
+// Since the reference rate definition is endorsed by all its providers, they
+// all have to agree on the change.
+// Parameters: reference rate ID, quorum, method ("median" or "trimmedMean"),
+//             percentage trimmed at either end, outlier threshold in basis points
+func configureReferenceRate(stub shim.ChaincodeStubInterface) pb.Response {
+	_, parameters := stub.GetFunctionAndParameters()
+	if len(parameters) != 5 {
+		return shim.Error("Wrong number of arguments supplied. Expected: <reference_rate_ID> <quorum> <method> <trim_percent> <outlier_BPS>")
+	}
+	rr, err := getReferenceRate(stub, parameters[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	rr.Quorum, err = strconv.Atoi(parameters[1])
+	if err != nil {
+		return shim.Error(fmt.Sprintf("Invalid quorum %s: %s", parameters[1], err))
+	}
+	rr.Method = parameters[2]
+	rr.TrimPercent, err = strconv.Atoi(parameters[3])
+	if err != nil {
+		return shim.Error(fmt.Sprintf("Invalid trim percentage %s: %s", parameters[3], err))
+	}
+	rr.OutlierBPS, err = strconv.ParseInt(parameters[4], 10, 64)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("Invalid outlier threshold %s: %s", parameters[4], err))
+	}
+	err = validateReferenceRate(rr)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	rrJSON, err := json.Marshal(rr)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState("rr"+parameters[0], rrJSON)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success([]byte{})
+}
+
+// Get the fixing of a reference rate for a date
+// Parameters: reference rate ID, fixing date (YYYY-MM-DD)
+func getFixing(stub shim.ChaincodeStubInterface) pb.Response {
+	_, parameters := stub.GetFunctionAndParameters()
+	if len(parameters) != 2 {
+		return shim.Error("Wrong number of arguments supplied. Expected: <reference_rate_ID> <fixing_date>")
+	}
+	fixingJSON, err := stub.GetState("fixing" + parameters[0] + "@" + parameters[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if fixingJSON == nil {
+		return shim.Error(fmt.Sprintf("Reference rate %s has not been fixed for %s", parameters[0], parameters[1]))
+	}
+	return shim.Success(fixingJSON)
+}
+
+// defineReferenceRates creates the reference rates given as pairs of provider MSP ID
+// and rate ID in the init parameters. A rate may have several providers. The
+// definition of a rate is endorsed by all its providers, every provider gets a
+// key of its own that is endorsed by the provider alone.
+// By default, a rate is fixed at the median once a majority of its providers submitted.
+func defineReferenceRates(stub shim.ChaincodeStubInterface, args [][]byte) error {
+	rateIDs := []string{}
+	rates := map[string]*ReferenceRate{}
+	for i := 0; i+1 < len(args); i += 2 {
+		org := string(args[i])
+		rateID := string(args[i+1])
+		rr, ok := rates[rateID]
+		if !ok {
+			rr = &ReferenceRate{Method: median, OutlierBPS: defaultOutlierBPS}
+			rates[rateID] = rr
+			rateIDs = append(rateIDs, rateID)
+		}
+		if !contains(rr.Providers, org) {
+			rr.Providers = append(rr.Providers, org)
+		}
+	}
+
+	for _, rateID := range rateIDs {
+		rr := rates[rateID]
+		rr.Quorum = len(rr.Providers)/2 + 1
+		for _, org := range rr.Providers {
+			providerID := "rr" + rateID + "#" + org
+			err := stub.PutState(providerID, []byte("none"))
+			if err != nil {
+				return err
+			}
+			err = setEndorsers(stub, providerID, org)
+			if err != nil {
+				return err
+			}
+		}
+
+		rrID := "rr" + rateID
+		rrJSON, err := json.Marshal(rr)
+		if err != nil {
+			return err
+		}
+		err = stub.PutState(rrID, rrJSON)
+		if err != nil {
+			return err
+		}
+		err = setEndorsers(stub, rrID, rr.Providers...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finalizeFixing aggregates the submissions for a date into the fixing of the reference rate.
+// The fixing is endorsed by all providers of the rate, so it cannot be changed afterwards.
+func finalizeFixing(stub shim.ChaincodeStubInterface, rateID string, rr *ReferenceRate, date string, submissions []*Submission) error {
+	now, err := txTime(stub)
+	if err != nil {
+		return err
+	}
+	fixing := &Fixing{
+		RateBPS:     aggregate(rr, submissions),
+		Date:        date,
+		Timestamp:   now,
+		Method:      rr.Method,
+		Submissions: submissions,
+	}
+	outliers := []*Submission{}
+	for _, s := range submissions {
+		if swapmath.IsOutlier(s.RateBPS, fixing.RateBPS, rr.OutlierBPS) {
+			outliers = append(outliers, s)
+			fixing.Outliers = append(fixing.Outliers, s.Provider)
+		}
+	}
+
+	fixingID := "fixing" + rateID + "@" + date
+	fixingJSON, err := json.Marshal(fixing)
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(fixingID, fixingJSON)
+	if err != nil {
+		return err
+	}
+	err = setEndorsers(stub, fixingID, rr.Providers...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Reference rate %s fixed at %d for %s\n", rateID, fixing.RateBPS, date)
+
+	if len(outliers) > 0 {
+		eventJSON, err := json.Marshal(outlierEvent{rateID, date, fixing.RateBPS, outliers})
+		if err != nil {
+			return err
+		}
+		err = stub.SetEvent("ReferenceRateOutliers", eventJSON)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// aggregate returns the median or trimmed mean of the submitted rates, rounded towards zero
+func aggregate(rr *ReferenceRate, submissions []*Submission) int64 {
+	rates := make([]int64, len(submissions))
+	for i, s := range submissions {
+		rates[i] = s.RateBPS
+	}
+	return swapmath.Aggregate(rr.Method, rr.TrimPercent, rates)
+}
+
+// getReferenceRate reads the definition of a reference rate
+func getReferenceRate(stub shim.ChaincodeStubInterface, rateID string) (*ReferenceRate, error) {
+	rrJSON, err := stub.GetState("rr" + rateID)
+	if err != nil {
+		return nil, err
+	}
+	if rrJSON == nil {
+		return nil, fmt.Errorf("Reference rate %s not found", rateID)
+	}
+	var rr ReferenceRate
+	err = json.Unmarshal(rrJSON, &rr)
+	if err != nil {
+		return nil, err
+	}
+	return &rr, nil
+}
+
+// validateReferenceRate checks that the quorum and aggregation method of a reference rate are usable
+func validateReferenceRate(rr *ReferenceRate) error {
+	if rr.Quorum < 1 || rr.Quorum > len(rr.Providers) {
+		return fmt.Errorf("Quorum must be between 1 and the number of providers (%d)", len(rr.Providers))
+	}
+	switch rr.Method {
+	case median:
+	case trimmedMean:
+		// less than half is trimmed at either end, so at least one submission remains
+		if rr.TrimPercent < 0 || rr.TrimPercent >= 50 {
+			return fmt.Errorf("Trim percentage must be between 0 and 49")
+		}
+	default:
+		return fmt.Errorf("Unsupported aggregation method %s", rr.Method)
+	}
+	if rr.OutlierBPS < 0 {
+		return fmt.Errorf("Outlier threshold must not be negative")
+	}
+	return nil
+}
+
+// readFixing returns the finalized fixing of a reference rate for a date, nil if the rate has not been fixed
+func readFixing(stub shim.ChaincodeStubInterface, rateID string, date string) (*Fixing, error) {
+	fixingJSON, err := stub.GetState("fixing" + rateID + "@" + date)
+	if err != nil {
+		return nil, err
+	}
+	if fixingJSON == nil {
+		return nil, nil
+	}
+	var fixing Fixing
+	err = json.Unmarshal(fixingJSON, &fixing)
+	if err != nil {
+		return nil, err
+	}
+	return &fixing, nil
+}
+
+// setEndorsers sets the endorsement policy of a key to require all given organizations
+func setEndorsers(stub shim.ChaincodeStubInterface, key string, orgs ...string) error {
+	ep, err := statebased.NewStateEP(nil)
+	if err != nil {
+		return err
+	}
+	err = ep.AddOrgs(statebased.RoleTypePeer, orgs...)
+	if err != nil {
+		return err
+	}
+	epBytes, err := ep.Policy()
+	if err != nil {
+		return err
+	}
+	return stub.SetStateValidationParameter(key, epBytes)
+}
+
+// contains checks if an organization is in a list
+func contains(orgs []string, org string) bool {
+	for _, o := range orgs {
+		if o == org {
+			return true
+		}
+	}
+	return false
+}
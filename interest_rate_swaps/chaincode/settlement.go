@@ -0,0 +1,333 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-samples/interest_rate_swaps/chaincode/swapmath"
+)
+
+// Settlement records that a payment of a swap has been made off-chain.
+// Payer, Payee and Amount are given by the settlement instruction, Reference
+// identifies the transfer in the external payment system. NettingID is set
+// if the payment was settled as part of a netting. Submitter is the MSP ID of
+// the client that submitted the instruction, ProposalSignature its signature
+// of the transaction proposal with ID TxID.
+type Settlement struct {
+	SwapID    string
+	Payer     string
+	Payee     string
+	Amount    uint64
+	Reference string
+	NettingID string `json:",omitempty"`
+	Timestamp time.Time
+	Submitter string
+	TxID      string
+	ProposalSignature
+}
+
+// Netting combines the outstanding payments of all swaps between two
+// participants into a single net obligation of Payer to pay Amount to Payee.
+// Payments holds the netted payment of every swap, from party A to party B
+// of the swap.
+type Netting struct {
+	ID        string
+	Payer     string
+	Payee     string
+	Amount    uint64
+	Payments  map[string]int64
+	Settled   bool
+	Reference string `json:",omitempty"`
+}
+
+// Define objectType names for prefix
+const settlementPrefix = "settlement"
+
+// Net the outstanding payments of all swaps between two participants.
+// The payments are marked as part of the netting (the payment entries hold the
+// netting key instead of the amount), so they can only be settled together by
+// settleNetting. Since the payment entries are updated, the transaction needs
+// to be endorsed according to the policies of all swaps involved.
+// Returns the JSONized Netting, its ID is the transaction ID.
+// Parameters: MSP ID of participant 1, MSP ID of participant 2
+func netPayments(stub shim.ChaincodeStubInterface) pb.Response {
+	_, parameters := stub.GetFunctionAndParameters()
+	if len(parameters) != 2 {
+		return shim.Error("Wrong number of arguments supplied. Expected: <participant1_MSPID> <participant2_MSPID>")
+	}
+	party1, party2 := parameters[0], parameters[1]
+	if party1 == party2 {
+		return shim.Error("Payments can only be netted between two different participants")
+	}
+
+	netting := &Netting{
+		ID:       stub.GetTxID(),
+		Payments: map[string]int64{},
+	}
+	nettingID := "netting" + netting.ID
+
+	// all swap keys start with "swap", the range ends before "swaq"
+	swapIterator, err := stub.GetStateByRange("swap", "swaq")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer swapIterator.Close()
+
+	net := swapmath.NewNet(party1, party2)
+	ep, err := statebased.NewStateEP(nil)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for swapIterator.HasNext() {
+		swapKV, err := swapIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		var irs InterestRateSwap
+		err = json.Unmarshal(swapKV.Value, &irs)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if !(irs.PartyA == party1 && irs.PartyB == party2) && !(irs.PartyA == party2 && irs.PartyB == party1) {
+			continue
+		}
+
+		swapID := swapKV.Key[len("swap"):]
+		paymentID := "payment" + swapID
+		paid, err := stub.GetState(paymentID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		payment, err := strconv.ParseInt(string(paid), 10, 64)
+		if err != nil {
+			// settled or already netted
+			continue
+		}
+		netting.Payments[swapID] = payment
+		net.Add(irs.PartyA, payment)
+		err = stub.PutState(paymentID, []byte(nettingID))
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		// the netting is endorsed by everyone endorsing the swaps
+		swapEP, err := stub.GetStateValidationParameter(swapKV.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		orgs, err := statebased.NewStateEP(swapEP)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = ep.AddOrgs(statebased.RoleTypePeer, orgs.ListOrgs()...)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	if len(netting.Payments) == 0 {
+		return shim.Error(fmt.Sprintf("No outstanding payments between %s and %s", party1, party2))
+	}
+
+	var ok bool
+	netting.Payer, netting.Payee, netting.Amount, ok = net.Obligation()
+	if !ok {
+		return shim.Error("Net amount is out of range")
+	}
+
+	nettingJSON, err := json.Marshal(netting)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(nettingID, nettingJSON)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	epBytes, err := ep.Policy()
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.SetStateValidationParameter(nettingID, epBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nettingJSON)
+}
+
+// Settle the net obligation of a netting.
+// The settlement instruction has to match the net obligation. Every payment of
+// the netting is marked done and recorded in the settlement history of its swap
+// with the reference of the net transfer.
+// Parameters: netting ID, MSP ID of the payer, MSP ID of the payee, amount, settlement reference
+func settleNetting(stub shim.ChaincodeStubInterface) pb.Response {
+	_, parameters := stub.GetFunctionAndParameters()
+	if len(parameters) != 5 {
+		return shim.Error("Wrong number of arguments supplied. Expected: <netting_ID> <payer_MSPID> <payee_MSPID> <amount> <settlement_reference>")
+	}
+	amount, err := strconv.ParseUint(parameters[3], 10, 64)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("Invalid amount %s: %s", parameters[3], err))
+	}
+	if parameters[4] == "" {
+		return shim.Error("Settlement reference must not be empty")
+	}
+
+	nettingID := "netting" + parameters[0]
+	nettingJSON, err := stub.GetState(nettingID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if nettingJSON == nil {
+		return shim.Error(fmt.Sprintf("Netting %s does not exist", parameters[0]))
+	}
+	var netting Netting
+	err = json.Unmarshal(nettingJSON, &netting)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if netting.Settled {
+		return shim.Error(fmt.Sprintf("Netting %s has already been settled", parameters[0]))
+	}
+	if !swapmath.MatchesObligation(netting.Payer, netting.Payee, netting.Amount, parameters[1], parameters[2], amount) {
+		return shim.Error(fmt.Sprintf("Settlement instruction does not match the net obligation: %s pays %d to %s", netting.Payer, netting.Amount, netting.Payee))
+	}
+
+	swapIDs := make([]string, 0, len(netting.Payments))
+	for swapID := range netting.Payments {
+		swapIDs = append(swapIDs, swapID)
+	}
+	sort.Strings(swapIDs)
+	for _, swapID := range swapIDs {
+		irs, err := getSwap(stub, swapID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		payer, payee, amount := obligation(irs, netting.Payments[swapID])
+		err = putSettlement(stub, &Settlement{
+			SwapID:    swapID,
+			Payer:     payer,
+			Payee:     payee,
+			Amount:    amount,
+			Reference: parameters[4],
+			NettingID: netting.ID,
+		})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = stub.PutState("payment"+swapID, []byte("none"))
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	netting.Settled = true
+	netting.Reference = parameters[4]
+	nettingJSON, err = json.Marshal(netting)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(nettingID, nettingJSON)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success([]byte{})
+}
+
+// Get the settlement history of a swap, ordered by time
+// Parameters: swap ID
+func getSettlements(stub shim.ChaincodeStubInterface) pb.Response {
+	_, parameters := stub.GetFunctionAndParameters()
+	if len(parameters) != 1 {
+		return shim.Error("Wrong number of arguments supplied. Expected: <swap_ID>")
+	}
+
+	settlementIterator, err := stub.GetStateByPartialCompositeKey(settlementPrefix, []string{parameters[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer settlementIterator.Close()
+
+	settlements := []*Settlement{}
+	for settlementIterator.HasNext() {
+		settlementKV, err := settlementIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		var settlement Settlement
+		err = json.Unmarshal(settlementKV.Value, &settlement)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		settlements = append(settlements, &settlement)
+	}
+	sort.SliceStable(settlements, func(i, j int) bool {
+		return settlements[i].Timestamp.Before(settlements[j].Timestamp)
+	})
+
+	settlementsJSON, err := json.Marshal(settlements)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(settlementsJSON)
+}
+
+// checkInstruction checks that a settlement instruction matches the payment due for a swap
+func checkInstruction(irs *InterestRateSwap, payment int64, instruction *Settlement) error {
+	if irs.PartyA == "" || irs.PartyB == "" {
+		return fmt.Errorf("Swap %s does not record its participants", instruction.SwapID)
+	}
+	payer, payee, amount := obligation(irs, payment)
+	if !swapmath.MatchesObligation(payer, payee, amount, instruction.Payer, instruction.Payee, instruction.Amount) {
+		return fmt.Errorf("Settlement instruction does not match the payment due: %s pays %d to %s", payer, amount, payee)
+	}
+	return nil
+}
+
+// obligation returns who pays whom for a payment from party A to party B of a swap
+func obligation(irs *InterestRateSwap, payment int64) (string, string, uint64) {
+	return swapmath.Obligation(irs.PartyA, irs.PartyB, payment)
+}
+
+// putSettlement records a settlement, signed by the submitter, in the settlement history of the swap.
+// The settlement entry gets the endorsement policy of the swap.
+func putSettlement(stub shim.ChaincodeStubInterface, settlement *Settlement) error {
+	var err error
+	settlement.Timestamp, err = txTime(stub)
+	if err != nil {
+		return err
+	}
+	settlement.TxID = stub.GetTxID()
+	settlement.Submitter, settlement.ProposalSignature, err = signer(stub)
+	if err != nil {
+		return err
+	}
+
+	settlementID, err := stub.CreateCompositeKey(settlementPrefix, []string{settlement.SwapID, settlement.TxID})
+	if err != nil {
+		return err
+	}
+	settlementJSON, err := json.Marshal(settlement)
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(settlementID, settlementJSON)
+	if err != nil {
+		return err
+	}
+	epBytes, err := stub.GetStateValidationParameter("swap" + settlement.SwapID)
+	if err != nil {
+		return err
+	}
+	return stub.SetStateValidationParameter(settlementID, epBytes)
+}
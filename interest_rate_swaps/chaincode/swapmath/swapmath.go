@@ -0,0 +1,181 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package swapmath holds the calculations of the interest rate swap chaincode
+// that don't depend on the ledger: payment periods, day counts, accrued
+// payments, the aggregation of reference rate submissions and the obligations
+// resulting from payments. It is used by the shim chaincode in this module as
+// well as the contract API version in interest_rate_swaps/chaincode-go, so both
+// versions calculate the same values.
+package swapmath
+
+import (
+	"math/big"
+	"sort"
+	"time"
+)
+
+// Supported day count conventions
+const (
+	Actual360 = "ACT/360"
+	Thirty360 = "30/360"
+)
+
+// Aggregation methods of reference rate submissions
+const (
+	Median      = "median"
+	TrimmedMean = "trimmedMean"
+)
+
+const (
+	// accrued interest is principal * rate in basis points * days / (10000 * 360)
+	bpsDivisor  = 10000
+	daysPerYear = 360
+)
+
+// PeriodCount returns the number of payment periods of a swap from start to end
+// with the given payment interval, the last period may be shorter
+func PeriodCount(start time.Time, end time.Time, interval time.Duration) int {
+	length := end.Sub(start)
+	count := length / interval
+	if length%interval != 0 {
+		count++
+	}
+	return int(count)
+}
+
+// PeriodDates returns the start and end date of a payment period of a swap,
+// the last period ends at the end date of the swap
+func PeriodDates(start time.Time, end time.Time, interval time.Duration, period int) (time.Time, time.Time) {
+	periodStart := start.Add(time.Duration(period) * interval)
+	periodEnd := periodStart.Add(interval)
+	if periodEnd.After(end) {
+		periodEnd = end
+	}
+	return periodStart, periodEnd
+}
+
+// DayCount returns the number of days between two dates according to the day count convention
+func DayCount(convention string, start time.Time, end time.Time) int64 {
+	y1, m1, d1 := start.UTC().Date()
+	y2, m2, d2 := end.UTC().Date()
+	if convention == Thirty360 {
+		// 30/360 bond basis
+		if d1 == 31 {
+			d1 = 30
+		}
+		if d2 == 31 && d1 == 30 {
+			d2 = 30
+		}
+		return int64(360*(y2-y1) + 30*(int(m2)-int(m1)) + (d2 - d1))
+	}
+	// ACT/360, count calendar days
+	days := time.Date(y2, m2, d2, 0, 0, 0, 0, time.UTC).Sub(time.Date(y1, m1, d1, 0, 0, 0, 0, time.UTC))
+	return int64(days / (24 * time.Hour))
+}
+
+// Accrue calculates the net payment from party A to party B for a payment
+// period from start to end, rounded towards zero:
+// principal * (fixedRateBPS - referenceRateBPS - floatingRateBPS) / 10000 * days / 360
+// It returns false if the payment doesn't fit into an int64.
+func Accrue(principal uint64, fixedRateBPS uint64, floatingRateBPS uint64, referenceRateBPS int64, convention string, start time.Time, end time.Time) (int64, bool) {
+	rate := new(big.Int).SetUint64(fixedRateBPS)
+	rate.Sub(rate, big.NewInt(referenceRateBPS))
+	rate.Sub(rate, new(big.Int).SetUint64(floatingRateBPS))
+
+	payment := new(big.Int).SetUint64(principal)
+	payment.Mul(payment, rate)
+	payment.Mul(payment, big.NewInt(DayCount(convention, start, end)))
+	payment.Quo(payment, big.NewInt(bpsDivisor*daysPerYear))
+	if !payment.IsInt64() {
+		return 0, false
+	}
+	return payment.Int64(), true
+}
+
+// Aggregate returns the median or trimmed mean (dropping trimPercent of the
+// rates at either end) of the submitted rates, rounded towards zero
+func Aggregate(method string, trimPercent int, submitted []int64) int64 {
+	rates := make([]int64, len(submitted))
+	copy(rates, submitted)
+	sort.Slice(rates, func(i, j int) bool { return rates[i] < rates[j] })
+
+	n := len(rates)
+	if method == TrimmedMean {
+		trim := n * trimPercent / 100
+		var sum int64
+		for _, rate := range rates[trim : n-trim] {
+			sum += rate
+		}
+		return sum / int64(n-2*trim)
+	}
+	if n%2 == 1 {
+		return rates[n/2]
+	}
+	return (rates[n/2-1] + rates[n/2]) / 2
+}
+
+// IsOutlier checks if a submitted rate deviates from the fixing by more than outlierBPS
+func IsOutlier(rate int64, fixing int64, outlierBPS int64) bool {
+	deviation := rate - fixing
+	return deviation > outlierBPS || -deviation > outlierBPS
+}
+
+// Obligation returns who pays whom for a payment from party A to party B of a swap
+func Obligation(partyA string, partyB string, payment int64) (string, string, uint64) {
+	if payment < 0 {
+		return partyB, partyA, uint64(-payment)
+	}
+	return partyA, partyB, uint64(payment)
+}
+
+// MatchesObligation checks an instruction against an obligation, a zero amount can be settled in either direction
+func MatchesObligation(payer string, payee string, amount uint64, instructedPayer string, instructedPayee string, instructedAmount uint64) bool {
+	if amount != instructedAmount {
+		return false
+	}
+	if payer == instructedPayer && payee == instructedPayee {
+		return true
+	}
+	return amount == 0 && payer == instructedPayee && payee == instructedPayer
+}
+
+// Net sums up the payments of the swaps between two participants into a net obligation
+type Net struct {
+	party1 string
+	party2 string
+	// net amount flowing from participant 1 to participant 2
+	amount big.Int
+}
+
+// NewNet returns an empty Net of the payments between two participants
+func NewNet(party1 string, party2 string) *Net {
+	return &Net{party1: party1, party2: party2}
+}
+
+// Add adds the payment from party A to the other party of a swap between the participants
+func (n *Net) Add(partyA string, payment int64) {
+	if partyA == n.party1 {
+		n.amount.Add(&n.amount, big.NewInt(payment))
+	} else {
+		n.amount.Sub(&n.amount, big.NewInt(payment))
+	}
+}
+
+// Obligation returns who pays whom to settle the net amount of the payments,
+// it returns false if the amount doesn't fit into an uint64
+func (n *Net) Obligation() (string, string, uint64, bool) {
+	payer, payee := n.party1, n.party2
+	amount := new(big.Int).Set(&n.amount)
+	if amount.Sign() < 0 {
+		payer, payee = n.party2, n.party1
+		amount.Neg(amount)
+	}
+	if !amount.IsUint64() {
+		return "", "", 0, false
+	}
+	return payer, payee, amount.Uint64(), true
+}
@@ -0,0 +1,272 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package swapmath
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+func date(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+var dayCountTests = []struct {
+	name       string
+	convention string
+	start      string
+	end        string
+	expected   int64
+}{
+	{"ACT/360 month", Actual360, "2021-01-01T00:00:00Z", "2021-02-01T00:00:00Z", 31},
+	{"ACT/360 leap February", Actual360, "2020-02-01T00:00:00Z", "2020-03-01T00:00:00Z", 29},
+	{"ACT/360 counts dates not hours", Actual360, "2021-01-01T23:00:00Z", "2021-01-02T01:00:00Z", 1},
+	{"ACT/360 in UTC", Actual360, "2021-01-01T23:00:00-02:00", "2021-01-02T23:00:00+02:00", 0},
+	{"default is ACT/360", "", "2021-01-01T00:00:00Z", "2021-03-01T00:00:00Z", 59},
+	{"30/360 month", Thirty360, "2021-01-15T00:00:00Z", "2021-02-15T00:00:00Z", 30},
+	{"30/360 year", Thirty360, "2020-03-01T00:00:00Z", "2021-03-01T00:00:00Z", 360},
+	{"30/360 start on the 31st", Thirty360, "2021-01-31T00:00:00Z", "2021-02-28T00:00:00Z", 28},
+	{"30/360 both on the 31st", Thirty360, "2021-01-31T00:00:00Z", "2021-03-31T00:00:00Z", 60},
+	{"30/360 end on the 31st after the 30th", Thirty360, "2021-04-30T00:00:00Z", "2021-05-31T00:00:00Z", 30},
+	{"30/360 end on the 31st only", Thirty360, "2021-01-15T00:00:00Z", "2021-03-31T00:00:00Z", 76},
+	{"30/360 end of February is not adjusted", Thirty360, "2021-02-28T00:00:00Z", "2021-03-31T00:00:00Z", 33},
+}
+
+func TestDayCount(t *testing.T) {
+	for _, tt := range dayCountTests {
+		t.Run(tt.name, func(t *testing.T) {
+			days := DayCount(tt.convention, date(tt.start), date(tt.end))
+			if days != tt.expected {
+				t.Errorf("expected %d days, got %d", tt.expected, days)
+			}
+		})
+	}
+}
+
+var accrueTests = []struct {
+	name       string
+	principal  uint64
+	fixed      uint64
+	floating   uint64
+	reference  int64
+	convention string
+	days       time.Duration
+	expected   int64
+	ok         bool
+}{
+	{"A pays B", 1000000, 300, 50, 100, Actual360, 90, 3750, true},
+	{"B pays A", 1000000, 300, 50, 400, Actual360, 90, -3750, true},
+	{"Negative reference rate", 1000000, 300, 50, -50, Actual360, 90, 7500, true},
+	{"No net payment", 1000000, 150, 50, 100, Actual360, 90, 0, true},
+	{"Rounded towards zero", 1000, 1, 0, 0, Actual360, 1, 0, true},
+	{"Rounded towards zero for B", 1000, 0, 0, 1, Actual360, 1, 0, true},
+	{"30/360", 3600000, 100, 0, 0, Thirty360, 31, 3000, true},
+	{"Out of range", math.MaxUint64, 10000, 0, 0, Actual360, 3600, 0, false},
+	{"Reference rate out of range", math.MaxUint64, 0, 0, math.MaxInt64, Actual360, 3600, 0, false},
+}
+
+func TestAccrue(t *testing.T) {
+	// 2021-01-01 plus 31 days is 2021-02-01, 30 days in 30/360
+	start := date("2021-01-01T00:00:00Z")
+	for _, tt := range accrueTests {
+		t.Run(tt.name, func(t *testing.T) {
+			payment, ok := Accrue(tt.principal, tt.fixed, tt.floating, tt.reference, tt.convention, start, start.Add(tt.days*day))
+			if ok != tt.ok {
+				t.Fatalf("expected ok %v, got %v", tt.ok, ok)
+			}
+			if payment != tt.expected {
+				t.Errorf("expected payment %d, got %d", tt.expected, payment)
+			}
+		})
+	}
+}
+
+var periodTests = []struct {
+	name     string
+	end      string
+	interval time.Duration
+	count    int
+	// start and end of the last period
+	lastStart string
+	lastEnd   string
+}{
+	{"Whole periods", "2021-12-27T00:00:00Z", 90 * day, 4, "2021-09-28T00:00:00Z", "2021-12-27T00:00:00Z"},
+	{"Short last period", "2021-12-01T00:00:00Z", 90 * day, 4, "2021-09-28T00:00:00Z", "2021-12-01T00:00:00Z"},
+	{"Last period one second long", "2021-12-27T00:00:01Z", 90 * day, 5, "2021-12-27T00:00:00Z", "2021-12-27T00:00:01Z"},
+	{"Single period", "2021-02-01T00:00:00Z", 90 * day, 1, "2021-01-01T00:00:00Z", "2021-02-01T00:00:00Z"},
+}
+
+func TestPeriods(t *testing.T) {
+	start := date("2021-01-01T00:00:00Z")
+	for _, tt := range periodTests {
+		t.Run(tt.name, func(t *testing.T) {
+			end := date(tt.end)
+			count := PeriodCount(start, end, tt.interval)
+			if count != tt.count {
+				t.Fatalf("expected %d periods, got %d", tt.count, count)
+			}
+
+			// periods follow each other without gaps
+			periodStart, _ := PeriodDates(start, end, tt.interval, 0)
+			if !periodStart.Equal(start) {
+				t.Errorf("expected the first period to start at %s, got %s", start, periodStart)
+			}
+			for period := 0; period < count-1; period++ {
+				periodStart, periodEnd := PeriodDates(start, end, tt.interval, period)
+				nextStart, _ := PeriodDates(start, end, tt.interval, period+1)
+				if !periodEnd.Equal(nextStart) {
+					t.Errorf("period %d ends at %s, period %d starts at %s", period, periodEnd, period+1, nextStart)
+				}
+				if periodEnd.Sub(periodStart) != tt.interval {
+					t.Errorf("period %d is not %s long", period, tt.interval)
+				}
+			}
+
+			lastStart, lastEnd := PeriodDates(start, end, tt.interval, count-1)
+			if !lastStart.Equal(date(tt.lastStart)) || !lastEnd.Equal(date(tt.lastEnd)) {
+				t.Errorf("expected the last period from %s to %s, got %s to %s", tt.lastStart, tt.lastEnd, lastStart, lastEnd)
+			}
+		})
+	}
+}
+
+type payment struct {
+	partyA string
+	amount int64
+}
+
+type instruction struct {
+	payer  string
+	payee  string
+	amount uint64
+}
+
+var obligationTests = []struct {
+	name          string
+	payment       int64
+	payer         string
+	payee         string
+	amount        uint64
+	instructions  []instruction
+	expectedMatch []bool
+}{
+	{
+		name:    "A pays B",
+		payment: 125,
+		payer:   "A", payee: "B", amount: 125,
+		instructions:  []instruction{{"A", "B", 125}, {"B", "A", 125}, {"A", "B", 124}, {"A", "C", 125}},
+		expectedMatch: []bool{true, false, false, false},
+	},
+	{
+		name:    "B pays A",
+		payment: -125,
+		payer:   "B", payee: "A", amount: 125,
+		instructions:  []instruction{{"B", "A", 125}, {"A", "B", 125}},
+		expectedMatch: []bool{true, false},
+	},
+	{
+		name:    "Nothing to pay",
+		payment: 0,
+		payer:   "A", payee: "B", amount: 0,
+		instructions:  []instruction{{"A", "B", 0}, {"B", "A", 0}, {"A", "B", 1}, {"A", "C", 0}},
+		expectedMatch: []bool{true, true, false, false},
+	},
+}
+
+func TestObligation(t *testing.T) {
+	for _, tt := range obligationTests {
+		t.Run(tt.name, func(t *testing.T) {
+			payer, payee, amount := Obligation("A", "B", tt.payment)
+			if payer != tt.payer || payee != tt.payee || amount != tt.amount {
+				t.Fatalf("expected %s to pay %d to %s, got %s pays %d to %s", tt.payer, tt.amount, tt.payee, payer, amount, payee)
+			}
+			for i, instruction := range tt.instructions {
+				match := MatchesObligation(payer, payee, amount, instruction.payer, instruction.payee, instruction.amount)
+				if match != tt.expectedMatch[i] {
+					t.Errorf("expected instruction %v to match %v, got %v", instruction, tt.expectedMatch[i], match)
+				}
+			}
+		})
+	}
+}
+
+var netTests = []struct {
+	name     string
+	payments []payment
+	payer    string
+	payee    string
+	amount   uint64
+	ok       bool
+}{
+	{"No payments", nil, "org1", "org2", 0, true},
+	{"Payments in both directions", []payment{{"org1", 125}, {"org2", 50}}, "org1", "org2", 75, true},
+	{"Participant 2 owes more", []payment{{"org1", 125}, {"org2", 200}}, "org2", "org1", 75, true},
+	{"Negative payments", []payment{{"org1", -125}, {"org2", -50}}, "org2", "org1", 75, true},
+	{"Payments cancel out", []payment{{"org1", 125}, {"org2", 125}}, "org1", "org2", 0, true},
+	{"Beyond int64", []payment{{"org1", math.MaxInt64}, {"org2", math.MinInt64}}, "org1", "org2", 1<<64 - 1, true},
+	{"Out of range", []payment{{"org1", math.MaxInt64}, {"org1", math.MaxInt64}, {"org1", 2}}, "", "", 0, false},
+}
+
+func TestNet(t *testing.T) {
+	for _, tt := range netTests {
+		t.Run(tt.name, func(t *testing.T) {
+			net := NewNet("org1", "org2")
+			for _, payment := range tt.payments {
+				net.Add(payment.partyA, payment.amount)
+			}
+			payer, payee, amount, ok := net.Obligation()
+			if ok != tt.ok {
+				t.Fatalf("expected ok %v, got %v", tt.ok, ok)
+			}
+			if payer != tt.payer || payee != tt.payee || amount != tt.amount {
+				t.Errorf("expected %s to pay %d to %s, got %s pays %d to %s", tt.payer, tt.amount, tt.payee, payer, amount, payee)
+			}
+		})
+	}
+}
+
+var aggregateTests = []struct {
+	name        string
+	method      string
+	trimPercent int
+	rates       []int64
+	expected    int64
+}{
+	{"Median of odd count", Median, 0, []int64{300, 100, 200}, 200},
+	{"Median of even count", Median, 0, []int64{400, 100, 200, 300}, 250},
+	{"Median rounded towards zero", Median, 0, []int64{-100, -51}, -75},
+	{"Single rate", Median, 0, []int64{42}, 42},
+	{"Trimmed mean without trim", TrimmedMean, 0, []int64{100, 200, 600}, 300},
+	{"Trimmed mean", TrimmedMean, 20, []int64{1000, 100, 110, 120, -500}, 110},
+	{"Trim rounded down", TrimmedMean, 10, []int64{1000, 100, 110, 120, -500}, 166},
+	{"Trimmed mean rounded towards zero", TrimmedMean, 0, []int64{-1, -2}, -1},
+}
+
+func TestAggregate(t *testing.T) {
+	for _, tt := range aggregateTests {
+		t.Run(tt.name, func(t *testing.T) {
+			rates := append([]int64{}, tt.rates...)
+			fixing := Aggregate(tt.method, tt.trimPercent, rates)
+			if fixing != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, fixing)
+			}
+			// the submitted rates are not reordered
+			for i := range rates {
+				if rates[i] != tt.rates[i] {
+					t.Fatalf("submitted rates were modified: %v", rates)
+				}
+			}
+		})
+	}
+}
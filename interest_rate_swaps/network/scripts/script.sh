@@ -8,6 +8,10 @@ MAX_RETRY=5
 
 CC_SRC_PATH="irscc/"
 
+# the swap starts yesterday, reference rates can only be submitted for dates close to today
+START=$(date -u -d @$(( $(date +%s) - 86400 )) +%Y-%m-%d)
+END=$(date -u -d @$(( $(date +%s) + 2 * 86400 )) +%Y-%m-%d)
+
 createChannel() {
 	CORE_PEER_LOCALMSPID=partya
 	CORE_PEER_ADDRESS=irs-partya:7051
@@ -106,7 +110,7 @@ setReferenceRate() {
 	CORE_PEER_ADDRESS=irs-rrprovider:7051
 	CORE_PEER_MSPCONFIGPATH=/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/peerOrganizations/rrprovider.example.com/users/User1@rrprovider.example.com/msp
 	echo "===================== Invoking chaincode ===================== "
-	peer chaincode invoke -o irs-orderer:7050 -C irs --waitForEvent -n irscc --peerAddresses irs-rrprovider:7051 -c '{"Args":["setReferenceRate","myrr","300"]}'
+	peer chaincode invoke -o irs-orderer:7050 -C irs --waitForEvent -n irscc --peerAddresses irs-rrprovider:7051 -c '{"Args":["setReferenceRate","myrr","300","'"$START"'"]}'
 	echo "===================== Chaincode invoked ===================== "
 }
 
@@ -115,7 +119,7 @@ createSwap() {
 	CORE_PEER_ADDRESS=irs-partya:7051
 	CORE_PEER_MSPCONFIGPATH=/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/peerOrganizations/partya.example.com/users/User1@partya.example.com/msp
 	echo "===================== Invoking chaincode ===================== "
-	peer chaincode invoke -o irs-orderer:7050 -C irs --waitForEvent -n irscc --peerAddresses irs-partya:7051 --peerAddresses irs-partyb:7051 --peerAddresses irs-auditor:7051 -c '{"Args":["createSwap","myswap","{\"StartDate\":\"2018-09-27T15:04:05Z\",\"EndDate\":\"2018-09-30T15:04:05Z\",\"PaymentInterval\":395,\"PrincipalAmount\":100000,\"FixedRateBPS\":400,\"FloatingRateBPS\":500,\"ReferenceRate\":\"myrr\"}", "partya", "partyb"]}'
+	peer chaincode invoke -o irs-orderer:7050 -C irs --waitForEvent -n irscc --peerAddresses irs-partya:7051 --peerAddresses irs-partyb:7051 --peerAddresses irs-auditor:7051 -c '{"Args":["createSwap","myswap","{\"StartDate\":\"'"$START"'T00:00:00Z\",\"EndDate\":\"'"$END"'T00:00:00Z\",\"PaymentInterval\":86400000000000,\"PrincipalAmount\":100000,\"FixedRateBPS\":400,\"FloatingRateBPS\":500,\"ReferenceRate\":\"myrr\",\"DayCountConvention\":\"ACT/360\"}", "partya", "partyb"]}'
 	echo "===================== Chaincode invoked ===================== "
 }
 
@@ -124,7 +128,7 @@ calculatePayment() {
 	CORE_PEER_ADDRESS=irs-partya:7051
 	CORE_PEER_MSPCONFIGPATH=/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/peerOrganizations/partya.example.com/users/User1@partya.example.com/msp
 	echo "===================== Invoking chaincode ===================== "
-	peer chaincode invoke -o irs-orderer:7050 -C irs --waitForEvent -n irscc --peerAddresses irs-partya:7051 --peerAddresses irs-partyb:7051 -c '{"Args":["calculatePayment","myswap"]}'
+	peer chaincode invoke -o irs-orderer:7050 -C irs --waitForEvent -n irscc --peerAddresses irs-partya:7051 --peerAddresses irs-partyb:7051 -c '{"Args":["calculatePayment","myswap","0"]}'
 	echo "===================== Chaincode invoked ===================== "
 }
 
@@ -133,7 +137,7 @@ settlePayment() {
 	CORE_PEER_ADDRESS=irs-partyb:7051
 	CORE_PEER_MSPCONFIGPATH=/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/peerOrganizations/partyb.example.com/users/User1@partyb.example.com/msp
 	echo "===================== Invoking chaincode ===================== "
-	peer chaincode invoke -o irs-orderer:7050 -C irs --waitForEvent -n irscc --peerAddresses irs-partya:7051 --peerAddresses irs-partyb:7051 -c '{"Args":["settlePayment","myswap"]}'
+	peer chaincode invoke -o irs-orderer:7050 -C irs --waitForEvent -n irscc --peerAddresses irs-partya:7051 --peerAddresses irs-partyb:7051 -c '{"Args":["settlePayment","myswap","partyb","partya","11","SETTLEMENT-0001"]}'
 	echo "===================== Chaincode invoked ===================== "
 }
 
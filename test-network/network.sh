@@ -378,6 +378,8 @@ CC_END_POLICY="NA"
 CC_COLL_CONFIG="NA"
 # chaincode init function defaults to "NA"
 CC_INIT_FCN="NA"
+# chaincode init function arguments default to none
+export CC_INIT_ARGS="[]"
 # use this as the default docker-compose yaml definition
 COMPOSE_FILE_BASE=compose-test-net.yaml
 # docker-compose.yaml file if you are using couchdb
@@ -486,6 +488,10 @@ while [[ $# -ge 1 ]] ; do
     CC_INIT_FCN="$2"
     shift
     ;;
+  -ccia )
+    CC_INIT_ARGS="$2"
+    shift
+    ;;
   -ccaasdocker )
     CCAAS_DOCKER_RUN="$2"
     shift
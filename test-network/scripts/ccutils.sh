@@ -128,9 +128,9 @@ function chaincodeInvokeInit() {
   # peer (if join was successful), let's supply it directly as we know
   # it using the "-o" option
   set -x
-  fcn_call='{"function":"'${CC_INIT_FCN}'","Args":[]}'
+  fcn_call='{"function":"'${CC_INIT_FCN}'","Args":'${CC_INIT_ARGS:-[]}'}'
   infoln "invoke fcn call:${fcn_call}"
-  peer chaincode invoke -o localhost:7050 --ordererTLSHostnameOverride orderer.example.com --tls --cafile "$ORDERER_CA" -C $CHANNEL_NAME -n ${CC_NAME} "${PEER_CONN_PARMS[@]}" --isInit -c ${fcn_call} >&log.txt
+  peer chaincode invoke -o localhost:7050 --ordererTLSHostnameOverride orderer.example.com --tls --cafile "$ORDERER_CA" -C $CHANNEL_NAME -n ${CC_NAME} "${PEER_CONN_PARMS[@]}" --isInit -c "${fcn_call}" >&log.txt
   res=$?
   { set +x; } 2>/dev/null
   cat log.txt
@@ -60,11 +60,12 @@ function printHelp() {
     println "    -ccep <policy>  - (Optional) Chaincode endorsement policy using signature policy syntax. The default policy requires an endorsement from Org1 and Org2"
     println "    -cccg <collection-config>  - (Optional) File path to private data collections configuration file"
     println "    -cci <fcn name>  - (Optional) Name of chaincode initialization function. When a function is provided, the execution of init will be requested and the function will be invoked."
+    println "    -ccia <fcn args>  - (Optional) Arguments of the chaincode initialization function as a JSON array of strings, e.g. '[\"a\",\"b\"]'. No arguments by default"
     println
     println "    -h - Print this message"
     println
     println " Possible Mode and flag combinations"
-    println "   \033[0;32mdeployCC\033[0m -ccn -ccl -ccv -ccs -ccp -cci -r -d -verbose"
+    println "   \033[0;32mdeployCC\033[0m -ccn -ccl -ccv -ccs -ccp -cci -ccia -r -d -verbose"
     println
     println " Examples:"
     println "   network.sh deployCC -ccn basic -ccp ../asset-transfer-basic/chaincode-javascript/ ./ -ccl javascript"
@@ -82,12 +83,13 @@ function printHelp() {
     println "    -ccep <policy>  - (Optional) Chaincode endorsement policy using signature policy syntax. The default policy requires an endorsement from Org1 and Org2"
     println "    -cccg <collection-config>  - (Optional) File path to private data collections configuration file"
     println "    -cci <fcn name>  - (Optional) Name of chaincode initialization function. When a function is provided, the execution of init will be requested and the function will be invoked."
+    println "    -ccia <fcn args>  - (Optional) Arguments of the chaincode initialization function as a JSON array of strings, e.g. '[\"a\",\"b\"]'. No arguments by default"
     println "    -ccaasdocker <true|false>  - (Optional) Default is true; the chaincode docker image will be built and containers started automatically. Set to false to control this manually"
     println
     println "    -h - Print this message"
     println
     println " Possible Mode and flag combinations"
-    println "   \033[0;32mdeployCC\033[0m -ccn -ccv -ccs -ccp -cci -r -d -verbose"
+    println "   \033[0;32mdeployCC\033[0m -ccn -ccv -ccs -ccp -cci -ccia -r -d -verbose"
     println
     println " Examples:"
     println "   network.sh deployCCAAS  -ccn basicj -ccp ../asset-transfer-basic/chaincode-java"
@@ -121,6 +123,7 @@ function printHelp() {
     println "    -ccep <policy>  - (Optional) Chaincode endorsement policy using signature policy syntax. The default policy requires an endorsement from Org1 and Org2"
     println "    -cccg <collection-config>  - (Optional) File path to private data collections configuration file"
     println "    -cci <fcn name>  - (Optional) Name of chaincode initialization function. When a function is provided, the execution of init will be requested and the function will be invoked."
+    println "    -ccia <fcn args>  - (Optional) Arguments of the chaincode initialization function as a JSON array of strings, e.g. '[\"a\",\"b\"]'. No arguments by default"
     println
     println "    -h - Print this message"
     println
@@ -128,7 +131,7 @@ function printHelp() {
     println "   \033[0;32mup\033[0m -ca -r -d -s -verbose"
     println "   \033[0;32mup createChannel\033[0m -ca -c -r -d -s -verbose"
     println "   \033[0;32mcreateChannel\033[0m -c -r -d -verbose"
-    println "   \033[0;32mdeployCC\033[0m -ccn -ccl -ccv -ccs -ccp -cci -r -d -verbose"
+    println "   \033[0;32mdeployCC\033[0m -ccn -ccl -ccv -ccs -ccp -cci -ccia -r -d -verbose"
     println
     println " Examples:"
     println "   network.sh up createChannel -ca -c mychannel -s couchdb"
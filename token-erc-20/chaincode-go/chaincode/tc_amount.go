@@ -0,0 +1,200 @@
+package chaincode
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Amounts (balances, allowances, total supply and event values) are decimal strings, e.g. "12.5"
+// The number of decimal places is set by the decimals option at Initialize
+// Internally amounts are handled as math/big integers of the smallest unit (amount * 10^decimals)
+// and stored in the world state as decimal strings with exactly decimals places, e.g. "12.50" for decimals "2"
+//
+// Balances written before amounts became decimal strings are plain integers (e.g. "5000"),
+// they are read as whole tokens and rewritten in the decimal form on the next update or by MigrateBalances
+
+// maxDecimals is the largest number of decimal places, 10^77 is the largest power of ten fitting into maxAmount
+const maxDecimals = 77
+
+// maxAmount is the largest amount in the smallest units, mirroring the uint256 used by ERC-20
+var maxAmount = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+// MigrateBalances rewrites balances of the given accounts, all allowances and the total supply in the decimal form
+// Migration is optional, integer balances are read correctly anyway
+// This is a governance transaction, it must be endorsed by all governance organizations:
+// it records its ID under the migration key, which carries their state-based endorsement policy (see setRolesEndorsement)
+func (s *SmartContract) MigrateBalances(ctx contractapi.TransactionContextInterface, accounts []string) error {
+
+	_, err := checkGovernance(ctx)
+	if err != nil {
+		return err
+	}
+
+	migration, err := ctx.GetStub().GetState(migrationKey)
+	if err != nil {
+		return fmt.Errorf("failed to read migration: %v", err)
+	}
+	if migration == nil {
+		return errors.New("migration has no endorsement policy yet, call SetGovernance() to set it")
+	}
+	err = ctx.GetStub().PutState(migrationKey, []byte(ctx.GetStub().GetTxID()))
+	if err != nil {
+		return fmt.Errorf("failed to put migration: %v", err)
+	}
+
+	decimals, err := getDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys := append([]string{totalSupplyKey}, accounts...)
+
+	allowanceIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(allowancePrefix, []string{})
+	if err != nil {
+		return fmt.Errorf("failed to get allowances: %v", err)
+	}
+	defer allowanceIterator.Close()
+
+	for allowanceIterator.HasNext() {
+		allowance, err := allowanceIterator.Next()
+		if err != nil {
+			return fmt.Errorf("failed to get allowance: %v", err)
+		}
+		keys = append(keys, allowance.Key)
+	}
+
+	for _, key := range keys {
+		amount, err := getAmount(ctx, key, decimals)
+		if err != nil {
+			return err
+		}
+		if amount == nil {
+			continue
+		}
+		err = putAmount(ctx, key, amount, decimals)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf("%d amounts migrated", len(keys))
+
+	return nil
+}
+
+// Helper Functions
+
+// getDecimals reads the number of decimal places set at Initialize
+func getDecimals(ctx contractapi.TransactionContextInterface) (int, error) {
+
+	decimalsBytes, err := ctx.GetStub().GetState(decimalsKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get decimals: %v", err)
+	}
+	if decimalsBytes == nil {
+		return 0, errors.New("decimals are not set, call Initialize() to initialize contract")
+	}
+
+	return checkDecimals(string(decimalsBytes))
+}
+
+// checkDecimals validates the decimals option
+func checkDecimals(decimals string) (int, error) {
+
+	d, err := strconv.Atoi(decimals)
+	if err != nil || d < 0 || d > maxDecimals {
+		return 0, fmt.Errorf("decimals must be an integer between 0 and %d", maxDecimals)
+	}
+
+	return d, nil
+}
+
+// parseAmount converts a decimal string to the amount in the smallest units
+// Negative amounts, amounts with more than decimals places and amounts above maxAmount are rejected
+func parseAmount(amount string, decimals int) (*big.Int, error) {
+
+	parts := strings.SplitN(amount, ".", 2)
+	whole, fraction := parts[0], ""
+	if len(parts) == 2 {
+		fraction = parts[1]
+		if fraction == "" {
+			return nil, fmt.Errorf("invalid amount %s", amount)
+		}
+	}
+	if whole == "" || !isDigits(whole) || !isDigits(fraction) {
+		return nil, fmt.Errorf("invalid amount %s", amount)
+	}
+	if len(fraction) > decimals {
+		return nil, fmt.Errorf("amount %s has more than %d decimal places", amount, decimals)
+	}
+
+	units, ok := new(big.Int).SetString(whole+fraction+strings.Repeat("0", decimals-len(fraction)), 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount %s", amount)
+	}
+	if units.Cmp(maxAmount) > 0 {
+		return nil, fmt.Errorf("amount %s is too large", amount)
+	}
+
+	return units, nil
+}
+
+// formatAmount converts the amount in the smallest units to a decimal string with exactly decimals places
+func formatAmount(units *big.Int, decimals int) string {
+
+	digits := units.String()
+	if decimals == 0 {
+		return digits
+	}
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+
+	return digits[:len(digits)-decimals] + "." + digits[len(digits)-decimals:]
+}
+
+// getAmount reads the amount stored under the key, nil is returned when the key doesn't exist
+func getAmount(ctx contractapi.TransactionContextInterface, key string, decimals int) (*big.Int, error) {
+
+	amountBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from world state: %v", key, err)
+	}
+	if amountBytes == nil {
+		return nil, nil
+	}
+
+	amount, err := parseAmount(string(amountBytes), decimals)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse amount stored under %s: %v", key, err)
+	}
+
+	return amount, nil
+}
+
+// putAmount stores the amount under the key in the decimal form
+func putAmount(ctx contractapi.TransactionContextInterface, key string, amount *big.Int, decimals int) error {
+
+	err := ctx.GetStub().PutState(key, []byte(formatAmount(amount, decimals)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", key, err)
+	}
+
+	return nil
+}
+
+// isDigits checks if the string consists of decimal digits only
+func isDigits(str string) bool {
+	for _, c := range str {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
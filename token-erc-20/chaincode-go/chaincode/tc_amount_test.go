@@ -0,0 +1,281 @@
+package chaincode
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-samples/token-erc-20/chaincode-go/chaincode/tests/testsfakes"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ParseAmount = []struct {
+	name          string
+	amount        string
+	decimals      int
+	expected      string
+	expectedError string
+}{
+	{
+		name:     "Integer",
+		amount:   "5000",
+		decimals: 2,
+		expected: "500000",
+	},
+	{
+		name:     "Fraction",
+		amount:   "12.5",
+		decimals: 18,
+		expected: "12500000000000000000",
+	},
+	{
+		name:     "Max amount",
+		amount:   "115792089237316195423570985008687907853269984665640564039457584007913129639935",
+		decimals: 0,
+		expected: "115792089237316195423570985008687907853269984665640564039457584007913129639935",
+	},
+	{
+		name:          "Too large",
+		amount:        "115792089237316195423570985008687907853269984665640564039457584007913129639936",
+		decimals:      0,
+		expectedError: "amount 115792089237316195423570985008687907853269984665640564039457584007913129639936 is too large",
+	},
+	{
+		name:          "Too many decimal places",
+		amount:        "1.234",
+		decimals:      2,
+		expectedError: "amount 1.234 has more than 2 decimal places",
+	},
+	{
+		name:          "Negative",
+		amount:        "-1",
+		decimals:      2,
+		expectedError: "invalid amount -1",
+	},
+	{
+		name:          "No whole part",
+		amount:        ".5",
+		decimals:      2,
+		expectedError: "invalid amount .5",
+	},
+	{
+		name:          "No fraction",
+		amount:        "5.",
+		decimals:      2,
+		expectedError: "invalid amount 5.",
+	},
+	{
+		name:          "Empty",
+		amount:        "",
+		decimals:      0,
+		expectedError: "invalid amount ",
+	},
+}
+
+var _FormatAmount = []struct {
+	name     string
+	units    string
+	decimals int
+	expected string
+}{
+	{
+		name:     "No decimals",
+		units:    "5000",
+		decimals: 0,
+		expected: "5000",
+	},
+	{
+		name:     "Decimals",
+		units:    "500012",
+		decimals: 2,
+		expected: "5000.12",
+	},
+	{
+		name:     "Below one",
+		units:    "5",
+		decimals: 3,
+		expected: "0.005",
+	},
+	{
+		name:     "Zero",
+		units:    "0",
+		decimals: 2,
+		expected: "0.00",
+	},
+}
+
+var _Transfer = []struct {
+	name          string
+	amount        string
+	state         map[string]string
+	expectedError string
+	expectedFrom  string
+	expectedTo    string
+}{
+	{
+		name:   "Big amounts",
+		amount: "0.000000000000000001",
+		state: map[string]string{
+			"SENDER":    "100000000000000000000000000000.000000000000000000",
+			"RECIPIENT": "99999999999999999999999999999.999999999999999999",
+		},
+		expectedFrom: "99999999999999999999999999999.999999999999999999",
+		expectedTo:   "100000000000000000000000000000.000000000000000000",
+	},
+	{
+		name:   "Integer balances",
+		amount: "0.5",
+		state: map[string]string{
+			"SENDER": "5000",
+		},
+		expectedFrom: "4999.500000000000000000",
+		expectedTo:   "0.500000000000000000",
+	},
+	{
+		name:   "Insufficient funds",
+		amount: "5000.000000000000000001",
+		state: map[string]string{
+			"SENDER": "5000",
+		},
+		expectedError: "failed to transfer: client account SENDER has insufficient funds",
+	},
+	{
+		name:   "Overflow",
+		amount: "1",
+		state: map[string]string{
+			"SENDER":    "1",
+			"RECIPIENT": "115792089237316195423570985008687907853269984665640564039457.584007913129639935",
+		},
+		expectedError: "failed to transfer: Math: addition overflow occurred 115792089237316195423570985008687907853269984665640564039457584007913129639935 + 1000000000000000000",
+	},
+}
+
+func TestParseAmount(t *testing.T) {
+
+	for _, tt := range _ParseAmount {
+		t.Run(tt.name, func(t *testing.T) {
+
+			units, err := parseAmount(tt.amount, tt.decimals)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, units.String())
+			}
+		})
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+
+	for _, tt := range _FormatAmount {
+		t.Run(tt.name, func(t *testing.T) {
+
+			units, err := parseAmount(tt.units, 0)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, formatAmount(units, tt.decimals))
+		})
+	}
+}
+
+func TestTransfer(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	stub := &testsfakes.FakeTestChaincodeStubInterface{}
+	tc := &testsfakes.FakeTestTransactionContextInterface{}
+	tc.GetStubStub = func() shim.ChaincodeStubInterface {
+		return stub
+	}
+	identity := &testsfakes.FakeTestClientIdentity{}
+	identity.GetIDReturns("SENDER", nil)
+	tc.GetClientIdentityReturns(identity)
+
+	for _, tt := range _Transfer {
+		t.Run(tt.name, func(t *testing.T) {
+
+			//Prepare dynamic data
+			stub.GetStateStub = func(key string) ([]byte, error) {
+				switch key {
+				case nameKey:
+					return []byte("name"), nil
+				case decimalsKey:
+					return []byte("18"), nil
+				}
+				if v, ok := tt.state[key]; ok {
+					return []byte(v), nil
+				}
+				return nil, nil
+			}
+			written := map[string]string{}
+			stub.PutStateStub = func(key string, value []byte) error {
+				written[key] = string(value)
+				return nil
+			}
+			var transferEvent string
+			stub.SetEventStub = func(name string, payload []byte) error {
+				transferEvent = string(payload)
+				return nil
+			}
+
+			err := sc.Transfer(tc, "RECIPIENT", tt.amount)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedFrom, written["SENDER"])
+				assert.Equal(t, tt.expectedTo, written["RECIPIENT"])
+				units, _ := parseAmount(tt.amount, 18)
+				assert.JSONEq(t, `{"from":"SENDER","to":"RECIPIENT","value":"`+formatAmount(units, 18)+`"}`, transferEvent)
+			}
+		})
+	}
+}
+
+func TestMigrateBalances(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	stub := &testsfakes.FakeTestChaincodeStubInterface{}
+	tc := &testsfakes.FakeTestTransactionContextInterface{}
+	tc.GetStubStub = func() shim.ChaincodeStubInterface {
+		return stub
+	}
+	identity := &testsfakes.FakeTestClientIdentity{}
+	tc.GetClientIdentityReturns(identity)
+	roles := `{"minter":"Org1MSP","admin":"Org2MSP","banks":["Org1MSP"],"governance":["Org1MSP","Org2MSP"]}`
+	state := map[string][]byte{
+		nameKey:        []byte("name"),
+		decimalsKey:    []byte("2"),
+		rolesKey:       []byte(roles),
+		totalSupplyKey: []byte("5000"),
+		"ACCOUNT":      []byte("5000"),
+	}
+	withWorldState(stub, state)
+	stub.GetTxIDReturns("TX1")
+
+	identity.GetMSPIDReturns("Org3MSP", nil)
+	err := sc.MigrateBalances(tc, []string{"ACCOUNT"})
+	assert.EqualError(t, err, "client is not authorized to change roles")
+	assert.Equal(t, "5000", string(state["ACCOUNT"]))
+
+	//contract initialized by a version without the migration key
+	identity.GetMSPIDReturns("Org1MSP", nil)
+	err = sc.MigrateBalances(tc, []string{"ACCOUNT"})
+	assert.EqualError(t, err, "migration has no endorsement policy yet, call SetGovernance() to set it")
+	assert.Equal(t, "5000", string(state["ACCOUNT"]))
+	assert.Equal(t, 0, stub.PutStateCallCount())
+
+	state[migrationKey] = []byte("TX0")
+	err = sc.MigrateBalances(tc, []string{"ACCOUNT", "MISSING"})
+	assert.NoError(t, err)
+	assert.Equal(t, "5000.00", string(state["ACCOUNT"]))
+	assert.Equal(t, "5000.00", string(state[totalSupplyKey]))
+	assert.NotContains(t, state, "MISSING")
+
+	//the migration key is written so that the endorsement policy of the governance organizations applies
+	assert.Equal(t, 3, stub.PutStateCallCount())
+	key, value := stub.PutStateArgsForCall(0)
+	assert.Equal(t, migrationKey, key)
+	assert.Equal(t, "TX1", string(value))
+	assert.Equal(t, roles, string(state[rolesKey]))
+}
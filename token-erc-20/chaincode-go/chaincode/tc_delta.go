@@ -0,0 +1,305 @@
+package chaincode
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Delta balance mode applies the high-throughput pattern (see high-throughput/chaincode-go) to an account balance.
+// Every transfer normally reads and rewrites the balance key of the recipient, so concurrent payments to the same
+// account fail with MVCC_READ_CONFLICT. In delta balance mode a credit only appends a row under the composite key
+// account~op~value~txID, which no other transaction reads or writes. The balance is the value under the balance key
+// plus all delta rows. Debits read the balance (all rows), so they are still serialized with other transactions
+// changing the account, and append a "-" row. PruneBalance folds the rows back into the balance key.
+//
+// Credits don't check the balance for overflow, balances can't overflow as the total supply is checked when minting.
+
+// Define objectType names for prefix
+const deltaBalancePrefix = "deltaBalance"
+const deltaIndexName = "account~op~value~txID"
+
+// EnableDeltaBalance switches the calling client's account to delta balance mode
+func (s *SmartContract) EnableDeltaBalance(ctx contractapi.TransactionContextInterface) error {
+
+	//check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	delta, err := isDeltaBalance(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	if delta {
+		return fmt.Errorf("account %s is already in delta balance mode", clientID)
+	}
+
+	deltaBalanceKey, err := ctx.GetStub().CreateCompositeKey(deltaBalancePrefix, []string{clientID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", deltaBalancePrefix, err)
+	}
+	err = ctx.GetStub().PutState(deltaBalanceKey, []byte("true"))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", deltaBalanceKey, err)
+	}
+
+	log.Printf("account %s switched to delta balance mode", clientID)
+
+	return nil
+}
+
+// DisableDeltaBalance folds the delta rows of the calling client's account and switches it back to a single balance key
+func (s *SmartContract) DisableDeltaBalance(ctx contractapi.TransactionContextInterface) error {
+
+	//check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	_, err = pruneDeltas(ctx, clientID)
+	if err != nil {
+		return err
+	}
+
+	deltaBalanceKey, err := ctx.GetStub().CreateCompositeKey(deltaBalancePrefix, []string{clientID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", deltaBalancePrefix, err)
+	}
+	err = ctx.GetStub().DelState(deltaBalanceKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete state of smart contract for key %s: %v", deltaBalanceKey, err)
+	}
+
+	log.Printf("account %s switched back from delta balance mode", clientID)
+
+	return nil
+}
+
+// PruneBalance folds all delta rows of the account into its balance key and returns the number of rows pruned
+// The balance doesn't change, so any client can prune any account. It should be done when the account is not busy,
+// as the transaction conflicts with concurrent credits of the account
+func (s *SmartContract) PruneBalance(ctx contractapi.TransactionContextInterface, account string) (int, error) {
+
+	//check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return 0, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	delta, err := isDeltaBalance(ctx, account)
+	if err != nil {
+		return 0, err
+	}
+	if !delta {
+		return 0, fmt.Errorf("account %s is not in delta balance mode", account)
+	}
+
+	return pruneDeltas(ctx, account)
+}
+
+// Helper Functions
+
+// isDeltaBalance checks if the account is in delta balance mode
+func isDeltaBalance(ctx contractapi.TransactionContextInterface, account string) (bool, error) {
+
+	deltaBalanceKey, err := ctx.GetStub().CreateCompositeKey(deltaBalancePrefix, []string{account})
+	if err != nil {
+		return false, fmt.Errorf("failed to create the composite key for prefix %s: %v", deltaBalancePrefix, err)
+	}
+
+	deltaBalanceBytes, err := ctx.GetStub().GetState(deltaBalanceKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s from world state: %v", deltaBalanceKey, err)
+	}
+
+	return deltaBalanceBytes != nil, nil
+}
+
+// getBalance reads the balance of the account, adding up the delta rows in delta balance mode
+// nil is returned when the account doesn't exist
+func getBalance(ctx contractapi.TransactionContextInterface, account string, decimals int) (*big.Int, error) {
+
+	balance, err := getAmount(ctx, account, decimals)
+	if err != nil {
+		return nil, err
+	}
+
+	delta, err := isDeltaBalance(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	if !delta {
+		return balance, nil
+	}
+
+	rows := 0
+	sum, err := foldDeltas(ctx, account, decimals, func(key string) error {
+		rows++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if balance == nil {
+		if rows == 0 {
+			return nil, nil
+		}
+		balance = new(big.Int)
+	}
+
+	balance.Add(balance, sum)
+	if balance.Sign() < 0 {
+		return nil, fmt.Errorf("balance of account %s is negative", account)
+	}
+
+	return balance, nil
+}
+
+// creditDelta appends a "+" row to the account in delta balance mode
+// The balance is only read if it has to be saved for a snapshot
+func creditDelta(ctx contractapi.TransactionContextInterface, account string, value *big.Int, decimals int) error {
+
+	err := snapshotBalance(ctx, account, func() (*big.Int, error) { return getBalance(ctx, account, decimals) }, decimals)
+	if err != nil {
+		return err
+	}
+
+	return putDelta(ctx, account, "+", value, decimals)
+}
+
+// putDelta appends a delta row to the account
+func putDelta(ctx contractapi.TransactionContextInterface, account string, op string, value *big.Int, decimals int) error {
+
+	deltaKey, err := ctx.GetStub().CreateCompositeKey(deltaIndexName, []string{account, op, formatAmount(value, decimals), ctx.GetStub().GetTxID()})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", deltaIndexName, err)
+	}
+
+	err = ctx.GetStub().PutState(deltaKey, []byte{0x00})
+	if err != nil {
+		return fmt.Errorf("failed to put delta of account %s: %v", account, err)
+	}
+
+	return nil
+}
+
+// pruneDeltas folds the delta rows of the account into its balance key and deletes them
+func pruneDeltas(ctx contractapi.TransactionContextInterface, account string) (int, error) {
+
+	decimals, err := getDecimals(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	balance, err := getAmount(ctx, account, decimals)
+	if err != nil {
+		return 0, err
+	}
+
+	rows := 0
+	sum, err := foldDeltas(ctx, account, decimals, func(key string) error {
+		rows++
+		err := ctx.GetStub().DelState(key)
+		if err != nil {
+			return fmt.Errorf("failed to delete delta row: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if rows == 0 {
+		return 0, nil
+	}
+
+	if balance == nil {
+		balance = new(big.Int)
+	}
+	balance.Add(balance, sum)
+	if balance.Sign() < 0 {
+		return 0, fmt.Errorf("balance of account %s is negative", account)
+	}
+
+	err = putAmount(ctx, account, balance, decimals)
+	if err != nil {
+		return 0, err
+	}
+
+	log.Printf("account %s pruned, balance is %s, %d rows pruned", account, formatAmount(balance, decimals), rows)
+
+	return rows, nil
+}
+
+// foldDeltas adds up the delta rows of the account, visit is called with the key of each row
+func foldDeltas(ctx contractapi.TransactionContextInterface, account string, decimals int, visit func(key string) error) (*big.Int, error) {
+
+	deltaIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(deltaIndexName, []string{account})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deltas of account %s: %v", account, err)
+	}
+	defer deltaIterator.Close()
+
+	sum := new(big.Int)
+	for deltaIterator.HasNext() {
+		delta, err := deltaIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get delta of account %s: %v", account, err)
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(delta.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split composite key %s: %v", delta.Key, err)
+		}
+		if len(keyParts) != 4 || keyParts[0] != account {
+			continue
+		}
+
+		value, err := parseAmount(keyParts[2], decimals)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse delta of account %s: %v", account, err)
+		}
+
+		switch keyParts[1] {
+		case "+":
+			sum.Add(sum, value)
+		case "-":
+			sum.Sub(sum, value)
+		default:
+			return nil, errors.New("unrecognized delta operation " + keyParts[1])
+		}
+
+		err = visit(delta.Key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return sum, nil
+}
@@ -0,0 +1,117 @@
+package chaincode
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-samples/token-erc-20/chaincode-go/chaincode/tests/testsfakes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeltaBalance(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	stub := &testsfakes.FakeTestChaincodeStubInterface{}
+	tc := &testsfakes.FakeTestTransactionContextInterface{}
+	tc.GetStubStub = func() shim.ChaincodeStubInterface {
+		return stub
+	}
+	identity := &testsfakes.FakeTestClientIdentity{}
+	identity.GetMSPIDReturns("Org1MSP", nil)
+	tc.GetClientIdentityReturns(identity)
+	state := map[string][]byte{
+		nameKey:     []byte("name"),
+		decimalsKey: []byte("2"),
+		rolesKey:    []byte(`{"minter":"Org1MSP","admin":"Org1MSP","banks":[],"governance":["Org1MSP"]}`),
+		"MERCHANT":  []byte("10.00"),
+		"PAYER1":    []byte("100.00"),
+		"PAYER2":    []byte("100.00"),
+	}
+	withWorldState(stub, state)
+	var reads []string
+	getState := stub.GetStateStub
+	stub.GetStateStub = func(key string) ([]byte, error) {
+		reads = append(reads, key)
+		return getState(key)
+	}
+	deltaRows := func() int {
+		rows := 0
+		for key := range state {
+			if _, keyParts, _ := stub.SplitCompositeKey(key); len(keyParts) == 4 && keyParts[0] == "MERCHANT" {
+				rows++
+			}
+		}
+		return rows
+	}
+
+	identity.GetIDReturns("MERCHANT", nil)
+	assert.NoError(t, sc.EnableDeltaBalance(tc))
+	assert.EqualError(t, sc.EnableDeltaBalance(tc), "account MERCHANT is already in delta balance mode")
+
+	//credits neither read nor write the balance key of the recipient
+	reads = nil
+	rangeQueries := stub.GetStateByPartialCompositeKeyCallCount()
+	identity.GetIDReturns("PAYER1", nil)
+	stub.GetTxIDReturns("TX1")
+	assert.NoError(t, sc.Transfer(tc, "MERCHANT", "5"))
+	assert.NotContains(t, reads, "MERCHANT")
+	assert.Equal(t, rangeQueries, stub.GetStateByPartialCompositeKeyCallCount())
+
+	identity.GetIDReturns("PAYER2", nil)
+	stub.GetTxIDReturns("TX2")
+	assert.NoError(t, sc.Transfer(tc, "MERCHANT", "7"))
+
+	assert.Equal(t, "10.00", string(state["MERCHANT"]))
+	assert.Equal(t, 2, deltaRows())
+	balance, err := sc.BalanceOf(tc, "MERCHANT")
+	assert.NoError(t, err)
+	assert.Equal(t, "22.00", balance)
+
+	//debits check the aggregate balance
+	identity.GetIDReturns("MERCHANT", nil)
+	stub.GetTxIDReturns("TX3")
+	assert.NoError(t, sc.Transfer(tc, "PAYER1", "20"))
+	stub.GetTxIDReturns("TX4")
+	assert.EqualError(t, sc.Transfer(tc, "PAYER1", "3"), "failed to transfer: client account MERCHANT has insufficient funds")
+	assert.Equal(t, "10.00", string(state["MERCHANT"]))
+	assert.Equal(t, 3, deltaRows())
+	balance, err = sc.ClientAccountBalance(tc)
+	assert.NoError(t, err)
+	assert.Equal(t, "2.00", balance)
+
+	//the first credit after a snapshot saves the aggregate balance
+	_, err = sc.Snapshot(tc)
+	assert.NoError(t, err)
+	identity.GetIDReturns("PAYER1", nil)
+	stub.GetTxIDReturns("TX5")
+	assert.NoError(t, sc.Transfer(tc, "MERCHANT", "1"))
+	balance, err = sc.BalanceOfAt(tc, "MERCHANT", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "2.00", balance)
+
+	//prune folds the rows into the balance key
+	stub.GetTxIDReturns("TX6")
+	rows, err := sc.PruneBalance(tc, "MERCHANT")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, rows)
+	assert.Equal(t, "3.00", string(state["MERCHANT"]))
+	assert.Equal(t, 0, deltaRows())
+	balance, err = sc.BalanceOf(tc, "MERCHANT")
+	assert.NoError(t, err)
+	assert.Equal(t, "3.00", balance)
+
+	_, err = sc.PruneBalance(tc, "PAYER1")
+	assert.EqualError(t, err, "account PAYER1 is not in delta balance mode")
+
+	//disabling the mode folds remaining rows
+	stub.GetTxIDReturns("TX7")
+	assert.NoError(t, sc.Transfer(tc, "MERCHANT", "1"))
+	identity.GetIDReturns("MERCHANT", nil)
+	assert.NoError(t, sc.DisableDeltaBalance(tc))
+	assert.Equal(t, "4.00", string(state["MERCHANT"]))
+	assert.Equal(t, 0, deltaRows())
+	delta, err := isDeltaBalance(tc, "MERCHANT")
+	assert.NoError(t, err)
+	assert.False(t, delta)
+}
@@ -1,12 +1,19 @@
 package chaincode
 
 import (
-	"crypto/rand"
+	"crypto/hmac"
 	"crypto/rsa"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
@@ -14,27 +21,51 @@ import (
 //Anonymous payments extension
 //Functionality responsible for configuration
 
-const BANK_ORG = "Org1MSP"
-const BANK_PDC = "_implicit_org_" + BANK_ORG
-const BANK_ACCOUNT = "account_" + BANK_ORG
+//Banks are the organizations listed in Roles (set at Initialize, changed with AddBank/RemoveBank).
+//Every bank has its own key material and account, stored under keys below followed by bank MSP ID.
+const BANK_PDC = "_implicit_org_"
+const BANK_ACCOUNT = "account_"
+const BANK_KEY_ID = "keyid_"
+const BANK_DENOMINATIONS = "denominations_"
+const BANK_KEY_EXPIRY = "expiry_"
+
+const keySize = 2048
+
+//Largest amount SplitAmount handles, in multiples of the greatest common divisor of the bank's denominations.
+//The split needs memory proportional to the amount, so larger amounts are rejected before anything is allocated.
+const maxSplitAmount = 1000000
+
+//Largest difference accepted between the transaction timestamp and the clock of the endorsing peer.
+//The client sets the timestamp, so without the bound it could pick any time for expiry and vesting.
+const maxClockSkew = 30 * time.Second
+
+//Clock of the endorsing peer, replaced in tests
+var peerClock = time.Now
 
 //NOTE: Call to this function must not generate blockchain transaction ("query", not "invoke")
 //Otherwise private key will be stored on-chain and revealed to everyone
+//Key is derived from the "seed" passed in transient map, so every peer returns exactly the same key
 func (s *SmartContract) GenerateKeyPair(ctx contractapi.TransactionContextInterface) (string, error) {
 
-	//Org1MSP act as a bank and is the only one entitled to generate signing keys
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	//Only banks are entitled to generate signing keys
+	_, err := checkBank(ctx, "GenerateKeyPair")
 	if err != nil {
-		return "", fmt.Errorf("failed to get MSPID: %v", err)
+		return "", err
 	}
-	if clientMSPID != BANK_ORG {
-		return "", errors.New("client is not authorized to call GenerateKeyPair")
+
+	tr, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return "", fmt.Errorf("failed to get Transient field: %v", err)
+	}
+	seed, ok := tr["seed"]
+	if !ok {
+		return "", errors.New("seed not found")
 	}
 
-	// Generate a key
-	keysize := 2048
-	//Line below is not deterministic, not a problem because we use only one peer
-	key, _ := rsa.GenerateKey(rand.Reader, keysize)
+	key, err := deriveKey(seed, keySize)
+	if err != nil {
+		return "", fmt.Errorf("failed to derive key: %v", err)
+	}
 
 	raw, err := json.Marshal(key)
 	if err != nil {
@@ -44,16 +75,21 @@ func (s *SmartContract) GenerateKeyPair(ctx contractapi.TransactionContextInterf
 	return base64.StdEncoding.EncodeToString(raw), nil
 }
 
-// //This request should go only to peer(s) that belong to Org1MSP (to avoid revealing the data)
-func (s *SmartContract) SavePrivateKey(ctx contractapi.TransactionContextInterface) error {
+// //This request should go only to peer(s) that belong to the bank (to avoid revealing the data)
+// //Private key is passed in transient map either as "key" (generated off-chain) or as "seed" (derived on each peer)
+func (s *SmartContract) SavePrivateKey(ctx contractapi.TransactionContextInterface, denomination int, keyID string) error {
 
-	// Org1MSP act as a bank and is the only one entitled to store signing keys
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	//Only banks are entitled to store signing keys, each one for itself
+	bank, err := checkBank(ctx, "SavePrivateKey")
 	if err != nil {
-		return fmt.Errorf("failed to get MSPID: %v", err)
+		return err
 	}
-	if clientMSPID != BANK_ORG {
-		return fmt.Errorf("client is not authorized to call SavePrivateKey")
+
+	if denomination <= 0 {
+		return errors.New("denomination must be a positive integer")
+	}
+	if keyID == "" {
+		return errors.New("key id must not be empty")
 	}
 
 	//ContractAPI doesn't support transient map....
@@ -64,47 +100,111 @@ func (s *SmartContract) SavePrivateKey(ctx contractapi.TransactionContextInterfa
 	}
 	key, ok := tr["key"]
 	if !ok {
-		return errors.New("key not found")
+		seed, ok := tr["seed"]
+		if !ok {
+			return errors.New("key not found")
+		}
+
+		//every endorsing peer derives the same key, so the private data hashes match
+		derived, err := deriveKey(seed, keySize)
+		if err != nil {
+			return fmt.Errorf("failed to derive key: %v", err)
+		}
+		if key, err = json.Marshal(derived); err != nil {
+			return fmt.Errorf("failed to marshal key: %v", err)
+		}
 	}
 
 	// 	//private key goes to implicit private data collection
 	// 	//access control must be implemented in the chaincode!
-	if err = ctx.GetStub().PutPrivateData(BANK_PDC, BANK_ORG, key); err != nil {
+	if err = ctx.GetStub().PutPrivateData(BANK_PDC+bank, bankKey(bank, denomination, keyID), key); err != nil {
 		return fmt.Errorf("failed to put private key: %v", err)
 	}
 
 	return nil
 }
 
-func (s *SmartContract) SavePublicKey(ctx contractapi.TransactionContextInterface, public string) error {
-	// Org1MSP act as a bank and is the only one entitled to store signing keys
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+//Publishes new version of the public key for given denomination and makes it the one used for new tokens.
+//Previous versions stay on-chain, so tokens signed with them can still be redeemed.
+//Each denomination has its own keys, so the key that signed a token determines the token value.
+//Tokens signed with the key expire together with it, at expiry epoch (unix time in seconds).
+//Expired tokens can't be credited anymore, payer can get them refunded instead (see RefundExpiredToken).
+func (s *SmartContract) SavePublicKey(ctx contractapi.TransactionContextInterface, denomination int, keyID string, public string, expiry int64) error {
+	//Only banks are entitled to store signing keys, each one for itself
+	bank, err := checkBank(ctx, "SavePublicKey")
 	if err != nil {
-		return fmt.Errorf("failed to get MSPID: %v", err)
+		return err
+	}
+
+	if denomination <= 0 {
+		return errors.New("denomination must be a positive integer")
 	}
-	if clientMSPID != BANK_ORG {
-		return fmt.Errorf("client is not authorized to call SavePublicKey")
+	if keyID == "" {
+		return errors.New("key id must not be empty")
 	}
 
-	if err = ctx.GetStub().PutState(BANK_ORG, []byte(public)); err != nil {
+	//key versions are immutable, otherwise already issued tokens could be invalidated
+	existing, err := ctx.GetStub().GetState(bankKey(bank, denomination, keyID))
+	if err != nil {
+		return fmt.Errorf("failed to get public key: %v", err)
+	}
+	if len(existing) > 0 {
+		return fmt.Errorf("key %s already exists for %s denomination %d", keyID, bank, denomination)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if expiry <= now {
+		return errors.New("key expiry must be in the future")
+	}
+
+	if err = ctx.GetStub().PutState(bankKey(bank, denomination, keyID), []byte(public)); err != nil {
 		return fmt.Errorf("failed to put public key: %v", err)
 	}
 
+	if err = ctx.GetStub().PutState(expiryKey(bank, denomination, keyID), []byte(strconv.FormatInt(expiry, 10))); err != nil {
+		return fmt.Errorf("failed to put key expiry: %v", err)
+	}
+
+	if err = ctx.GetStub().PutState(keyIDKey(bank, denomination), []byte(keyID)); err != nil {
+		return fmt.Errorf("failed to put key id: %v", err)
+	}
+
+	//first key of the denomination makes it available to payers
+	denominations, err := s.Denominations(ctx, bank)
+	if err != nil {
+		return err
+	}
+	for _, d := range denominations {
+		if d == denomination {
+			return nil
+		}
+	}
+	denominations = append(denominations, denomination)
+	sort.Sort(sort.Reverse(sort.IntSlice(denominations)))
+
+	raw, err := json.Marshal(denominations)
+	if err != nil {
+		return fmt.Errorf("failed to marshal denominations: %v", err)
+	}
+	if err = ctx.GetStub().PutState(BANK_DENOMINATIONS+bank, raw); err != nil {
+		return fmt.Errorf("failed to put denominations: %v", err)
+	}
+
 	return nil
 }
 
-func (s *SmartContract) GetPrivateKey(ctx contractapi.TransactionContextInterface) (string, error) {
+func (s *SmartContract) GetPrivateKey(ctx contractapi.TransactionContextInterface, denomination int, keyID string) (string, error) {
 
-	// Org1MSP act as a bank and is the only one entitled to generate signing keys
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	//Only banks are entitled to read signing keys, each one for itself
+	bank, err := checkBank(ctx, "GetPrivateKey")
 	if err != nil {
-		return "", fmt.Errorf("failed to get MSPID: %v", err)
-	}
-	if clientMSPID != BANK_ORG {
-		return "", fmt.Errorf("client is not authorized to call GetPrivateKey")
+		return "", err
 	}
 
-	key, err := ctx.GetStub().GetPrivateData(BANK_PDC, BANK_ORG)
+	key, err := ctx.GetStub().GetPrivateData(BANK_PDC+bank, bankKey(bank, denomination, keyID))
 	if err != nil {
 		return "", fmt.Errorf("failed to get private data: %v", err)
 	}
@@ -112,20 +212,350 @@ func (s *SmartContract) GetPrivateKey(ctx contractapi.TransactionContextInterfac
 	return string(key), nil
 }
 
+//Returns id of the key that is currently used by the bank to sign new tokens of given denomination
+func (s *SmartContract) CurrentKeyID(ctx contractapi.TransactionContextInterface, bank string, denomination int) (string, error) {
+
+	keyID, err := ctx.GetStub().GetState(keyIDKey(bank, denomination))
+	if err != nil {
+		return "", fmt.Errorf("failed to get key id: %v", err)
+	}
+	if len(keyID) == 0 {
+		return "", fmt.Errorf("no public key has been saved by %s for denomination %d", bank, denomination)
+	}
+
+	return string(keyID), nil
+}
+
+//Returns denominations the bank issues tokens in, from the highest to the lowest
+func (s *SmartContract) Denominations(ctx contractapi.TransactionContextInterface, bank string) ([]int, error) {
+
+	raw, err := ctx.GetStub().GetState(BANK_DENOMINATIONS + bank)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get denominations: %v", err)
+	}
+
+	denominations := []int{}
+	if len(raw) == 0 {
+		return denominations, nil
+	}
+	if err = json.Unmarshal(raw, &denominations); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal denominations: %v", err)
+	}
+
+	return denominations, nil
+}
+
+//Helper for the payer: splits amount into the fewest tokens of denominations available at the bank.
+//Returns denominations of the tokens, from the highest to the lowest.
+//Like BlindToken it's meant to be called as a query.
+func (s *SmartContract) SplitAmount(ctx contractapi.TransactionContextInterface, bank string, amount int) ([]int, error) {
+
+	if amount <= 0 {
+		return nil, errors.New("amount must be a positive integer")
+	}
+
+	denominations, err := s.Denominations(ctx, bank)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := splitAmount(amount, denominations)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
 func (s *SmartContract) SetBankAccount(ctx contractapi.TransactionContextInterface, account string) error {
 
-	// Org1MSP act as a bank and is the only one entitled to set up bank Account
+	//Only banks are entitled to set up bank Account, each one for itself
+	bank, err := checkBank(ctx, "SetBankAccount")
+	if err != nil {
+		return err
+	}
+
+	if err = ctx.GetStub().PutState(BANK_ACCOUNT+bank, []byte(account)); err != nil {
+		return fmt.Errorf("failed to put public key: %v", err)
+	}
+
+	return nil
+}
+
+//Checks that the client belongs to one of the banks and returns its MSP ID
+func checkBank(ctx contractapi.TransactionContextInterface, function string) (string, error) {
+
 	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
 	if err != nil {
-		return fmt.Errorf("failed to get MSPID: %v", err)
+		return "", fmt.Errorf("failed to get MSPID: %v", err)
+	}
+
+	roles, err := getRoles(ctx)
+	if err != nil {
+		return "", err
 	}
-	if clientMSPID != BANK_ORG {
-		return errors.New("client is not authorized to call SetBankAccount")
+	if !contains(roles.Banks, clientMSPID) {
+		return "", fmt.Errorf("client is not authorized to call %s", function)
 	}
 
-	if err = ctx.GetStub().PutState(BANK_ACCOUNT, []byte(account)); err != nil {
-		return fmt.Errorf("failed to put public key: %v", err)
+	return clientMSPID, nil
+}
+
+//Checks that the organization is one of the banks
+func checkIsBank(ctx contractapi.TransactionContextInterface, bank string) error {
+
+	roles, err := getRoles(ctx)
+	if err != nil {
+		return err
+	}
+	if !contains(roles.Banks, bank) {
+		return fmt.Errorf("%s is not a bank", bank)
 	}
 
 	return nil
 }
+
+//Reads account of the bank, where it keeps the value of issued tokens
+func getBankAccount(ctx contractapi.TransactionContextInterface, bank string) (string, error) {
+
+	account, err := ctx.GetStub().GetState(BANK_ACCOUNT + bank)
+	if err != nil {
+		return "", fmt.Errorf("failed to get bank account: %v", err)
+	}
+
+	return string(account), nil
+}
+
+//Key under which given version of the bank denomination key is stored (public key on-chain, private key in bank PDC)
+func bankKey(bank string, denomination int, keyID string) string {
+	return bank + "_" + strconv.Itoa(denomination) + "_" + keyID
+}
+
+//Key under which id of the current key of the bank denomination is stored
+func keyIDKey(bank string, denomination int) string {
+	return BANK_KEY_ID + bank + "_" + strconv.Itoa(denomination)
+}
+
+//Key under which expiry epoch of given version of the bank denomination key is stored
+func expiryKey(bank string, denomination int, keyID string) string {
+	return BANK_KEY_EXPIRY + bank + "_" + strconv.Itoa(denomination) + "_" + keyID
+}
+
+//Reads expiry epoch of given version of the bank denomination key
+func getKeyExpiry(ctx contractapi.TransactionContextInterface, bank string, denomination int, keyID string) (int64, error) {
+
+	raw, err := ctx.GetStub().GetState(expiryKey(bank, denomination, keyID))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get key expiry: %v", err)
+	}
+	if len(raw) == 0 {
+		return 0, fmt.Errorf("expiry of key %s not found for %s denomination %d", keyID, bank, denomination)
+	}
+
+	expiry, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse key expiry: %v", err)
+	}
+
+	return expiry, nil
+}
+
+//Transaction time (unix time in seconds). The same on all endorsing peers, unlike the local clock.
+//Rejected if it is more than maxClockSkew away from the clock of the endorsing peer.
+func txTime(ctx contractapi.TransactionContextInterface) (int64, error) {
+
+	ts, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	if ts == nil {
+		return 0, errors.New("transaction timestamp not set")
+	}
+
+	t := time.Unix(ts.Seconds, int64(ts.Nanos))
+	skew := peerClock().Sub(t)
+	if skew > maxClockSkew || skew < -maxClockSkew {
+		return 0, fmt.Errorf("transaction timestamp %d is more than %v away from the time of the peer", ts.Seconds, maxClockSkew)
+	}
+
+	return ts.Seconds, nil
+}
+
+//Reads given version of the bank denomination public key
+func getPublicKey(ctx contractapi.TransactionContextInterface, bank string, denomination int, keyID string) (*rsa.PublicKey, error) {
+
+	pubkey, err := ctx.GetStub().GetState(bankKey(bank, denomination, keyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pubkey: %v", err)
+	}
+	if len(pubkey) == 0 {
+		return nil, fmt.Errorf("key %s not found for %s denomination %d", keyID, bank, denomination)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(string(pubkey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode pubkey: %v", err)
+	}
+
+	var key rsa.PublicKey
+	if err = json.Unmarshal(raw, &key); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal pubkey: %v", err)
+	}
+
+	return &key, nil
+}
+
+//Splits amount into the fewest tokens (change-making). Greedy split is not optimal for every
+//set of denominations (e.g. 1, 3, 4 and amount 6), so the minimum is computed for every partial amount.
+//Amounts are counted in multiples of the greatest common divisor of denominations, up to maxSplitAmount.
+func splitAmount(amount int, denominations []int) ([]int, error) {
+
+	unit := 0
+	for _, d := range denominations {
+		unit = gcd(unit, d)
+	}
+	if unit <= 0 || amount%unit != 0 {
+		return nil, fmt.Errorf("amount %d can't be split into available denominations", amount)
+	}
+	units := amount / unit
+	if units > maxSplitAmount {
+		return nil, fmt.Errorf("amount %d is too large to split, the limit is %d", amount, maxSplitAmount*unit)
+	}
+
+	//count[a] - fewest tokens summing up to a units, last[a] - denomination of the last token used for a
+	count := make([]int, units+1)
+	last := make([]int, units+1)
+	for a := 1; a <= units; a++ {
+		count[a] = -1
+		for _, d := range denominations {
+			d /= unit
+			if d > a || count[a-d] < 0 {
+				continue
+			}
+			//ties go to the higher denomination, as denominations are sorted from the highest
+			if count[a] < 0 || count[a-d]+1 < count[a] {
+				count[a] = count[a-d] + 1
+				last[a] = d
+			}
+		}
+	}
+	if count[units] < 0 {
+		return nil, fmt.Errorf("amount %d can't be split into available denominations", amount)
+	}
+
+	tokens := []int{}
+	for a := units; a > 0; a -= last[a] {
+		tokens = append(tokens, last[a]*unit)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(tokens)))
+
+	return tokens, nil
+}
+
+//Greatest common divisor, gcd(0, b) is b
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+//Derives RSA key from the seed. Unlike rsa.GenerateKey the result depends only on the input,
+//so all endorsing peers end up with the same key.
+func deriveKey(seed []byte, bits int) (*rsa.PrivateKey, error) {
+
+	if len(seed) == 0 {
+		return nil, errors.New("seed must not be empty")
+	}
+
+	stream := &seedReader{seed: seed}
+	e := big.NewInt(65537)
+	one := big.NewInt(1)
+
+	for {
+		p, err := derivePrime(stream, bits/2)
+		if err != nil {
+			return nil, err
+		}
+		q, err := derivePrime(stream, bits-bits/2)
+		if err != nil {
+			return nil, err
+		}
+		if p.Cmp(q) == 0 {
+			continue
+		}
+
+		n := new(big.Int).Mul(p, q)
+		if n.BitLen() != bits {
+			continue
+		}
+
+		phi := new(big.Int).Mul(new(big.Int).Sub(p, one), new(big.Int).Sub(q, one))
+		d := new(big.Int).ModInverse(e, phi)
+		if d == nil {
+			continue
+		}
+
+		key := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: n, E: int(e.Int64())},
+			D:         d,
+			Primes:    []*big.Int{p, q},
+		}
+		key.Precompute()
+		if err = key.Validate(); err != nil {
+			return nil, err
+		}
+
+		return key, nil
+	}
+}
+
+//Reads candidates from the stream until a prime of exactly given size is found
+func derivePrime(stream io.Reader, bits int) (*big.Int, error) {
+
+	buf := make([]byte, (bits+7)/8)
+	for {
+		if _, err := io.ReadFull(stream, buf); err != nil {
+			return nil, err
+		}
+
+		p := new(big.Int).SetBytes(buf)
+		//top two bits set, so the product of two primes has full length; odd numbers only
+		p.SetBit(p, bits-1, 1)
+		p.SetBit(p, bits-2, 1)
+		p.SetBit(p, 0, 1)
+		for i := bits; i < len(buf)*8; i++ {
+			p.SetBit(p, i, 0)
+		}
+
+		if p.ProbablyPrime(20) {
+			return p, nil
+		}
+	}
+}
+
+//Deterministic byte stream: HMAC-SHA256(seed, counter) blocks
+type seedReader struct {
+	seed    []byte
+	counter uint64
+	buf     []byte
+}
+
+func (r *seedReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(r.buf) == 0 {
+			var ctr [8]byte
+			binary.BigEndian.PutUint64(ctr[:], r.counter)
+			r.counter++
+
+			mac := hmac.New(sha256.New, r.seed)
+			mac.Write(ctr[:])
+			r.buf = mac.Sum(nil)
+		}
+		c := copy(p[n:], r.buf)
+		r.buf = r.buf[c:]
+		n += c
+	}
+	return n, nil
+}
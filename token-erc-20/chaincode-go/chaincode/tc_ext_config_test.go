@@ -8,16 +8,34 @@ import (
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
 	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-samples/token-erc-20/chaincode-go/chaincode/tests/testsfakes"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+const bankOrg = "Org1MSP"
+
+// Serves roles with bankOrg as the only bank, other keys are read with getState
+func withRoles(getState func(key string) ([]byte, error)) func(key string) ([]byte, error) {
+	return func(key string) ([]byte, error) {
+		if key == rolesKey {
+			return []byte(`{"minter":"Org1MSP","banks":["Org1MSP"],"governance":["Org1MSP"]}`), nil
+		}
+		if getState == nil {
+			return nil, nil
+		}
+		return getState(key)
+	}
+}
+
 var _GenerateKeyPair = []struct {
 	name          string
 	identity      func() cid.ClientIdentity
+	transientdata func() (map[string][]byte, error)
 	expectedError string
 }{
 	{
@@ -31,15 +49,31 @@ var _GenerateKeyPair = []struct {
 		},
 		expectedError: "client is not authorized to call GenerateKeyPair",
 	},
+	{
+		name: "No seed",
+		identity: func() cid.ClientIdentity {
+			identity := &testsfakes.FakeTestClientIdentity{}
+			identity.GetMSPIDStub = func() (string, error) {
+				return bankOrg, nil
+			}
+			return identity
+		},
+		expectedError: "seed not found",
+	},
 	{
 		name: "OK",
 		identity: func() cid.ClientIdentity {
 			identity := &testsfakes.FakeTestClientIdentity{}
 			identity.GetMSPIDStub = func() (string, error) {
-				return BANK_ORG, nil
+				return bankOrg, nil
 			}
 			return identity
 		},
+		transientdata: func() (map[string][]byte, error) {
+			return map[string][]byte{
+				"seed": []byte("SEED"),
+			}, nil
+		},
 		expectedError: "",
 	},
 }
@@ -47,6 +81,7 @@ var _GenerateKeyPair = []struct {
 var _SavePrivateKey = []struct {
 	name                   string
 	identity               func() cid.ClientIdentity
+	inKeyID                string
 	transientdata          func() (map[string][]byte, error)
 	expectedError          string
 	expectedPutPrivateData func(collection string, key string, value []byte) error
@@ -63,22 +98,35 @@ var _SavePrivateKey = []struct {
 		expectedError: "client is not authorized to call SavePrivateKey",
 	},
 	{
-		name: "No transient data",
+		name: "No key id",
+		identity: func() cid.ClientIdentity {
+			identity := &testsfakes.FakeTestClientIdentity{}
+			identity.GetMSPIDStub = func() (string, error) {
+				return bankOrg, nil
+			}
+			return identity
+		},
+		expectedError: "key id must not be empty",
+	},
+	{
+		name:    "No transient data",
+		inKeyID: "v1",
 		identity: func() cid.ClientIdentity {
 			identity := &testsfakes.FakeTestClientIdentity{}
 			identity.GetMSPIDStub = func() (string, error) {
-				return BANK_ORG, nil
+				return bankOrg, nil
 			}
 			return identity
 		},
 		expectedError: "key not found",
 	},
 	{
-		name: "No key",
+		name:    "No key",
+		inKeyID: "v1",
 		identity: func() cid.ClientIdentity {
 			identity := &testsfakes.FakeTestClientIdentity{}
 			identity.GetMSPIDStub = func() (string, error) {
-				return BANK_ORG, nil
+				return bankOrg, nil
 			}
 			return identity
 		},
@@ -90,11 +138,12 @@ var _SavePrivateKey = []struct {
 		expectedError: "key not found",
 	},
 	{
-		name: "OK",
+		name:    "OK",
+		inKeyID: "v1",
 		identity: func() cid.ClientIdentity {
 			identity := &testsfakes.FakeTestClientIdentity{}
 			identity.GetMSPIDStub = func() (string, error) {
-				return BANK_ORG, nil
+				return bankOrg, nil
 			}
 			return identity
 		},
@@ -111,11 +160,11 @@ var _SavePrivateKey = []struct {
 		},
 		expectedError: "",
 		expectedPutPrivateData: func(collection string, key string, value []byte) error {
-			if collection != BANK_PDC {
-				return fmt.Errorf("expected: %v, got: %v", BANK_PDC, collection)
+			if collection != BANK_PDC+bankOrg {
+				return fmt.Errorf("expected: %v, got: %v", BANK_PDC+bankOrg, collection)
 			}
-			if key != BANK_ORG {
-				return fmt.Errorf("expected: %v, got: %v", BANK_ORG, key)
+			if key != bankKey(bankOrg, 100, "v1") {
+				return fmt.Errorf("expected: %v, got: %v", bankKey(bankOrg, 100, "v1"), key)
 			}
 
 			var pk rsa.PrivateKey
@@ -123,6 +172,36 @@ var _SavePrivateKey = []struct {
 				return fmt.Errorf("expectedPutPrivateData: failed to unmarshal key: %v", err)
 			}
 
+			return nil
+		},
+	},
+	{
+		name: "OK from seed",
+		identity: func() cid.ClientIdentity {
+			identity := &testsfakes.FakeTestClientIdentity{}
+			identity.GetMSPIDStub = func() (string, error) {
+				return bankOrg, nil
+			}
+			return identity
+		},
+		inKeyID: "v1",
+		transientdata: func() (map[string][]byte, error) {
+			return map[string][]byte{
+				"seed": []byte("SEED"),
+			}, nil
+		},
+		expectedError: "",
+		expectedPutPrivateData: func(collection string, key string, value []byte) error {
+			if key != bankKey(bankOrg, 100, "v1") {
+				return fmt.Errorf("expected: %v, got: %v", bankKey(bankOrg, 100, "v1"), key)
+			}
+
+			expected, _ := deriveKey([]byte("SEED"), keySize)
+			raw, _ := json.Marshal(expected)
+			if string(raw) != string(value) {
+				return errors.New("expectedPutPrivateData: key not derived from seed")
+			}
+
 			return nil
 		},
 	},
@@ -131,8 +210,12 @@ var _SavePrivateKey = []struct {
 var _SavePublicKey = []struct {
 	name             string
 	identity         func() cid.ClientIdentity
+	denomination     int
+	keyID            string
 	publicKey        string
+	expiry           int64
 	expectedError    string
+	expectedGetState func(key string) ([]byte, error)
 	expectedPutState func(key string, value []byte) error
 }{
 	{
@@ -146,20 +229,61 @@ var _SavePublicKey = []struct {
 		},
 		expectedError: "client is not authorized to call SavePublicKey",
 	},
+	{
+		name: "Wrong denomination",
+		identity: func() cid.ClientIdentity {
+			identity := &testsfakes.FakeTestClientIdentity{}
+			identity.GetMSPIDStub = func() (string, error) {
+				return bankOrg, nil
+			}
+			return identity
+		},
+		denomination:  0,
+		keyID:         "v1",
+		publicKey:     "base64key",
+		expectedError: "denomination must be a positive integer",
+	},
 	{
 		name: "OK",
 		identity: func() cid.ClientIdentity {
 			identity := &testsfakes.FakeTestClientIdentity{}
 			identity.GetMSPIDStub = func() (string, error) {
-				return BANK_ORG, nil
+				return bankOrg, nil
 			}
 			return identity
 		},
+		denomination:  100,
+		keyID:         "v1",
 		publicKey:     "base64key",
+		expiry:        2000,
 		expectedError: "",
+		expectedGetState: func(key string) ([]byte, error) {
+			if key == BANK_DENOMINATIONS+bankOrg {
+				return []byte("[50]"), nil
+			}
+			return nil, nil
+		},
 		expectedPutState: func(key string, value []byte) error {
-			if key != BANK_ORG {
-				return fmt.Errorf("expected: %v, got: %v", BANK_ORG, key)
+			if key == keyIDKey(bankOrg, 100) {
+				if string(value) != "v1" {
+					return fmt.Errorf("expected: %v, got: %v", "v1", string(value))
+				}
+				return nil
+			}
+			if key == expiryKey(bankOrg, 100, "v1") {
+				if string(value) != "2000" {
+					return fmt.Errorf("expected: %v, got: %v", "2000", string(value))
+				}
+				return nil
+			}
+			if key == BANK_DENOMINATIONS+bankOrg {
+				if string(value) != "[100,50]" {
+					return fmt.Errorf("expected: %v, got: %v", "[100,50]", string(value))
+				}
+				return nil
+			}
+			if key != bankKey(bankOrg, 100, "v1") {
+				return fmt.Errorf("expected: %v, got: %v", bankKey(bankOrg, 100, "v1"), key)
 			}
 
 			expected := "base64key"
@@ -170,6 +294,41 @@ var _SavePublicKey = []struct {
 			return nil
 		},
 	},
+	{
+		name: "Key already exists",
+		identity: func() cid.ClientIdentity {
+			identity := &testsfakes.FakeTestClientIdentity{}
+			identity.GetMSPIDStub = func() (string, error) {
+				return bankOrg, nil
+			}
+			return identity
+		},
+		denomination:  100,
+		keyID:         "v1",
+		publicKey:     "base64key",
+		expectedError: "key v1 already exists for Org1MSP denomination 100",
+		expectedGetState: func(key string) ([]byte, error) {
+			return []byte("oldkey"), nil
+		},
+	},
+	{
+		name: "Already expired",
+		identity: func() cid.ClientIdentity {
+			identity := &testsfakes.FakeTestClientIdentity{}
+			identity.GetMSPIDStub = func() (string, error) {
+				return bankOrg, nil
+			}
+			return identity
+		},
+		denomination:  100,
+		keyID:         "v1",
+		publicKey:     "base64key",
+		expiry:        1000,
+		expectedError: "key expiry must be in the future",
+		expectedGetState: func(key string) ([]byte, error) {
+			return nil, nil
+		},
+	},
 }
 
 var _GetPrivateKey = []struct {
@@ -195,18 +354,18 @@ var _GetPrivateKey = []struct {
 		identity: func() cid.ClientIdentity {
 			identity := &testsfakes.FakeTestClientIdentity{}
 			identity.GetMSPIDStub = func() (string, error) {
-				return BANK_ORG, nil
+				return bankOrg, nil
 			}
 			return identity
 		},
 		expectedError: "",
 		expectedOut:   "PRIVATE_KEY",
 		expectedGetPrivateData: func(collection, key string) ([]byte, error) {
-			if collection != BANK_PDC {
-				return nil, fmt.Errorf("expected: %v, got: %v", BANK_PDC, collection)
+			if collection != BANK_PDC+bankOrg {
+				return nil, fmt.Errorf("expected: %v, got: %v", BANK_PDC+bankOrg, collection)
 			}
-			if key != BANK_ORG {
-				return nil, fmt.Errorf("expected: %v, got: %v", BANK_ORG, key)
+			if key != bankKey(bankOrg, 100, "v1") {
+				return nil, fmt.Errorf("expected: %v, got: %v", bankKey(bankOrg, 100, "v1"), key)
 			}
 
 			return []byte("PRIVATE_KEY"), nil
@@ -237,15 +396,15 @@ var _SetBankAccount = []struct {
 		identity: func() cid.ClientIdentity {
 			identity := &testsfakes.FakeTestClientIdentity{}
 			identity.GetMSPIDStub = func() (string, error) {
-				return BANK_ORG, nil
+				return bankOrg, nil
 			}
 			return identity
 		},
 		inAccount:     "SOME_ACCOUNT",
 		expectedError: "",
 		expectedPutState: func(key string, value []byte) error {
-			if key != BANK_ACCOUNT {
-				return fmt.Errorf("expected: %v, got: %v", BANK_ACCOUNT, key)
+			if key != BANK_ACCOUNT+bankOrg {
+				return fmt.Errorf("expected: %v, got: %v", BANK_ACCOUNT+bankOrg, key)
 			}
 			if string(value) != "SOME_ACCOUNT" {
 				return fmt.Errorf("expected: %v, got: %v", "SOME_ACCOUNT", value)
@@ -264,12 +423,14 @@ func TestGenerateKeyPair(t *testing.T) {
 	tc.GetStubStub = func() shim.ChaincodeStubInterface {
 		return stub
 	}
+	stub.GetStateStub = withRoles(nil)
 
 	for _, tt := range _GenerateKeyPair {
 		t.Run(tt.name, func(t *testing.T) {
 
 			//Prepare dynamic data
 			tc.GetClientIdentityStub = tt.identity
+			stub.GetTransientStub = tt.transientdata
 
 			r, err := sc.GenerateKeyPair(tc)
 			if tt.expectedError != "" {
@@ -295,6 +456,7 @@ func TestSavePrivateKey(t *testing.T) {
 	tc.GetStubStub = func() shim.ChaincodeStubInterface {
 		return stub
 	}
+	stub.GetStateStub = withRoles(nil)
 
 	for _, tt := range _SavePrivateKey {
 		t.Run(tt.name, func(t *testing.T) {
@@ -304,7 +466,7 @@ func TestSavePrivateKey(t *testing.T) {
 			stub.GetTransientStub = tt.transientdata
 			stub.PutPrivateDataStub = tt.expectedPutPrivateData
 
-			err := sc.SavePrivateKey(tc)
+			err := sc.SavePrivateKey(tc, 100, tt.inKeyID)
 			if tt.expectedError != "" {
 				assert.EqualError(t, err, tt.expectedError)
 			} else {
@@ -325,14 +487,17 @@ func TestSavePublicKey(t *testing.T) {
 		return stub
 	}
 
+	withTxTime(stub, 1000)
+
 	for _, tt := range _SavePublicKey {
 		t.Run(tt.name, func(t *testing.T) {
 
 			//Prepare dynamic data
 			tc.GetClientIdentityStub = tt.identity
+			stub.GetStateStub = withRoles(tt.expectedGetState)
 			stub.PutStateStub = tt.expectedPutState
 
-			err := sc.SavePublicKey(tc, tt.publicKey)
+			err := sc.SavePublicKey(tc, tt.denomination, tt.keyID, tt.publicKey, tt.expiry)
 			if tt.expectedError != "" {
 				assert.EqualError(t, err, tt.expectedError)
 			} else {
@@ -352,6 +517,7 @@ func TestGetPrivateKey(t *testing.T) {
 	tc.GetStubStub = func() shim.ChaincodeStubInterface {
 		return stub
 	}
+	stub.GetStateStub = withRoles(nil)
 
 	for _, tt := range _GetPrivateKey {
 		t.Run(tt.name, func(t *testing.T) {
@@ -360,7 +526,7 @@ func TestGetPrivateKey(t *testing.T) {
 			tc.GetClientIdentityStub = tt.identity
 			stub.GetPrivateDataStub = tt.expectedGetPrivateData
 
-			key, err := sc.GetPrivateKey(tc)
+			key, err := sc.GetPrivateKey(tc, 100, "v1")
 			if tt.expectedError != "" {
 				assert.EqualError(t, err, tt.expectedError)
 			} else {
@@ -381,6 +547,7 @@ func TestSetBankAccount(t *testing.T) {
 	tc.GetStubStub = func() shim.ChaincodeStubInterface {
 		return stub
 	}
+	stub.GetStateStub = withRoles(nil)
 
 	for _, tt := range _SetBankAccount {
 		t.Run(tt.name, func(t *testing.T) {
@@ -399,3 +566,107 @@ func TestSetBankAccount(t *testing.T) {
 		})
 	}
 }
+
+func TestCurrentKeyID(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	stub := &testsfakes.FakeTestChaincodeStubInterface{}
+	tc := &testsfakes.FakeTestTransactionContextInterface{}
+	tc.GetStubStub = func() shim.ChaincodeStubInterface {
+		return stub
+	}
+
+	stub.GetStateStub = func(key string) ([]byte, error) {
+		return nil, nil
+	}
+	_, err := sc.CurrentKeyID(tc, bankOrg, 100)
+	assert.EqualError(t, err, "no public key has been saved by Org1MSP for denomination 100")
+
+	stub.GetStateStub = func(key string) ([]byte, error) {
+		if key != keyIDKey(bankOrg, 100) {
+			return nil, fmt.Errorf("expected: %v, got: %v", keyIDKey(bankOrg, 100), key)
+		}
+		return []byte("v2"), nil
+	}
+	keyID, err := sc.CurrentKeyID(tc, bankOrg, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", keyID)
+}
+
+func TestDeriveKey(t *testing.T) {
+
+	first, err := deriveKey([]byte("SEED"), keySize)
+	assert.NoError(t, err)
+	assert.Equal(t, keySize, first.N.BitLen())
+
+	//Same seed must always give the same key, no matter which peer derives it
+	second, err := deriveKey([]byte("SEED"), keySize)
+	assert.NoError(t, err)
+	assert.Equal(t, first.N, second.N)
+	assert.Equal(t, first.D, second.D)
+
+	other, err := deriveKey([]byte("OTHER_SEED"), keySize)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.N, other.N)
+
+	_, err = deriveKey(nil, keySize)
+	assert.EqualError(t, err, "seed must not be empty")
+}
+
+func TestSplitAmount(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	stub := &testsfakes.FakeTestChaincodeStubInterface{}
+	tc := &testsfakes.FakeTestTransactionContextInterface{}
+	tc.GetStubStub = func() shim.ChaincodeStubInterface {
+		return stub
+	}
+
+	var _SplitAmount = []struct {
+		name          string
+		denominations string
+		amount        int
+		expectedError string
+		expectedOut   []int
+	}{
+		{name: "No denominations", denominations: "", amount: 10, expectedError: "amount 10 can't be split into available denominations"},
+		{name: "Wrong amount", denominations: "[1]", amount: 0, expectedError: "amount must be a positive integer"},
+		{name: "Not possible", denominations: "[100,50]", amount: 120, expectedError: "amount 120 can't be split into available denominations"},
+		{name: "Greedy", denominations: "[100,50,10,1]", amount: 250, expectedOut: []int{100, 100, 50}},
+		{name: "Not greedy", denominations: "[4,3,1]", amount: 6, expectedOut: []int{3, 3}},
+		{name: "Not a multiple of denominations", denominations: "[100,50]", amount: 125, expectedError: "amount 125 can't be split into available denominations"},
+		{name: "Too large", denominations: "[4,3,1]", amount: 1000000000000, expectedError: "amount 1000000000000 is too large to split, the limit is 1000000"},
+		{name: "Large multiple of denominations", denominations: "[100000000,50000000]", amount: 250000000, expectedOut: []int{100000000, 100000000, 50000000}},
+	}
+
+	for _, tt := range _SplitAmount {
+		t.Run(tt.name, func(t *testing.T) {
+
+			//Prepare dynamic data
+			stub.GetStateStub = func(key string) ([]byte, error) {
+				if key != BANK_DENOMINATIONS+bankOrg {
+					return nil, fmt.Errorf("expected: %v, got: %v", BANK_DENOMINATIONS+bankOrg, key)
+				}
+				return []byte(tt.denominations), nil
+			}
+
+			tokens, err := sc.SplitAmount(tc, bankOrg, tt.amount)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedOut, tokens)
+			}
+		})
+	}
+}
+
+// Sets the transaction timestamp and the clock of the endorsing peer to the same time
+func withTxTime(stub *testsfakes.FakeTestChaincodeStubInterface, seconds int64) {
+	stub.GetTxTimestampReturns(&timestamppb.Timestamp{Seconds: seconds}, nil)
+	peerClock = func() time.Time {
+		return time.Unix(seconds, 0)
+	}
+}
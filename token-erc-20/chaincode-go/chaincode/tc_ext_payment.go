@@ -2,10 +2,15 @@ package chaincode
 
 import (
 	"crypto/rsa"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/big"
+	"strconv"
 
 	"github.com/cryptoballot/rsablind"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
@@ -14,40 +19,64 @@ import (
 //Anonymous payments extension
 //Functionality responsible for payment
 
-const DEBIT_PROOF = "debit_" + BANK_ORG
-const CREDIT_PROOF = "credit_" + BANK_ORG
+//Prefixes of the proofs, followed by bank MSP ID and blinded token (debit) or hex encoded token hash (credit)
+const DEBIT_PROOF = "debit_"
+const CREDIT_PROOF = "credit_"
+
+//Stored as debit/credit proof. Records which key the token was signed with and so what it's worth.
+type tokenProof struct {
+	Denomination int
+	KeyID        string
+	//Set in debit proof only, the account to refund if the token expires unused
+	Payer string
+	//Token expired and its value went back to the payer
+	Refunded bool
+}
 
 //STEP 0 - Payer hides the messate to be sign
 //To not reveal the data the request must go to the peer that is trusted to the payer + no blockchain transaction can be generated
-func (s *SmartContract) BlindToken(ctx contractapi.TransactionContextInterface, uuid string) (string, error) {
+//Token is blinded with the current key of the bank denomination, its id is returned and must be used in the following steps
+func (s *SmartContract) BlindToken(ctx contractapi.TransactionContextInterface, bank string, denomination int, uuid string) (string, error) {
+
+	if err := checkIsBank(ctx, bank); err != nil {
+		return "", err
+	}
 
-	pubKey, err := ctx.GetStub().GetState(BANK_ORG)
+	keyID, err := s.CurrentKeyID(ctx, bank, denomination)
 	if err != nil {
-		return "", fmt.Errorf("failed to get pub key: %v", err)
+		return "", err
 	}
 
-	raw, err := base64.StdEncoding.DecodeString(string(pubKey))
+	key, err := getPublicKey(ctx, bank, denomination, keyID)
 	if err != nil {
-		return "", fmt.Errorf("failed to decode pubkey : %v", err)
+		return "", err
 	}
 
-	var key rsa.PublicKey
-	if err = json.Unmarshal(raw, &key); err != nil {
-		return "", fmt.Errorf("failed to unmarshal pubkey : %v", err)
+	expiry, err := getKeyExpiry(ctx, bank, denomination, keyID)
+	if err != nil {
+		return "", err
 	}
 
 	// Blind the hashed message
-	blinded, unblinder, err := rsablind.Blind(&key, []byte(uuid))
+	blinded, unblinder, err := rsablind.Blind(key, tokenHash(key, uuid))
 	if err != nil {
 		return "", fmt.Errorf("failed to blind the message : %v", err)
 	}
 
 	resp := struct {
-		Blinded   string
-		Unblinder string
+		Bank         string
+		Denomination int
+		KeyID        string
+		Expiry       int64
+		Blinded      string
+		Unblinder    string
 	}{
-		Blinded:   base64.StdEncoding.EncodeToString(blinded),
-		Unblinder: base64.StdEncoding.EncodeToString(unblinder),
+		Bank:         bank,
+		Denomination: denomination,
+		KeyID:        keyID,
+		Expiry:       expiry,
+		Blinded:      base64.StdEncoding.EncodeToString(blinded),
+		Unblinder:    base64.StdEncoding.EncodeToString(unblinder),
 	}
 
 	response, err := json.Marshal(&resp)
@@ -58,15 +87,42 @@ func (s *SmartContract) BlindToken(ctx contractapi.TransactionContextInterface,
 	return string(response), nil
 }
 
-//STEP 1 - Payer debits his account
-func (s *SmartContract) DebitMyAccount(ctx contractapi.TransactionContextInterface, blinded string) error {
+//STEP 1 - Payer debits his account with the value of the token denomination, bank account is credited
+//Debit proof records the key the token was blinded with. Only the current key can be used for new tokens.
+func (s *SmartContract) DebitMyAccount(ctx contractapi.TransactionContextInterface, bank string, denomination int, keyID string, blinded string) error {
 
-	account, err := ctx.GetStub().GetState(BANK_ACCOUNT)
+	if err := checkIsBank(ctx, bank); err != nil {
+		return err
+	}
+
+	currentKeyID, err := s.CurrentKeyID(ctx, bank, denomination)
 	if err != nil {
-		return fmt.Errorf("failed to get bank account: %v", err)
+		return err
+	}
+	if keyID != currentKeyID {
+		return fmt.Errorf("key %s is not the current key, blind the token again", keyID)
 	}
 
-	debit, err := ctx.GetStub().GetState(DEBIT_PROOF + blinded)
+	expired, err := isExpired(ctx, bank, denomination, keyID)
+	if err != nil {
+		return err
+	}
+	if expired {
+		return fmt.Errorf("key %s has expired, no new tokens can be issued with it", keyID)
+	}
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	account, err := getBankAccount(ctx, bank)
+	if err != nil {
+		return err
+	}
+
+	debit, err := ctx.GetStub().GetState(DEBIT_PROOF + bank + blinded)
 	if err != nil {
 		return fmt.Errorf("failed to get debit proof: %v", err)
 	}
@@ -74,18 +130,23 @@ func (s *SmartContract) DebitMyAccount(ctx contractapi.TransactionContextInterfa
 		return errors.New("debit operation can be only done once for one blinded token")
 	}
 
-	if err = ctx.GetStub().PutState(DEBIT_PROOF+blinded, []byte(blinded)); err != nil {
+	proof, err := json.Marshal(tokenProof{Denomination: denomination, KeyID: keyID, Payer: clientID})
+	if err != nil {
+		return fmt.Errorf("failed to marshal debit proof: %v", err)
+	}
+	if err = ctx.GetStub().PutState(DEBIT_PROOF+bank+blinded, proof); err != nil {
 		return fmt.Errorf("failed to put message: %v", err)
 	}
 
-	return s.Transfer(ctx, string(account), 1)
+	return s.Transfer(ctx, account, strconv.Itoa(denomination))
 }
 
 // //STEP 2 - Payer asks bank to blindsign the token. Bank verifies if STEP 1 took place.
-// //This request should go only to peer(s) that belong to Org1MSP (otherwise it will fail due to lack of private data)
-func (s *SmartContract) BlindSignToken(ctx contractapi.TransactionContextInterface, blinded string) (string, error) {
+// //This request should go only to peer(s) that belong to the bank (otherwise it will fail due to lack of private data)
+// //Token is signed with the denomination key recorded in the debit proof
+func (s *SmartContract) BlindSignToken(ctx contractapi.TransactionContextInterface, bank string, blinded string) (string, error) {
 
-	debit, err := ctx.GetStub().GetState(DEBIT_PROOF + blinded)
+	debit, err := ctx.GetStub().GetState(DEBIT_PROOF + bank + blinded)
 	if err != nil {
 		return "", fmt.Errorf("failed to get debit proof: %v", err)
 	}
@@ -93,10 +154,18 @@ func (s *SmartContract) BlindSignToken(ctx contractapi.TransactionContextInterfa
 		return "", errors.New("token not paid. please call DebitMyAccount first")
 	}
 
-	k, err := ctx.GetStub().GetPrivateData(BANK_PDC, BANK_ORG)
+	var proof tokenProof
+	if err := json.Unmarshal(debit, &proof); err != nil {
+		return "", fmt.Errorf("failed to unmarshal debit proof: %v", err)
+	}
+
+	k, err := ctx.GetStub().GetPrivateData(BANK_PDC+bank, bankKey(bank, proof.Denomination, proof.KeyID))
 	if err != nil {
 		return "", fmt.Errorf("failed to get private data: %v", err)
 	}
+	if len(k) == 0 {
+		return "", fmt.Errorf("private key %s not found for %s denomination %d", proof.KeyID, bank, proof.Denomination)
+	}
 
 	var key rsa.PrivateKey
 	if err := json.Unmarshal(k, &key); err != nil {
@@ -118,20 +187,11 @@ func (s *SmartContract) BlindSignToken(ctx contractapi.TransactionContextInterfa
 }
 
 //This request should go only to peer(s) that belongs to the Payer
-func (s *SmartContract) UnblindSignature(ctx contractapi.TransactionContextInterface, sig string, unblinder string) (string, error) {
+func (s *SmartContract) UnblindSignature(ctx contractapi.TransactionContextInterface, bank string, denomination int, keyID string, sig string, unblinder string) (string, error) {
 
-	pubkey, err := ctx.GetStub().GetState(BANK_ORG)
+	key, err := getPublicKey(ctx, bank, denomination, keyID)
 	if err != nil {
-		return "", fmt.Errorf("failed to get pubkey: %v", err)
-	}
-	raw, err := base64.StdEncoding.DecodeString(string(pubkey))
-	if err != nil {
-		return "", fmt.Errorf("failed to decode pubkey: %v", err)
-	}
-
-	var key rsa.PublicKey
-	if err := json.Unmarshal(raw, &key); err != nil {
-		return "", fmt.Errorf("failed to unmarshal key: %v", err)
+		return "", err
 	}
 
 	unblinderBytes, err := base64.StdEncoding.DecodeString(unblinder)
@@ -144,26 +204,23 @@ func (s *SmartContract) UnblindSignature(ctx contractapi.TransactionContextInter
 	}
 
 	// Unblind the signature
-	unblindedSig := rsablind.Unblind(&key, sigBytes, unblinderBytes)
+	unblindedSig := rsablind.Unblind(key, sigBytes, unblinderBytes)
 
 	return base64.StdEncoding.EncodeToString(unblindedSig), nil
 }
 
 //This is done by Payee
-func (s *SmartContract) CreditMyAccount(ctx contractapi.TransactionContextInterface, unblindedSig string, uuid string) error {
+//Signature is verified against the denomination key version it was issued with, retired versions are still accepted
+//Payee is credited with the value of the denomination. Expired tokens are not accepted.
+func (s *SmartContract) CreditMyAccount(ctx contractapi.TransactionContextInterface, bank string, denomination int, keyID string, unblindedSig string, uuid string) error {
 
-	pubkey, err := ctx.GetStub().GetState(BANK_ORG)
-	if err != nil {
-		return fmt.Errorf("failed to get pubkey: %v", err)
-	}
-	raw, err := base64.StdEncoding.DecodeString(string(pubkey))
-	if err != nil {
-		return fmt.Errorf("failed to decode pubkey: %v", err)
+	if err := checkIsBank(ctx, bank); err != nil {
+		return err
 	}
 
-	var key rsa.PublicKey
-	if err := json.Unmarshal(raw, &key); err != nil {
-		return fmt.Errorf("failed to unmarshal key: %v", err)
+	key, err := getPublicKey(ctx, bank, denomination, keyID)
+	if err != nil {
+		return err
 	}
 
 	unblindedSigBytes, err := base64.StdEncoding.DecodeString(unblindedSig)
@@ -171,12 +228,22 @@ func (s *SmartContract) CreditMyAccount(ctx contractapi.TransactionContextInterf
 		return fmt.Errorf("failed to decode unblindedSig: %v", err)
 	}
 
-	if err := rsablind.VerifyBlindSignature(&key, []byte(uuid), unblindedSigBytes); err != nil {
+	hashed := tokenHash(key, uuid)
+	if err := rsablind.VerifyBlindSignature(key, hashed, unblindedSigBytes); err != nil {
 		return fmt.Errorf("failed to verify signature: %v", err)
 	}
 
+	expired, err := isExpired(ctx, bank, denomination, keyID)
+	if err != nil {
+		return err
+	}
+	if expired {
+		return errors.New("token has expired")
+	}
+
 	//validate for double payments
-	credit, err := ctx.GetStub().GetState(CREDIT_PROOF + uuid)
+	creditKey := CREDIT_PROOF + bank + hex.EncodeToString(hashed)
+	credit, err := ctx.GetStub().GetState(creditKey)
 	if err != nil {
 		return fmt.Errorf("failed to get credit proof: %v", err)
 	}
@@ -184,7 +251,11 @@ func (s *SmartContract) CreditMyAccount(ctx contractapi.TransactionContextInterf
 		return errors.New("credit operation can be only done once for one blinded token")
 	}
 
-	if err = ctx.GetStub().PutState(CREDIT_PROOF+uuid, []byte(uuid)); err != nil {
+	proof, err := json.Marshal(tokenProof{Denomination: denomination, KeyID: keyID})
+	if err != nil {
+		return fmt.Errorf("failed to marshal credit proof: %v", err)
+	}
+	if err = ctx.GetStub().PutState(creditKey, proof); err != nil {
 		return fmt.Errorf("failed to put message: %v", err)
 	}
 
@@ -194,9 +265,163 @@ func (s *SmartContract) CreditMyAccount(ctx contractapi.TransactionContextInterf
 		return fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	account, err := ctx.GetStub().GetState(BANK_ACCOUNT)
+	account, err := getBankAccount(ctx, bank)
 	if err != nil {
-		return fmt.Errorf("failed to get bank account: %v", err)
+		return err
+	}
+	return transferToken(ctx, account, clientID, denomination)
+}
+
+//Done by Payer, when the token expired before payee used it
+//Payer proves the token is his by revealing uuid and unblinder, they must match the blinded token he paid for.
+//The hash of the uuid is what was blinded, so without the uuid the payer can't make up an unblinder that matches.
+//It links the payer with the token, which is fine as the token can't be used anymore.
+//Refund is possible also when the bank has been removed (see RemoveBank).
+func (s *SmartContract) RefundExpiredToken(ctx contractapi.TransactionContextInterface, bank string, blinded string, uuid string, unblinder string) error {
+
+	debit, err := ctx.GetStub().GetState(DEBIT_PROOF + bank + blinded)
+	if err != nil {
+		return fmt.Errorf("failed to get debit proof: %v", err)
+	}
+	if len(debit) == 0 {
+		return errors.New("token not paid")
+	}
+
+	var proof tokenProof
+	if err := json.Unmarshal(debit, &proof); err != nil {
+		return fmt.Errorf("failed to unmarshal debit proof: %v", err)
+	}
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+	if proof.Payer != clientID {
+		return errors.New("client is not the payer of the token")
+	}
+	if proof.Refunded {
+		return errors.New("token has already been refunded")
 	}
-	return transferHelper(ctx, string(account), clientID, 1)
+
+	expired, err := isExpired(ctx, bank, proof.Denomination, proof.KeyID)
+	if err != nil {
+		return err
+	}
+	if !expired {
+		return errors.New("token has not expired yet")
+	}
+
+	key, err := getPublicKey(ctx, bank, proof.Denomination, proof.KeyID)
+	if err != nil {
+		return err
+	}
+	blindedBytes, err := base64.StdEncoding.DecodeString(blinded)
+	if err != nil {
+		return fmt.Errorf("failed to decode blinded message: %v", err)
+	}
+	unblinderBytes, err := base64.StdEncoding.DecodeString(unblinder)
+	if err != nil {
+		return fmt.Errorf("failed to decode unblinder: %v", err)
+	}
+	hashed := tokenHash(key, uuid)
+	if !isBlindedToken(key, blindedBytes, hashed, unblinderBytes) {
+		return errors.New("uuid and unblinder don't match the blinded token")
+	}
+
+	//spent token can't be refunded, refunded token can't be spent
+	creditKey := CREDIT_PROOF + bank + hex.EncodeToString(hashed)
+	credit, err := ctx.GetStub().GetState(creditKey)
+	if err != nil {
+		return fmt.Errorf("failed to get credit proof: %v", err)
+	}
+	if len(credit) > 0 {
+		return errors.New("token has already been used")
+	}
+
+	proof.Refunded = true
+	raw, err := json.Marshal(proof)
+	if err != nil {
+		return fmt.Errorf("failed to marshal debit proof: %v", err)
+	}
+	if err = ctx.GetStub().PutState(DEBIT_PROOF+bank+blinded, raw); err != nil {
+		return fmt.Errorf("failed to put message: %v", err)
+	}
+
+	raw, err = json.Marshal(tokenProof{Denomination: proof.Denomination, KeyID: proof.KeyID, Refunded: true})
+	if err != nil {
+		return fmt.Errorf("failed to marshal credit proof: %v", err)
+	}
+	if err = ctx.GetStub().PutState(creditKey, raw); err != nil {
+		return fmt.Errorf("failed to put message: %v", err)
+	}
+
+	account, err := getBankAccount(ctx, bank)
+	if err != nil {
+		return err
+	}
+	return transferToken(ctx, account, clientID, proof.Denomination)
+}
+
+//Moves the value of a token between accounts, the denomination is given in whole tokens
+func transferToken(ctx contractapi.TransactionContextInterface, from string, to string, denomination int) error {
+
+	decimals, err := getDecimals(ctx)
+	if err != nil {
+		return err
+	}
+	value, err := parseAmount(strconv.Itoa(denomination), decimals)
+	if err != nil {
+		return err
+	}
+
+	return transferHelper(ctx, from, to, value)
+}
+
+//Checks if tokens signed with given key have expired (at transaction time)
+func isExpired(ctx contractapi.TransactionContextInterface, bank string, denomination int, keyID string) (bool, error) {
+
+	expiry, err := getKeyExpiry(ctx, bank, denomination, keyID)
+	if err != nil {
+		return false, err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return now > expiry, nil
+}
+
+//Full domain hash of the token uuid, this is the message that gets blinded and signed.
+//rsablind doesn't hash, signing the raw uuid would let anyone pick u and claim blinded * u^e mod N as the uuid of a paid token.
+//SHA-256 is run in counter mode until the hash is 3/4 of the key size, as recommended by rsablind.
+func tokenHash(key *rsa.PublicKey, uuid string) []byte {
+
+	size := key.Size() * 3 / 4
+	hashed := make([]byte, 0, size+sha256.Size)
+	counter := make([]byte, 4)
+	for i := uint32(0); len(hashed) < size; i++ {
+		binary.BigEndian.PutUint32(counter, i)
+		h := sha256.New()
+		h.Write(counter)
+		h.Write([]byte(uuid))
+		hashed = h.Sum(hashed)
+	}
+
+	return hashed[:size]
+}
+
+//Checks if blinded is the hashed token blinded with the factor that unblinder reverts.
+//rsablind computes blinded = hashed * r^e mod N and unblinder = r^-1 mod N,
+//so blinded * unblinder^e mod N must give back hashed. Only public key is needed.
+func isBlindedToken(key *rsa.PublicKey, blinded []byte, hashed []byte, unblinder []byte) bool {
+
+	e := big.NewInt(int64(key.E))
+	m := new(big.Int).Exp(new(big.Int).SetBytes(unblinder), e, key.N)
+	m.Mul(m, new(big.Int).SetBytes(blinded))
+	m.Mod(m, key.N)
+
+	return m.Cmp(new(big.Int).SetBytes(hashed)) == 0
 }
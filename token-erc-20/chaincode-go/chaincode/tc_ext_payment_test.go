@@ -4,10 +4,14 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"testing"
+	"time"
 
+	"github.com/cryptoballot/rsablind"
 	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-samples/token-erc-20/chaincode-go/chaincode/tests/testsfakes"
 	"github.com/stretchr/testify/assert"
@@ -73,7 +77,7 @@ var _BlindSignToken = []struct {
 			return raw, nil
 		},
 		expectedGetState: func(key string) ([]byte, error) {
-			return []byte("DEBIT_PROOF"), nil
+			return []byte(`{"Denomination":100,"KeyID":"v1"}`), nil
 		},
 	},
 	{
@@ -89,22 +93,40 @@ var _BlindSignToken = []struct {
 			return raw, nil
 		},
 		expectedGetState: func(key string) ([]byte, error) {
-			return []byte("DEBIT_PROOF"), nil
+			return []byte(`{"Denomination":100,"KeyID":"v1"}`), nil
 		},
 	},
 }
 
 var _BlindToken = []struct {
 	name             string
+	bank             string
 	expectedError    string
 	expectedGetState func(key string) ([]byte, error)
 }{
+	{
+		name:          "Not a bank",
+		bank:          "Org2MSP",
+		expectedError: "Org2MSP is not a bank",
+	},
+	{
+		name:          "No public key",
+		bank:          bankOrg,
+		expectedError: "no public key has been saved by Org1MSP for denomination 100",
+		expectedGetState: func(key string) ([]byte, error) {
+			return nil, nil
+		},
+	},
 	{
 		name:          "Wrong public key",
-		expectedError: "failed to decode pubkey : illegal base64 data at input byte 3",
+		bank:          bankOrg,
+		expectedError: "failed to decode pubkey: illegal base64 data at input byte 3",
 		expectedGetState: func(key string) ([]byte, error) {
-			if key != BANK_ORG {
-				return nil, fmt.Errorf("expected: %v, got: %v", BANK_ORG, key)
+			if key == keyIDKey(bankOrg, 100) {
+				return []byte("v1"), nil
+			}
+			if key != bankKey(bankOrg, 100, "v1") {
+				return nil, fmt.Errorf("expected: %v, got: %v", bankKey(bankOrg, 100, "v1"), key)
 			}
 
 			return []byte("BAD_KEY"), nil
@@ -112,10 +134,14 @@ var _BlindToken = []struct {
 	},
 	{
 		name:          "Wrong public key",
-		expectedError: "failed to unmarshal pubkey : invalid character 'B' looking for beginning of value",
+		bank:          bankOrg,
+		expectedError: "failed to unmarshal pubkey: invalid character 'B' looking for beginning of value",
 		expectedGetState: func(key string) ([]byte, error) {
-			if key != BANK_ORG {
-				return nil, fmt.Errorf("expected: %v, got: %v", BANK_ORG, key)
+			if key == keyIDKey(bankOrg, 100) {
+				return []byte("v1"), nil
+			}
+			if key != bankKey(bankOrg, 100, "v1") {
+				return nil, fmt.Errorf("expected: %v, got: %v", bankKey(bankOrg, 100, "v1"), key)
 			}
 
 			return []byte(base64.StdEncoding.EncodeToString([]byte("BAD_KEY"))), nil
@@ -123,10 +149,17 @@ var _BlindToken = []struct {
 	},
 	{
 		name:          "OK",
+		bank:          bankOrg,
 		expectedError: "",
 		expectedGetState: func(key string) ([]byte, error) {
-			if key != BANK_ORG {
-				return nil, fmt.Errorf("expected: %v, got: %v", BANK_ORG, key)
+			if key == keyIDKey(bankOrg, 100) {
+				return []byte("v1"), nil
+			}
+			if key == expiryKey(bankOrg, 100, "v1") {
+				return []byte("2000"), nil
+			}
+			if key != bankKey(bankOrg, 100, "v1") {
+				return nil, fmt.Errorf("expected: %v, got: %v", bankKey(bankOrg, 100, "v1"), key)
 			}
 
 			//{"N":24787195276930649230287258224340937817134667548122992571687926700523791918995022371399680424603186705632926283400030142229555298587717622245758017009612531064280998254756811023415303979856710423159807478247895638371357845840168781001996196641941245168685183801966763986410584953753935493538808827004646878984724764578398312887538042873274452796852965052714687294117500361602012732138337699494039768791809140448141857817416516087993825920762548175448427494835658788790598202508241242574358201397507888819508438933881873637979957026638911790569628084982540484272086690427943232989852325243855959762458200343374592344889,"E":65537}
@@ -138,14 +171,49 @@ var _BlindToken = []struct {
 
 var _DebitMyAccount = []struct {
 	name             string
+	inKeyID          string
 	expectedError    string
 	expectedGetState func(key string) ([]byte, error)
 }{
+	{
+		name:          "Not current key",
+		inKeyID:       "v0",
+		expectedError: "key v0 is not the current key, blind the token again",
+		expectedGetState: func(key string) ([]byte, error) {
+			if key == keyIDKey(bankOrg, 100) {
+				return []byte("v1"), nil
+			}
+
+			return nil, nil
+		},
+	},
+	{
+		name:          "Expired key",
+		inKeyID:       "v1",
+		expectedError: "key v1 has expired, no new tokens can be issued with it",
+		expectedGetState: func(key string) ([]byte, error) {
+			if key == keyIDKey(bankOrg, 100) {
+				return []byte("v1"), nil
+			}
+			if key == expiryKey(bankOrg, 100, "v1") {
+				return []byte("500"), nil
+			}
+
+			return nil, nil
+		},
+	},
 	{
 		name:          "Can't debit twice",
+		inKeyID:       "v1",
 		expectedError: "debit operation can be only done once for one blinded token",
 		expectedGetState: func(key string) ([]byte, error) {
-			if key == BANK_ACCOUNT {
+			if key == keyIDKey(bankOrg, 100) {
+				return []byte("v1"), nil
+			}
+			if key == expiryKey(bankOrg, 100, "v1") {
+				return []byte("2000"), nil
+			}
+			if key == BANK_ACCOUNT+bankOrg {
 				return []byte("BANK_ACCOUNT"), nil
 			}
 
@@ -154,9 +222,16 @@ var _DebitMyAccount = []struct {
 	},
 	{
 		name:          "Transfer not initialised",
+		inKeyID:       "v1",
 		expectedError: "Contract options need to be set before calling any function, call Initialize() to initialize contract",
 		expectedGetState: func(key string) ([]byte, error) {
-			if key == BANK_ACCOUNT {
+			if key == keyIDKey(bankOrg, 100) {
+				return []byte("v1"), nil
+			}
+			if key == expiryKey(bankOrg, 100, "v1") {
+				return []byte("2000"), nil
+			}
+			if key == BANK_ACCOUNT+bankOrg {
 				return []byte("BANK_ACCOUNT"), nil
 			}
 
@@ -179,9 +254,9 @@ func TestUnblindSignature(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 
 			//Prepare dynamic data
-			stub.GetStateStub = tt.expectedGetState
+			stub.GetStateStub = withRoles(tt.expectedGetState)
 
-			r, err := sc.UnblindSignature(tc, tt.sig, tt.unblinder)
+			r, err := sc.UnblindSignature(tc, bankOrg, 100, "v1", tt.sig, tt.unblinder)
 			if tt.expectedError != "" {
 				assert.EqualError(t, err, tt.expectedError)
 			} else {
@@ -208,9 +283,9 @@ func TestBlindSignToken(t *testing.T) {
 
 			//Prepare dynamic data
 			stub.GetPrivateDataStub = tt.expectedGetPrivateData
-			stub.GetStateStub = tt.expectedGetState
+			stub.GetStateStub = withRoles(tt.expectedGetState)
 
-			r, err := sc.BlindSignToken(tc, tt.inBlindedMessage)
+			r, err := sc.BlindSignToken(tc, bankOrg, tt.inBlindedMessage)
 			if tt.expectedError != "" {
 				assert.EqualError(t, err, tt.expectedError)
 			} else {
@@ -232,13 +307,18 @@ func TestDebitMyAccount(t *testing.T) {
 		return stub
 	}
 
+	identity := &testsfakes.FakeTestClientIdentity{}
+	identity.GetIDReturns("PAYER", nil)
+	tc.GetClientIdentityReturns(identity)
+	withTxTime(stub, 1000)
+
 	for _, tt := range _DebitMyAccount {
 		t.Run(tt.name, func(t *testing.T) {
 
 			//Prepare dynamic data
-			stub.GetStateStub = tt.expectedGetState
+			stub.GetStateStub = withRoles(tt.expectedGetState)
 
-			err := sc.DebitMyAccount(tc, "BLINDED")
+			err := sc.DebitMyAccount(tc, bankOrg, 100, tt.inKeyID, "BLINDED")
 			if tt.expectedError != "" {
 				assert.EqualError(t, err, tt.expectedError)
 			} else {
@@ -263,9 +343,9 @@ func TestBlindToken(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 
 			//Prepare dynamic data
-			stub.GetStateStub = tt.expectedGetState
+			stub.GetStateStub = withRoles(tt.expectedGetState)
 
-			r, err := sc.BlindToken(tc, "UUID")
+			r, err := sc.BlindToken(tc, tt.bank, 100, "UUID")
 			if tt.expectedError != "" {
 				assert.EqualError(t, err, tt.expectedError)
 			} else {
@@ -274,6 +354,9 @@ func TestBlindToken(t *testing.T) {
 				var response map[string]interface{}
 				json.Unmarshal([]byte(r), &response)
 
+				assert.Equal(t, float64(100), response["Denomination"])
+				assert.Equal(t, "v1", response["KeyID"])
+				assert.Equal(t, float64(2000), response["Expiry"])
 				assert.NotNil(t, response["Blinded"])
 				assert.NotNil(t, response["Unblinder"])
 
@@ -284,3 +367,288 @@ func TestBlindToken(t *testing.T) {
 	}
 
 }
+
+func TestRefundExpiredToken(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	stub := &testsfakes.FakeTestChaincodeStubInterface{}
+	tc := &testsfakes.FakeTestTransactionContextInterface{}
+	tc.GetStubStub = func() shim.ChaincodeStubInterface {
+		return stub
+	}
+	identity := &testsfakes.FakeTestClientIdentity{}
+	identity.GetIDReturns("PAYER", nil)
+	tc.GetClientIdentityReturns(identity)
+
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	raw, _ := json.Marshal(key.PublicKey)
+	pubkey := base64.StdEncoding.EncodeToString(raw)
+	blindedBytes, unblinderBytes, _ := rsablind.Blind(&key.PublicKey, tokenHash(&key.PublicKey, "UUID"))
+	blinded := base64.StdEncoding.EncodeToString(blindedBytes)
+	unblinder := base64.StdEncoding.EncodeToString(unblinderBytes)
+	creditKey := CREDIT_PROOF + bankOrg + hex.EncodeToString(tokenHash(&key.PublicKey, "UUID"))
+
+	//Forged unblinder: any u gives a "uuid" blinded * u^e mod N that the blinded token would match without hashing
+	forgedUnblinder := big.NewInt(12345)
+	forgedUUID := new(big.Int).Exp(forgedUnblinder, big.NewInt(int64(key.E)), key.N)
+	forgedUUID.Mul(forgedUUID, new(big.Int).SetBytes(blindedBytes))
+	forgedUUID.Mod(forgedUUID, key.N)
+
+	var _RefundExpiredToken = []struct {
+		name          string
+		uuid          string
+		unblinder     string
+		now           int64
+		peerNow       int64
+		state         map[string]string
+		expectedError string
+	}{
+		{
+			name:          "Not paid",
+			uuid:          "UUID",
+			now:           3000,
+			state:         map[string]string{},
+			expectedError: "token not paid",
+		},
+		{
+			name: "Not a payer",
+			uuid: "UUID",
+			now:  3000,
+			state: map[string]string{
+				DEBIT_PROOF + bankOrg + blinded: `{"Denomination":100,"KeyID":"v1","Payer":"SOMEONE_ELSE"}`,
+			},
+			expectedError: "client is not the payer of the token",
+		},
+		{
+			name: "Already refunded",
+			uuid: "UUID",
+			now:  3000,
+			state: map[string]string{
+				DEBIT_PROOF + bankOrg + blinded: `{"Denomination":100,"KeyID":"v1","Payer":"PAYER","Refunded":true}`,
+			},
+			expectedError: "token has already been refunded",
+		},
+		{
+			name: "Not expired",
+			uuid: "UUID",
+			now:  1000,
+			state: map[string]string{
+				DEBIT_PROOF + bankOrg + blinded: `{"Denomination":100,"KeyID":"v1","Payer":"PAYER"}`,
+				expiryKey(bankOrg, 100, "v1"):   "2000",
+			},
+			expectedError: "token has not expired yet",
+		},
+		{
+			name: "Wrong uuid",
+			uuid: "OTHER_UUID",
+			now:  3000,
+			state: map[string]string{
+				DEBIT_PROOF + bankOrg + blinded: `{"Denomination":100,"KeyID":"v1","Payer":"PAYER"}`,
+				expiryKey(bankOrg, 100, "v1"):   "2000",
+				bankKey(bankOrg, 100, "v1"):     pubkey,
+			},
+			expectedError: "uuid and unblinder don't match the blinded token",
+		},
+		{
+			name:      "Forged unblinder",
+			uuid:      string(forgedUUID.Bytes()),
+			unblinder: base64.StdEncoding.EncodeToString(forgedUnblinder.Bytes()),
+			now:       3000,
+			state: map[string]string{
+				DEBIT_PROOF + bankOrg + blinded: `{"Denomination":100,"KeyID":"v1","Payer":"PAYER"}`,
+				expiryKey(bankOrg, 100, "v1"):   "2000",
+				bankKey(bankOrg, 100, "v1"):     pubkey,
+			},
+			expectedError: "uuid and unblinder don't match the blinded token",
+		},
+		{
+			name:    "Timestamp too far from the peer",
+			uuid:    "UUID",
+			now:     3000,
+			peerNow: 1000,
+			state: map[string]string{
+				DEBIT_PROOF + bankOrg + blinded: `{"Denomination":100,"KeyID":"v1","Payer":"PAYER"}`,
+				expiryKey(bankOrg, 100, "v1"):   "2000",
+			},
+			expectedError: "transaction timestamp 3000 is more than 30s away from the time of the peer",
+		},
+		{
+			name: "Already used",
+			uuid: "UUID",
+			now:  3000,
+			state: map[string]string{
+				DEBIT_PROOF + bankOrg + blinded: `{"Denomination":100,"KeyID":"v1","Payer":"PAYER"}`,
+				expiryKey(bankOrg, 100, "v1"):   "2000",
+				bankKey(bankOrg, 100, "v1"):     pubkey,
+				creditKey:                       `{"Denomination":100,"KeyID":"v1"}`,
+			},
+			expectedError: "token has already been used",
+		},
+		{
+			name: "OK",
+			uuid: "UUID",
+			now:  3000,
+			state: map[string]string{
+				DEBIT_PROOF + bankOrg + blinded: `{"Denomination":100,"KeyID":"v1","Payer":"PAYER"}`,
+				expiryKey(bankOrg, 100, "v1"):   "2000",
+				bankKey(bankOrg, 100, "v1"):     pubkey,
+				BANK_ACCOUNT + bankOrg:          "BANK_ACCOUNT",
+				decimalsKey:                     "0",
+				"BANK_ACCOUNT":                  "500",
+				"PAYER":                         "0",
+			},
+		},
+	}
+
+	for _, tt := range _RefundExpiredToken {
+		t.Run(tt.name, func(t *testing.T) {
+
+			//Prepare dynamic data
+			withTxTime(stub, tt.now)
+			if tt.peerNow != 0 {
+				peerClock = func() time.Time {
+					return time.Unix(tt.peerNow, 0)
+				}
+			}
+			stub.GetStateStub = func(key string) ([]byte, error) {
+				if v, ok := tt.state[key]; ok {
+					return []byte(v), nil
+				}
+				return nil, nil
+			}
+			written := map[string]string{}
+			stub.PutStateStub = func(key string, value []byte) error {
+				written[key] = string(value)
+				return nil
+			}
+			inUnblinder := unblinder
+			if tt.unblinder != "" {
+				inUnblinder = tt.unblinder
+			}
+
+			err := sc.RefundExpiredToken(tc, bankOrg, blinded, tt.uuid, inUnblinder)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, `{"Denomination":100,"KeyID":"v1","Payer":"PAYER","Refunded":true}`, written[DEBIT_PROOF+bankOrg+blinded])
+				assert.Equal(t, `{"Denomination":100,"KeyID":"v1","Payer":"","Refunded":true}`, written[creditKey])
+				assert.Equal(t, "400", written["BANK_ACCOUNT"])
+				assert.Equal(t, "100", written["PAYER"])
+			}
+		})
+	}
+}
+
+func TestCreditMyAccount(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	stub := &testsfakes.FakeTestChaincodeStubInterface{}
+	tc := &testsfakes.FakeTestTransactionContextInterface{}
+	tc.GetStubStub = func() shim.ChaincodeStubInterface {
+		return stub
+	}
+	identity := &testsfakes.FakeTestClientIdentity{}
+	identity.GetIDReturns("PAYEE", nil)
+	tc.GetClientIdentityReturns(identity)
+
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	raw, _ := json.Marshal(key.PublicKey)
+	pubkey := base64.StdEncoding.EncodeToString(raw)
+	sign := func(hashed []byte) string {
+		blinded, unblinder, _ := rsablind.Blind(&key.PublicKey, hashed)
+		sig, _ := rsablind.BlindSign(key, blinded)
+		return base64.StdEncoding.EncodeToString(rsablind.Unblind(&key.PublicKey, sig, unblinder))
+	}
+	sig := sign(tokenHash(&key.PublicKey, "UUID"))
+	creditKey := CREDIT_PROOF + bankOrg + hex.EncodeToString(tokenHash(&key.PublicKey, "UUID"))
+	state := map[string]string{
+		expiryKey(bankOrg, 100, "v1"): "2000",
+		bankKey(bankOrg, 100, "v1"):   pubkey,
+		BANK_ACCOUNT + bankOrg:        "BANK_ACCOUNT",
+		decimalsKey:                   "0",
+		"BANK_ACCOUNT":                "500",
+		"PAYEE":                       "0",
+	}
+
+	var _CreditMyAccount = []struct {
+		name          string
+		sig           string
+		now           int64
+		peerNow       int64
+		credited      bool
+		expectedError string
+	}{
+		{
+			name:          "Signature of the raw uuid",
+			sig:           sign([]byte("UUID")),
+			now:           1000,
+			expectedError: "failed to verify signature: crypto/rsa: verification error",
+		},
+		{
+			name:          "Expired",
+			sig:           sig,
+			now:           3000,
+			expectedError: "token has expired",
+		},
+		{
+			name:          "Timestamp too far from the peer",
+			sig:           sig,
+			now:           1000,
+			peerNow:       3000,
+			expectedError: "transaction timestamp 1000 is more than 30s away from the time of the peer",
+		},
+		{
+			name:          "Already credited",
+			sig:           sig,
+			now:           1000,
+			credited:      true,
+			expectedError: "credit operation can be only done once for one blinded token",
+		},
+		{
+			name: "OK",
+			sig:  sig,
+			now:  1000,
+		},
+	}
+
+	for _, tt := range _CreditMyAccount {
+		t.Run(tt.name, func(t *testing.T) {
+
+			//Prepare dynamic data
+			withTxTime(stub, tt.now)
+			if tt.peerNow != 0 {
+				peerClock = func() time.Time {
+					return time.Unix(tt.peerNow, 0)
+				}
+			}
+			stub.GetStateStub = withRoles(func(key string) ([]byte, error) {
+				if key == creditKey && tt.credited {
+					return []byte(`{"Denomination":100,"KeyID":"v1"}`), nil
+				}
+				if v, ok := state[key]; ok {
+					return []byte(v), nil
+				}
+				return nil, nil
+			})
+			written := map[string]string{}
+			stub.PutStateStub = func(key string, value []byte) error {
+				written[key] = string(value)
+				return nil
+			}
+
+			err := sc.CreditMyAccount(tc, bankOrg, 100, "v1", tt.sig, "UUID")
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				assert.Empty(t, written)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, `{"Denomination":100,"KeyID":"v1","Payer":"","Refunded":false}`, written[creditKey])
+				assert.Equal(t, "400", written["BANK_ACCOUNT"])
+				assert.Equal(t, "100", written["PAYEE"])
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define key name for roles
+const rolesKey = "roles"
+
+// Define key name for the ID of the last balance migration, it has the same endorsement policy as the roles
+const migrationKey = "migration"
+
+// Roles records which organizations play the privileged roles in the contract
+// Governance organizations must all endorse any change of the roles (state-based endorsement of the roles key)
+type Roles struct {
+	Minter     string   `json:"minter"`
+	Admin      string   `json:"admin"`
+	Banks      []string `json:"banks"`
+	Governance []string `json:"governance"`
+}
+
+// GetRoles returns organizations playing the minter, admin, bank and governance roles
+func (s *SmartContract) GetRoles(ctx contractapi.TransactionContextInterface) (*Roles, error) {
+
+	//check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return nil, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	return getRoles(ctx)
+}
+
+// SetMinter hands the minter role over to another organization
+// This is a governance transaction, it must be endorsed by all governance organizations
+func (s *SmartContract) SetMinter(ctx contractapi.TransactionContextInterface, minter string) error {
+
+	roles, err := checkGovernance(ctx)
+	if err != nil {
+		return err
+	}
+
+	if minter == "" {
+		return errors.New("minter must not be empty")
+	}
+	roles.Minter = minter
+
+	log.Printf("minter role set to %s", minter)
+
+	return putRoles(ctx, roles)
+}
+
+// SetAdmin hands the admin role (pausing the contract and freezing accounts) over to another organization
+// This is a governance transaction, it must be endorsed by all governance organizations
+func (s *SmartContract) SetAdmin(ctx contractapi.TransactionContextInterface, admin string) error {
+
+	roles, err := checkGovernance(ctx)
+	if err != nil {
+		return err
+	}
+
+	if admin == "" {
+		return errors.New("admin must not be empty")
+	}
+	roles.Admin = admin
+
+	log.Printf("admin role set to %s", admin)
+
+	return putRoles(ctx, roles)
+}
+
+// AddBank adds an organization to the issuing banks of the anonymous payments extension
+// This is a governance transaction, it must be endorsed by all governance organizations
+func (s *SmartContract) AddBank(ctx contractapi.TransactionContextInterface, bank string) error {
+
+	roles, err := checkGovernance(ctx)
+	if err != nil {
+		return err
+	}
+
+	if bank == "" {
+		return errors.New("bank must not be empty")
+	}
+	if contains(roles.Banks, bank) {
+		return fmt.Errorf("%s is already a bank", bank)
+	}
+	roles.Banks = append(roles.Banks, bank)
+
+	log.Printf("bank %s added", bank)
+
+	return putRoles(ctx, roles)
+}
+
+// RemoveBank removes an organization from the issuing banks
+// Tokens already issued by the bank can't be used afterwards
+// This is a governance transaction, it must be endorsed by all governance organizations
+func (s *SmartContract) RemoveBank(ctx contractapi.TransactionContextInterface, bank string) error {
+
+	roles, err := checkGovernance(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !contains(roles.Banks, bank) {
+		return fmt.Errorf("%s is not a bank", bank)
+	}
+	banks := []string{}
+	for _, b := range roles.Banks {
+		if b != bank {
+			banks = append(banks, b)
+		}
+	}
+	roles.Banks = banks
+
+	log.Printf("bank %s removed", bank)
+
+	return putRoles(ctx, roles)
+}
+
+// SetGovernance replaces the governance organizations
+// This is a governance transaction, it must be endorsed by all current governance organizations
+// Following changes need endorsement of the new ones
+func (s *SmartContract) SetGovernance(ctx contractapi.TransactionContextInterface, governance []string) error {
+
+	roles, err := checkGovernance(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(governance) == 0 {
+		return errors.New("at least one governance organization is required")
+	}
+	roles.Governance = governance
+
+	log.Printf("governance organizations set to %v", governance)
+
+	if err = putRoles(ctx, roles); err != nil {
+		return err
+	}
+
+	return setRolesEndorsement(ctx, governance)
+}
+
+// Helper Functions
+
+// getRoles reads the roles from the world state
+func getRoles(ctx contractapi.TransactionContextInterface) (*Roles, error) {
+
+	rolesBytes, err := ctx.GetStub().GetState(rolesKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read roles from world state: %v", err)
+	}
+	if rolesBytes == nil {
+		return nil, errors.New("roles have not been set")
+	}
+
+	var roles Roles
+	if err = json.Unmarshal(rolesBytes, &roles); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal roles: %v", err)
+	}
+
+	return &roles, nil
+}
+
+// putRoles writes the roles to the world state and emits a RolesChanged event
+func putRoles(ctx contractapi.TransactionContextInterface, roles *Roles) error {
+
+	rolesJSON, err := json.Marshal(roles)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(rolesKey, rolesJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put roles: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("RolesChanged", rolesJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return nil
+}
+
+// setRolesEndorsement requires all governance organizations to endorse changes of the roles and migration keys
+func setRolesEndorsement(ctx contractapi.TransactionContextInterface, governance []string) error {
+
+	endorsementPolicy, err := statebased.NewStateEP(nil)
+	if err != nil {
+		return err
+	}
+	err = endorsementPolicy.AddOrgs(statebased.RoleTypePeer, governance...)
+	if err != nil {
+		return fmt.Errorf("failed to add org to endorsement policy: %v", err)
+	}
+	policy, err := endorsementPolicy.Policy()
+	if err != nil {
+		return fmt.Errorf("failed to create endorsement policy bytes from org: %v", err)
+	}
+
+	//the policy is kept only for existing keys
+	err = ctx.GetStub().PutState(migrationKey, []byte(ctx.GetStub().GetTxID()))
+	if err != nil {
+		return fmt.Errorf("failed to put migration: %v", err)
+	}
+
+	for _, key := range []string{rolesKey, migrationKey} {
+		err = ctx.GetStub().SetStateValidationParameter(key, policy)
+		if err != nil {
+			return fmt.Errorf("failed to set validation parameter on %s: %v", key, err)
+		}
+	}
+
+	return nil
+}
+
+// checkGovernance verifies that the contract is initialized and the client belongs to a governance organization
+func checkGovernance(ctx contractapi.TransactionContextInterface) (*Roles, error) {
+
+	//check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return nil, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	roles, err := getRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get MSPID: %v", err)
+	}
+	if !contains(roles.Governance, clientMSPID) {
+		return nil, fmt.Errorf("client is not authorized to change roles")
+	}
+
+	return roles, nil
+}
+
+// checkMinter verifies that the client belongs to the minter organization
+func checkMinter(ctx contractapi.TransactionContextInterface) error {
+
+	roles, err := getRoles(ctx)
+	if err != nil {
+		return err
+	}
+
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get MSPID: %v", err)
+	}
+	if clientMSPID != roles.Minter {
+		return fmt.Errorf("client is not authorized to mint new tokens")
+	}
+
+	return nil
+}
+
+// contains checks if the slice holds the string
+func contains(sli []string, str string) bool {
+	for _, a := range sli {
+		if a == str {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,244 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-samples/token-erc-20/chaincode-go/chaincode/tests/testsfakes"
+	"github.com/stretchr/testify/assert"
+)
+
+var _Initialize = []struct {
+	name          string
+	isInit        bool
+	mspID         string
+	minter        string
+	admin         string
+	banks         []string
+	governance    []string
+	expectedError string
+}{
+	{
+		name:          "No minter",
+		isInit:        true,
+		governance:    []string{"Org1MSP"},
+		expectedError: "minter must not be empty",
+	},
+	{
+		name:          "No admin",
+		isInit:        true,
+		minter:        "Org1MSP",
+		governance:    []string{"Org1MSP"},
+		expectedError: "admin must not be empty",
+	},
+	{
+		name:          "No governance",
+		isInit:        true,
+		minter:        "Org1MSP",
+		admin:         "Org2MSP",
+		expectedError: "at least one governance organization is required",
+	},
+	{
+		name:          "Not the init transaction",
+		minter:        "Org1MSP",
+		admin:         "Org2MSP",
+		governance:    []string{"Org1MSP", "Org2MSP"},
+		expectedError: "Initialize must be invoked as the init transaction of a chaincode definition with --init-required",
+	},
+	{
+		name:          "Not a governance organisation",
+		isInit:        true,
+		mspID:         "Org3MSP",
+		minter:        "Org1MSP",
+		admin:         "Org2MSP",
+		governance:    []string{"Org1MSP", "Org2MSP"},
+		expectedError: "client is not authorized to initialize contract, Org3MSP is not a governance organization",
+	},
+	{
+		name:       "OK",
+		isInit:     true,
+		mspID:      "Org2MSP",
+		minter:     "Org1MSP",
+		admin:      "Org2MSP",
+		banks:      []string{"Org1MSP", "Org3MSP"},
+		governance: []string{"Org1MSP", "Org2MSP"},
+	},
+}
+
+var _GovernanceTransactions = []struct {
+	name          string
+	mspID         string
+	call          func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) error
+	expectedError string
+	expectedRoles string
+}{
+	{
+		name:  "Not a governance organisation",
+		mspID: "Org3MSP",
+		call: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) error {
+			return sc.SetMinter(tc, "Org3MSP")
+		},
+		expectedError: "client is not authorized to change roles",
+	},
+	{
+		name:  "Set minter",
+		mspID: "Org2MSP",
+		call: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) error {
+			return sc.SetMinter(tc, "Org2MSP")
+		},
+		expectedRoles: `{"minter":"Org2MSP","admin":"Org2MSP","banks":["Org1MSP"],"governance":["Org1MSP","Org2MSP"]}`,
+	},
+	{
+		name:  "Set admin",
+		mspID: "Org1MSP",
+		call: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) error {
+			return sc.SetAdmin(tc, "Org3MSP")
+		},
+		expectedRoles: `{"minter":"Org1MSP","admin":"Org3MSP","banks":["Org1MSP"],"governance":["Org1MSP","Org2MSP"]}`,
+	},
+	{
+		name:  "Add existing bank",
+		mspID: "Org2MSP",
+		call: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) error {
+			return sc.AddBank(tc, "Org1MSP")
+		},
+		expectedError: "Org1MSP is already a bank",
+	},
+	{
+		name:  "Add bank",
+		mspID: "Org2MSP",
+		call: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) error {
+			return sc.AddBank(tc, "Org3MSP")
+		},
+		expectedRoles: `{"minter":"Org1MSP","admin":"Org2MSP","banks":["Org1MSP","Org3MSP"],"governance":["Org1MSP","Org2MSP"]}`,
+	},
+	{
+		name:  "Remove bank",
+		mspID: "Org1MSP",
+		call: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) error {
+			return sc.RemoveBank(tc, "Org1MSP")
+		},
+		expectedRoles: `{"minter":"Org1MSP","admin":"Org2MSP","banks":[],"governance":["Org1MSP","Org2MSP"]}`,
+	},
+	{
+		name:  "Set governance",
+		mspID: "Org1MSP",
+		call: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) error {
+			return sc.SetGovernance(tc, []string{"Org3MSP"})
+		},
+		expectedRoles: `{"minter":"Org1MSP","admin":"Org2MSP","banks":["Org1MSP"],"governance":["Org3MSP"]}`,
+	},
+}
+
+func TestInitialize(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	stub := &testsfakes.FakeTestChaincodeStubInterface{}
+	tc := &testsfakes.FakeTestTransactionContextInterface{}
+	tc.GetStubStub = func() shim.ChaincodeStubInterface {
+		return stub
+	}
+	identity := &testsfakes.FakeTestClientIdentity{}
+	tc.GetClientIdentityReturns(identity)
+
+	for _, tt := range _Initialize {
+		t.Run(tt.name, func(t *testing.T) {
+
+			//Prepare dynamic data
+			stub.GetSignedProposalReturns(signedProposal(t, tt.isInit), nil)
+			identity.GetMSPIDReturns(tt.mspID, nil)
+			written := map[string][]byte{}
+			stub.PutStateStub = func(key string, value []byte) error {
+				written[key] = value
+				return nil
+			}
+			policies := map[string][]byte{}
+			stub.SetStateValidationParameterStub = func(key string, value []byte) error {
+				policies[key] = value
+				return nil
+			}
+
+			ok, err := sc.Initialize(tc, "name", "symbol", "2", tt.minter, tt.admin, tt.banks, tt.governance)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+			} else {
+				assert.NoError(t, err)
+				assert.True(t, ok)
+
+				var roles Roles
+				assert.NoError(t, json.Unmarshal(written[rolesKey], &roles))
+				assert.Equal(t, Roles{Minter: tt.minter, Admin: tt.admin, Banks: tt.banks, Governance: tt.governance}, roles)
+
+				//all governance organizations must endorse changes of roles and migrations
+				assert.Len(t, policies, 2)
+				for _, key := range []string{rolesKey, migrationKey} {
+					ep, err := statebased.NewStateEP(policies[key])
+					assert.NoError(t, err)
+					assert.ElementsMatch(t, tt.governance, ep.ListOrgs())
+				}
+				assert.Contains(t, written, migrationKey)
+			}
+		})
+	}
+}
+
+func TestGovernanceTransactions(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	stub := &testsfakes.FakeTestChaincodeStubInterface{}
+	tc := &testsfakes.FakeTestTransactionContextInterface{}
+	tc.GetStubStub = func() shim.ChaincodeStubInterface {
+		return stub
+	}
+	identity := &testsfakes.FakeTestClientIdentity{}
+	tc.GetClientIdentityReturns(identity)
+	stub.GetStateStub = func(key string) ([]byte, error) {
+		if key == rolesKey {
+			return []byte(`{"minter":"Org1MSP","admin":"Org2MSP","banks":["Org1MSP"],"governance":["Org1MSP","Org2MSP"]}`), nil
+		}
+		return []byte("INITIALIZED"), nil
+	}
+
+	for _, tt := range _GovernanceTransactions {
+		t.Run(tt.name, func(t *testing.T) {
+
+			//Prepare dynamic data
+			identity.GetMSPIDReturns(tt.mspID, nil)
+			written := map[string][]byte{}
+			stub.PutStateStub = func(key string, value []byte) error {
+				written[key] = value
+				return nil
+			}
+
+			err := tt.call(&sc, tc)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedRoles, string(written[rolesKey]))
+			}
+		})
+	}
+}
+
+// signedProposal returns a proposal invoking Initialize, as the init transaction or not
+func signedProposal(t *testing.T, isInit bool) *peer.SignedProposal {
+	input, err := proto.Marshal(&peer.ChaincodeInvocationSpec{
+		ChaincodeSpec: &peer.ChaincodeSpec{
+			Input: &peer.ChaincodeInput{Args: [][]byte{[]byte("Initialize")}, IsInit: isInit},
+		},
+	})
+	assert.NoError(t, err)
+	payload, err := proto.Marshal(&peer.ChaincodeProposalPayload{Input: input})
+	assert.NoError(t, err)
+	proposal, err := proto.Marshal(&peer.Proposal{Payload: payload})
+	assert.NoError(t, err)
+
+	return &peer.SignedProposal{ProposalBytes: proposal}
+}
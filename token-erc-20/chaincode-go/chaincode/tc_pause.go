@@ -0,0 +1,269 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define key name for the contract-wide pause switch
+const pausedKey = "paused"
+
+// Define objectType names for prefix
+const frozenPrefix = "frozen"
+
+// freezeEvent provides an organized struct for emitting Frozen and Unfrozen events
+type freezeEvent struct {
+	Account string `json:"account"`
+}
+
+// pauseEvent provides an organized struct for emitting Paused and Unpaused events
+type pauseEvent struct {
+	Admin string `json:"admin"`
+}
+
+// Pause stops all transfers, mints and burns until Unpause is called
+// Only the admin organization can pause the contract
+// This function triggers a Paused event
+func (s *SmartContract) Pause(ctx contractapi.TransactionContextInterface) error {
+	return setPaused(ctx, "Pause", true)
+}
+
+// Unpause resumes transfers, mints and burns
+// Only the admin organization can unpause the contract
+// This function triggers an Unpaused event
+func (s *SmartContract) Unpause(ctx contractapi.TransactionContextInterface) error {
+	return setPaused(ctx, "Unpause", false)
+}
+
+// Paused returns true when the contract is paused
+func (s *SmartContract) Paused(ctx contractapi.TransactionContextInterface) (bool, error) {
+
+	//check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return false, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	return isPaused(ctx)
+}
+
+// Freeze blocks the account from sending and receiving tokens
+// Only the admin organization can freeze accounts
+// This function triggers a Frozen event
+func (s *SmartContract) Freeze(ctx contractapi.TransactionContextInterface, account string) error {
+	return setFrozen(ctx, "Freeze", account, true)
+}
+
+// Unfreeze lifts the freeze of the account
+// Only the admin organization can unfreeze accounts
+// This function triggers an Unfrozen event
+func (s *SmartContract) Unfreeze(ctx contractapi.TransactionContextInterface, account string) error {
+	return setFrozen(ctx, "Unfreeze", account, false)
+}
+
+// IsFrozen returns true when the account is frozen
+func (s *SmartContract) IsFrozen(ctx contractapi.TransactionContextInterface, account string) (bool, error) {
+
+	//check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return false, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	return isFrozen(ctx, account)
+}
+
+// Helper Functions
+
+// setPaused switches the pause on or off and emits a Paused or Unpaused event
+func setPaused(ctx contractapi.TransactionContextInterface, funcName string, paused bool) error {
+
+	admin, err := checkAdmin(ctx, funcName)
+	if err != nil {
+		return err
+	}
+
+	current, err := isPaused(ctx)
+	if err != nil {
+		return err
+	}
+	if current == paused {
+		if paused {
+			return errors.New("contract is already paused")
+		}
+		return errors.New("contract is not paused")
+	}
+
+	eventName := "Unpaused"
+	if paused {
+		eventName = "Paused"
+		err = ctx.GetStub().PutState(pausedKey, []byte("true"))
+	} else {
+		err = ctx.GetStub().DelState(pausedKey)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update pause switch: %v", err)
+	}
+
+	pauseEventJSON, err := json.Marshal(pauseEvent{admin})
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent(eventName, pauseEventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	log.Printf("contract %s by %s", eventName, admin)
+
+	return nil
+}
+
+// setFrozen freezes or unfreezes the account and emits a Frozen or Unfrozen event
+func setFrozen(ctx contractapi.TransactionContextInterface, funcName string, account string, frozen bool) error {
+
+	_, err := checkAdmin(ctx, funcName)
+	if err != nil {
+		return err
+	}
+
+	if account == "" {
+		return errors.New("account must not be empty")
+	}
+
+	frozenKey, err := ctx.GetStub().CreateCompositeKey(frozenPrefix, []string{account})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", frozenPrefix, err)
+	}
+
+	current, err := isFrozen(ctx, account)
+	if err != nil {
+		return err
+	}
+	if current == frozen {
+		if frozen {
+			return fmt.Errorf("account %s is already frozen", account)
+		}
+		return fmt.Errorf("account %s is not frozen", account)
+	}
+
+	eventName := "Unfrozen"
+	if frozen {
+		eventName = "Frozen"
+		err = ctx.GetStub().PutState(frozenKey, []byte("true"))
+	} else {
+		err = ctx.GetStub().DelState(frozenKey)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", frozenKey, err)
+	}
+
+	freezeEventJSON, err := json.Marshal(freezeEvent{account})
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent(eventName, freezeEventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	log.Printf("account %s %s", account, eventName)
+
+	return nil
+}
+
+// isPaused checks the pause switch
+func isPaused(ctx contractapi.TransactionContextInterface) (bool, error) {
+
+	pausedBytes, err := ctx.GetStub().GetState(pausedKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to read pause switch from world state: %v", err)
+	}
+
+	return pausedBytes != nil, nil
+}
+
+// isFrozen checks if the account is frozen
+func isFrozen(ctx contractapi.TransactionContextInterface, account string) (bool, error) {
+
+	frozenKey, err := ctx.GetStub().CreateCompositeKey(frozenPrefix, []string{account})
+	if err != nil {
+		return false, fmt.Errorf("failed to create the composite key for prefix %s: %v", frozenPrefix, err)
+	}
+
+	frozenBytes, err := ctx.GetStub().GetState(frozenKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s from world state: %v", frozenKey, err)
+	}
+
+	return frozenBytes != nil, nil
+}
+
+// checkNotBlocked fails when the contract is paused or any of the accounts is frozen
+// It guards every balance change, transferHelper calls it for both sides of a transfer
+func checkNotBlocked(ctx contractapi.TransactionContextInterface, accounts ...string) error {
+
+	paused, err := isPaused(ctx)
+	if err != nil {
+		return err
+	}
+	if paused {
+		return errors.New("contract is paused")
+	}
+
+	for _, account := range accounts {
+		frozen, err := isFrozen(ctx, account)
+		if err != nil {
+			return err
+		}
+		if frozen {
+			return fmt.Errorf("account %s is frozen", account)
+		}
+	}
+
+	return nil
+}
+
+// checkAdmin verifies that the contract is initialized and the client belongs to the admin organization
+// The client ID is returned for logging and events
+func checkAdmin(ctx contractapi.TransactionContextInterface, funcName string) (string, error) {
+
+	//check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	roles, err := getRoles(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get MSPID: %v", err)
+	}
+	if roles.Admin == "" || clientMSPID != roles.Admin {
+		return "", fmt.Errorf("client is not authorized to call %s", funcName)
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	return clientID, nil
+}
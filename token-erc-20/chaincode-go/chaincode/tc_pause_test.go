@@ -0,0 +1,193 @@
+package chaincode
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-samples/token-erc-20/chaincode-go/chaincode/tests/testsfakes"
+	"github.com/stretchr/testify/assert"
+)
+
+var _PauseAndFreeze = []struct {
+	name          string
+	mspID         string
+	state         map[string]string
+	call          func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) error
+	expectedError string
+	expectedEvent string
+	expectedState map[string]string
+}{
+	{
+		name:  "Not an admin",
+		mspID: "Org1MSP",
+		call: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) error {
+			return sc.Pause(tc)
+		},
+		expectedError: "client is not authorized to call Pause",
+	},
+	{
+		name:  "Pause",
+		mspID: "Org2MSP",
+		call: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) error {
+			return sc.Pause(tc)
+		},
+		expectedEvent: `Paused{"admin":"ADMIN"}`,
+		expectedState: map[string]string{pausedKey: "true"},
+	},
+	{
+		name:  "Already paused",
+		mspID: "Org2MSP",
+		state: map[string]string{pausedKey: "true"},
+		call: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) error {
+			return sc.Pause(tc)
+		},
+		expectedError: "contract is already paused",
+	},
+	{
+		name:  "Unpause",
+		mspID: "Org2MSP",
+		state: map[string]string{pausedKey: "true"},
+		call: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) error {
+			return sc.Unpause(tc)
+		},
+		expectedEvent: `Unpaused{"admin":"ADMIN"}`,
+		expectedState: map[string]string{},
+	},
+	{
+		name:  "Freeze",
+		mspID: "Org2MSP",
+		call: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) error {
+			return sc.Freeze(tc, "ACCOUNT")
+		},
+		expectedEvent: `Frozen{"account":"ACCOUNT"}`,
+		expectedState: map[string]string{frozenPrefix + "ACCOUNT": "true"},
+	},
+	{
+		name:  "Unfreeze not frozen",
+		mspID: "Org2MSP",
+		call: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) error {
+			return sc.Unfreeze(tc, "ACCOUNT")
+		},
+		expectedError: "account ACCOUNT is not frozen",
+	},
+	{
+		name:  "Unfreeze",
+		mspID: "Org2MSP",
+		state: map[string]string{frozenPrefix + "ACCOUNT": "true"},
+		call: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) error {
+			return sc.Unfreeze(tc, "ACCOUNT")
+		},
+		expectedEvent: `Unfrozen{"account":"ACCOUNT"}`,
+		expectedState: map[string]string{},
+	},
+	{
+		name:  "Transfer when paused",
+		mspID: "Org1MSP",
+		state: map[string]string{pausedKey: "true", "ADMIN": "100"},
+		call: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) error {
+			return sc.Transfer(tc, "ACCOUNT", "10")
+		},
+		expectedError: "failed to transfer: contract is paused",
+	},
+	{
+		name:  "Transfer to frozen account",
+		mspID: "Org1MSP",
+		state: map[string]string{frozenPrefix + "ACCOUNT": "true", "ADMIN": "100"},
+		call: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) error {
+			return sc.Transfer(tc, "ACCOUNT", "10")
+		},
+		expectedError: "failed to transfer: account ACCOUNT is frozen",
+	},
+	{
+		name:  "Transfer from frozen account",
+		mspID: "Org1MSP",
+		state: map[string]string{frozenPrefix + "ADMIN": "true", "ADMIN": "100"},
+		call: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) error {
+			return sc.Transfer(tc, "ACCOUNT", "10")
+		},
+		expectedError: "failed to transfer: account ADMIN is frozen",
+	},
+	{
+		name:  "Mint when paused",
+		mspID: "Org1MSP",
+		state: map[string]string{pausedKey: "true"},
+		call: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) error {
+			return sc.Mint(tc, "10")
+		},
+		expectedError: "contract is paused",
+	},
+	{
+		name:  "Transfer after unfreeze",
+		mspID: "Org1MSP",
+		state: map[string]string{"ADMIN": "100"},
+		call: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) error {
+			return sc.Transfer(tc, "ACCOUNT", "10")
+		},
+		expectedEvent: `Transfer{"from":"ADMIN","to":"ACCOUNT","value":"10.00"}`,
+		expectedState: map[string]string{"ADMIN": "90.00", "ACCOUNT": "10.00"},
+	},
+}
+
+func TestPauseAndFreeze(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	stub := &testsfakes.FakeTestChaincodeStubInterface{}
+	tc := &testsfakes.FakeTestTransactionContextInterface{}
+	tc.GetStubStub = func() shim.ChaincodeStubInterface {
+		return stub
+	}
+	identity := &testsfakes.FakeTestClientIdentity{}
+	identity.GetIDReturns("ADMIN", nil)
+	tc.GetClientIdentityReturns(identity)
+	stub.CreateCompositeKeyStub = func(objectType string, attributes []string) (string, error) {
+		return objectType + strings.Join(attributes, ""), nil
+	}
+
+	for _, tt := range _PauseAndFreeze {
+		t.Run(tt.name, func(t *testing.T) {
+
+			//Prepare dynamic data
+			identity.GetMSPIDReturns(tt.mspID, nil)
+			state := map[string]string{
+				nameKey:     "name",
+				decimalsKey: "2",
+				rolesKey:    `{"minter":"Org1MSP","admin":"Org2MSP","banks":[],"governance":["Org1MSP"]}`,
+			}
+			for k, v := range tt.state {
+				state[k] = v
+			}
+			stub.GetStateStub = func(key string) ([]byte, error) {
+				if v, ok := state[key]; ok {
+					return []byte(v), nil
+				}
+				return nil, nil
+			}
+			written := map[string]string{}
+			stub.PutStateStub = func(key string, value []byte) error {
+				written[key] = string(value)
+				return nil
+			}
+			stub.DelStateStub = func(key string) error {
+				delete(written, key)
+				return nil
+			}
+			var event string
+			stub.SetEventStub = func(name string, payload []byte) error {
+				event = name + string(payload)
+				return nil
+			}
+
+			err := tt.call(&sc, tc)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				assert.Empty(t, written)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedEvent, event)
+				assert.Equal(t, tt.expectedState, written)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Balances and the total supply are snapshotted lazily, Snapshot only increments the current snapshot ID
+// The first write of a balance after a snapshot saves the value it had before the write under
+// the composite key snapshot~<balance key>~<snapshot ID>. The value at snapshot S is then the value
+// saved under the lowest snapshot ID >= S, or the current value when nothing changed since S.
+
+// Define key name for the current snapshot ID
+const snapshotIDKey = "snapshotID"
+
+// Define objectType names for prefix
+const snapshotPrefix = "snapshot"
+
+// snapshotEvent provides an organized struct for emitting Snapshot events
+type snapshotEvent struct {
+	ID int `json:"id"`
+}
+
+// Snapshot records a new snapshot of all balances and the total supply and returns its ID
+// Only the admin organization can take snapshots
+// This function triggers a Snapshot event
+func (s *SmartContract) Snapshot(ctx contractapi.TransactionContextInterface) (int, error) {
+
+	_, err := checkAdmin(ctx, "Snapshot")
+	if err != nil {
+		return 0, err
+	}
+
+	snapshotID, err := getSnapshotID(ctx)
+	if err != nil {
+		return 0, err
+	}
+	snapshotID++
+
+	err = ctx.GetStub().PutState(snapshotIDKey, []byte(strconv.Itoa(snapshotID)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to update snapshot ID: %v", err)
+	}
+
+	snapshotEventJSON, err := json.Marshal(snapshotEvent{snapshotID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent("Snapshot", snapshotEventJSON)
+	if err != nil {
+		return 0, fmt.Errorf("failed to set event: %v", err)
+	}
+
+	log.Printf("snapshot %d taken", snapshotID)
+
+	return snapshotID, nil
+}
+
+// CurrentSnapshotID returns the ID of the latest snapshot, 0 when no snapshot has been taken
+func (s *SmartContract) CurrentSnapshotID(ctx contractapi.TransactionContextInterface) (int, error) {
+
+	//check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return 0, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	return getSnapshotID(ctx)
+}
+
+// BalanceOfAt returns the balance the account had when the snapshot was taken
+func (s *SmartContract) BalanceOfAt(ctx contractapi.TransactionContextInterface, account string, snapshotID int) (string, error) {
+
+	//check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	return valueAt(ctx, account, snapshotID)
+}
+
+// TotalSupplyAt returns the total token supply when the snapshot was taken
+func (s *SmartContract) TotalSupplyAt(ctx contractapi.TransactionContextInterface, snapshotID int) (string, error) {
+
+	//check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	return valueAt(ctx, totalSupplyKey, snapshotID)
+}
+
+// Helper Functions
+
+// getSnapshotID reads the current snapshot ID
+func getSnapshotID(ctx contractapi.TransactionContextInterface) (int, error) {
+
+	snapshotIDBytes, err := ctx.GetStub().GetState(snapshotIDKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read snapshot ID from world state: %v", err)
+	}
+	if snapshotIDBytes == nil {
+		return 0, nil
+	}
+
+	snapshotID, _ := strconv.Atoi(string(snapshotIDBytes)) // Error handling not needed since Itoa() was used when setting the snapshot ID, guaranteeing it was an integer.
+
+	return snapshotID, nil
+}
+
+// putBalance writes the updated balance (or total supply) stored under the key
+// The current value is saved first if this is the first write of the key since the latest snapshot
+// Balances in delta balance mode get a delta row instead
+func putBalance(ctx contractapi.TransactionContextInterface, key string, current *big.Int, updated *big.Int, decimals int) error {
+
+	if current == nil {
+		current = new(big.Int)
+	}
+
+	err := snapshotBalance(ctx, key, func() (*big.Int, error) { return current, nil }, decimals)
+	if err != nil {
+		return err
+	}
+
+	delta, err := isDeltaBalance(ctx, key)
+	if err != nil {
+		return err
+	}
+	if delta {
+		switch updated.Cmp(current) {
+		case 1:
+			return putDelta(ctx, key, "+", new(big.Int).Sub(updated, current), decimals)
+		case -1:
+			return putDelta(ctx, key, "-", new(big.Int).Sub(current, updated), decimals)
+		}
+		return nil
+	}
+
+	return putAmount(ctx, key, updated, decimals)
+}
+
+// snapshotBalance saves the value stored under the key if this is its first write since the latest snapshot
+// The current value is only read when it has to be saved
+func snapshotBalance(ctx contractapi.TransactionContextInterface, key string, current func() (*big.Int, error), decimals int) error {
+
+	snapshotID, err := getSnapshotID(ctx)
+	if err != nil {
+		return err
+	}
+	if snapshotID == 0 {
+		return nil
+	}
+
+	snapshotKey, err := ctx.GetStub().CreateCompositeKey(snapshotPrefix, []string{key, formatSnapshotID(snapshotID)})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", snapshotPrefix, err)
+	}
+
+	snapshotBytes, err := ctx.GetStub().GetState(snapshotKey)
+	if err != nil {
+		return fmt.Errorf("failed to read %s from world state: %v", snapshotKey, err)
+	}
+	if snapshotBytes != nil {
+		return nil
+	}
+
+	value, err := current()
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		value = new(big.Int)
+	}
+
+	return putAmount(ctx, snapshotKey, value, decimals)
+}
+
+// valueAt returns the value stored under the key at the snapshot
+func valueAt(ctx contractapi.TransactionContextInterface, key string, snapshotID int) (string, error) {
+
+	currentSnapshotID, err := getSnapshotID(ctx)
+	if err != nil {
+		return "", err
+	}
+	if snapshotID <= 0 || snapshotID > currentSnapshotID {
+		return "", fmt.Errorf("snapshot %d does not exist", snapshotID)
+	}
+
+	decimals, err := getDecimals(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// Snapshots of the key are returned in ascending order of their IDs thanks to formatSnapshotID
+	snapshotIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(snapshotPrefix, []string{key})
+	if err != nil {
+		return "", fmt.Errorf("failed to get snapshots of %s: %v", key, err)
+	}
+	defer snapshotIterator.Close()
+
+	for snapshotIterator.HasNext() {
+		snapshot, err := snapshotIterator.Next()
+		if err != nil {
+			return "", fmt.Errorf("failed to get snapshot of %s: %v", key, err)
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(snapshot.Key)
+		if err != nil {
+			return "", fmt.Errorf("failed to split composite key %s: %v", snapshot.Key, err)
+		}
+		if len(attributes) != 2 || attributes[0] != key {
+			continue
+		}
+
+		id, err := strconv.Atoi(attributes[1])
+		if err != nil {
+			return "", fmt.Errorf("invalid snapshot ID %s: %v", attributes[1], err)
+		}
+		if id >= snapshotID {
+			value, err := parseAmount(string(snapshot.Value), decimals)
+			if err != nil {
+				return "", fmt.Errorf("failed to parse snapshot of %s: %v", key, err)
+			}
+			return formatAmount(value, decimals), nil
+		}
+	}
+
+	// The value hasn't changed since the snapshot
+	value, err := getBalance(ctx, key, decimals)
+	if err != nil {
+		return "", err
+	}
+	if value == nil {
+		value = new(big.Int)
+	}
+
+	return formatAmount(value, decimals), nil
+}
+
+// formatSnapshotID pads the snapshot ID with zeros, so composite keys sort in the order of snapshots
+func formatSnapshotID(snapshotID int) string {
+	return fmt.Sprintf("%020d", snapshotID)
+}
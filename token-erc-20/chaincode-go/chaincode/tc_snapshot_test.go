@@ -0,0 +1,217 @@
+package chaincode
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-samples/token-erc-20/chaincode-go/chaincode/tests/testsfakes"
+	"github.com/stretchr/testify/assert"
+)
+
+// Backs the stub with an in-memory world state, composite keys are built the same way as by the peer
+func withWorldState(stub *testsfakes.FakeTestChaincodeStubInterface, state map[string][]byte) {
+	stub.GetStateStub = func(key string) ([]byte, error) {
+		return state[key], nil
+	}
+	stub.PutStateStub = func(key string, value []byte) error {
+		state[key] = value
+		return nil
+	}
+	stub.DelStateStub = func(key string) error {
+		delete(state, key)
+		return nil
+	}
+	stub.CreateCompositeKeyStub = func(objectType string, attributes []string) (string, error) {
+		for _, attribute := range append([]string{objectType}, attributes...) {
+			err := validateCompositeKeyAttribute(attribute)
+			if err != nil {
+				return "", err
+			}
+		}
+		return "\x00" + objectType + "\x00" + strings.Join(append(attributes, ""), "\x00"), nil
+	}
+	stub.SplitCompositeKeyStub = func(compositeKey string) (string, []string, error) {
+		parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(compositeKey, "\x00"), "\x00"), "\x00")
+		return parts[0], parts[1:], nil
+	}
+	stub.GetStateByPartialCompositeKeyStub = func(objectType string, attributes []string) (shim.StateQueryIteratorInterface, error) {
+		prefix, _ := stub.CreateCompositeKey(objectType, attributes)
+		keys := []string{}
+		for key := range state {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		iterator := &testsfakes.FakeTestStateQueryIterator{}
+		iterator.HasNextStub = func() bool {
+			return len(keys) > 0
+		}
+		iterator.NextStub = func() (*queryresult.KV, error) {
+			key := keys[0]
+			keys = keys[1:]
+			return &queryresult.KV{Key: key, Value: state[key]}, nil
+		}
+		return iterator, nil
+	}
+}
+
+// Rejects the attributes of composite keys the peer rejects, i.e. invalid UTF-8 and U+0000 or U+10FFFF
+func validateCompositeKeyAttribute(attribute string) error {
+	if !utf8.ValidString(attribute) {
+		return fmt.Errorf("not a valid utf8 string: [%x]", attribute)
+	}
+	for index, runeValue := range attribute {
+		if runeValue == 0 || runeValue == utf8.MaxRune {
+			return fmt.Errorf("input contains unicode %#U starting at position [%d]. %#U and %#U are not allowed in the input attribute of a composite key",
+				runeValue, index, rune(0), utf8.MaxRune)
+		}
+	}
+	return nil
+}
+
+// Queries after: Mint 100, Snapshot 1, Transfer 30 and 20, Snapshot 2, Burn 10, Snapshot 3
+var _SnapshotQueries = []struct {
+	name          string
+	query         func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) (string, error)
+	expected      string
+	expectedError string
+}{
+	{
+		name: "Minter balance at snapshot 1",
+		query: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) (string, error) {
+			return sc.BalanceOfAt(tc, "MINTER", 1)
+		},
+		expected: "100.00",
+	},
+	{
+		name: "Recipient balance at snapshot 1",
+		query: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) (string, error) {
+			return sc.BalanceOfAt(tc, "RECIPIENT", 1)
+		},
+		expected: "0.00",
+	},
+	{
+		name: "Minter balance at snapshot 2",
+		query: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) (string, error) {
+			return sc.BalanceOfAt(tc, "MINTER", 2)
+		},
+		expected: "50.00",
+	},
+	{
+		name: "Recipient balance at snapshot 2",
+		query: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) (string, error) {
+			return sc.BalanceOfAt(tc, "RECIPIENT", 2)
+		},
+		expected: "50.00",
+	},
+	{
+		name: "Balance not changed since snapshot",
+		query: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) (string, error) {
+			return sc.BalanceOfAt(tc, "MINTER", 3)
+		},
+		expected: "40.00",
+	},
+	{
+		name: "Unknown account",
+		query: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) (string, error) {
+			return sc.BalanceOfAt(tc, "UNKNOWN", 1)
+		},
+		expected: "0.00",
+	},
+	{
+		name: "Total supply at snapshot 2",
+		query: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) (string, error) {
+			return sc.TotalSupplyAt(tc, 2)
+		},
+		expected: "100.00",
+	},
+	{
+		name: "Total supply at snapshot 3",
+		query: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) (string, error) {
+			return sc.TotalSupplyAt(tc, 3)
+		},
+		expected: "90.00",
+	},
+	{
+		name: "Snapshot does not exist",
+		query: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) (string, error) {
+			return sc.TotalSupplyAt(tc, 4)
+		},
+		expectedError: "snapshot 4 does not exist",
+	},
+	{
+		name: "Snapshot 0 does not exist",
+		query: func(sc *SmartContract, tc *testsfakes.FakeTestTransactionContextInterface) (string, error) {
+			return sc.BalanceOfAt(tc, "MINTER", 0)
+		},
+		expectedError: "snapshot 0 does not exist",
+	},
+}
+
+func TestSnapshot(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	stub := &testsfakes.FakeTestChaincodeStubInterface{}
+	tc := &testsfakes.FakeTestTransactionContextInterface{}
+	tc.GetStubStub = func() shim.ChaincodeStubInterface {
+		return stub
+	}
+	identity := &testsfakes.FakeTestClientIdentity{}
+	identity.GetIDReturns("MINTER", nil)
+	tc.GetClientIdentityReturns(identity)
+	state := map[string][]byte{
+		nameKey:     []byte("name"),
+		decimalsKey: []byte("2"),
+		rolesKey:    []byte(`{"minter":"Org1MSP","admin":"Org1MSP","banks":[],"governance":["Org1MSP"]}`),
+	}
+	withWorldState(stub, state)
+	minterSnapshot1, _ := stub.CreateCompositeKey(snapshotPrefix, []string{"MINTER", formatSnapshotID(1)})
+
+	identity.GetMSPIDReturns("Org2MSP", nil)
+	_, err := sc.Snapshot(tc)
+	assert.EqualError(t, err, "client is not authorized to call Snapshot")
+
+	identity.GetMSPIDReturns("Org1MSP", nil)
+	assert.NoError(t, sc.Mint(tc, "100"))
+
+	snapshotID, err := sc.Snapshot(tc)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, snapshotID)
+
+	//only the first write after the snapshot saves the balance
+	assert.NoError(t, sc.Transfer(tc, "RECIPIENT", "30"))
+	assert.Equal(t, "100.00", string(state[minterSnapshot1]))
+	assert.NoError(t, sc.Transfer(tc, "RECIPIENT", "20"))
+	assert.Equal(t, "100.00", string(state[minterSnapshot1]))
+
+	snapshotID, err = sc.Snapshot(tc)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, snapshotID)
+
+	assert.NoError(t, sc.Burn(tc, "10"))
+
+	snapshotID, err = sc.Snapshot(tc)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, snapshotID)
+
+	for _, tt := range _SnapshotQueries {
+		t.Run(tt.name, func(t *testing.T) {
+
+			value, err := tt.query(&sc, tc)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, value)
+			}
+		})
+	}
+}
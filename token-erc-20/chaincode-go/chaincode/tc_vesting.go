@@ -0,0 +1,315 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Tokens of a vesting schedule are locked in an escrow account, i.e. a balance key of its own
+// (vestingEscrow_<schedule ID>), so they are moved with transferHelper like any other balance.
+// The account is a plain key: accounts are nested in composite keys (frozen, delta and snapshot keys),
+// whose attributes must not contain U+0000. Client IDs are base64 encoded, so they never contain '_'.
+// The schedule itself is stored under the composite key vesting~<beneficiary>~<schedule ID>.
+
+// Define objectType names for prefix
+const vestingPrefix = "vesting"
+const vestingEscrowPrefix = "vestingEscrow"
+
+// VestingSchedule describes tokens locked for the beneficiary
+// Tokens vest linearly from Start over Duration seconds, nothing vests before Start + Cliff
+type VestingSchedule struct {
+	ID          string `json:"id"`
+	Funder      string `json:"funder"`
+	Beneficiary string `json:"beneficiary"`
+	Amount      string `json:"amount"`
+	Released    string `json:"released"`
+	Start       int64  `json:"start"`
+	Cliff       int64  `json:"cliff"`
+	Duration    int64  `json:"duration"`
+	Releasable  string `json:"releasable,omitempty"`
+}
+
+// vestingReleaseEvent provides an organized struct for emitting VestingReleased events
+type vestingReleaseEvent struct {
+	ID          string `json:"id"`
+	Beneficiary string `json:"beneficiary"`
+	Value       string `json:"value"`
+}
+
+// CreateVestingSchedule locks amount tokens of the calling client for the beneficiary and returns the schedule ID
+// param {String} beneficiary The account receiving the tokens as they vest
+// param {String} amount The decimal amount of tokens to lock
+// param {Number} start The vesting start, in seconds since the Unix epoch
+// param {Number} cliff The number of seconds after start before which nothing can be released
+// param {Number} duration The number of seconds after start when all tokens are vested
+// This function triggers a VestingScheduleCreated event
+func (s *SmartContract) CreateVestingSchedule(ctx contractapi.TransactionContextInterface, beneficiary string, amount string, start int64, cliff int64, duration int64) (string, error) {
+
+	//check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	if beneficiary == "" {
+		return "", errors.New("beneficiary must not be empty")
+	}
+	if duration <= 0 {
+		return "", errors.New("vesting duration must be positive")
+	}
+	if cliff < 0 || cliff > duration {
+		return "", errors.New("vesting cliff must be between 0 and duration")
+	}
+
+	decimals, err := getDecimals(ctx)
+	if err != nil {
+		return "", err
+	}
+	value, err := parseAmount(amount, decimals)
+	if err != nil {
+		return "", err
+	}
+	if value.Sign() <= 0 {
+		return "", errors.New("vesting amount must be a positive number")
+	}
+
+	// Get ID of submitting client identity
+	funder, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	schedule := VestingSchedule{
+		ID:          ctx.GetStub().GetTxID(),
+		Funder:      funder,
+		Beneficiary: beneficiary,
+		Amount:      formatAmount(value, decimals),
+		Released:    formatAmount(new(big.Int), decimals),
+		Start:       start,
+		Cliff:       cliff,
+		Duration:    duration,
+	}
+
+	// Lock the tokens
+	err = transferHelper(ctx, funder, vestingEscrowAccount(schedule.ID), value)
+	if err != nil {
+		return "", fmt.Errorf("failed to lock tokens: %v", err)
+	}
+
+	scheduleJSON, err := putVestingSchedule(ctx, &schedule)
+	if err != nil {
+		return "", err
+	}
+
+	err = ctx.GetStub().SetEvent("VestingScheduleCreated", scheduleJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to set event: %v", err)
+	}
+
+	log.Printf("vesting schedule %s of %s tokens created for %s", schedule.ID, schedule.Amount, beneficiary)
+
+	return schedule.ID, nil
+}
+
+// Release transfers the tokens vested so far (at the transaction timestamp) from the schedule to the calling client
+// Only the beneficiary of the schedule can release it
+// This function triggers a VestingReleased event
+func (s *SmartContract) Release(ctx contractapi.TransactionContextInterface, scheduleID string) (string, error) {
+
+	//check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	// Get ID of submitting client identity
+	beneficiary, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	scheduleKey, err := ctx.GetStub().CreateCompositeKey(vestingPrefix, []string{beneficiary, scheduleID})
+	if err != nil {
+		return "", fmt.Errorf("failed to create the composite key for prefix %s: %v", vestingPrefix, err)
+	}
+	scheduleBytes, err := ctx.GetStub().GetState(scheduleKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to read vesting schedule from world state: %v", err)
+	}
+	if scheduleBytes == nil {
+		return "", fmt.Errorf("vesting schedule %s not found for client", scheduleID)
+	}
+
+	var schedule VestingSchedule
+	err = json.Unmarshal(scheduleBytes, &schedule)
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal vesting schedule: %v", err)
+	}
+
+	decimals, err := getDecimals(ctx)
+	if err != nil {
+		return "", err
+	}
+	released, err := parseAmount(schedule.Released, decimals)
+	if err != nil {
+		return "", err
+	}
+	releasable, err := releasableAmount(ctx, &schedule, decimals)
+	if err != nil {
+		return "", err
+	}
+	if releasable.Sign() == 0 {
+		return "", errors.New("no tokens are due for release")
+	}
+
+	err = transferHelper(ctx, vestingEscrowAccount(schedule.ID), beneficiary, releasable)
+	if err != nil {
+		return "", fmt.Errorf("failed to release tokens: %v", err)
+	}
+
+	released, err = add(released, releasable)
+	if err != nil {
+		return "", err
+	}
+	schedule.Released = formatAmount(released, decimals)
+	_, err = putVestingSchedule(ctx, &schedule)
+	if err != nil {
+		return "", err
+	}
+
+	// Emit the VestingReleased event
+	releaseEvent := vestingReleaseEvent{schedule.ID, beneficiary, formatAmount(releasable, decimals)}
+	releaseEventJSON, err := json.Marshal(releaseEvent)
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent("VestingReleased", releaseEventJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to set event: %v", err)
+	}
+
+	log.Printf("%s tokens of vesting schedule %s released, %s of %s released so far", formatAmount(releasable, decimals), schedule.ID, schedule.Released, schedule.Amount)
+
+	return formatAmount(releasable, decimals), nil
+}
+
+// VestingSchedules returns all vesting schedules of the beneficiary
+// Releasable is the amount that can be released at the time of the query
+func (s *SmartContract) VestingSchedules(ctx contractapi.TransactionContextInterface, beneficiary string) ([]*VestingSchedule, error) {
+
+	//check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return nil, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	decimals, err := getDecimals(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	scheduleIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(vestingPrefix, []string{beneficiary})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vesting schedules: %v", err)
+	}
+	defer scheduleIterator.Close()
+
+	schedules := []*VestingSchedule{}
+	for scheduleIterator.HasNext() {
+		scheduleKV, err := scheduleIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get vesting schedule: %v", err)
+		}
+
+		var schedule VestingSchedule
+		err = json.Unmarshal(scheduleKV.Value, &schedule)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal vesting schedule: %v", err)
+		}
+
+		releasable, err := releasableAmount(ctx, &schedule, decimals)
+		if err != nil {
+			return nil, err
+		}
+		schedule.Releasable = formatAmount(releasable, decimals)
+
+		schedules = append(schedules, &schedule)
+	}
+
+	return schedules, nil
+}
+
+// Helper Functions
+
+// vestingEscrowAccount returns the account the tokens of a vesting schedule are locked in
+func vestingEscrowAccount(scheduleID string) string {
+	return vestingEscrowPrefix + "_" + scheduleID
+}
+
+// putVestingSchedule writes the schedule to the world state and returns its JSON
+func putVestingSchedule(ctx contractapi.TransactionContextInterface, schedule *VestingSchedule) ([]byte, error) {
+
+	scheduleKey, err := ctx.GetStub().CreateCompositeKey(vestingPrefix, []string{schedule.Beneficiary, schedule.ID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", vestingPrefix, err)
+	}
+
+	scheduleJSON, err := json.Marshal(schedule)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(scheduleKey, scheduleJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to put vesting schedule: %v", err)
+	}
+
+	return scheduleJSON, nil
+}
+
+// releasableAmount computes the amount vested at the transaction timestamp minus the amount already released
+func releasableAmount(ctx contractapi.TransactionContextInterface, schedule *VestingSchedule, decimals int) (*big.Int, error) {
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := parseAmount(schedule.Amount, decimals)
+	if err != nil {
+		return nil, err
+	}
+	released, err := parseAmount(schedule.Released, decimals)
+	if err != nil {
+		return nil, err
+	}
+
+	vested := new(big.Int)
+	elapsed := now - schedule.Start
+	switch {
+	case elapsed < schedule.Cliff:
+		// nothing vests before the cliff
+	case elapsed >= schedule.Duration:
+		vested.Set(amount)
+	default:
+		// linear vesting, rounded down to the smallest unit
+		vested.Mul(amount, big.NewInt(elapsed))
+		vested.Quo(vested, big.NewInt(schedule.Duration))
+	}
+
+	return sub(vested, released)
+}
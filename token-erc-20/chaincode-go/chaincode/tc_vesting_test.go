@@ -0,0 +1,243 @@
+package chaincode
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-samples/token-erc-20/chaincode-go/chaincode/tests/testsfakes"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var _CreateVestingSchedule = []struct {
+	name          string
+	amount        string
+	cliff         int64
+	duration      int64
+	expectedError string
+}{
+	{
+		name:          "No duration",
+		amount:        "100",
+		expectedError: "vesting duration must be positive",
+	},
+	{
+		name:          "Cliff after end",
+		amount:        "100",
+		cliff:         2000,
+		duration:      1000,
+		expectedError: "vesting cliff must be between 0 and duration",
+	},
+	{
+		name:          "Zero amount",
+		amount:        "0",
+		duration:      1000,
+		expectedError: "vesting amount must be a positive number",
+	},
+	{
+		name:          "Insufficient funds",
+		amount:        "1000.01",
+		duration:      1000,
+		expectedError: "failed to lock tokens: client account FUNDER has insufficient funds",
+	},
+}
+
+// Releases of a schedule of 100 tokens starting at 1000, with cliff 100 and duration 1000
+var _Release = []struct {
+	name          string
+	now           int64
+	client        string
+	expected      string
+	expectedError string
+}{
+	{
+		name:          "Before cliff",
+		now:           1050,
+		client:        "BENEFICIARY",
+		expectedError: "no tokens are due for release",
+	},
+	{
+		name:          "Not a beneficiary",
+		now:           1250,
+		client:        "FUNDER",
+		expectedError: "vesting schedule TX1 not found for client",
+	},
+	{
+		name:     "After cliff",
+		now:      1250,
+		client:   "BENEFICIARY",
+		expected: "25.00",
+	},
+	{
+		name:          "Already released",
+		now:           1250,
+		client:        "BENEFICIARY",
+		expectedError: "no tokens are due for release",
+	},
+	{
+		name:     "Rounded down",
+		now:      1333,
+		client:   "BENEFICIARY",
+		expected: "8.30",
+	},
+	{
+		name:     "After end",
+		now:      5000,
+		client:   "BENEFICIARY",
+		expected: "66.70",
+	},
+}
+
+func TestCreateVestingSchedule(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	stub := &testsfakes.FakeTestChaincodeStubInterface{}
+	tc := &testsfakes.FakeTestTransactionContextInterface{}
+	tc.GetStubStub = func() shim.ChaincodeStubInterface {
+		return stub
+	}
+	identity := &testsfakes.FakeTestClientIdentity{}
+	identity.GetIDReturns("FUNDER", nil)
+	tc.GetClientIdentityReturns(identity)
+
+	for _, tt := range _CreateVestingSchedule {
+		t.Run(tt.name, func(t *testing.T) {
+
+			//Prepare dynamic data
+			withWorldState(stub, map[string][]byte{
+				nameKey:     []byte("name"),
+				decimalsKey: []byte("2"),
+				"FUNDER":    []byte("1000.00"),
+			})
+
+			_, err := sc.CreateVestingSchedule(tc, "BENEFICIARY", tt.amount, 1000, tt.cliff, tt.duration)
+			assert.EqualError(t, err, tt.expectedError)
+		})
+	}
+}
+
+func TestRelease(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	stub := &testsfakes.FakeTestChaincodeStubInterface{}
+	tc := &testsfakes.FakeTestTransactionContextInterface{}
+	tc.GetStubStub = func() shim.ChaincodeStubInterface {
+		return stub
+	}
+	identity := &testsfakes.FakeTestClientIdentity{}
+	tc.GetClientIdentityReturns(identity)
+	state := map[string][]byte{
+		nameKey:     []byte("name"),
+		decimalsKey: []byte("2"),
+		"FUNDER":    []byte("1000.00"),
+	}
+	withWorldState(stub, state)
+	stub.GetTxIDReturns("TX1")
+	withTxTime(stub, 500)
+	escrowKey := vestingEscrowAccount("TX1")
+
+	identity.GetIDReturns("FUNDER", nil)
+	scheduleID, err := sc.CreateVestingSchedule(tc, "BENEFICIARY", "100", 1000, 100, 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, "TX1", scheduleID)
+	assert.Equal(t, "900.00", string(state["FUNDER"]))
+	assert.Equal(t, "100.00", string(state[escrowKey]))
+
+	for _, tt := range _Release {
+		t.Run(tt.name, func(t *testing.T) {
+
+			//Prepare dynamic data
+			identity.GetIDReturns(tt.client, nil)
+			withTxTime(stub, tt.now)
+
+			released, err := sc.Release(tc, "TX1")
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, released)
+			}
+		})
+	}
+
+	assert.Equal(t, "100.00", string(state["BENEFICIARY"]))
+	assert.Equal(t, "0.00", string(state[escrowKey]))
+}
+
+func TestReleaseSkewedTimestamp(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	stub := &testsfakes.FakeTestChaincodeStubInterface{}
+	tc := &testsfakes.FakeTestTransactionContextInterface{}
+	tc.GetStubStub = func() shim.ChaincodeStubInterface {
+		return stub
+	}
+	identity := &testsfakes.FakeTestClientIdentity{}
+	tc.GetClientIdentityReturns(identity)
+	state := map[string][]byte{
+		nameKey:     []byte("name"),
+		decimalsKey: []byte("2"),
+		"FUNDER":    []byte("1000.00"),
+	}
+	withWorldState(stub, state)
+	stub.GetTxIDReturns("TX1")
+	withTxTime(stub, 500)
+
+	identity.GetIDReturns("FUNDER", nil)
+	_, err := sc.CreateVestingSchedule(tc, "BENEFICIARY", "100", 1000, 0, 1000)
+	assert.NoError(t, err)
+
+	//the beneficiary sets a timestamp in the year 3000 while the peer is still before the start
+	identity.GetIDReturns("BENEFICIARY", nil)
+	stub.GetTxTimestampReturns(&timestamppb.Timestamp{Seconds: 32503680000}, nil)
+
+	_, err = sc.Release(tc, "TX1")
+	assert.EqualError(t, err, "transaction timestamp 32503680000 is more than 30s away from the time of the peer")
+	assert.Nil(t, state["BENEFICIARY"])
+	assert.Equal(t, "100.00", string(state[vestingEscrowAccount("TX1")]))
+
+	//a timestamp within the skew is accepted
+	stub.GetTxTimestampReturns(&timestamppb.Timestamp{Seconds: 530}, nil)
+	_, err = sc.Release(tc, "TX1")
+	assert.EqualError(t, err, "no tokens are due for release")
+}
+
+func TestVestingSchedules(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	stub := &testsfakes.FakeTestChaincodeStubInterface{}
+	tc := &testsfakes.FakeTestTransactionContextInterface{}
+	tc.GetStubStub = func() shim.ChaincodeStubInterface {
+		return stub
+	}
+	identity := &testsfakes.FakeTestClientIdentity{}
+	identity.GetIDReturns("FUNDER", nil)
+	tc.GetClientIdentityReturns(identity)
+	withWorldState(stub, map[string][]byte{
+		nameKey:     []byte("name"),
+		decimalsKey: []byte("2"),
+		"FUNDER":    []byte("1000.00"),
+	})
+
+	stub.GetTxIDReturns("TX1")
+	_, err := sc.CreateVestingSchedule(tc, "BENEFICIARY", "100", 1000, 0, 1000)
+	assert.NoError(t, err)
+	stub.GetTxIDReturns("TX2")
+	_, err = sc.CreateVestingSchedule(tc, "BENEFICIARY", "10", 2000, 0, 1000)
+	assert.NoError(t, err)
+	stub.GetTxIDReturns("TX3")
+	_, err = sc.CreateVestingSchedule(tc, "SOMEONE_ELSE", "10", 2000, 0, 1000)
+	assert.NoError(t, err)
+
+	withTxTime(stub, 1500)
+	schedules, err := sc.VestingSchedules(tc, "BENEFICIARY")
+	assert.NoError(t, err)
+	assert.Equal(t, []*VestingSchedule{
+		{ID: "TX1", Funder: "FUNDER", Beneficiary: "BENEFICIARY", Amount: "100.00", Released: "0.00", Start: 1000, Duration: 1000, Releasable: "50.00"},
+		{ID: "TX2", Funder: "FUNDER", Beneficiary: "BENEFICIARY", Amount: "10.00", Released: "0.00", Start: 2000, Duration: 1000, Releasable: "0.00"},
+	}, schedules)
+}
@@ -20,3 +20,8 @@ type TestChaincodeStubInterface interface {
 type TestClientIdentity interface {
 	cid.ClientIdentity
 }
+
+//go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 . TestStateQueryIterator
+type TestStateQueryIterator interface {
+	shim.StateQueryIteratorInterface
+}
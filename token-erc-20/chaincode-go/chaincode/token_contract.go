@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"strconv"
+	"math/big"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/peer"
 )
 
 // Define key names for options
@@ -30,12 +32,13 @@ type SmartContract struct {
 type event struct {
 	From  string `json:"from"`
 	To    string `json:"to"`
-	Value int    `json:"value"`
+	Value string `json:"value"`
 }
 
 // Mint creates new tokens and adds them to minter's account balance
+// amount is a decimal string with up to decimals places
 // This function triggers a Transfer event
-func (s *SmartContract) Mint(ctx contractapi.TransactionContextInterface, amount int) error {
+func (s *SmartContract) Mint(ctx contractapi.TransactionContextInterface, amount string) error {
 
 	//check if contract has been intilized first
 	initialized, err := checkInitialized(ctx)
@@ -46,13 +49,10 @@ func (s *SmartContract) Mint(ctx contractapi.TransactionContextInterface, amount
 		return fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
 	}
 
-	// Check minter authorization - this sample assumes Org1 is the central banker with privilege to mint new tokens
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	// Check minter authorization - the minter organization is set at Initialize and can be changed by governance (see SetMinter)
+	err = checkMinter(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get MSPID: %v", err)
-	}
-	if clientMSPID != "Org1MSP" {
-		return fmt.Errorf("client is not authorized to mint new tokens")
+		return err
 	}
 
 	// Get ID of submitting client identity
@@ -61,62 +61,69 @@ func (s *SmartContract) Mint(ctx contractapi.TransactionContextInterface, amount
 		return fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	if amount <= 0 {
-		return fmt.Errorf("mint amount must be a positive integer")
+	decimals, err := getDecimals(ctx)
+	if err != nil {
+		return err
 	}
 
-	currentBalanceBytes, err := ctx.GetStub().GetState(minter)
+	value, err := parseAmount(amount, decimals)
 	if err != nil {
-		return fmt.Errorf("failed to read minter account %s from world state: %v", minter, err)
+		return err
+	}
+	if value.Sign() <= 0 {
+		return fmt.Errorf("mint amount must be a positive number")
+	}
+
+	// Check that the contract is not paused and the minter account is not frozen
+	err = checkNotBlocked(ctx, minter)
+	if err != nil {
+		return err
 	}
 
-	var currentBalance int
+	currentBalance, err := getBalance(ctx, minter, decimals)
+	if err != nil {
+		return fmt.Errorf("failed to read minter account %s from world state: %v", minter, err)
+	}
 
 	// If minter current balance doesn't yet exist, we'll create it with a current balance of 0
-	if currentBalanceBytes == nil {
-		currentBalance = 0
-	} else {
-		currentBalance, _ = strconv.Atoi(string(currentBalanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
+	if currentBalance == nil {
+		currentBalance = new(big.Int)
 	}
 
-	updatedBalance, err := add(currentBalance, amount)
+	updatedBalance, err := add(currentBalance, value)
 	if err != nil {
 		return err
 	}
 
-	err = ctx.GetStub().PutState(minter, []byte(strconv.Itoa(updatedBalance)))
+	err = putBalance(ctx, minter, currentBalance, updatedBalance, decimals)
 	if err != nil {
 		return err
 	}
 
 	// Update the totalSupply
-	totalSupplyBytes, err := ctx.GetStub().GetState(totalSupplyKey)
+	totalSupply, err := getAmount(ctx, totalSupplyKey, decimals)
 	if err != nil {
 		return fmt.Errorf("failed to retrieve total token supply: %v", err)
 	}
 
-	var totalSupply int
-
 	// If no tokens have been minted, initialize the totalSupply
-	if totalSupplyBytes == nil {
-		totalSupply = 0
-	} else {
-		totalSupply, _ = strconv.Atoi(string(totalSupplyBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
+	if totalSupply == nil {
+		totalSupply = new(big.Int)
 	}
 
 	// Add the mint amount to the total supply and update the state
-	totalSupply, err = add(totalSupply, amount)
+	updatedTotalSupply, err := add(totalSupply, value)
 	if err != nil {
 		return err
 	}
 
-	err = ctx.GetStub().PutState(totalSupplyKey, []byte(strconv.Itoa(totalSupply)))
+	err = putBalance(ctx, totalSupplyKey, totalSupply, updatedTotalSupply, decimals)
 	if err != nil {
 		return err
 	}
 
 	// Emit the Transfer event
-	transferEvent := event{"0x0", minter, amount}
+	transferEvent := event{"0x0", minter, formatAmount(value, decimals)}
 	transferEventJSON, err := json.Marshal(transferEvent)
 	if err != nil {
 		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
@@ -126,14 +133,15 @@ func (s *SmartContract) Mint(ctx contractapi.TransactionContextInterface, amount
 		return fmt.Errorf("failed to set event: %v", err)
 	}
 
-	log.Printf("minter account %s balance updated from %d to %d", minter, currentBalance, updatedBalance)
+	log.Printf("minter account %s balance updated from %s to %s", minter, formatAmount(currentBalance, decimals), formatAmount(updatedBalance, decimals))
 
 	return nil
 }
 
 // Burn redeems tokens the minter's account balance
+// amount is a decimal string with up to decimals places
 // This function triggers a Transfer event
-func (s *SmartContract) Burn(ctx contractapi.TransactionContextInterface, amount int) error {
+func (s *SmartContract) Burn(ctx contractapi.TransactionContextInterface, amount string) error {
 
 	//check if contract has been intilized first
 	initialized, err := checkInitialized(ctx)
@@ -143,13 +151,10 @@ func (s *SmartContract) Burn(ctx contractapi.TransactionContextInterface, amount
 	if !initialized {
 		return fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
 	}
-	// Check minter authorization - this sample assumes Org1 is the central banker with privilege to burn new tokens
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	// Check minter authorization - only the minter organization has privilege to burn tokens
+	err = checkMinter(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get MSPID: %v", err)
-	}
-	if clientMSPID != "Org1MSP" {
-		return fmt.Errorf("client is not authorized to mint new tokens")
+		return err
 	}
 
 	// Get ID of submitting client identity
@@ -158,60 +163,69 @@ func (s *SmartContract) Burn(ctx contractapi.TransactionContextInterface, amount
 		return fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	if amount <= 0 {
-		return errors.New("burn amount must be a positive integer")
+	decimals, err := getDecimals(ctx)
+	if err != nil {
+		return err
 	}
 
-	currentBalanceBytes, err := ctx.GetStub().GetState(minter)
+	value, err := parseAmount(amount, decimals)
 	if err != nil {
-		return fmt.Errorf("failed to read minter account %s from world state: %v", minter, err)
+		return err
+	}
+	if value.Sign() <= 0 {
+		return errors.New("burn amount must be a positive number")
 	}
 
-	var currentBalance int
+	// Check that the contract is not paused and the minter account is not frozen
+	err = checkNotBlocked(ctx, minter)
+	if err != nil {
+		return err
+	}
+
+	currentBalance, err := getBalance(ctx, minter, decimals)
+	if err != nil {
+		return fmt.Errorf("failed to read minter account %s from world state: %v", minter, err)
+	}
 
 	// Check if minter current balance exists
-	if currentBalanceBytes == nil {
+	if currentBalance == nil {
 		return errors.New("The balance does not exist")
 	}
 
-	currentBalance, _ = strconv.Atoi(string(currentBalanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
-
-	updatedBalance, err := sub(currentBalance, amount)
+	updatedBalance, err := sub(currentBalance, value)
 	if err != nil {
 		return err
 	}
 
-	err = ctx.GetStub().PutState(minter, []byte(strconv.Itoa(updatedBalance)))
+	err = putBalance(ctx, minter, currentBalance, updatedBalance, decimals)
 	if err != nil {
 		return err
 	}
 
 	// Update the totalSupply
-	totalSupplyBytes, err := ctx.GetStub().GetState(totalSupplyKey)
+	totalSupply, err := getAmount(ctx, totalSupplyKey, decimals)
 	if err != nil {
 		return fmt.Errorf("failed to retrieve total token supply: %v", err)
 	}
 
 	// If no tokens have been minted, throw error
-	if totalSupplyBytes == nil {
+	if totalSupply == nil {
 		return errors.New("totalSupply does not exist")
 	}
 
-	totalSupply, _ := strconv.Atoi(string(totalSupplyBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
-
 	// Subtract the burn amount to the total supply and update the state
-	totalSupply, err = sub(totalSupply, amount)
+	updatedTotalSupply, err := sub(totalSupply, value)
 	if err != nil {
 		return err
 	}
 
-	err = ctx.GetStub().PutState(totalSupplyKey, []byte(strconv.Itoa(totalSupply)))
+	err = putBalance(ctx, totalSupplyKey, totalSupply, updatedTotalSupply, decimals)
 	if err != nil {
 		return err
 	}
 
 	// Emit the Transfer event
-	transferEvent := event{minter, "0x0", amount}
+	transferEvent := event{minter, "0x0", formatAmount(value, decimals)}
 	transferEventJSON, err := json.Marshal(transferEvent)
 	if err != nil {
 		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
@@ -221,15 +235,16 @@ func (s *SmartContract) Burn(ctx contractapi.TransactionContextInterface, amount
 		return fmt.Errorf("failed to set event: %v", err)
 	}
 
-	log.Printf("minter account %s balance updated from %d to %d", minter, currentBalance, updatedBalance)
+	log.Printf("minter account %s balance updated from %s to %s", minter, formatAmount(currentBalance, decimals), formatAmount(updatedBalance, decimals))
 
 	return nil
 }
 
 // Transfer transfers tokens from client account to recipient account
 // recipient account must be a valid clientID as returned by the ClientID() function
+// amount is a decimal string with up to decimals places
 // This function triggers a Transfer event
-func (s *SmartContract) Transfer(ctx contractapi.TransactionContextInterface, recipient string, amount int) error {
+func (s *SmartContract) Transfer(ctx contractapi.TransactionContextInterface, recipient string, amount string) error {
 
 	//check if contract has been intilized first
 	initialized, err := checkInitialized(ctx)
@@ -246,13 +261,23 @@ func (s *SmartContract) Transfer(ctx contractapi.TransactionContextInterface, re
 		return fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	err = transferHelper(ctx, clientID, recipient, amount)
+	decimals, err := getDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	value, err := parseAmount(amount, decimals)
+	if err != nil {
+		return err
+	}
+
+	err = transferHelper(ctx, clientID, recipient, value)
 	if err != nil {
 		return fmt.Errorf("failed to transfer: %v", err)
 	}
 
 	// Emit the Transfer event
-	transferEvent := event{clientID, recipient, amount}
+	transferEvent := event{clientID, recipient, formatAmount(value, decimals)}
 	transferEventJSON, err := json.Marshal(transferEvent)
 	if err != nil {
 		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
@@ -265,60 +290,66 @@ func (s *SmartContract) Transfer(ctx contractapi.TransactionContextInterface, re
 	return nil
 }
 
-// BalanceOf returns the balance of the given account
-func (s *SmartContract) BalanceOf(ctx contractapi.TransactionContextInterface, account string) (int, error) {
+// BalanceOf returns the balance of the given account as a decimal string
+func (s *SmartContract) BalanceOf(ctx contractapi.TransactionContextInterface, account string) (string, error) {
 
 	//check if contract has been intilized first
 	initialized, err := checkInitialized(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+		return "", fmt.Errorf("failed to check if contract ia already initialized: %v", err)
 	}
 	if !initialized {
-		return 0, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
 	}
 
-	balanceBytes, err := ctx.GetStub().GetState(account)
+	decimals, err := getDecimals(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to read from world state: %v", err)
-	}
-	if balanceBytes == nil {
-		return 0, fmt.Errorf("the account %s does not exist", account)
+		return "", err
 	}
 
-	balance, _ := strconv.Atoi(string(balanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
+	balance, err := getBalance(ctx, account, decimals)
+	if err != nil {
+		return "", fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if balance == nil {
+		return "", fmt.Errorf("the account %s does not exist", account)
+	}
 
-	return balance, nil
+	return formatAmount(balance, decimals), nil
 }
 
-// ClientAccountBalance returns the balance of the requesting client's account
-func (s *SmartContract) ClientAccountBalance(ctx contractapi.TransactionContextInterface) (int, error) {
+// ClientAccountBalance returns the balance of the requesting client's account as a decimal string
+func (s *SmartContract) ClientAccountBalance(ctx contractapi.TransactionContextInterface) (string, error) {
 
 	//check if contract has been intilized first
 	initialized, err := checkInitialized(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+		return "", fmt.Errorf("failed to check if contract ia already initialized: %v", err)
 	}
 	if !initialized {
-		return 0, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
 	}
 
 	// Get ID of submitting client identity
 	clientID, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
-		return 0, fmt.Errorf("failed to get client id: %v", err)
+		return "", fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	balanceBytes, err := ctx.GetStub().GetState(clientID)
+	decimals, err := getDecimals(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to read from world state: %v", err)
-	}
-	if balanceBytes == nil {
-		return 0, fmt.Errorf("the account %s does not exist", clientID)
+		return "", err
 	}
 
-	balance, _ := strconv.Atoi(string(balanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
+	balance, err := getBalance(ctx, clientID, decimals)
+	if err != nil {
+		return "", fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if balance == nil {
+		return "", fmt.Errorf("the account %s does not exist", clientID)
+	}
 
-	return balance, nil
+	return formatAmount(balance, decimals), nil
 }
 
 // ClientAccountID returns the id of the requesting client's account
@@ -344,42 +375,44 @@ func (s *SmartContract) ClientAccountID(ctx contractapi.TransactionContextInterf
 	return clientAccountID, nil
 }
 
-// TotalSupply returns the total token supply
-func (s *SmartContract) TotalSupply(ctx contractapi.TransactionContextInterface) (int, error) {
+// TotalSupply returns the total token supply as a decimal string
+func (s *SmartContract) TotalSupply(ctx contractapi.TransactionContextInterface) (string, error) {
 
 	//check if contract has been intilized first
 	initialized, err := checkInitialized(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+		return "", fmt.Errorf("failed to check if contract ia already initialized: %v", err)
 	}
 	if !initialized {
-		return 0, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
 	}
 
-	// Retrieve total supply of tokens from state of smart contract
-	totalSupplyBytes, err := ctx.GetStub().GetState(totalSupplyKey)
+	decimals, err := getDecimals(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to retrieve total token supply: %v", err)
+		return "", err
 	}
 
-	var totalSupply int
+	// Retrieve total supply of tokens from state of smart contract
+	totalSupply, err := getAmount(ctx, totalSupplyKey, decimals)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve total token supply: %v", err)
+	}
 
 	// If no tokens have been minted, return 0
-	if totalSupplyBytes == nil {
-		totalSupply = 0
-	} else {
-		totalSupply, _ = strconv.Atoi(string(totalSupplyBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
+	if totalSupply == nil {
+		totalSupply = new(big.Int)
 	}
 
-	log.Printf("TotalSupply: %d tokens", totalSupply)
+	log.Printf("TotalSupply: %s tokens", formatAmount(totalSupply, decimals))
 
-	return totalSupply, nil
+	return formatAmount(totalSupply, decimals), nil
 }
 
 // Approve allows the spender to withdraw from the calling client's token account
 // The spender can withdraw multiple times if necessary, up to the value amount
+// value is a decimal string with up to decimals places
 // This function triggers an Approval event
-func (s *SmartContract) Approve(ctx contractapi.TransactionContextInterface, spender string, value int) error {
+func (s *SmartContract) Approve(ctx contractapi.TransactionContextInterface, spender string, value string) error {
 
 	//check if contract has been intilized first
 	initialized, err := checkInitialized(ctx)
@@ -402,14 +435,24 @@ func (s *SmartContract) Approve(ctx contractapi.TransactionContextInterface, spe
 		return fmt.Errorf("failed to create the composite key for prefix %s: %v", allowancePrefix, err)
 	}
 
+	decimals, err := getDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	allowance, err := parseAmount(value, decimals)
+	if err != nil {
+		return err
+	}
+
 	// Update the state of the smart contract by adding the allowanceKey and value
-	err = ctx.GetStub().PutState(allowanceKey, []byte(strconv.Itoa(value)))
+	err = putAmount(ctx, allowanceKey, allowance, decimals)
 	if err != nil {
-		return fmt.Errorf("failed to update state of smart contract for key %s: %v", allowanceKey, err)
+		return err
 	}
 
 	// Emit the Approval event
-	approvalEvent := event{owner, spender, value}
+	approvalEvent := event{owner, spender, formatAmount(allowance, decimals)}
 	approvalEventJSON, err := json.Marshal(approvalEvent)
 	if err != nil {
 		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
@@ -419,52 +462,54 @@ func (s *SmartContract) Approve(ctx contractapi.TransactionContextInterface, spe
 		return fmt.Errorf("failed to set event: %v", err)
 	}
 
-	log.Printf("client %s approved a withdrawal allowance of %d for spender %s", owner, value, spender)
+	log.Printf("client %s approved a withdrawal allowance of %s for spender %s", owner, formatAmount(allowance, decimals), spender)
 
 	return nil
 }
 
-// Allowance returns the amount still available for the spender to withdraw from the owner
-func (s *SmartContract) Allowance(ctx contractapi.TransactionContextInterface, owner string, spender string) (int, error) {
+// Allowance returns the amount still available for the spender to withdraw from the owner as a decimal string
+func (s *SmartContract) Allowance(ctx contractapi.TransactionContextInterface, owner string, spender string) (string, error) {
 
 	//check if contract has been intilized first
 	initialized, err := checkInitialized(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+		return "", fmt.Errorf("failed to check if contract ia already initialized: %v", err)
 	}
 	if !initialized {
-		return 0, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
 	}
 
 	// Create allowanceKey
 	allowanceKey, err := ctx.GetStub().CreateCompositeKey(allowancePrefix, []string{owner, spender})
 	if err != nil {
-		return 0, fmt.Errorf("failed to create the composite key for prefix %s: %v", allowancePrefix, err)
+		return "", fmt.Errorf("failed to create the composite key for prefix %s: %v", allowancePrefix, err)
 	}
 
-	// Read the allowance amount from the world state
-	allowanceBytes, err := ctx.GetStub().GetState(allowanceKey)
+	decimals, err := getDecimals(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to read allowance for %s from world state: %v", allowanceKey, err)
+		return "", err
 	}
 
-	var allowance int
+	// Read the allowance amount from the world state
+	allowance, err := getAmount(ctx, allowanceKey, decimals)
+	if err != nil {
+		return "", fmt.Errorf("failed to read allowance for %s from world state: %v", allowanceKey, err)
+	}
 
 	// If no current allowance, set allowance to 0
-	if allowanceBytes == nil {
-		allowance = 0
-	} else {
-		allowance, err = strconv.Atoi(string(allowanceBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
+	if allowance == nil {
+		allowance = new(big.Int)
 	}
 
-	log.Printf("The allowance left for spender %s to withdraw from owner %s: %d", spender, owner, allowance)
+	log.Printf("The allowance left for spender %s to withdraw from owner %s: %s", spender, owner, formatAmount(allowance, decimals))
 
-	return allowance, nil
+	return formatAmount(allowance, decimals), nil
 }
 
 // TransferFrom transfers the value amount from the "from" address to the "to" address
+// value is a decimal string with up to decimals places
 // This function triggers a Transfer event
-func (s *SmartContract) TransferFrom(ctx contractapi.TransactionContextInterface, from string, to string, value int) error {
+func (s *SmartContract) TransferFrom(ctx contractapi.TransactionContextInterface, from string, to string, value string) error {
 
 	//check if contract has been intilized first
 	initialized, err := checkInitialized(ctx)
@@ -487,39 +532,55 @@ func (s *SmartContract) TransferFrom(ctx contractapi.TransactionContextInterface
 		return fmt.Errorf("failed to create the composite key for prefix %s: %v", allowancePrefix, err)
 	}
 
+	decimals, err := getDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	amount, err := parseAmount(value, decimals)
+	if err != nil {
+		return err
+	}
+
 	// Retrieve the allowance of the spender
-	currentAllowanceBytes, err := ctx.GetStub().GetState(allowanceKey)
+	currentAllowance, err := getAmount(ctx, allowanceKey, decimals)
 	if err != nil {
 		return fmt.Errorf("failed to retrieve the allowance for %s from world state: %v", allowanceKey, err)
 	}
-
-	var currentAllowance int
-	currentAllowance, _ = strconv.Atoi(string(currentAllowanceBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
+	if currentAllowance == nil {
+		currentAllowance = new(big.Int)
+	}
 
 	// Check if transferred value is less than allowance
-	if currentAllowance < value {
+	if currentAllowance.Cmp(amount) < 0 {
 		return fmt.Errorf("spender does not have enough allowance for transfer")
 	}
 
+	// A frozen spender can't move tokens on behalf of others, the "from" and "to" accounts are checked by transferHelper
+	err = checkNotBlocked(ctx, spender)
+	if err != nil {
+		return fmt.Errorf("failed to transfer: %v", err)
+	}
+
 	// Initiate the transfer
-	err = transferHelper(ctx, from, to, value)
+	err = transferHelper(ctx, from, to, amount)
 	if err != nil {
 		return fmt.Errorf("failed to transfer: %v", err)
 	}
 
 	// Decrease the allowance
-	updatedAllowance, err := sub(currentAllowance, value)
+	updatedAllowance, err := sub(currentAllowance, amount)
 	if err != nil {
 		return err
 	}
 
-	err = ctx.GetStub().PutState(allowanceKey, []byte(strconv.Itoa(updatedAllowance)))
+	err = putAmount(ctx, allowanceKey, updatedAllowance, decimals)
 	if err != nil {
 		return err
 	}
 
 	// Emit the Transfer event
-	transferEvent := event{from, to, value}
+	transferEvent := event{from, to, formatAmount(amount, decimals)}
 	transferEventJSON, err := json.Marshal(transferEvent)
 	if err != nil {
 		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
@@ -529,7 +590,110 @@ func (s *SmartContract) TransferFrom(ctx contractapi.TransactionContextInterface
 		return fmt.Errorf("failed to set event: %v", err)
 	}
 
-	log.Printf("spender %s allowance updated from %d to %d", spender, currentAllowance, updatedAllowance)
+	log.Printf("spender %s allowance updated from %s to %s", spender, formatAmount(currentAllowance, decimals), formatAmount(updatedAllowance, decimals))
+
+	return nil
+}
+
+// BatchTransferFrom transfers the value amounts from each of the "from" addresses to the "to" address
+// using the allowances the "from" addresses approved for the calling client
+// The recipient is credited once with the sum, so several payments to the same account can be collected in one
+// transaction, e.g. by a chaincode invoking it for the winners of an auction
+// values are decimal strings with up to decimals places, the "from" addresses must be distinct
+// This function triggers a BatchTransfer event with the list of transfers
+func (s *SmartContract) BatchTransferFrom(ctx contractapi.TransactionContextInterface, from []string, to string, values []string) error {
+
+	//check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	if len(from) != len(values) {
+		return fmt.Errorf("the number of values must match the number of from addresses")
+	}
+
+	// Get ID of submitting client identity
+	spender, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	decimals, err := getDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	allowanceKeys := make([]string, len(from))
+	amounts := make([]*big.Int, len(from))
+	updatedAllowances := make([]*big.Int, len(from))
+	for i := range from {
+		allowanceKeys[i], err = ctx.GetStub().CreateCompositeKey(allowancePrefix, []string{from[i], spender})
+		if err != nil {
+			return fmt.Errorf("failed to create the composite key for prefix %s: %v", allowancePrefix, err)
+		}
+
+		amounts[i], err = parseAmount(values[i], decimals)
+		if err != nil {
+			return err
+		}
+
+		// Retrieve the allowance of the spender
+		currentAllowance, err := getAmount(ctx, allowanceKeys[i], decimals)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve the allowance for %s from world state: %v", allowanceKeys[i], err)
+		}
+		if currentAllowance == nil {
+			currentAllowance = new(big.Int)
+		}
+
+		// Check if transferred value is less than allowance
+		if currentAllowance.Cmp(amounts[i]) < 0 {
+			return fmt.Errorf("spender does not have enough allowance for transfer from %s", from[i])
+		}
+
+		updatedAllowances[i], err = sub(currentAllowance, amounts[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	// A frozen spender can't move tokens on behalf of others, the "from" and "to" accounts are checked by transferManyHelper
+	err = checkNotBlocked(ctx, spender)
+	if err != nil {
+		return fmt.Errorf("failed to transfer: %v", err)
+	}
+
+	// Initiate the transfers
+	err = transferManyHelper(ctx, from, to, amounts)
+	if err != nil {
+		return fmt.Errorf("failed to transfer: %v", err)
+	}
+
+	// Decrease the allowances
+	transferEvents := make([]event, len(from))
+	for i := range from {
+		err = putAmount(ctx, allowanceKeys[i], updatedAllowances[i], decimals)
+		if err != nil {
+			return err
+		}
+		transferEvents[i] = event{from[i], to, formatAmount(amounts[i], decimals)}
+	}
+
+	// Emit the BatchTransfer event
+	transferEventsJSON, err := json.Marshal(transferEvents)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent("BatchTransfer", transferEventsJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	log.Printf("spender %s transferred from %d accounts to %s", spender, len(from), to)
 
 	return nil
 }
@@ -581,16 +745,41 @@ func (s *SmartContract) Symbol(ctx contractapi.TransactionContextInterface) (str
 // Set information for a token and intialize contract.
 // param {String} name The name of the token
 // param {String} symbol The symbol of the token
-// param {String} decimals The decimals used for the token operations
-func (s *SmartContract) Initialize(ctx contractapi.TransactionContextInterface, name string, symbol string, decimals string) (bool, error) {
+// param {String} decimals The number of decimal places of token amounts, an integer between 0 and 77
+// param {String} minter The organization with privilege to mint and burn tokens
+// param {String} admin The organization with privilege to pause the contract and freeze accounts
+// param {[]String} banks The organizations issuing tokens for anonymous payments
+// param {[]String} governance The organizations that must all endorse any later change of the roles
+// Initialize must be invoked as the init transaction (--isInit) of a chaincode definition approved with --init-required:
+// no other function can be invoked before it and the peer accepts it only once, so nobody can take the roles first
+func (s *SmartContract) Initialize(ctx contractapi.TransactionContextInterface, name string, symbol string, decimals string, minter string, admin string, banks []string, governance []string) (bool, error) {
+
+	if _, err := checkDecimals(decimals); err != nil {
+		return false, err
+	}
+	if minter == "" {
+		return false, fmt.Errorf("minter must not be empty")
+	}
+	if admin == "" {
+		return false, fmt.Errorf("admin must not be empty")
+	}
+	if len(governance) == 0 {
+		return false, fmt.Errorf("at least one governance organization is required")
+	}
 
-	// Check minter authorization - this sample assumes Org1 is the central banker with privilege to intitialize contract
+	// Check initializer authorization - the channel members agreed on who initializes the contract when they approved the definition
+	err := checkInitTransaction(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	// The submitter of the init transaction chooses all roles, so it must be one of the governance organizations it names
 	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
 	if err != nil {
 		return false, fmt.Errorf("failed to get MSPID: %v", err)
 	}
-	if clientMSPID != "Org1MSP" {
-		return false, fmt.Errorf("client is not authorized to initialize contract")
+	if !contains(governance, clientMSPID) {
+		return false, fmt.Errorf("client is not authorized to initialize contract, %s is not a governance organization", clientMSPID)
 	}
 
 	//check contract options are not already set, client is not authorized to change them once intitialized
@@ -617,86 +806,149 @@ func (s *SmartContract) Initialize(ctx contractapi.TransactionContextInterface,
 		return false, fmt.Errorf("failed to set token name: %v", err)
 	}
 
+	if banks == nil {
+		banks = []string{}
+	}
+	err = putRoles(ctx, &Roles{Minter: minter, Admin: admin, Banks: banks, Governance: governance})
+	if err != nil {
+		return false, err
+	}
+
+	err = setRolesEndorsement(ctx, governance)
+	if err != nil {
+		return false, err
+	}
+
 	return true, nil
 }
 
 // Helper Functions
 
 // transferHelper is a helper function that transfers tokens from the "from" address to the "to" address
+// value is given in the smallest units (see parseAmount)
 // Dependant functions include Transfer and TransferFrom
-func transferHelper(ctx contractapi.TransactionContextInterface, from string, to string, value int) error {
+func transferHelper(ctx contractapi.TransactionContextInterface, from string, to string, value *big.Int) error {
+	return transferManyHelper(ctx, []string{from}, to, []*big.Int{value})
+}
 
-	if from == to {
-		return fmt.Errorf("cannot transfer to and from same client account")
-	}
+// transferManyHelper is a helper function that transfers tokens from each of the "from" addresses to the "to" address
+// values are given in the smallest units (see parseAmount), the recipient is credited once with their sum
+// All checks are done before the first write, so a failed transfer leaves no writes behind
+// Dependant functions include transferHelper and BatchTransferFrom
+func transferManyHelper(ctx contractapi.TransactionContextInterface, froms []string, to string, values []*big.Int) error {
 
-	if value < 0 { // transfer of 0 is allowed in ERC-20, so just validate against negative amounts
-		return fmt.Errorf("transfer amount cannot be negative")
+	total := new(big.Int)
+	for i, from := range froms {
+		if from == to {
+			return fmt.Errorf("cannot transfer to and from same client account")
+		}
+
+		// a balance is read once per transaction, so every account can only be debited once
+		if contains(froms[:i], from) {
+			return fmt.Errorf("cannot transfer from client account %s twice", from)
+		}
+
+		if values[i].Sign() < 0 { // transfer of 0 is allowed in ERC-20, so just validate against negative amounts
+			return fmt.Errorf("transfer amount cannot be negative")
+		}
+		total.Add(total, values[i])
 	}
 
-	fromCurrentBalanceBytes, err := ctx.GetStub().GetState(from)
+	// Check that the contract is not paused and no account is frozen
+	err := checkNotBlocked(ctx, append(append([]string{}, froms...), to)...)
 	if err != nil {
-		return fmt.Errorf("failed to read client account %s from world state: %v", from, err)
+		return err
 	}
 
-	if fromCurrentBalanceBytes == nil {
-		return fmt.Errorf("client account %s has no balance", from)
+	decimals, err := getDecimals(ctx)
+	if err != nil {
+		return err
 	}
 
-	fromCurrentBalance, _ := strconv.Atoi(string(fromCurrentBalanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
+	fromCurrentBalances := make([]*big.Int, len(froms))
+	fromUpdatedBalances := make([]*big.Int, len(froms))
+	for i, from := range froms {
+		fromCurrentBalances[i], err = getBalance(ctx, from, decimals)
+		if err != nil {
+			return fmt.Errorf("failed to read client account %s from world state: %v", from, err)
+		}
 
-	if fromCurrentBalance < value {
-		return fmt.Errorf("client account %s has insufficient funds", from)
-	}
+		if fromCurrentBalances[i] == nil {
+			return fmt.Errorf("client account %s has no balance", from)
+		}
 
-	toCurrentBalanceBytes, err := ctx.GetStub().GetState(to)
-	if err != nil {
-		return fmt.Errorf("failed to read recipient account %s from world state: %v", to, err)
-	}
+		if fromCurrentBalances[i].Cmp(values[i]) < 0 {
+			return fmt.Errorf("client account %s has insufficient funds", from)
+		}
 
-	var toCurrentBalance int
-	// If recipient current balance doesn't yet exist, we'll create it with a current balance of 0
-	if toCurrentBalanceBytes == nil {
-		toCurrentBalance = 0
-	} else {
-		toCurrentBalance, _ = strconv.Atoi(string(toCurrentBalanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
+		fromUpdatedBalances[i], err = sub(fromCurrentBalances[i], values[i])
+		if err != nil {
+			return err
+		}
 	}
 
-	fromUpdatedBalance, err := sub(fromCurrentBalance, value)
+	// Credits of accounts in delta balance mode are appended without reading the recipient balance
+	toDelta, err := isDeltaBalance(ctx, to)
 	if err != nil {
 		return err
 	}
 
-	toUpdatedBalance, err := add(toCurrentBalance, value)
-	if err != nil {
-		return err
+	var toCurrentBalance, toUpdatedBalance *big.Int
+	if !toDelta {
+		toCurrentBalance, err = getAmount(ctx, to, decimals)
+		if err != nil {
+			return fmt.Errorf("failed to read recipient account %s from world state: %v", to, err)
+		}
+
+		// If recipient current balance doesn't yet exist, we'll create it with a current balance of 0
+		if toCurrentBalance == nil {
+			toCurrentBalance = new(big.Int)
+		}
+
+		toUpdatedBalance, err = add(toCurrentBalance, total)
+		if err != nil {
+			return err
+		}
 	}
 
-	err = ctx.GetStub().PutState(from, []byte(strconv.Itoa(fromUpdatedBalance)))
-	if err != nil {
-		return err
+	for i, from := range froms {
+		err = putBalance(ctx, from, fromCurrentBalances[i], fromUpdatedBalances[i], decimals)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("client %s balance updated from %s to %s", from, formatAmount(fromCurrentBalances[i], decimals), formatAmount(fromUpdatedBalances[i], decimals))
+	}
+
+	if toDelta {
+		err = creditDelta(ctx, to, total, decimals)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("recipient %s credited with %s", to, formatAmount(total, decimals))
+
+		return nil
 	}
 
-	err = ctx.GetStub().PutState(to, []byte(strconv.Itoa(toUpdatedBalance)))
+	err = putBalance(ctx, to, toCurrentBalance, toUpdatedBalance, decimals)
 	if err != nil {
 		return err
 	}
 
-	log.Printf("client %s balance updated from %d to %d", from, fromCurrentBalance, fromUpdatedBalance)
-	log.Printf("recipient %s balance updated from %d to %d", to, toCurrentBalance, toUpdatedBalance)
+	log.Printf("recipient %s balance updated from %s to %s", to, formatAmount(toCurrentBalance, decimals), formatAmount(toUpdatedBalance, decimals))
 
 	return nil
 }
 
 // add two number checking for overflow
-func add(b int, q int) (int, error) {
+func add(b *big.Int, q *big.Int) (*big.Int, error) {
 
-	// Check overflow
-	var sum int
-	sum = q + b
+	// Check overflow - the sum must not exceed maxAmount
+	sum := new(big.Int).Add(b, q)
 
-	if (sum < q) == (b >= 0 && q >= 0) {
-		return 0, fmt.Errorf("Math: addition overflow occurred %d + %d", b, q)
+	if sum.Cmp(maxAmount) > 0 {
+		return nil, fmt.Errorf("Math: addition overflow occurred %s + %s", b, q)
 	}
 
 	return sum, nil
@@ -716,15 +968,47 @@ func checkInitialized(ctx contractapi.TransactionContextInterface) (bool, error)
 	return true, nil
 }
 
+// checkInitTransaction checks that the transaction is the init transaction of the chaincode definition
+func checkInitTransaction(ctx contractapi.TransactionContextInterface) error {
+	signedProposal, err := ctx.GetStub().GetSignedProposal()
+	if err != nil {
+		return fmt.Errorf("failed to get the signed proposal: %v", err)
+	}
+	if signedProposal == nil {
+		return fmt.Errorf("the signed proposal is missing")
+	}
+
+	proposal := &peer.Proposal{}
+	err = proto.Unmarshal(signedProposal.ProposalBytes, proposal)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal the proposal: %v", err)
+	}
+	payload := &peer.ChaincodeProposalPayload{}
+	err = proto.Unmarshal(proposal.Payload, payload)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal the proposal payload: %v", err)
+	}
+	invocation := &peer.ChaincodeInvocationSpec{}
+	err = proto.Unmarshal(payload.Input, invocation)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal the chaincode invocation: %v", err)
+	}
+
+	if !invocation.GetChaincodeSpec().GetInput().GetIsInit() {
+		return fmt.Errorf("Initialize must be invoked as the init transaction of a chaincode definition with --init-required")
+	}
+
+	return nil
+}
+
 // sub two number checking for overflow
-func sub(b int, q int) (int, error) {
+func sub(b *big.Int, q *big.Int) (*big.Int, error) {
 
-	// Check overflow
-	var diff int
-	diff = b - q
+	// Check underflow - the difference must not be negative
+	diff := new(big.Int).Sub(b, q)
 
-	if (diff > b) == (b >= 0 && q >= 0) {
-		return 0, fmt.Errorf("Math: Subtraction overflow occurred  %d - %d", b, q)
+	if diff.Sign() < 0 {
+		return nil, fmt.Errorf("Math: Subtraction overflow occurred  %s - %s", b, q)
 	}
 
 	return diff, nil
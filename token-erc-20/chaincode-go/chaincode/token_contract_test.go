@@ -0,0 +1,121 @@
+package chaincode
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-samples/token-erc-20/chaincode-go/chaincode/tests/testsfakes"
+	"github.com/stretchr/testify/assert"
+)
+
+// Balances and allowances (approved for SELLER) before each batch transfer
+var _BatchTransferFrom = []struct {
+	name               string
+	from               []string
+	values             []string
+	expectedError      string
+	expectedBalances   map[string]string
+	expectedAllowances map[string]string
+}{
+	{
+		name:               "OK",
+		from:               []string{"BUYER1", "BUYER2"},
+		values:             []string{"30", "20.5"},
+		expectedBalances:   map[string]string{"BUYER1": "70.00", "BUYER2": "29.50", "SELLER": "60.50"},
+		expectedAllowances: map[string]string{"BUYER1": "70.00", "BUYER2": "29.50"},
+	},
+	{
+		name:          "Values don't match",
+		from:          []string{"BUYER1", "BUYER2"},
+		values:        []string{"30"},
+		expectedError: "the number of values must match the number of from addresses",
+	},
+	{
+		name:          "Insufficient allowance",
+		from:          []string{"BUYER1", "BUYER2"},
+		values:        []string{"30", "60"},
+		expectedError: "spender does not have enough allowance for transfer from BUYER2",
+	},
+	{
+		name:          "Insufficient funds",
+		from:          []string{"BUYER1", "POOR"},
+		values:        []string{"30", "20"},
+		expectedError: "failed to transfer: client account POOR has insufficient funds",
+	},
+	{
+		name:          "Same account twice",
+		from:          []string{"BUYER1", "BUYER1"},
+		values:        []string{"30", "20"},
+		expectedError: "failed to transfer: cannot transfer from client account BUYER1 twice",
+	},
+}
+
+func TestBatchTransferFrom(t *testing.T) {
+
+	//Prepare fixed data
+	sc := SmartContract{}
+	stub := &testsfakes.FakeTestChaincodeStubInterface{}
+	tc := &testsfakes.FakeTestTransactionContextInterface{}
+	tc.GetStubStub = func() shim.ChaincodeStubInterface {
+		return stub
+	}
+	identity := &testsfakes.FakeTestClientIdentity{}
+	identity.GetIDReturns("SELLER", nil)
+	tc.GetClientIdentityReturns(identity)
+	stub.GetTxIDReturns("TX1")
+
+	for _, tt := range _BatchTransferFrom {
+		t.Run(tt.name, func(t *testing.T) {
+
+			//Prepare dynamic data
+			state := map[string][]byte{
+				nameKey:     []byte("name"),
+				decimalsKey: []byte("2"),
+				"BUYER1":    []byte("100.00"),
+				"BUYER2":    []byte("50.00"),
+				"POOR":      []byte("10.00"),
+				"SELLER":    []byte("10.00"),
+			}
+			withWorldState(stub, state)
+			allowanceKey := func(owner string) string {
+				key, _ := stub.CreateCompositeKey(allowancePrefix, []string{owner, "SELLER"})
+				return key
+			}
+			for _, owner := range []string{"BUYER1", "BUYER2", "POOR"} {
+				state[allowanceKey(owner)] = []byte("50.00")
+			}
+			state[allowanceKey("BUYER1")] = []byte("100.00")
+			before := map[string]string{}
+			for key, value := range state {
+				before[key] = string(value)
+			}
+			var transferEvent string
+			stub.SetEventStub = func(name string, payload []byte) error {
+				assert.Equal(t, "BatchTransfer", name)
+				transferEvent = string(payload)
+				return nil
+			}
+
+			err := sc.BatchTransferFrom(tc, tt.from, "SELLER", tt.values)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+
+				//a failed transfer leaves no writes behind
+				after := map[string]string{}
+				for key, value := range state {
+					after[key] = string(value)
+				}
+				assert.Equal(t, before, after)
+			} else {
+				assert.NoError(t, err)
+				for account, balance := range tt.expectedBalances {
+					assert.Equal(t, balance, string(state[account]), account)
+				}
+				for owner, allowance := range tt.expectedAllowances {
+					assert.Equal(t, allowance, string(state[allowanceKey(owner)]), owner)
+				}
+				assert.JSONEq(t, `[{"from":"BUYER1","to":"SELLER","value":"30.00"},{"from":"BUYER2","to":"SELLER","value":"20.50"}]`, transferEvent)
+			}
+		})
+	}
+}
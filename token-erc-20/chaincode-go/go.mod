@@ -3,7 +3,8 @@ module github.com/hyperledger/fabric-samples/token-erc-20/chaincode-go
 go 1.14
 
 require (
-	github.com/cryptoballot/rsablind v0.0.0-20170925165423-14f9913880b7 // indirect
+	github.com/cryptoballot/rsablind v0.0.0-20170925165423-14f9913880b7
+	github.com/golang/protobuf v1.5.2
 	github.com/hyperledger/fabric-chaincode-go v0.0.0-20200424173110-d7076418f212
 	github.com/hyperledger/fabric-contract-api-go v1.1.0
 	github.com/hyperledger/fabric-protos-go v0.0.0-20200424173316-dd554ba3746e